@@ -14,6 +14,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -30,7 +31,12 @@ var (
 	BuildTime = "unknown"
 )
 
-const protocolVersion = "1.0"
+// Socket protocol versions. Requests are sent as 1.1 and resent as 1.0 to
+// a daemon that predates 1.1.
+const (
+	protocolVersion       = "1.1"
+	legacyProtocolVersion = "1.0"
+)
 
 func main() {
 	if len(os.Args) < 2 {
@@ -51,6 +57,20 @@ func main() {
 		err = runPush(args)
 	case "status":
 		err = runStatus(args)
+	case "queue":
+		err = runQueue(args)
+	case "import":
+		err = runImport(args)
+	case "index":
+		err = runIndex(args)
+	case "cleanup":
+		err = runCleanup(args)
+	case "star", "unstar":
+		err = runStar(args, cmd == "star")
+	case "encrypt-existing":
+		err = runEncryptExisting(args)
+	case "fsck":
+		err = runFsck(args)
 	case "ui":
 		err = runUI(args)
 	case "config":
@@ -79,6 +99,13 @@ func printUsage() {
 	fmt.Println("  tabs-cli install")
 	fmt.Println("  tabs-cli push --session-id <id> --tool <tool> [--tag key:value]")
 	fmt.Println("  tabs-cli status")
+	fmt.Println("  tabs-cli queue")
+	fmt.Println("  tabs-cli import [--since YYYY-MM-DD] [--cwd path] [--dry-run]")
+	fmt.Println("  tabs-cli index rebuild")
+	fmt.Println("  tabs-cli cleanup [--dry-run]")
+	fmt.Println("  tabs-cli star|unstar --session-id <id> [--tool claude-code]")
+	fmt.Println("  tabs-cli encrypt-existing [--passphrase-env VAR]")
+	fmt.Println("  tabs-cli fsck")
 	fmt.Println("  tabs-cli ui")
 	fmt.Println("  tabs-cli config --set key=value")
 	fmt.Println("\nCommands:")
@@ -86,6 +113,13 @@ func printUsage() {
 	fmt.Println("  install        Install Claude Code hook scripts")
 	fmt.Println("  push           Upload a session to remote server")
 	fmt.Println("  status         Show daemon status")
+	fmt.Println("  queue          Show the auto-push upload queue")
+	fmt.Println("  import         Backfill sessions from Claude Code transcripts")
+	fmt.Println("  index          Rebuild the local session index")
+	fmt.Println("  cleanup        Apply the local retention policy")
+	fmt.Println("  star           Keep a session regardless of retention (unstar to undo)")
+	fmt.Println("  encrypt-existing  Enable encryption at rest and encrypt stored sessions")
+	fmt.Println("  fsck           Check every session file for corrupt lines")
 	fmt.Println("  ui             Run local web UI API server")
 	fmt.Println("  config         Manage configuration")
 	fmt.Println("  version        Print version info")
@@ -118,7 +152,26 @@ type pushTag struct {
 	Value string `json:"value"`
 }
 
+// runCapture sends a hook event to the daemon. Cursor's before* hooks gate
+// the action on the hook's answer; tabs only observes, so they are allowed
+// on every path, and a failed capture is logged to stderr rather than
+// returned as an exit status Cursor could act on.
 func runCapture(args []string) error {
+	permission, err := captureEvent(args)
+	if !permission {
+		return err
+	}
+	fmt.Println(`{"permission":"allow"}`)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tabs-cli capture:", err)
+	}
+	return nil
+}
+
+// captureEvent reports whether the event is a Cursor permission hook as soon
+// as it knows. A Cursor event that cannot be read counts as one: allowing a
+// hook that expects no answer is harmless.
+func captureEvent(args []string) (bool, error) {
 	fs := flag.NewFlagSet("capture", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
@@ -129,16 +182,21 @@ func runCapture(args []string) error {
 
 	fs.StringVar(&sessionID, "session-id", "", "Session ID (UUID)")
 	fs.StringVar(&eventRaw, "event", "", "Event JSON string, '-' for stdin, or '@file' to read")
-	fs.StringVar(&tool, "tool", "claude-code", "Tool name: claude-code or cursor")
+	fs.StringVar(&tool, "tool", "claude-code", "Tool name: "+strings.Join(daemon.RegisteredTools(), ", "))
 	fs.StringVar(&timestamp, "timestamp", "", "ISO 8601 timestamp (default: now)")
 
 	if err := fs.Parse(args); err != nil {
-		return err
+		return cursorToolArg(args), err
 	}
 
 	eventObj, err := readEventObject(eventRaw)
 	if err != nil {
-		return err
+		return tool == "cursor", err
+	}
+	permission := false
+	if tool == "cursor" {
+		name, _ := eventObj["hook_event_name"].(string)
+		permission = cursorPermissionHooks[name]
 	}
 
 	if sessionID == "" {
@@ -150,24 +208,24 @@ func runCapture(args []string) error {
 			}
 		}
 		if sessionID == "" {
-			return errors.New("--session-id is required (or event.session_id / event.conversation_id)")
+			return permission, errors.New("--session-id is required (or event.session_id / event.conversation_id)")
 		}
 	}
 
 	if existing, ok := eventObj["session_id"]; ok {
 		existingStr, ok := existing.(string)
 		if !ok {
-			return errors.New("event.session_id must be a string")
+			return permission, errors.New("event.session_id must be a string")
 		}
 		if existingStr != sessionID {
-			return fmt.Errorf("event.session_id (%s) does not match --session-id", existingStr)
+			return permission, fmt.Errorf("event.session_id (%s) does not match --session-id", existingStr)
 		}
 	} else {
 		eventObj["session_id"] = sessionID
 	}
 	if tool == "cursor" {
 		if existing, ok := eventObj["conversation_id"].(string); ok && existing != "" && existing != sessionID {
-			return fmt.Errorf("event.conversation_id (%s) does not match --session-id", existing)
+			return permission, fmt.Errorf("event.conversation_id (%s) does not match --session-id", existing)
 		}
 	}
 
@@ -188,24 +246,37 @@ func runCapture(args []string) error {
 		Payload: payload,
 	})
 	if err != nil {
-		return err
+		return permission, err
 	}
 
 	if resp.Status != "ok" {
-		return formatResponseError(resp)
+		return permission, formatResponseError(resp)
+	}
+
+	if permission {
+		return true, nil
 	}
 
 	var data struct {
 		SessionID     string `json:"session_id"`
 		EventsWritten int    `json:"events_written"`
+		Queued        bool   `json:"queued"`
+		Suppressed    bool   `json:"suppressed"`
 	}
 	if err := json.Unmarshal(resp.Data, &data); err != nil {
 		fmt.Println(string(resp.Data))
-		return nil
+		return false, nil
 	}
 
-	fmt.Printf("Captured session %s (%d events)\n", data.SessionID, data.EventsWritten)
-	return nil
+	switch {
+	case data.Suppressed:
+		fmt.Printf("Session %s not captured (privacy rule)\n", data.SessionID)
+	case data.Queued:
+		fmt.Printf("Queued event for session %s\n", data.SessionID)
+	default:
+		fmt.Printf("Captured session %s (%d events)\n", data.SessionID, data.EventsWritten)
+	}
+	return false, nil
 }
 
 type tagFlags []string
@@ -228,7 +299,7 @@ func runPush(args []string) error {
 	var tags tagFlags
 
 	fs.StringVar(&sessionID, "session-id", "", "Session ID (UUID)")
-	fs.StringVar(&tool, "tool", "claude-code", "Tool name: claude-code or cursor")
+	fs.StringVar(&tool, "tool", "claude-code", "Tool name: "+strings.Join(daemon.RegisteredTools(), ", "))
 	fs.Var(&tags, "tag", "Tag key:value (repeatable)")
 
 	if err := fs.Parse(args); err != nil {
@@ -237,8 +308,8 @@ func runPush(args []string) error {
 	if sessionID == "" {
 		return errors.New("--session-id is required")
 	}
-	if tool != "claude-code" && tool != "cursor" {
-		return errors.New("--tool must be claude-code or cursor")
+	if !daemon.IsRegisteredTool(tool) {
+		return fmt.Errorf("--tool must be one of: %s", strings.Join(daemon.RegisteredTools(), ", "))
 	}
 
 	parsedTags, err := parsePushTags(tags)
@@ -397,7 +468,10 @@ func installClaudeSettings(command string) (string, error) {
 		hooks = make(map[string]interface{})
 	}
 
-	events := []string{"SessionStart", "UserPromptSubmit", "Stop"}
+	events := []string{
+		"SessionStart", "UserPromptSubmit", "PreToolUse", "PostToolUse", "Notification",
+		"PreCompact", "Stop", "SubagentStop", "SessionEnd",
+	}
 	for _, event := range events {
 		hooks[event] = ensureClaudeSettingsHook(hooks[event], command)
 	}
@@ -472,6 +546,27 @@ func hasCommand(group map[string]interface{}, command string) bool {
 	return false
 }
 
+// cursorToolArg reports whether the arguments select the cursor tool, for
+// when they cannot be parsed.
+func cursorToolArg(args []string) bool {
+	for i, arg := range args {
+		switch {
+		case arg == "--tool=cursor" || arg == "-tool=cursor":
+			return true
+		case (arg == "--tool" || arg == "-tool") && i+1 < len(args) && args[i+1] == "cursor":
+			return true
+		}
+	}
+	return false
+}
+
+// cursorPermissionHooks expect a permission decision on stdout.
+var cursorPermissionHooks = map[string]bool{
+	"beforeShellExecution": true,
+	"beforeMCPExecution":   true,
+	"beforeReadFile":       true,
+}
+
 type cursorHooks struct {
 	Version int                     `json:"version"`
 	Hooks   map[string][]cursorHook `json:"hooks"`
@@ -501,7 +596,10 @@ func installCursorHooks(command string) (string, error) {
 		cfg.Hooks = map[string][]cursorHook{}
 	}
 	cfg.Version = 1
-	events := []string{"beforeSubmitPrompt", "stop"}
+	events := []string{
+		"beforeSubmitPrompt", "beforeShellExecution", "beforeMCPExecution", "beforeReadFile",
+		"afterFileEdit", "stop",
+	}
 	for _, event := range events {
 		cfg.Hooks[event] = ensureCursorHook(cfg.Hooks[event], command)
 	}
@@ -549,14 +647,7 @@ func runStatus(args []string) error {
 		return formatResponseError(resp)
 	}
 
-	var data struct {
-		PID              int    `json:"pid"`
-		UptimeSeconds    int    `json:"uptime_seconds"`
-		SessionsCaptured int    `json:"sessions_captured"`
-		EventsProcessed  int    `json:"events_processed"`
-		CursorPolling    bool   `json:"cursor_polling"`
-		LastEventAt      string `json:"last_event_at"`
-	}
+	var data daemonStatus
 	if err := json.Unmarshal(resp.Data, &data); err != nil {
 		fmt.Println(string(resp.Data))
 		return nil
@@ -565,14 +656,478 @@ func runStatus(args []string) error {
 	fmt.Printf("Daemon running (pid %d)\n", data.PID)
 	fmt.Printf("Uptime: %ds\n", data.UptimeSeconds)
 	fmt.Printf("Sessions captured: %d\n", data.SessionsCaptured)
+	if data.SessionsSuppressed > 0 {
+		fmt.Printf("Sessions suppressed by privacy rules: %d\n", data.SessionsSuppressed)
+	}
 	fmt.Printf("Events processed: %d\n", data.EventsProcessed)
+	if q := data.CaptureQueue; q.Depth > 0 || q.Processed > 0 || q.Parked > 0 {
+		fmt.Printf("Capture queue: %d pending, %d failed, latency avg %.1fms max %.1fms\n", q.Depth, q.Failed, q.AvgLatencyMs, q.MaxLatencyMs)
+		if q.Parked > 0 {
+			fmt.Printf("Failed captures parked: %d (retried when the daemon restarts)\n", q.Parked)
+		}
+	}
 	fmt.Printf("Cursor polling: %t\n", data.CursorPolling)
 	if data.LastEventAt != "" {
 		fmt.Printf("Last event: %s\n", data.LastEventAt)
 	}
+	fmt.Printf("Auto-push: %t (%d queued)\n", data.AutoPush, len(data.UploadQueue))
+	if rec := data.Reconcile; rec != nil {
+		if rec.InProgress {
+			fmt.Printf("Startup catch-up: running (%d sessions scanned)\n", rec.SessionsScanned)
+		} else {
+			fmt.Printf("Startup catch-up: %d events recovered across %d sessions\n", rec.EventsRecovered, rec.SessionsRecovered)
+		}
+	}
 	return nil
 }
 
+type daemonStatus struct {
+	PID                int                      `json:"pid"`
+	UptimeSeconds      int                      `json:"uptime_seconds"`
+	SessionsCaptured   int                      `json:"sessions_captured"`
+	SessionsSuppressed int                      `json:"sessions_suppressed"`
+	EventsProcessed    int                      `json:"events_processed"`
+	CursorPolling      bool                     `json:"cursor_polling"`
+	LastEventAt        string                   `json:"last_event_at"`
+	AutoPush           bool                     `json:"auto_push"`
+	UploadQueue        []uploadQueueEntry       `json:"upload_queue"`
+	Reconcile          *daemon.ReconcileResult  `json:"reconcile"`
+	CaptureQueue       daemon.CaptureQueueStats `json:"capture_queue"`
+}
+
+type uploadQueueEntry struct {
+	SessionID     string `json:"session_id"`
+	Tool          string `json:"tool"`
+	Status        string `json:"status"`
+	EnqueuedAt    string `json:"enqueued_at"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	LastError     string `json:"last_error"`
+	LastErrorCode string `json:"last_error_code"`
+}
+
+func runQueue(args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("queue does not take arguments")
+	}
+
+	resp, err := sendSocketRequest(request{
+		Version: protocolVersion,
+		Type:    "daemon_status",
+		Payload: map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+
+	var data daemonStatus
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return err
+	}
+
+	if !data.AutoPush {
+		fmt.Println("Auto-push is disabled (tabs-cli config set remote.auto_push true)")
+	}
+	if len(data.UploadQueue) == 0 {
+		fmt.Println("Upload queue is empty")
+		return nil
+	}
+	for _, entry := range data.UploadQueue {
+		fmt.Printf("%s  %-11s  %-7s  attempts=%d", entry.SessionID, entry.Tool, entry.Status, entry.Attempts)
+		if entry.Status == "pending" && entry.NextAttemptAt != "" {
+			fmt.Printf("  next=%s", entry.NextAttemptAt)
+		}
+		if entry.LastError != "" {
+			fmt.Printf("  error=%s (%s)", entry.LastError, entry.LastErrorCode)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var since string
+	var cwd string
+	var projectsDir string
+	var dryRun bool
+
+	fs.StringVar(&since, "since", "", "Only import transcripts modified on/after this date (YYYY-MM-DD or RFC3339)")
+	fs.StringVar(&cwd, "cwd", "", "Only import sessions whose working directory is under this path")
+	fs.StringVar(&projectsDir, "projects-dir", "", "Claude Code projects directory (default: config or ~/.claude/projects)")
+	fs.BoolVar(&dryRun, "dry-run", false, "Report what would be imported without writing")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("import does not take positional arguments")
+	}
+
+	payload := map[string]interface{}{"dry_run": dryRun}
+	if since != "" {
+		ts, err := parseSince(since)
+		if err != nil {
+			return err
+		}
+		payload["since"] = ts.Format(time.RFC3339)
+	}
+	if cwd != "" {
+		abs, err := filepath.Abs(cfgpkg.ExpandHome(cwd))
+		if err != nil {
+			return err
+		}
+		payload["cwd"] = abs
+	}
+	if projectsDir != "" {
+		payload["projects_dir"] = cfgpkg.ExpandHome(projectsDir)
+	}
+
+	resp, err := sendSocketRequestTimeout(request{
+		Version: protocolVersion,
+		Type:    "import_sessions",
+		Payload: payload,
+	}, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+
+	var result daemon.ImportResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return err
+	}
+	for _, session := range result.Sessions {
+		if session.Skipped != "" {
+			continue
+		}
+		verb := "imported"
+		if result.DryRun {
+			verb = "would import"
+		}
+		fmt.Printf("%s %s (%d events) %s\n", verb, session.SessionID, session.Events, session.Cwd)
+	}
+	label := "Imported"
+	if result.DryRun {
+		label = "Would import"
+	}
+	fmt.Printf("%s %d of %d sessions from %s (%d events, %d skipped)\n",
+		label, result.SessionsImported, result.SessionsScanned, result.ProjectsDir, result.EventsWritten, result.SessionsSkipped)
+	return nil
+}
+
+func runIndex(args []string) error {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return errors.New("usage: tabs-cli index rebuild")
+	}
+
+	resp, err := sendSocketRequestTimeout(request{
+		Version: protocolVersion,
+		Type:    "rebuild_index",
+		Payload: map[string]interface{}{},
+	}, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+
+	var result daemon.RebuildResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d sessions from %d files", result.SessionsIndexed, result.FilesScanned)
+	if result.Errors > 0 {
+		fmt.Printf(" (%d unreadable)", result.Errors)
+	}
+	fmt.Println()
+	return nil
+}
+
+func runCleanup(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dryRun bool
+	fs.BoolVar(&dryRun, "dry-run", false, "List what would be deleted without deleting")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("cleanup does not take positional arguments")
+	}
+
+	resp, err := sendSocketRequestTimeout(request{
+		Version: protocolVersion,
+		Type:    "cleanup_sessions",
+		Payload: map[string]interface{}{"dry_run": dryRun},
+	}, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+
+	var result daemon.RetentionResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return err
+	}
+	verb := "deleted"
+	if result.DryRun {
+		verb = "would delete"
+	}
+	for _, session := range result.Deleted {
+		fmt.Printf("%s %s %-11s %8s  %-8s  last active %s  %s\n",
+			verb, session.SessionID, session.Tool, formatBytes(session.Bytes), session.Reason, session.LastActivity, session.Cwd)
+	}
+	for _, id := range result.OrphanCursors {
+		fmt.Printf("%s orphaned cursor state/%s.json\n", verb, id)
+	}
+	label := "Deleted"
+	if result.DryRun {
+		label = "Would delete"
+	}
+	fmt.Printf("%s %d of %d sessions (%s of %s) and %d orphaned cursor files\n",
+		label, len(result.Deleted), result.SessionsScanned, formatBytes(result.BytesFreed), formatBytes(result.BytesScanned), len(result.OrphanCursors))
+	if len(result.Kept) > 0 {
+		rules := make([]string, 0, len(result.Kept))
+		for rule, count := range result.Kept {
+			rules = append(rules, fmt.Sprintf("%s=%d", rule, count))
+		}
+		sort.Strings(rules)
+		fmt.Printf("Kept by keep rules: %s\n", strings.Join(rules, ", "))
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func runStar(args []string, starred bool) error {
+	fs := flag.NewFlagSet("star", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var sessionID string
+	var tool string
+	fs.StringVar(&sessionID, "session-id", "", "Session ID (UUID)")
+	fs.StringVar(&tool, "tool", "claude-code", "Tool name: "+strings.Join(daemon.RegisteredTools(), ", "))
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if sessionID == "" {
+		return errors.New("--session-id is required")
+	}
+	if !daemon.IsRegisteredTool(tool) {
+		return fmt.Errorf("--tool must be one of: %s", strings.Join(daemon.RegisteredTools(), ", "))
+	}
+
+	resp, err := sendSocketRequest(request{
+		Version: protocolVersion,
+		Type:    "star_session",
+		Payload: map[string]interface{}{
+			"session_id": sessionID,
+			"tool":       tool,
+			"starred":    starred,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+	if starred {
+		fmt.Printf("Starred %s; retention will keep it\n", sessionID)
+	} else {
+		fmt.Printf("Unstarred %s\n", sessionID)
+	}
+	return nil
+}
+
+func runEncryptExisting(args []string) error {
+	fs := flag.NewFlagSet("encrypt-existing", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var passphraseEnv string
+	fs.StringVar(&passphraseEnv, "passphrase-env", "", "Derive the key from the passphrase in this environment variable instead of a random keyfile")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("encrypt-existing does not take positional arguments")
+	}
+
+	cfgPath, err := cfgpkg.Path()
+	if err != nil {
+		return err
+	}
+	cfg, err := cfgpkg.Load(cfgPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		cfg = cfgpkg.Default()
+	}
+	baseDir, err := daemon.EnsureBaseDir()
+	if err != nil {
+		return err
+	}
+	changed := !cfg.Encryption.Enabled
+	if passphraseEnv != "" && passphraseEnv != cfg.Encryption.PassphraseEnv {
+		cfg.Encryption.PassphraseEnv = passphraseEnv
+		changed = true
+	}
+	created, err := daemon.CreateKeyFile(baseDir, cfg.Encryption)
+	if err != nil {
+		return err
+	}
+	keyPath := daemon.KeyFilePath(baseDir, cfg.Encryption)
+	if created {
+		fmt.Printf("Created key file %s\n", keyPath)
+		if cfg.Encryption.PassphraseEnv == "" {
+			fmt.Println("Back it up: sessions cannot be read without it.")
+		} else {
+			fmt.Printf("The daemon needs %s set in its environment to read and write sessions.\n", cfg.Encryption.PassphraseEnv)
+		}
+	}
+	// Check the key before turning encryption on, so a wrong passphrase
+	// cannot leave the daemon unable to write.
+	if err := daemon.ConfigureEncryption(baseDir, cfg.Encryption); err != nil {
+		return err
+	}
+	// The daemon loads the key from these settings in its own environment
+	// and encrypts with it before the config is saved, so a key only this
+	// shell can load never turns encryption on.
+	resp, err := sendSocketRequestTimeout(request{
+		Version: protocolVersion,
+		Type:    "encrypt_existing",
+		Payload: map[string]interface{}{
+			"encryption": map[string]interface{}{
+				"key_file":       cfg.Encryption.KeyFile,
+				"passphrase_env": cfg.Encryption.PassphraseEnv,
+			},
+		},
+	}, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "ok" {
+		return formatResponseError(resp)
+	}
+	if changed {
+		cfg.Encryption.Enabled = true
+		if err := cfgpkg.Write(cfgPath, cfg); err != nil {
+			return fmt.Errorf("the daemon is encrypting but the config could not be saved, so it will stop after a restart: %w", err)
+		}
+		fmt.Printf("Enabled encryption in %s\n", cfgPath)
+	}
+
+	var result daemon.EncryptResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Encrypted %d session files and %d cursor files (%d already encrypted)\n",
+		result.SessionFiles, result.CursorFiles, result.AlreadyEncrypted)
+	return nil
+}
+
+// runFsck reads the session files directly, so it works while the daemon is
+// down; the daemon repairs torn tails itself when it starts.
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("fsck does not take arguments")
+	}
+
+	cfgPath, err := cfgpkg.Path()
+	if err != nil {
+		return err
+	}
+	cfg, err := cfgpkg.Load(cfgPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		cfg = cfgpkg.Default()
+	}
+	baseDir, err := daemon.EnsureBaseDir()
+	if err != nil {
+		return err
+	}
+	if err := daemon.ConfigureEncryption(baseDir, cfg.Encryption); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: encrypted sessions cannot be checked:", err)
+	}
+
+	result, err := daemon.CheckSessions(baseDir)
+	if err != nil {
+		return err
+	}
+	corrupt := 0
+	for _, check := range result.Problems {
+		fmt.Println(check.Path)
+		if check.Error != "" {
+			fmt.Printf("  unreadable: %s\n", check.Error)
+		}
+		for _, line := range check.Corrupt {
+			fmt.Printf("  line %d (offset %d): %s\n", line.Line, line.Offset, line.Reason)
+		}
+		if check.TornTail > 0 {
+			fmt.Printf("  torn tail: %d bytes without a newline\n", check.TornTail)
+		}
+		corrupt += len(check.Corrupt)
+	}
+	fmt.Printf("Checked %d session files (%d events): %d with problems, %d corrupt lines\n",
+		result.FilesChecked, result.Events, len(result.Problems), corrupt)
+	if len(result.Problems) > 0 {
+		return fmt.Errorf("%d session files have problems", len(result.Problems))
+	}
+	return nil
+}
+
+func parseSince(value string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+	ts, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("--since must be YYYY-MM-DD or RFC3339")
+	}
+	return ts, nil
+}
+
 func runUI(args []string) error {
 	fs := flag.NewFlagSet("ui", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
@@ -602,6 +1157,10 @@ func runUI(args []string) error {
 		return err
 	}
 
+	if err := daemon.ConfigureEncryption(baseDir, cfg.Encryption); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: encrypted sessions will not be readable:", err)
+	}
+
 	server := localserver.NewServer(baseDir, cfg)
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
@@ -706,6 +1265,22 @@ func daemonSocketPath() (string, error) {
 }
 
 func sendSocketRequest(req request) (*response, error) {
+	return sendSocketRequestTimeout(req, 5*time.Second)
+}
+
+func sendSocketRequestTimeout(req request, timeout time.Duration) (*response, error) {
+	resp, err := exchangeSocketRequest(req, timeout)
+	if err == nil && req.Version != legacyProtocolVersion && resp.Status != "ok" &&
+		resp.Error != nil && resp.Error.Code == "unsupported_version" {
+		req.Version = legacyProtocolVersion
+		return exchangeSocketRequest(req, timeout)
+	}
+	return resp, err
+}
+
+// exchangeSocketRequest sends one request on a new connection and closes it
+// once the response is read.
+func exchangeSocketRequest(req request, timeout time.Duration) (*response, error) {
 	path, err := daemonSocketPath()
 	if err != nil {
 		return nil, err
@@ -723,7 +1298,7 @@ func sendSocketRequest(req request) (*response, error) {
 	}
 	defer conn.Close()
 
-	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
 		return nil, err
 	}
 
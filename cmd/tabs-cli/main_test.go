@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout runs fn and returns what it printed.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open %s: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, devNull
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	fn()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestCursorPermissionHooksAllowWithoutDaemon(t *testing.T) {
+	// No socket and no tabs-daemon binary to start.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("PATH", "")
+
+	conversation := "c0ffee00-1111-4222-8333-944455556666"
+	cases := map[string][]string{
+		"daemon unreachable": {"--tool", "cursor", "--event", `{"conversation_id":"` + conversation + `","hook_event_name":"beforeShellExecution","command":"ls"}`},
+		"unreadable event":   {"--tool", "cursor", "--event", `{not json`},
+		"unknown flag":       {"--tool", "cursor", "--bogus"},
+	}
+	for name, args := range cases {
+		var err error
+		out := captureStdout(t, func() { err = runCapture(args) })
+		if err != nil {
+			t.Errorf("%s: expected no error for a permission hook, got %v", name, err)
+		}
+		if strings.TrimSpace(out) != `{"permission":"allow"}` {
+			t.Errorf("%s: expected an allow decision, got %q", name, out)
+		}
+	}
+
+	// Hooks that expect no decision still report the failure.
+	args := []string{"--tool", "cursor", "--event", `{"conversation_id":"` + conversation + `","hook_event_name":"afterFileEdit"}`}
+	var err error
+	out := captureStdout(t, func() { err = runCapture(args) })
+	if err == nil || out != "" {
+		t.Fatalf("expected an error and no output, got %v %q", err, out)
+	}
+}
+
+func TestSendSocketRequestFallsBackToProtocol10(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".tabs"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	ln, err := net.Listen("unix", filepath.Join(home, ".tabs", "daemon.sock"))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// A daemon that predates 1.1 refuses it and answers 1.0.
+	versions := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadBytes('\n')
+			var req request
+			_ = json.Unmarshal(line, &req)
+			versions <- req.Version
+			resp := response{Version: "1.0", Status: "ok"}
+			if req.Version != "1.0" {
+				resp = response{Version: "1.0", Status: "error", Error: &responseError{Code: "unsupported_version"}}
+			}
+			_ = json.NewEncoder(conn).Encode(resp)
+			conn.Close()
+		}
+	}()
+
+	resp, err := sendSocketRequestTimeout(request{Version: protocolVersion, Type: "daemon_status"}, 2*time.Second)
+	if err != nil || resp.Status != "ok" {
+		t.Fatalf("expected the request to succeed as 1.0: %+v (%v)", resp, err)
+	}
+	if first, second := <-versions, <-versions; first != "1.1" || second != "1.0" {
+		t.Fatalf("unexpected versions sent: %s, %s", first, second)
+	}
+}
@@ -26,12 +26,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// A config that cannot be read is an error, not a reason to run on
+	// defaults: those would drop its encryption and privacy settings.
 	cfg := config.Default()
 	if cfgPath, err := config.Path(); err != nil {
-		fallback.Warn("config path error", "error", err)
+		fallback.Error("config path error", "error", err)
+		os.Exit(1)
 	} else if loaded, err := config.Load(cfgPath); err != nil {
 		if !os.IsNotExist(err) {
-			fallback.Warn("config load error", "error", err)
+			fallback.Error("config load error", "error", err)
+			os.Exit(1)
 		}
 	} else {
 		cfg = loaded
@@ -54,6 +58,13 @@ func main() {
 	}
 
 	server := daemon.NewServer(baseDir, logger)
+	if err := server.Configure(cfg); err != nil {
+		_ = pidLock.Release()
+		logger.Error("config apply failed", "error", err)
+		os.Exit(1)
+	}
+	server.RepairSessions()
+	server.ResumeCaptures()
 	if err := server.Listen(); err != nil {
 		_ = pidLock.Release()
 		logger.Error("socket listen failed", "error", err)
@@ -63,8 +74,13 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
+	daemon.StartReconciliation(ctx, server)
+	daemon.StartLiveTail(ctx, server)
 	daemon.StartCursorPoller(ctx, server, cfg)
+	daemon.StartUploadQueue(ctx, server)
 	daemon.StartCleanupRoutine(ctx, baseDir, cfg.Local.EmptySessionRetentionHours, logger)
+	daemon.StartArchiveRoutine(ctx, server, cfg.Local.ArchiveAfterDays)
+	daemon.StartRetentionRoutine(ctx, server)
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -44,6 +44,10 @@ func main() {
 	}
 	logger := logging.New(cfg.Local.LogLevel, os.Stdout).With("component", "local")
 
+	if err := daemon.ConfigureEncryption(baseDir, cfg.Encryption); err != nil {
+		logger.Warn("encrypted sessions will not be readable", "error", err)
+	}
+
 	server := localserver.NewServer(baseDir, cfg)
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
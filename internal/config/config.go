@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -17,12 +18,28 @@ type Config struct {
 	Remote     RemoteConfig
 	Cursor     CursorConfig
 	ClaudeCode ClaudeCodeConfig
+	Redaction  RedactionConfig
+	Encryption EncryptionConfig
+	Privacy    PrivacyConfig
+	Pricing    map[string]ModelPrice // model (or model prefix) -> price
 }
 
 type LocalConfig struct {
 	UIPort                     int
 	LogLevel                   string
-	EmptySessionRetentionHours int // 0 = keep forever, >0 = delete empty sessions older than N hours
+	EmptySessionRetentionHours int    // 0 = keep forever, >0 = delete empty sessions older than N hours
+	LiveTail                   bool   // watch active transcripts and capture lines as they are written
+	GitContext                 bool   // record repo, branch and HEAD of the session cwd at start and end
+	ArchiveAfterDays           int    // 0 = never, >0 = gzip sessions that ended more than N days ago
+	Fsync                      string // FsyncAlways, FsyncBatch or FsyncNever
+
+	// Retention policy for captured sessions. Pushed and starred sessions and
+	// sessions under RetentionExcludeCwds are never deleted.
+	RetentionDays        int      // 0 = keep forever, >0 = delete sessions idle for more than N days
+	MaxDiskMB            int      // 0 = unlimited, >0 = evict oldest sessions beyond this total size
+	RetentionKeepPushed  bool     // never delete sessions that were pushed to the remote server
+	RetentionKeepStarred bool     // never delete starred sessions
+	RetentionExcludeCwds []string // sessions whose cwd is under one of these paths are kept
 }
 
 type RemoteConfig struct {
@@ -41,12 +58,110 @@ type ClaudeCodeConfig struct {
 	ProjectsDir string
 }
 
+type RedactionConfig struct {
+	Enabled       bool
+	Patterns      []string // extra user regexes, reported as custom_1, custom_2, ...
+	DisabledRules []string // built-in rule names to skip (e.g. "high_entropy")
+}
+
+// EncryptionConfig controls encryption at rest of session files and cursor
+// state. The master key lives in KeyFile, or is derived from the passphrase in
+// the PassphraseEnv environment variable, in which case KeyFile only holds
+// the KDF salt.
+type EncryptionConfig struct {
+	Enabled       bool
+	KeyFile       string // "" = ~/.tabs/keyfile
+	PassphraseEnv string // environment variable holding a passphrase; "" = random key in KeyFile
+}
+
+// PrivacyConfig lists directories whose sessions are not shared. Projects can
+// also opt out with a .tabsignore or .tabs.toml file (see ParseProjectConfig).
+type PrivacyConfig struct {
+	IgnoreCwds    []string // sessions under these paths are not captured at all
+	LocalOnlyCwds []string // sessions under these paths are captured but never pushed
+}
+
+// ModelPrice is a model's price in USD per million tokens.
+type ModelPrice struct {
+	Input      float64
+	Output     float64
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// Cost prices a token count.
+func (p ModelPrice) Cost(input, output, cacheWrite, cacheRead int64) float64 {
+	return (float64(input)*p.Input + float64(output)*p.Output +
+		float64(cacheWrite)*p.CacheWrite + float64(cacheRead)*p.CacheRead) / 1e6
+}
+
+// DefaultPricing lists list prices for the models the capture adapters see
+// most. Keys match by prefix, so "claude-sonnet-4" covers dated snapshots.
+func DefaultPricing() map[string]ModelPrice {
+	return map[string]ModelPrice{
+		"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.5},
+		"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+		"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+		"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+		"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+		"claude-haiku-4-5":  {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.1},
+		"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+		"gemini-2.5-pro":    {Input: 1.25, Output: 10, CacheRead: 0.31},
+		"gemini-2.5-flash":  {Input: 0.3, Output: 2.5, CacheRead: 0.075},
+	}
+}
+
+// LookupPrice finds the price for a model, preferring an exact key and then
+// the longest key that prefixes the model name.
+func LookupPrice(prices map[string]ModelPrice, model string) (ModelPrice, bool) {
+	if model == "" {
+		return ModelPrice{}, false
+	}
+	if price, ok := prices[model]; ok {
+		return price, true
+	}
+	var best string
+	for key := range prices {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return prices[best], true
+}
+
+// parseModelPrice reads [input, output, cache_write, cache_read]; trailing
+// cache prices may be omitted.
+func parseModelPrice(values []string) (ModelPrice, error) {
+	if len(values) < 2 || len(values) > 4 {
+		return ModelPrice{}, errors.New("price must list input, output and optional cache_write, cache_read per million tokens")
+	}
+	nums := make([]float64, 4)
+	for i, value := range values {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || n < 0 {
+			return ModelPrice{}, fmt.Errorf("invalid price %q", value)
+		}
+		nums[i] = n
+	}
+	return ModelPrice{Input: nums[0], Output: nums[1], CacheWrite: nums[2], CacheRead: nums[3]}, nil
+}
+
 func Default() Config {
 	return Config{
 		Local: LocalConfig{
 			UIPort:                     3787,
 			LogLevel:                   "info",
 			EmptySessionRetentionHours: 24, // Delete empty sessions after 24 hours by default
+			LiveTail:                   true,
+			GitContext:                 true,
+			ArchiveAfterDays:           30,
+			Fsync:                      FsyncAlways,
+			RetentionKeepPushed:        true,
+			RetentionKeepStarred:       true,
+			RetentionExcludeCwds:       []string{},
 		},
 		Remote: RemoteConfig{
 			ServerURL:   "https://tabs.company.com",
@@ -61,6 +176,21 @@ func Default() Config {
 		ClaudeCode: ClaudeCodeConfig{
 			ProjectsDir: "",
 		},
+		Redaction: RedactionConfig{
+			Enabled:       true,
+			Patterns:      []string{},
+			DisabledRules: []string{},
+		},
+		Encryption: EncryptionConfig{
+			Enabled:       false,
+			KeyFile:       "",
+			PassphraseEnv: "",
+		},
+		Privacy: PrivacyConfig{
+			IgnoreCwds:    []string{},
+			LocalOnlyCwds: []string{},
+		},
+		Pricing: DefaultPricing(),
 	}
 }
 
@@ -110,18 +240,93 @@ func Parse(data []byte) (Config, error) {
 	return cfg, nil
 }
 
+// Fsync modes for session file appends (local.fsync).
+const (
+	FsyncAlways = "always" // sync every appended event before the hook's job completes
+	FsyncBatch  = "batch"  // sync once per capture, before the cursor covering it is saved
+	FsyncNever  = "never"  // leave it to the OS; a crash can lose the newest events
+)
+
+func validFsyncMode(mode string) error {
+	switch mode {
+	case FsyncAlways, FsyncBatch, FsyncNever:
+		return nil
+	}
+	return fmt.Errorf("fsync must be one of: %s, %s, %s", FsyncAlways, FsyncBatch, FsyncNever)
+}
+
+// Capture modes a project can choose in its .tabs.toml.
+const (
+	CaptureFull      = "full"       // capture and allow pushing
+	CaptureLocalOnly = "local-only" // capture, but never push to the remote server
+	CaptureIgnore    = "ignore"     // do not capture at all
+)
+
+// ProjectConfig is a per-directory .tabs.toml:
+//
+//	[capture]
+//	mode = "local-only"
+type ProjectConfig struct {
+	CaptureMode string // CaptureFull, CaptureLocalOnly or CaptureIgnore; "" = not set
+}
+
+// ParseProjectConfig reads a .tabs.toml. Unknown sections and keys are
+// ignored; an unknown capture mode is an error.
+func ParseProjectConfig(data []byte) (ProjectConfig, error) {
+	var project ProjectConfig
+	var section string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := stripTomlComment(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || section != "capture" || strings.TrimSpace(parts[0]) != "mode" {
+			continue
+		}
+		value, err := parseTomlValue(parts[1])
+		if err != nil {
+			return ProjectConfig{}, err
+		}
+		mode, err := toString(value)
+		if err != nil {
+			return ProjectConfig{}, err
+		}
+		switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+		case CaptureFull, CaptureLocalOnly, CaptureIgnore:
+			project.CaptureMode = mode
+		default:
+			return ProjectConfig{}, fmt.Errorf("capture.mode must be one of: %s, %s, %s", CaptureFull, CaptureLocalOnly, CaptureIgnore)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ProjectConfig{}, err
+	}
+	return project, nil
+}
+
 func stripTomlComment(line string) string {
 	if !strings.Contains(line, "#") {
 		return line
 	}
 	var b strings.Builder
-	inQuotes := false
+	var quote byte
 	for i := 0; i < len(line); i++ {
 		ch := line[i]
-		if ch == '"' {
-			inQuotes = !inQuotes
+		if ch == '"' || ch == '\'' {
+			if quote == 0 {
+				quote = ch
+			} else if quote == ch {
+				quote = 0
+			}
 		}
-		if ch == '#' && !inQuotes {
+		if ch == '#' && quote == 0 {
 			break
 		}
 		b.WriteByte(ch)
@@ -156,6 +361,63 @@ func ApplyValue(cfg *Config, section, key, raw string) error {
 				return err
 			}
 			cfg.Local.EmptySessionRetentionHours = hours
+		case "live_tail":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.LiveTail = b
+		case "git_context":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.GitContext = b
+		case "archive_after_days":
+			days, err := toInt(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.ArchiveAfterDays = days
+		case "fsync":
+			text, err := toString(value)
+			if err != nil {
+				return err
+			}
+			if err := validFsyncMode(text); err != nil {
+				return err
+			}
+			cfg.Local.Fsync = text
+		case "retention_days":
+			days, err := toInt(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.RetentionDays = days
+		case "max_disk_mb":
+			mb, err := toInt(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.MaxDiskMB = mb
+		case "retention_keep_pushed":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.RetentionKeepPushed = b
+		case "retention_keep_starred":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.RetentionKeepStarred = b
+		case "retention_exclude_cwds":
+			arr, err := toStringSlice(value)
+			if err != nil {
+				return err
+			}
+			cfg.Local.RetentionExcludeCwds = arr
 		}
 	case "remote":
 		switch key {
@@ -208,6 +470,73 @@ func ApplyValue(cfg *Config, section, key, raw string) error {
 			}
 			cfg.ClaudeCode.ProjectsDir = text
 		}
+	case "redaction":
+		switch key {
+		case "enabled":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Redaction.Enabled = b
+		case "patterns":
+			arr, err := toStringSlice(value)
+			if err != nil {
+				return err
+			}
+			cfg.Redaction.Patterns = arr
+		case "disabled_rules":
+			arr, err := toStringSlice(value)
+			if err != nil {
+				return err
+			}
+			cfg.Redaction.DisabledRules = arr
+		}
+	case "encryption":
+		switch key {
+		case "enabled":
+			b, err := toBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.Encryption.Enabled = b
+		case "key_file":
+			text, err := toString(value)
+			if err != nil {
+				return err
+			}
+			cfg.Encryption.KeyFile = text
+		case "passphrase_env":
+			text, err := toString(value)
+			if err != nil {
+				return err
+			}
+			cfg.Encryption.PassphraseEnv = text
+		}
+	case "privacy":
+		switch key {
+		case "ignore_cwds":
+			arr, err := toStringSlice(value)
+			if err != nil {
+				return err
+			}
+			cfg.Privacy.IgnoreCwds = arr
+		case "local_only_cwds":
+			arr, err := toStringSlice(value)
+			if err != nil {
+				return err
+			}
+			cfg.Privacy.LocalOnlyCwds = arr
+		}
+	case "pricing":
+		values, err := toStringSlice(value)
+		if err != nil {
+			return err
+		}
+		price, err := parseModelPrice(values)
+		if err != nil {
+			return fmt.Errorf("pricing.%s: %w", key, err)
+		}
+		cfg.Pricing[unquoteTomlString(key)] = price
 	}
 
 	return nil
@@ -223,21 +552,20 @@ func parseTomlValue(raw string) (interface{}, error) {
 		if inner == "" {
 			return []string{}, nil
 		}
-		parts := splitComma(inner)
+		parts := splitTomlArray(inner)
 		values := make([]string, 0, len(parts))
 		for _, part := range parts {
 			part = strings.TrimSpace(part)
 			if part == "" {
 				continue
 			}
-			unquoted, err := strconv.Unquote(part)
-			if err != nil {
-				unquoted = part
-			}
-			values = append(values, unquoted)
+			values = append(values, unquoteTomlString(part))
 		}
 		return values, nil
 	}
+	if len(trimmed) >= 2 && strings.HasPrefix(trimmed, "'") && strings.HasSuffix(trimmed, "'") {
+		return trimmed[1 : len(trimmed)-1], nil
+	}
 	if strings.HasPrefix(trimmed, "\"") && strings.HasSuffix(trimmed, "\"") {
 		unquoted, err := strconv.Unquote(trimmed)
 		if err != nil {
@@ -254,6 +582,40 @@ func parseTomlValue(raw string) (interface{}, error) {
 	return trimmed, nil
 }
 
+// splitTomlArray splits array items on commas that are outside quoted strings,
+// so regex patterns such as '\d{2,4}' survive intact.
+func splitTomlArray(input string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		switch {
+		case quote == '"' && ch == '\\':
+			i++
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case quote == 0 && ch == ',':
+			parts = append(parts, strings.TrimSpace(input[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(input[start:]))
+}
+
+func unquoteTomlString(part string) string {
+	if len(part) >= 2 && strings.HasPrefix(part, "'") && strings.HasSuffix(part, "'") {
+		return part[1 : len(part)-1]
+	}
+	unquoted, err := strconv.Unquote(part)
+	if err != nil {
+		return part
+	}
+	return unquoted
+}
+
 func splitComma(input string) []string {
 	parts := strings.Split(input, ",")
 	for i, part := range parts {
@@ -377,6 +739,74 @@ func ApplySet(cfg *Config, key, rawValue string) error {
 		}
 		cfg.Local.EmptySessionRetentionHours = hours
 		return nil
+	case "local.live_tail", "live_tail", "live-tail":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("live_tail must be true or false")
+		}
+		cfg.Local.LiveTail = b
+		return nil
+	case "local.git_context", "git_context", "git-context":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("git_context must be true or false")
+		}
+		cfg.Local.GitContext = b
+		return nil
+	case "local.fsync", "fsync":
+		mode := strings.ToLower(strings.TrimSpace(rawValue))
+		if err := validFsyncMode(mode); err != nil {
+			return err
+		}
+		cfg.Local.Fsync = mode
+		return nil
+	case "local.archive_after_days", "archive_after_days", "archive-after-days":
+		days, err := strconv.Atoi(rawValue)
+		if err != nil {
+			return errors.New("archive_after_days must be a number")
+		}
+		if days < 0 {
+			return errors.New("archive_after_days must be >= 0")
+		}
+		cfg.Local.ArchiveAfterDays = days
+		return nil
+	case "local.retention_days", "retention_days", "retention-days":
+		days, err := strconv.Atoi(rawValue)
+		if err != nil {
+			return errors.New("retention_days must be a number")
+		}
+		if days < 0 {
+			return errors.New("retention_days must be >= 0")
+		}
+		cfg.Local.RetentionDays = days
+		return nil
+	case "local.max_disk_mb", "max_disk_mb", "max-disk-mb":
+		mb, err := strconv.Atoi(rawValue)
+		if err != nil {
+			return errors.New("max_disk_mb must be a number")
+		}
+		if mb < 0 {
+			return errors.New("max_disk_mb must be >= 0")
+		}
+		cfg.Local.MaxDiskMB = mb
+		return nil
+	case "local.retention_keep_pushed", "retention_keep_pushed", "retention-keep-pushed":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("retention_keep_pushed must be true or false")
+		}
+		cfg.Local.RetentionKeepPushed = b
+		return nil
+	case "local.retention_keep_starred", "retention_keep_starred", "retention-keep-starred":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("retention_keep_starred must be true or false")
+		}
+		cfg.Local.RetentionKeepStarred = b
+		return nil
+	case "local.retention_exclude_cwds", "retention_exclude_cwds", "retention-exclude-cwds":
+		cfg.Local.RetentionExcludeCwds = parseTags(rawValue)
+		return nil
 	case "cursor.db_path", "cursor.db-path", "db.path", "db_path", "db-path":
 		path := ExpandHome(strings.TrimSpace(rawValue))
 		cfg.Cursor.DBPath = path
@@ -395,7 +825,50 @@ func ApplySet(cfg *Config, key, rawValue string) error {
 		path := ExpandHome(strings.TrimSpace(rawValue))
 		cfg.ClaudeCode.ProjectsDir = path
 		return nil
+	case "redaction.enabled":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("redaction.enabled must be true or false")
+		}
+		cfg.Redaction.Enabled = b
+		return nil
+	case "redaction.patterns":
+		cfg.Redaction.Patterns = parseTags(rawValue)
+		return nil
+	case "redaction.disabled_rules":
+		cfg.Redaction.DisabledRules = parseTags(rawValue)
+		return nil
+	case "encryption.enabled":
+		b, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return errors.New("encryption.enabled must be true or false")
+		}
+		cfg.Encryption.Enabled = b
+		return nil
+	case "encryption.key_file", "encryption.key-file":
+		cfg.Encryption.KeyFile = ExpandHome(strings.TrimSpace(rawValue))
+		return nil
+	case "encryption.passphrase_env", "encryption.passphrase-env":
+		cfg.Encryption.PassphraseEnv = strings.TrimSpace(rawValue)
+		return nil
+	case "privacy.ignore_cwds", "privacy.ignore-cwds", "ignore_cwds", "ignore-cwds":
+		cfg.Privacy.IgnoreCwds = parseTags(rawValue)
+		return nil
+	case "privacy.local_only_cwds", "privacy.local-only-cwds", "local_only_cwds", "local-only-cwds":
+		cfg.Privacy.LocalOnlyCwds = parseTags(rawValue)
+		return nil
 	default:
+		if model, ok := strings.CutPrefix(strings.TrimSpace(key), "pricing."); ok && model != "" {
+			price, err := parseModelPrice(splitComma(strings.Trim(strings.TrimSpace(rawValue), "[]")))
+			if err != nil {
+				return fmt.Errorf("pricing.%s: %w", model, err)
+			}
+			if cfg.Pricing == nil {
+				cfg.Pricing = map[string]ModelPrice{}
+			}
+			cfg.Pricing[model] = price
+			return nil
+		}
 		return fmt.Errorf("unknown config key: %s", key)
 	}
 }
@@ -475,7 +948,16 @@ func Format(cfg Config) string {
 	b.WriteString("[local]\n")
 	fmt.Fprintf(&b, "ui_port = %d\n", cfg.Local.UIPort)
 	fmt.Fprintf(&b, "log_level = %q\n", cfg.Local.LogLevel)
-	fmt.Fprintf(&b, "empty_session_retention_hours = %d\n\n", cfg.Local.EmptySessionRetentionHours)
+	fmt.Fprintf(&b, "empty_session_retention_hours = %d\n", cfg.Local.EmptySessionRetentionHours)
+	fmt.Fprintf(&b, "live_tail = %t\n", cfg.Local.LiveTail)
+	fmt.Fprintf(&b, "git_context = %t\n", cfg.Local.GitContext)
+	fmt.Fprintf(&b, "archive_after_days = %d\n", cfg.Local.ArchiveAfterDays)
+	fmt.Fprintf(&b, "fsync = %q\n", cfg.Local.Fsync)
+	fmt.Fprintf(&b, "retention_days = %d\n", cfg.Local.RetentionDays)
+	fmt.Fprintf(&b, "max_disk_mb = %d\n", cfg.Local.MaxDiskMB)
+	fmt.Fprintf(&b, "retention_keep_pushed = %t\n", cfg.Local.RetentionKeepPushed)
+	fmt.Fprintf(&b, "retention_keep_starred = %t\n", cfg.Local.RetentionKeepStarred)
+	fmt.Fprintf(&b, "retention_exclude_cwds = %s\n\n", formatStringArray(cfg.Local.RetentionExcludeCwds))
 
 	b.WriteString("[remote]\n")
 	fmt.Fprintf(&b, "server_url = %q\n", cfg.Remote.ServerURL)
@@ -488,11 +970,43 @@ func Format(cfg Config) string {
 	fmt.Fprintf(&b, "poll_interval = %d\n\n", cfg.Cursor.PollInterval)
 
 	b.WriteString("[claude_code]\n")
-	fmt.Fprintf(&b, "projects_dir = %q\n", cfg.ClaudeCode.ProjectsDir)
+	fmt.Fprintf(&b, "projects_dir = %q\n\n", cfg.ClaudeCode.ProjectsDir)
+
+	b.WriteString("[redaction]\n")
+	fmt.Fprintf(&b, "enabled = %t\n", cfg.Redaction.Enabled)
+	fmt.Fprintf(&b, "patterns = %s\n", formatLiteralArray(cfg.Redaction.Patterns))
+	fmt.Fprintf(&b, "disabled_rules = %s\n\n", formatStringArray(cfg.Redaction.DisabledRules))
+
+	b.WriteString("[encryption]\n")
+	fmt.Fprintf(&b, "enabled = %t\n", cfg.Encryption.Enabled)
+	fmt.Fprintf(&b, "key_file = %q\n", cfg.Encryption.KeyFile)
+	fmt.Fprintf(&b, "passphrase_env = %q\n\n", cfg.Encryption.PassphraseEnv)
+
+	b.WriteString("[privacy]\n")
+	fmt.Fprintf(&b, "ignore_cwds = %s\n", formatStringArray(cfg.Privacy.IgnoreCwds))
+	fmt.Fprintf(&b, "local_only_cwds = %s\n", formatStringArray(cfg.Privacy.LocalOnlyCwds))
+
+	if len(cfg.Pricing) > 0 {
+		b.WriteString("\n# USD per million tokens: [input, output, cache_write, cache_read]\n")
+		b.WriteString("[pricing]\n")
+		models := make([]string, 0, len(cfg.Pricing))
+		for model := range cfg.Pricing {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		for _, model := range models {
+			p := cfg.Pricing[model]
+			fmt.Fprintf(&b, "%q = [%s, %s, %s, %s]\n", model, formatPrice(p.Input), formatPrice(p.Output), formatPrice(p.CacheWrite), formatPrice(p.CacheRead))
+		}
+	}
 
 	return b.String()
 }
 
+func formatPrice(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
 func formatStringArray(values []string) string {
 	if len(values) == 0 {
 		return "[]"
@@ -503,3 +1017,20 @@ func formatStringArray(values []string) string {
 	}
 	return "[" + strings.Join(quoted, ", ") + "]"
 }
+
+// formatLiteralArray writes values as TOML literal strings where possible so
+// regex backslashes round-trip without escaping.
+func formatLiteralArray(values []string) string {
+	if len(values) == 0 {
+		return "[]"
+	}
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.ContainsAny(value, "'\n") {
+			quoted = append(quoted, strconv.Quote(value))
+			continue
+		}
+		quoted = append(quoted, "'"+value+"'")
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	aiderTool = "aider"
+
+	aiderSessionHeader = "# aider chat started at "
+	aiderUserPrefix    = "#### "
+)
+
+// aiderCapturer reads Aider's markdown chat log (.aider.chat.history.md in
+// the project root). Aider has no hooks, so a wrapper sends session_id and
+// transcript_path after each turn. The log is shared by every Aider run in
+// the project: a new session starts at the last "chat started" header, and
+// an assistant reply is only consumed once the next block begins or the
+// session ends, since Aider may still be streaming it.
+type aiderCapturer struct{}
+
+func (aiderCapturer) Tool() string { return aiderTool }
+
+func (c aiderCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	name, _ := event["hook_event_name"].(string)
+	return s.captureTranscript(capturePayload{Tool: c.Tool(), Event: event}, sessionID, hookTime, s.aiderAppender(name == "SessionEnd"))
+}
+
+func (aiderCapturer) appender(s *Server) transcriptAppender {
+	return s.aiderAppender(false)
+}
+
+func (s *Server) aiderAppender(flush bool) transcriptAppender {
+	return func(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+		return s.appendAiderHistory(sessionPath, sessionID, cursor, hookTime, flush)
+	}
+}
+
+func (s *Server) appendAiderHistory(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time, flush bool) (int, time.Time, error) {
+	if cursor == nil || cursor.TranscriptPath == "" {
+		return 0, time.Time{}, nil
+	}
+	file, err := os.Open(cursor.TranscriptPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	offset := cursor.LastOffset
+	if offset > int64(len(data)) {
+		offset = 0
+	}
+	if offset == 0 && cursor.LastLineHash == "" {
+		// First capture for this session: skip earlier runs in the log.
+		if idx := bytes.LastIndex(data, []byte(aiderSessionHeader)); idx > 0 {
+			offset = int64(idx)
+		}
+	}
+
+	events, consumed := parseAiderHistory(data[offset:], sessionID, hookTime, flush)
+	eventsWritten := 0
+	lastEventTime := time.Time{}
+	for _, event := range events {
+		wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+		if err != nil {
+			return eventsWritten, lastEventTime, err
+		}
+		eventsWritten++
+		lastEventTime = maxTime(lastEventTime, wroteAt)
+	}
+	if consumed > 0 {
+		cursor.LastOffset = offset + consumed
+		cursor.LastLineHash = hashLine(data[offset : offset+consumed])
+	}
+	return eventsWritten, lastEventTime, nil
+}
+
+// parseAiderHistory converts complete blocks of an Aider chat log into
+// events. It returns the number of bytes consumed; a trailing assistant
+// block is left unconsumed unless flush is set.
+func parseAiderHistory(data []byte, sessionID string, fallback time.Time, flush bool) ([]map[string]interface{}, int64) {
+	events := []map[string]interface{}{}
+	ts := fallback
+
+	var role string
+	var lines []string
+	var consumed int64
+	var pos int64
+
+	emit := func(end int64) {
+		text := strings.TrimSpace(strings.Join(lines, "\n"))
+		if role != "" && text != "" {
+			events = append(events, buildEvent("message", sessionID, aiderTool, ts, map[string]interface{}{
+				"role":    role,
+				"content": []map[string]interface{}{{"type": "text", "text": text}},
+			}))
+		}
+		role = ""
+		lines = nil
+		consumed = end
+	}
+
+	for pos < int64(len(data)) {
+		rest := data[pos:]
+		nl := bytes.IndexByte(rest, '\n')
+		if nl < 0 {
+			break
+		}
+		line := strings.TrimRight(string(rest[:nl]), "\r")
+		start := pos
+		pos += int64(nl + 1)
+
+		switch {
+		case strings.HasPrefix(line, aiderSessionHeader):
+			emit(start)
+			if parsed, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimPrefix(line, aiderSessionHeader), time.Local); err == nil {
+				ts = parsed
+			}
+			consumed = pos
+		case strings.HasPrefix(line, aiderUserPrefix) || line == "####":
+			if role != "user" {
+				emit(start)
+				role = "user"
+			}
+			lines = append(lines, strings.TrimRight(strings.TrimPrefix(strings.TrimPrefix(line, "####"), " "), " "))
+		case strings.HasPrefix(line, ">"):
+			// Command echo and tool output such as "Applied edit to x.py".
+			if role != "" {
+				emit(start)
+			}
+			consumed = pos
+		case strings.TrimSpace(line) == "":
+			if role == "user" {
+				emit(pos)
+			} else if role == "assistant" {
+				lines = append(lines, "")
+			} else {
+				consumed = pos
+			}
+		default:
+			if role != "assistant" {
+				emit(start)
+				role = "assistant"
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if role == "user" || (role != "" && flush) {
+		emit(pos)
+	}
+	return events, consumed
+}
@@ -0,0 +1,287 @@
+package daemon
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+const (
+	sessionFileExt  = ".jsonl"
+	archivedFileExt = ".jsonl.gz"
+)
+
+// IsSessionFileName reports whether name is a session file, live (.jsonl)
+// or archived (.jsonl.gz).
+func IsSessionFileName(name string) bool {
+	return strings.HasSuffix(name, sessionFileExt) || strings.HasSuffix(name, archivedFileExt)
+}
+
+// TrimSessionExt strips the .jsonl or .jsonl.gz extension from a session
+// file name.
+func TrimSessionExt(name string) string {
+	if strings.HasSuffix(name, archivedFileExt) {
+		return strings.TrimSuffix(name, archivedFileExt)
+	}
+	return strings.TrimSuffix(name, sessionFileExt)
+}
+
+func isArchivedSessionFile(path string) bool {
+	return strings.HasSuffix(path, archivedFileExt)
+}
+
+// OpenSessionFile opens a session file for reading, decompressing archived
+// files and decrypting encrypted ones transparently.
+func OpenSessionFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var src io.ReadCloser = file
+	if isArchivedSessionFile(path) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("open archived session %s: %w", path, err)
+		}
+		src = &gzipFile{Reader: zr, file: file}
+	}
+	plain, err := decryptSessionReader(src)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("open session %s: %w", path, err)
+	}
+	return sessionReader{Reader: plain, Closer: src}, nil
+}
+
+type sessionReader struct {
+	io.Reader
+	io.Closer
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compressSessionFile gzips path into path.gz and removes the original. The
+// archive is written to a temporary file and renamed into place, so a crash
+// leaves at most a stray temporary file.
+func compressSessionFile(path string) (string, error) {
+	target := path + ".gz"
+	if err := rewriteFile(path, target, func(dst io.Writer, src io.Reader) error {
+		zw := gzip.NewWriter(dst)
+		if _, err := io.Copy(zw, src); err != nil {
+			return err
+		}
+		return zw.Close()
+	}); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// restoreSessionFile decompresses an archived session back to .jsonl so it
+// can be appended to again.
+func restoreSessionFile(path string) (string, error) {
+	target := strings.TrimSuffix(path, ".gz")
+	if _, err := os.Stat(target); err == nil {
+		// An interrupted archive run left both; the plain file is current.
+		_ = os.Remove(path)
+		return target, nil
+	}
+	if err := rewriteFile(path, target, func(dst io.Writer, src io.Reader) error {
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(dst, zr)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func rewriteFile(src, dst string, convert func(io.Writer, io.Reader) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if err := convert(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0o600); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, dst)
+}
+
+// ArchiveSessions gzips session files whose session ended more than
+// afterDays days ago. Each file is archived under its session lock, so a
+// capture never appends to a file that is being compressed.
+func (s *Server) ArchiveSessions(afterDays int) (int, error) {
+	if afterDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-time.Duration(afterDays) * 24 * time.Hour)
+	days, err := os.ReadDir(SessionsDir(s.baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	archived := 0
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(s.baseDir), day.Name())
+		files, err := os.ReadDir(dayDir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, sessionFileExt) {
+				continue
+			}
+			path := filepath.Join(dayDir, name)
+			md, err := ReplaySessionMetadata(path)
+			if err != nil || md.SessionID == "" || md.EndedAt == "" {
+				continue
+			}
+			ended, err := time.Parse(time.RFC3339Nano, md.EndedAt)
+			if err != nil || ended.After(cutoff) {
+				continue
+			}
+			ok, err := s.archiveSessionFile(path, md.SessionID, md.Tool)
+			if err != nil {
+				return archived, err
+			}
+			if ok {
+				archived++
+			}
+		}
+	}
+	return archived, nil
+}
+
+func (s *Server) archiveSessionFile(path, sessionID, tool string) (bool, error) {
+	defer s.lockSession(sessionID)()
+	if _, err := os.Stat(path); err != nil {
+		// Removed or archived since the directory was read.
+		return false, nil
+	}
+	if _, err := os.Stat(path + ".gz"); err == nil {
+		// Left over from an interrupted run; the plain file is current.
+		_ = os.Remove(path + ".gz")
+	}
+	target, err := compressSessionFile(path)
+	if err != nil {
+		return false, err
+	}
+	s.relocateSessionFile(sessionID, tool, path, target)
+	return true, nil
+}
+
+// relocateSessionFile points the file cache, the cursor and the index at a
+// session file's new path. Callers hold the session lock.
+func (s *Server) relocateSessionFile(sessionID, tool, from, to string) {
+	s.state.forgetSessionFile(sessionID, tool, from)
+	cursor, err := loadCursorState(s.baseDir, sessionID)
+	if err != nil || cursor == nil {
+		return
+	}
+	if cursor.Metadata == nil {
+		// No cursor state to update; refresh the index row only.
+		if md, err := ReplaySessionMetadata(to); err == nil && s.index != nil {
+			md.CostUSD = events.SessionCost(md.UsageByModel, s.pricing)
+			_ = s.index.Upsert(indexEntryFromMetadata(md))
+		}
+		return
+	}
+	if cursor.Metadata.FilePath != from && cursor.Metadata.FilePath != "" {
+		return
+	}
+	cursor.Metadata.FilePath = to
+	if err := s.saveCursor(cursor); err != nil {
+		s.logger.Warn("cursor update after archive failed", "session_id", sessionID, "error", err)
+	}
+}
+
+// StartArchiveRoutine gzips sessions that ended more than afterDays days ago.
+// It runs once on startup and then every hour, like the empty session
+// cleanup.
+func StartArchiveRoutine(ctx context.Context, srv *Server, afterDays int) {
+	if afterDays <= 0 {
+		srv.logger.Info("session archival disabled")
+		return
+	}
+	srv.logger.Info("starting session archive routine", "archive_after_days", afterDays)
+	go func() {
+		runArchive(srv, afterDays)
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runArchive(srv, afterDays)
+			}
+		}
+	}()
+}
+
+func runArchive(srv *Server, afterDays int) {
+	archived, err := srv.ArchiveSessions(afterDays)
+	if err != nil {
+		srv.logger.Error("session archive failed", "error", err)
+	}
+	if archived > 0 {
+		srv.logger.Info("archived sessions", "archived", archived)
+	}
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveAndResumeSession(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "4d5e6f70-0000-4000-8000-000000000001"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	lines := []string{
+		`{"type":"user","message":{"role":"user","content":"old work"},"timestamp":"2025-01-01T12:00:00Z"}`,
+	}
+	if err := os.WriteFile(transcriptPath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	ended := time.Date(2025, 1, 1, 12, 5, 0, 0, time.UTC)
+	end := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "SessionEnd", "reason": "exit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: end}, sessionID, ended); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	livePath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+
+	archived, err := srv.ArchiveSessions(30)
+	if err != nil || archived != 1 {
+		t.Fatalf("archive: archived=%d err=%v", archived, err)
+	}
+	if _, err := os.Stat(livePath); !os.IsNotExist(err) {
+		t.Fatalf("expected the plain file to be removed, stat err=%v", err)
+	}
+	archivedPath, ok, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if !ok || archivedPath != livePath+".gz" {
+		t.Fatalf("expected archived file, got %q", archivedPath)
+	}
+	md, err := ReplaySessionMetadata(archivedPath)
+	if err != nil || md.MessageCount != 1 || md.EndedAt == "" {
+		t.Fatalf("replay archived: md=%+v err=%v", md, err)
+	}
+	if empty, _, err := isEmptySession(archivedPath); err != nil || empty {
+		t.Fatalf("archived session read as empty: empty=%v err=%v", empty, err)
+	}
+	events, _, err := readSessionEvents(archivedPath)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("read archived events: %d err=%v", len(events), err)
+	}
+	entry, ok, err := srv.index.Lookup(sessionID, "claude-code")
+	if err != nil || !ok || entry.FilePath != archivedPath {
+		t.Fatalf("index not pointed at the archive: %+v err=%v", entry, err)
+	}
+
+	// Resuming the session decompresses it and appends to the plain file.
+	file, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	_, _ = file.WriteString(`{"type":"user","message":{"role":"user","content":"back again"},"timestamp":"2025-03-01T09:00:00Z"}` + "\n")
+	file.Close()
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "UserPromptSubmit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture after archive: %v", err)
+	}
+	if _, err := os.Stat(archivedPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive to be removed, stat err=%v", err)
+	}
+	if got := eventTypes(readEvents(t, livePath)); got != "session_start,message,session_end,message,hook" {
+		t.Fatalf("unexpected events after resume: %s", got)
+	}
+	entry, _, _ = srv.index.Lookup(sessionID, "claude-code")
+	if entry.FilePath != livePath {
+		t.Fatalf("index not pointed back at the plain file: %q", entry.FilePath)
+	}
+}
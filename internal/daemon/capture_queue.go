@@ -0,0 +1,479 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxCaptureWorkers    = 4   // sessions processed at the same time
+	captureLatencyWindow = 128 // recent jobs the latency stats cover
+
+	maxCaptureAttempts = 5                      // tries before a job is parked in failed/
+	captureRetryBase   = 200 * time.Millisecond // first retry delay, doubled per attempt
+	captureRetryMax    = 5 * time.Second
+	failedCaptureTTL   = 7 * 24 * time.Hour // parked jobs older than this are deleted
+)
+
+// captureJob is one hook event that was acknowledged but not yet written. It
+// is journaled before the hook gets its reply, so a crash in between loses
+// nothing: the journal is replayed on the next start.
+type captureJob struct {
+	Seq        uint64                 `json:"seq"`
+	Tool       string                 `json:"tool"`
+	SessionID  string                 `json:"session_id"`
+	Timestamp  string                 `json:"timestamp"`   // hook time
+	ReceivedAt string                 `json:"received_at"` // when the daemon acknowledged it
+	Event      map[string]interface{} `json:"event"`
+	Attempts   int                    `json:"attempts,omitempty"`   // failed tries so far
+	LastError  string                 `json:"last_error,omitempty"` // why the last try failed
+}
+
+// CaptureQueueStats is the capture_queue block of daemon_status.
+type CaptureQueueStats struct {
+	Depth         int     `json:"depth"`     // journaled jobs not yet written, including in-flight ones
+	InFlight      int     `json:"in_flight"` // jobs being written right now
+	Processed     int     `json:"processed"`
+	Failed        int     `json:"failed"`          // jobs parked in failed/ by this run, held ones included
+	Retried       int     `json:"retried"`         // failed tries that were retried
+	Parked        int     `json:"parked"`          // jobs in failed/, retried on the next start
+	LastLatencyMs float64 `json:"last_latency_ms"` // acknowledgement to written, last job
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`  // over the last captureLatencyWindow jobs
+	MaxLatencyMs  float64 `json:"max_latency_ms"`  // over the last captureLatencyWindow jobs
+}
+
+// captureQueue hands journaled hook events to per-session workers. Jobs of
+// one session run one at a time in journal order; different sessions run in
+// parallel, up to maxCaptureWorkers.
+type captureQueue struct {
+	dir     string
+	process func(captureJob) error
+	logger  *slog.Logger
+
+	journalMu sync.Mutex // orders seq assignment, journal write and enqueue
+	lastSeq   uint64
+
+	mu        sync.Mutex
+	pending   map[string][]captureJob // session key -> jobs in seq order
+	running   map[string]bool         // sessions with a worker
+	held      map[string]bool         // sessions with a parked job; later jobs are parked behind it
+	closed    bool
+	depth     int
+	inFlight  int
+	processed int
+	failed    int
+	retried   int
+	parked    int
+	latencies []time.Duration // ring of recent latencies
+	next      int
+
+	retryBase time.Duration // captureRetryBase; shortened by tests
+	slots     chan struct{}
+	stop      chan struct{} // closed by Close; cuts retry waits short
+	wg        sync.WaitGroup
+}
+
+func newCaptureQueue(dir string, process func(captureJob) error, logger *slog.Logger) *captureQueue {
+	return &captureQueue{
+		dir:     dir,
+		process: process,
+		logger:  logger,
+		pending: make(map[string][]captureJob),
+		running: make(map[string]bool),
+		held:    make(map[string]bool),
+		slots:   make(chan struct{}, maxCaptureWorkers),
+		stop:    make(chan struct{}),
+
+		retryBase: captureRetryBase,
+	}
+}
+
+// Enqueue journals a job and schedules it. Once it returns nil the hook
+// can be acknowledged.
+func (q *captureQueue) Enqueue(job captureJob, now time.Time) error {
+	q.journalMu.Lock()
+	defer q.journalMu.Unlock()
+
+	seq := uint64(now.UnixNano())
+	if seq <= q.lastSeq {
+		seq = q.lastSeq + 1
+	}
+	job.Seq = seq
+	job.ReceivedAt = now.UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if data, err = sealDocument(data); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(q.jobPath(seq), data, 0o600); err != nil {
+		return err
+	}
+	if err := syncDir(q.dir); err != nil {
+		return err
+	}
+	q.lastSeq = seq
+	q.schedule(job)
+	return nil
+}
+
+// Replay schedules the jobs a previous run acknowledged but did not write.
+// Jobs parked in failed/ get another round of attempts, since most failures
+// (a full disk, a lock timeout) do not outlive a restart; parked jobs older
+// than failedCaptureTTL are deleted instead. Jobs that cannot be read (for
+// example without the encryption key) stay in the journal.
+func (q *captureQueue) Replay() (int, error) {
+	q.requeueFailed(time.Now())
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var jobs []captureJob
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(q.dir, name)
+		if strings.HasPrefix(name, ".tmp-") {
+			// A journal write that never completed was never acknowledged.
+			_ = os.Remove(path)
+			continue
+		}
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			data, err = openDocument(data)
+		}
+		var job captureJob
+		if err == nil {
+			err = json.Unmarshal(data, &job)
+		}
+		if err != nil {
+			q.logger.Warn("capture journal entry unreadable", "path", path, "error", err)
+			continue
+		}
+		job.Attempts = 0 // a parked job gets a new round of attempts
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Seq < jobs[j].Seq })
+
+	q.journalMu.Lock()
+	defer q.journalMu.Unlock()
+	for _, job := range jobs {
+		if job.Seq > q.lastSeq {
+			q.lastSeq = job.Seq
+		}
+		q.schedule(job)
+	}
+	return len(jobs), nil
+}
+
+func (q *captureQueue) schedule(job captureJob) {
+	key := sessionKey(job.SessionID, job.Tool)
+	q.mu.Lock()
+	if q.held[key] {
+		q.mu.Unlock()
+		q.hold(job)
+		return
+	}
+	defer q.mu.Unlock()
+	q.pending[key] = append(q.pending[key], job)
+	q.depth++
+	if q.running[key] || q.closed {
+		return
+	}
+	q.running[key] = true
+	q.wg.Add(1)
+	go q.work(key)
+}
+
+// work drains one session's jobs in order, then exits.
+func (q *captureQueue) work(key string) {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		jobs := q.pending[key]
+		if len(jobs) == 0 || q.closed {
+			delete(q.running, key)
+			q.mu.Unlock()
+			return
+		}
+		job := jobs[0]
+		q.mu.Unlock()
+
+		q.slots <- struct{}{}
+		q.mu.Lock()
+		q.inFlight++
+		q.mu.Unlock()
+		err := q.process(job)
+		<-q.slots
+
+		if err != nil && job.Attempts+1 < maxCaptureAttempts {
+			q.retry(key, job, err)
+			continue
+		}
+		q.finish(key, job, err)
+	}
+}
+
+// retry leaves a failed job at the head of its session, so later jobs of the
+// session keep waiting behind it, and waits out the backoff. Close cuts the
+// wait short; the job then stays in the journal for the next start.
+func (q *captureQueue) retry(key string, job captureJob, err error) {
+	job.Attempts++
+	job.LastError = err.Error()
+	q.logger.Warn("capture failed, retrying", "session_id", job.SessionID, "tool", job.Tool, "attempt", job.Attempts, "error", err)
+	q.mu.Lock()
+	q.inFlight--
+	q.retried++
+	if jobs := q.pending[key]; len(jobs) > 0 {
+		jobs[0] = job
+	}
+	q.mu.Unlock()
+
+	timer := time.NewTimer(captureRetryDelay(q.retryBase, job.Attempts))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-q.stop:
+	}
+}
+
+func captureRetryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if delay > captureRetryMax || delay <= 0 {
+		delay = captureRetryMax
+	}
+	return delay
+}
+
+func (q *captureQueue) finish(key string, job captureJob, err error) {
+	path := q.jobPath(job.Seq)
+	if err != nil {
+		job.Attempts++
+		job.LastError = err.Error()
+		q.logger.Warn("capture failed, parking job", "session_id", job.SessionID, "tool", job.Tool, "attempts", job.Attempts, "error", err)
+		// Park the payload instead of retrying it forever; the next start
+		// retries it, and it is deleted once older than failedCaptureTTL.
+		if parkErr := q.park(job); parkErr != nil {
+			q.logger.Warn("capture job could not be parked", "path", path, "error", parkErr)
+		}
+	} else if rmErr := os.Remove(path); rmErr != nil && !os.IsNotExist(rmErr) {
+		q.logger.Warn("capture journal cleanup failed", "path", path, "error", rmErr)
+	}
+
+	var held []captureJob
+	q.mu.Lock()
+	if jobs := q.pending[key]; len(jobs) > 0 {
+		q.pending[key] = jobs[1:]
+		if len(q.pending[key]) == 0 {
+			delete(q.pending, key)
+		}
+	}
+	q.depth--
+	q.inFlight--
+	if err != nil {
+		q.failed++
+		// Later jobs of the session would be written ahead of the parked
+		// one, which would then replay with a stale seq, so they are parked
+		// behind it until the next start retries them all in order.
+		held = q.pending[key]
+		delete(q.pending, key)
+		q.depth -= len(held)
+		q.held[key] = true
+	} else {
+		q.processed++
+		if received, parseErr := time.Parse(time.RFC3339Nano, job.ReceivedAt); parseErr == nil {
+			latency := time.Since(received)
+			if len(q.latencies) < captureLatencyWindow {
+				q.latencies = append(q.latencies, latency)
+			} else {
+				q.latencies[q.next] = latency
+			}
+			q.next = (q.next + 1) % captureLatencyWindow
+		}
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		for _, later := range held {
+			q.hold(later)
+		}
+		q.pruneFailed(time.Now())
+	}
+}
+
+// hold parks a job of a session whose earlier job was parked.
+func (q *captureQueue) hold(job captureJob) {
+	job.LastError = "held behind a parked job of the session"
+	if err := q.park(job); err != nil {
+		// It stays in the journal and runs, in order, on the next start.
+		q.logger.Warn("capture job could not be held", "path", q.jobPath(job.Seq), "error", err)
+		return
+	}
+	q.logger.Warn("capture job held behind a parked job", "session_id", job.SessionID, "tool", job.Tool)
+	q.mu.Lock()
+	q.failed++
+	q.parked++
+	q.mu.Unlock()
+}
+
+// Stats reports queue depth and recent processing latency.
+func (q *captureQueue) Stats() CaptureQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := CaptureQueueStats{
+		Depth:     q.depth,
+		InFlight:  q.inFlight,
+		Processed: q.processed,
+		Failed:    q.failed,
+		Retried:   q.retried,
+		Parked:    q.parked,
+	}
+	if len(q.latencies) == 0 {
+		return stats
+	}
+	var total, longest time.Duration
+	for _, latency := range q.latencies {
+		total += latency
+		if latency > longest {
+			longest = latency
+		}
+	}
+	last := q.latencies[(q.next+len(q.latencies)-1)%len(q.latencies)]
+	stats.LastLatencyMs = durationMs(last)
+	stats.AvgLatencyMs = durationMs(total / time.Duration(len(q.latencies)))
+	stats.MaxLatencyMs = durationMs(longest)
+	return stats
+}
+
+// Close stops workers from starting new jobs and waits for in-flight ones.
+// Jobs left in the journal run on the next start.
+func (q *captureQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *captureQueue) failedDir() string {
+	return filepath.Join(q.dir, "failed")
+}
+
+// park moves a job that ran out of attempts to failed/, rewritten with its
+// attempt count and last error for inspection.
+func (q *captureQueue) park(job captureJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if data, err = sealDocument(data); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(q.failedDir(), 0o700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(q.failedDir(), filepath.Base(q.jobPath(job.Seq))), data, 0o600); err != nil {
+		return err
+	}
+	return os.Remove(q.jobPath(job.Seq))
+}
+
+// requeueFailed moves parked jobs back into the journal for Replay and
+// deletes those older than failedCaptureTTL.
+func (q *captureQueue) requeueFailed(now time.Time) {
+	q.pruneFailed(now)
+	defer q.pruneFailed(now) // recount what could not be moved
+	entries, err := os.ReadDir(q.failedDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if err := os.Rename(filepath.Join(q.failedDir(), name), filepath.Join(q.dir, name)); err != nil {
+			q.logger.Warn("failed capture job not requeued", "name", name, "error", err)
+		}
+	}
+}
+
+// pruneFailed deletes parked jobs received more than failedCaptureTTL ago
+// and counts the rest. The age comes from the file name, the journal seq,
+// which is the receive time in nanoseconds.
+func (q *captureQueue) pruneFailed(now time.Time) {
+	entries, err := os.ReadDir(q.failedDir())
+	if err != nil {
+		return
+	}
+	parked := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if err == nil && now.Sub(time.Unix(0, int64(seq))) > failedCaptureTTL {
+			path := filepath.Join(q.failedDir(), entry.Name())
+			if err := os.Remove(path); err == nil {
+				q.logger.Warn("deleted expired failed capture job", "path", path)
+				continue
+			}
+		}
+		parked++
+	}
+	q.mu.Lock()
+	q.parked = parked
+	q.mu.Unlock()
+}
+
+func (q *captureQueue) jobPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.json", seq))
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// syncDir flushes a directory entry so a rename or create in it survives a
+// crash.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,260 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitForCaptures(t *testing.T, q *captureQueue) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().Depth > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("capture queue did not drain: %+v", q.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCaptureQueueOrdersPerSessionAndReplaysJournal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "capture-journal")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var mu sync.Mutex
+	seen := map[string][]string{}
+	record := func(job captureJob) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[job.SessionID] = append(seen[job.SessionID], job.Event["n"].(string))
+		return nil
+	}
+
+	// A stopped queue only journals, like a daemon that died before its
+	// workers ran.
+	stopped := newCaptureQueue(dir, record, logger)
+	if err := stopped.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	now := time.Now()
+	for i, n := range []string{"1", "2", "3", "4", "5", "6"} {
+		session := "a"
+		if i%2 == 1 {
+			session = "b"
+		}
+		// Equal timestamps still get increasing sequence numbers.
+		if err := stopped.Enqueue(captureJob{Tool: "claude-code", SessionID: session, Event: map[string]interface{}{"n": n}}, now); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 6 {
+		t.Fatalf("expected 6 journal entries, got %d", len(entries))
+	}
+
+	q := newCaptureQueue(dir, record, logger)
+	replayed, err := q.Replay()
+	if err != nil || replayed != 6 {
+		t.Fatalf("replay: %d err=%v", replayed, err)
+	}
+	for _, n := range []string{"7", "8"} {
+		if err := q.Enqueue(captureJob{Tool: "claude-code", SessionID: "a", Event: map[string]interface{}{"n": n}}, now); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	waitForCaptures(t, q)
+
+	mu.Lock()
+	a, b := seen["a"], seen["b"]
+	mu.Unlock()
+	if got := strings.Join(a, ","); got != "1,3,5,7,8" {
+		t.Fatalf("session a out of order: %s", got)
+	}
+	if got := strings.Join(b, ","); got != "2,4,6" {
+		t.Fatalf("session b out of order: %s", got)
+	}
+	stats := q.Stats()
+	if stats.Processed != 8 || stats.Depth != 0 || stats.InFlight != 0 || stats.MaxLatencyMs <= 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("journal not emptied: %d entries", len(entries))
+	}
+}
+
+func TestCaptureJobWritesSessionEvents(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "8b9c0d1e-0000-4000-8000-000000000001"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	if err := os.WriteFile(transcriptPath, []byte(`{"type":"user","message":{"role":"user","content":"queued prompt"},"timestamp":"2026-01-01T12:00:00Z"}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "cwd": "/work/app", "hook_event_name": "UserPromptSubmit"}
+	job := captureJob{Tool: "claude-code", SessionID: sessionID, Timestamp: "2026-01-01T12:00:01Z", Event: hook}
+	if err := srv.captures.Enqueue(job, time.Now()); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	waitForCaptures(t, srv.captures)
+
+	path, ok, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if !ok {
+		t.Fatalf("session file not written")
+	}
+	if got := eventTypes(readEvents(t, path)); got != "session_start,message,hook" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	status := srv.state.Snapshot(0)
+	if status.EventsProcessed != 3 || status.SessionsCaptured != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestCaptureQueueRetriesThenParksAndRequeues(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "capture-journal")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var mu sync.Mutex
+	failures := map[string]int{"flaky": 2, "broken": 1 << 30}
+	process := func(job captureJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures[job.SessionID] > 0 {
+			failures[job.SessionID]--
+			return errors.New("no space left on device")
+		}
+		return nil
+	}
+	q := newCaptureQueue(dir, process, logger)
+	q.retryBase = time.Millisecond
+	for _, session := range []string{"flaky", "broken"} {
+		if err := q.Enqueue(captureJob{Tool: "claude-code", SessionID: session, Event: map[string]interface{}{}}, time.Now()); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	waitForCaptures(t, q)
+	stats := q.Stats()
+	if stats.Processed != 1 || stats.Failed != 1 || stats.Parked != 1 || stats.Retried != 2+maxCaptureAttempts-1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	parked, _ := os.ReadDir(filepath.Join(dir, "failed"))
+	if len(parked) != 1 {
+		t.Fatalf("expected one parked job, got %d", len(parked))
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "failed", parked[0].Name()))
+	if !strings.Contains(string(data), `"attempts":5`) || !strings.Contains(string(data), "no space left") {
+		t.Fatalf("parked job lacks its attempts and error: %s", data)
+	}
+
+	// The next start retries the parked job.
+	mu.Lock()
+	failures["broken"] = 0
+	mu.Unlock()
+	restarted := newCaptureQueue(dir, process, logger)
+	if replayed, err := restarted.Replay(); err != nil || replayed != 1 {
+		t.Fatalf("replay: %d err=%v", replayed, err)
+	}
+	waitForCaptures(t, restarted)
+	if stats := restarted.Stats(); stats.Processed != 1 || stats.Parked != 0 {
+		t.Fatalf("unexpected stats after restart: %+v", stats)
+	}
+
+	// Parked jobs older than the TTL are deleted rather than retried.
+	old := uint64(time.Now().Add(-failedCaptureTTL - time.Hour).UnixNano())
+	if err := os.WriteFile(filepath.Join(dir, "failed", fmt.Sprintf("%020d.json", old)), []byte(`{}`), 0o600); err != nil {
+		t.Fatalf("write parked job: %v", err)
+	}
+	if replayed, err := newCaptureQueue(dir, process, logger).Replay(); err != nil || replayed != 0 {
+		t.Fatalf("replay of expired job: %d err=%v", replayed, err)
+	}
+	if left, _ := os.ReadDir(filepath.Join(dir, "failed")); len(left) != 0 {
+		t.Fatalf("expired parked job not deleted")
+	}
+}
+
+func TestCaptureQueueHoldsLaterJobsBehindParkedOne(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "capture-journal")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var mu sync.Mutex
+	broken := true
+	var written []string
+	process := func(job captureJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		n := fmt.Sprint(job.Event["n"])
+		if broken && n == "1" {
+			return errors.New("no space left on device")
+		}
+		written = append(written, n)
+		return nil
+	}
+	enqueue := func(q *captureQueue, n int) {
+		t.Helper()
+		if err := q.Enqueue(captureJob{Tool: "claude-code", SessionID: "s", Event: map[string]interface{}{"n": n}}, time.Now()); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	q := newCaptureQueue(dir, process, logger)
+	q.retryBase = time.Millisecond
+	for n := 1; n <= 3; n++ {
+		enqueue(q, n)
+	}
+	waitForCaptures(t, q)
+	// A job arriving after the park is held too.
+	enqueue(q, 4)
+	waitForCaptures(t, q)
+
+	mu.Lock()
+	if len(written) != 0 {
+		t.Fatalf("later jobs were written ahead of the parked one: %v", written)
+	}
+	broken = false
+	mu.Unlock()
+	if stats := q.Stats(); stats.Processed != 0 || stats.Failed != 4 || stats.Parked != 4 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// The next start retries them all in order.
+	restarted := newCaptureQueue(dir, process, logger)
+	if replayed, err := restarted.Replay(); err != nil || replayed != 4 {
+		t.Fatalf("replay: %d err=%v", replayed, err)
+	}
+	waitForCaptures(t, restarted)
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(written, ","); got != "1,2,3,4" {
+		t.Fatalf("unexpected replay order: %s", got)
+	}
+}
+
+func TestCaptureJournalIsRedacted(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	// Keep jobs in the journal, as if the daemon died before writing them.
+	if err := srv.captures.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	secret := "sk-proj-Q7vX2mLp9RzT4kWb8NcY3hJd6FsG1aEuZ0oKiVq5"
+	payload := fmt.Sprintf(`{"tool":"claude-code","event":{"session_id":"8b9c0d1e-0000-4000-8000-000000000002","cwd":"/work/app","prompt":"use %s please"}}`, secret)
+	if resp := srv.capture([]byte(payload)); resp.Status != "ok" {
+		t.Fatalf("capture: %+v", resp)
+	}
+	entries, err := os.ReadDir(CaptureJournalDir(baseDir))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one journal entry, got %d (%v)", len(entries), err)
+	}
+	data, err := os.ReadFile(filepath.Join(CaptureJournalDir(baseDir), entries[0].Name()))
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	if strings.Contains(string(data), secret) || !strings.Contains(string(data), "[REDACTED:high_entropy]") {
+		t.Fatalf("journal holds the secret: %s", data)
+	}
+}
@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+// Capturer converts one agent tool's hook payloads into tabs events.
+// handleCapture dispatches on the payload's tool name, so supporting a new
+// tool means registering a Capturer for it.
+type Capturer interface {
+	// Tool is the name stored on sessions and events, e.g. "claude-code".
+	Tool() string
+	// Capture persists whatever the hook event makes available and returns
+	// the number of events written and the latest event time.
+	Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error)
+}
+
+// transcriptCapturer is implemented by capturers that tail a transcript file,
+// which lets the daemon catch a session up without waiting for a hook.
+type transcriptCapturer interface {
+	Capturer
+	appender(s *Server) transcriptAppender
+}
+
+var (
+	capturersMu sync.RWMutex
+	capturers   = map[string]Capturer{}
+)
+
+func init() {
+	RegisterCapturer(claudeCapturer{})
+	RegisterCapturer(cursorCapturer{})
+	RegisterCapturer(codexCapturer{})
+	RegisterCapturer(geminiCapturer{})
+	RegisterCapturer(aiderCapturer{})
+}
+
+// RegisterCapturer makes a tool available to capture and push, and adds its
+// name to the tools the events package knows. It panics if the tool name is
+// empty or already registered.
+func RegisterCapturer(c Capturer) {
+	capturersMu.Lock()
+	defer capturersMu.Unlock()
+
+	tool := c.Tool()
+	if tool == "" {
+		panic("daemon: RegisterCapturer with empty tool name")
+	}
+	if _, dup := capturers[tool]; dup {
+		panic(fmt.Sprintf("daemon: RegisterCapturer called twice for %s", tool))
+	}
+	capturers[tool] = c
+	events.RegisterTool(tool)
+}
+
+// LookupCapturer returns the capturer registered for tool.
+func LookupCapturer(tool string) (Capturer, bool) {
+	capturersMu.RLock()
+	defer capturersMu.RUnlock()
+	c, ok := capturers[tool]
+	return c, ok
+}
+
+// IsRegisteredTool reports whether tool has a registered capturer.
+func IsRegisteredTool(tool string) bool {
+	_, ok := LookupCapturer(tool)
+	return ok
+}
+
+// RegisteredTools returns the registered tool names in sorted order.
+func RegisteredTools() []string {
+	capturersMu.RLock()
+	defer capturersMu.RUnlock()
+	tools := make([]string, 0, len(capturers))
+	for tool := range capturers {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	return tools
+}
+
+type claudeCapturer struct{}
+
+func (claudeCapturer) Tool() string { return "claude-code" }
+
+func (c claudeCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	return s.captureClaude(capturePayload{Tool: c.Tool(), Event: event}, sessionID, hookTime)
+}
+
+func (claudeCapturer) appender(s *Server) transcriptAppender {
+	return s.claudeAppender(nil)
+}
+
+type cursorCapturer struct{}
+
+func (cursorCapturer) Tool() string { return "cursor" }
+
+func (c cursorCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	return s.captureCursor(capturePayload{Tool: c.Tool(), Event: event}, sessionID, hookTime)
+}
+
+// EventCapturer stores hook payloads that are already tabs events, one event
+// per capture. Register one for integrations that emit the tabs event format
+// directly instead of a native transcript.
+type EventCapturer struct {
+	Name string
+}
+
+func (c EventCapturer) Tool() string { return c.Name }
+
+func (c EventCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	defer s.lockSession(sessionID)()
+
+	normalized, eventJSON, err := normalizeEvent(event, sessionID, c.Name, hookTime, s.redactor)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid event payload: %w", err)
+	}
+
+	cursor, err := loadCursorState(s.baseDir, sessionID)
+	if err != nil {
+		s.logger.Warn("cursor state load failed", "session_id", sessionID, "error", err)
+	}
+	if cursor == nil {
+		return 0, time.Time{}, errors.New("failed to read cursor state")
+	}
+
+	lineHash := hashLine(eventJSON)
+	if cursor.LastLineHash == lineHash {
+		return 0, time.Time{}, nil
+	}
+
+	sessionPath, err := s.state.EnsureSessionFile(s.baseDir, sessionID, c.Name, hookTime)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if err := recoverLastSeq(sessionPath, cursor); err != nil {
+		return 0, time.Time{}, err
+	}
+	// The duplicate check above hashes the unstamped line: a repeated hook
+	// would otherwise differ from the last one by its seq.
+	stamped, seq, err := stampEvent(cursor, normalized, eventJSON)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	lastOffset, err := s.appendLine(sessionPath, cursor, stamped)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	cursor.LastSeq = seq
+
+	meta := extractEventMetadata(normalized)
+	updateCursorState(cursor, meta, normalized, lineHash, lastOffset, sessionPath)
+	if err := s.saveCursor(cursor); err != nil {
+		return 0, time.Time{}, err
+	}
+	if meta.EventType == "session_end" {
+		s.enqueueAutoPush(sessionID, c.Name)
+	}
+	return 1, hookTime, nil
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+func TestRegisteredTools(t *testing.T) {
+	tools := RegisteredTools()
+	for _, want := range []string{"aider", "claude-code", "codex-cli", "cursor", "gemini-cli"} {
+		if !IsRegisteredTool(want) {
+			t.Errorf("expected %s to be registered (have %v)", want, tools)
+		}
+	}
+	if IsRegisteredTool("vim") {
+		t.Errorf("unexpected tool registered")
+	}
+	// The remote server validates uploads against the events package; its
+	// built-in names must match the capturers the daemon registers.
+	if known := strings.Join(events.Tools(), ","); known != strings.Join(tools, ",") {
+		t.Errorf("events package knows %s, daemon registers %v", known, tools)
+	}
+}
+
+func TestCodexEventsFromLine(t *testing.T) {
+	fallback := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"session meta skipped", `{"timestamp":"2026-01-01T12:00:00Z","type":"session_meta","payload":{"id":"abc","cwd":"/work"}}`, ""},
+		{"user message", `{"timestamp":"2026-01-01T12:00:00Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"fix it"}]}}`, "message"},
+		{"environment context dropped", `{"type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>cwd</environment_context>"}]}}`, ""},
+		{"function call", `{"type":"response_item","payload":{"type":"function_call","name":"shell","arguments":"{\"command\":[\"ls\"]}","call_id":"call_1"}}`, "tool_use"},
+		{"function output", `{"type":"response_item","payload":{"type":"function_call_output","call_id":"call_1","output":"{\"output\":\"boom\",\"metadata\":{\"exit_code\":1}}"}}`, "tool_result"},
+		{"legacy unwrapped", `{"type":"message","role":"assistant","content":[{"type":"output_text","text":"done"}]}`, "message"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, _, err := codexEventsFromLine([]byte(tc.line), "sess", fallback)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if tc.want == "" {
+				if len(events) != 0 {
+					t.Fatalf("expected no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0]["event_type"] != tc.want || events[0]["tool"] != codexTool {
+				t.Fatalf("expected one %s event, got %v", tc.want, events)
+			}
+		})
+	}
+
+	events, _, _ := codexEventsFromLine([]byte(cases[4].line), "sess", fallback)
+	data := events[0]["data"].(map[string]interface{})
+	if data["content"] != "boom" || data["is_error"] != true {
+		t.Fatalf("expected unwrapped failing output, got %v", data)
+	}
+}
+
+func TestGeminiCaptureTracksMessageIndex(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	chatPath := filepath.Join(t.TempDir(), "session.json")
+	writeChat := func(messages string) {
+		if err := os.WriteFile(chatPath, []byte(`{"sessionId":"g1","messages":[`+messages+`]}`), 0o644); err != nil {
+			t.Fatalf("write chat: %v", err)
+		}
+	}
+	user := `{"id":"1","timestamp":"2026-01-01T12:00:00Z","type":"user","content":"list files"}`
+	reply := `{"id":"2","timestamp":"2026-01-01T12:00:02Z","type":"gemini","content":"Here they are","model":"gemini-2.5-pro","toolCalls":[{"id":"t1","name":"list_directory","args":{"path":"."},"result":[{"text":"a.go"}],"status":"success"}]}`
+	writeChat(user)
+
+	hook := map[string]interface{}{"session_id": "g1", "transcript_path": chatPath, "cwd": "/work", "hook_event_name": "AfterAgent"}
+	capturer, _ := LookupCapturer(geminiTool)
+	written, _, err := capturer.Capture(srv, hook, "g1", time.Now())
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if written != 2 { // session_start + user message
+		t.Fatalf("expected 2 events, got %d", written)
+	}
+
+	writeChat(user + "," + reply)
+	written, _, err = capturer.Capture(srv, hook, "g1", time.Now())
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if written != 3 { // assistant message + tool_use + tool_result
+		t.Fatalf("expected 3 new events, got %d", written)
+	}
+
+	cursor, err := loadCursorState(baseDir, "g1")
+	if err != nil {
+		t.Fatalf("load cursor: %v", err)
+	}
+	if cursor.LastIndex != 2 {
+		t.Fatalf("expected last_index 2, got %d", cursor.LastIndex)
+	}
+}
+
+func TestParseAiderHistory(t *testing.T) {
+	history := strings.Join([]string{
+		"# aider chat started at 2026-01-01 12:00:00",
+		"",
+		"> /usr/local/bin/aider --model sonnet",
+		"> Added main.go to the chat.",
+		"",
+		"#### add a flag",
+		"#### for verbose output",
+		"",
+		"Sure, here is the change.",
+		"",
+		"It adds `-v`.",
+		"",
+		"> Applied edit to main.go",
+		"",
+		"#### thanks",
+		"",
+		"You're welcome",
+		"",
+	}, "\n")
+
+	events, consumed := parseAiderHistory([]byte(history), "sess", time.Now(), false)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events before flush, got %d", len(events))
+	}
+	first := events[0]["data"].(map[string]interface{})
+	if first["role"] != "user" {
+		t.Fatalf("expected user first, got %v", first)
+	}
+	text := first["content"].([]map[string]interface{})[0]["text"]
+	if text != "add a flag\nfor verbose output" {
+		t.Fatalf("unexpected user text %q", text)
+	}
+	reply := events[1]["data"].(map[string]interface{})["content"].([]map[string]interface{})[0]["text"]
+	if reply != "Sure, here is the change.\n\nIt adds `-v`." {
+		t.Fatalf("unexpected assistant text %q", reply)
+	}
+	if consumed >= int64(len(history)) {
+		t.Fatalf("trailing assistant reply must stay unconsumed")
+	}
+
+	rest, _ := parseAiderHistory([]byte(history)[consumed:], "sess", time.Now(), true)
+	if len(rest) != 1 || rest[0]["data"].(map[string]interface{})["role"] != "assistant" {
+		t.Fatalf("expected flushed assistant reply, got %v", rest)
+	}
+}
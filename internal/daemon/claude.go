@@ -8,12 +8,60 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/victorarias/tabs/internal/events"
 )
 
 func (s *Server) captureClaude(req capturePayload, sessionID string, hookTime time.Time) (int, time.Time, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.captureTranscript(req, sessionID, hookTime, s.claudeAppender(req.Event))
+}
+
+// claudeAppender copies the main transcript, then any sub-agent transcripts
+// it references. A SubagentStop hook names its agent before the Task result
+// does, so its transcript is picked up right away. A resumed conversation is
+// linked to its parent first, so the history it repeats is skipped. The hook
+// itself is recorded last, stamped with the time it fired.
+func (s *Server) claudeAppender(hook map[string]interface{}) transcriptAppender {
+	appendMain := s.lineAppender(claudeEventsFromLine)
+	return func(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+		if hook != nil {
+			noteSubagentHook(cursor, hook)
+		}
+		linked, linkedAt, err := s.resolveContinuation(sessionPath, cursor, hookTime)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		written, latest, err := appendMain(sessionPath, sessionID, cursor, hookTime)
+		written += linked
+		latest = maxTime(latest, linkedAt)
+		if err != nil {
+			return written, latest, err
+		}
+		n, wroteAt, err := s.appendClaudeSubagents(sessionPath, sessionID, cursor, hookTime)
+		written += n
+		latest = maxTime(latest, wroteAt)
+		if err != nil {
+			return written, latest, err
+		}
+		hookEvent := buildHookEvent(hook, sessionID, subagentTool(cursor), hookTime)
+		if hookEvent == nil {
+			return written, latest, nil
+		}
+		wroteAt, err = s.appendEvent(sessionPath, cursor, hookEvent)
+		if err != nil {
+			return written, latest, err
+		}
+		return written + 1, maxTime(latest, wroteAt), nil
+	}
+}
+
+// captureTranscript is the shared hook flow for tools that keep their own
+// transcript on disk: resolve the transcript, emit session_start once, copy
+// new entries via appendNew, and close the session on SessionEnd.
+func (s *Server) captureTranscript(req capturePayload, sessionID string, hookTime time.Time, appendNew transcriptAppender) (int, time.Time, error) {
+	defer s.lockSession(sessionID)()
 
 	cursor, err := loadCursorState(s.baseDir, sessionID)
 	if err != nil {
@@ -44,40 +92,43 @@ func (s *Server) captureClaude(req capturePayload, sessionID string, hookTime ti
 	if needsSessionStart(cursor) {
 		startEvent := buildSessionStartEvent(req.Event, sessionID, req.Tool, hookTime)
 		if startEvent != nil {
-			wroteAt, err := s.appendEvent(sessionPath, cursor, startEvent)
+			written, wroteAt, err := s.appendBoundaryEvent(sessionPath, cursor, startEvent)
 			if err != nil {
 				return 0, time.Time{}, err
 			}
-			eventsWritten++
+			eventsWritten += written
 			lastEventTime = maxTime(lastEventTime, wroteAt)
 		}
 	}
 
-	written, latest, newOffset, lastHash, err := s.appendClaudeTranscript(sessionPath, sessionID, cursor, hookTime)
+	written, latest, err := appendNew(sessionPath, sessionID, cursor, hookTime)
 	if err != nil {
 		return 0, time.Time{}, err
 	}
 	eventsWritten += written
 	lastEventTime = maxTime(lastEventTime, latest)
-	if newOffset >= 0 {
-		cursor.LastOffset = newOffset
-	}
-	if lastHash != "" {
-		cursor.LastLineHash = lastHash
-	}
 
 	if endEvent := buildSessionEndEvent(req.Event, sessionID, req.Tool, hookTime, cursor); endEvent != nil {
-		wroteAt, err := s.appendEvent(sessionPath, cursor, endEvent)
+		closed, closedAt, err := s.closeSubagents(sessionPath, cursor, hookTime, true)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		eventsWritten += closed
+		lastEventTime = maxTime(lastEventTime, closedAt)
+
+		s.attachSessionUsage(endEvent, cursor)
+		written, wroteAt, err := s.appendBoundaryEvent(sessionPath, cursor, endEvent)
 		if err != nil {
 			return 0, time.Time{}, err
 		}
-		eventsWritten++
+		eventsWritten += written
 		lastEventTime = maxTime(lastEventTime, wroteAt)
 	}
 
-	if err := saveCursorState(s.baseDir, cursor); err != nil {
+	if err := s.saveCursor(cursor); err != nil {
 		return 0, time.Time{}, err
 	}
+	s.trackTranscript(sessionID, cursor)
 
 	return eventsWritten, lastEventTime, nil
 }
@@ -124,7 +175,15 @@ func buildSessionEndEvent(event map[string]interface{}, sessionID, tool string,
 		data["tool_use_count"] = value
 	}
 	if len(data) == 0 {
-		return nil
+		// A SessionEnd hook always closes the session, even without counters.
+		if name, _ := event["hook_event_name"].(string); name != "SessionEnd" {
+			return nil
+		}
+		if reason, ok := event["reason"].(string); ok && reason != "" {
+			data["reason"] = reason
+		} else {
+			data["metadata"] = map[string]interface{}{}
+		}
 	}
 	return buildEvent("session_end", sessionID, tool, hookTimestamp(event, hookTime), data)
 }
@@ -151,7 +210,47 @@ func hookTimestamp(event map[string]interface{}, fallback time.Time) time.Time {
 	return fallback
 }
 
+// transcriptLineParser turns one line of a JSONL transcript into tabs events.
+type transcriptLineParser func(line []byte, sessionID string, fallback time.Time) ([]map[string]interface{}, time.Time, error)
+
+// transcriptAppender copies transcript entries the cursor has not seen yet
+// into the session file and advances the cursor past them.
+type transcriptAppender func(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error)
+
+// lineAppender adapts a JSONL line parser into a transcriptAppender that
+// tracks progress by byte offset and last line hash.
+func (s *Server) lineAppender(parse transcriptLineParser) transcriptAppender {
+	return func(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+		written, latest, newOffset, lastHash, err := s.appendTranscript(sessionPath, sessionID, cursor, hookTime, parse)
+		if err != nil {
+			return written, latest, err
+		}
+		if newOffset >= 0 {
+			cursor.LastOffset = newOffset
+		}
+		if lastHash != "" {
+			cursor.LastLineHash = lastHash
+		}
+		return written, latest, nil
+	}
+}
+
 func (s *Server) appendClaudeTranscript(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, int64, string, error) {
+	return s.appendTranscript(sessionPath, sessionID, cursor, hookTime, claudeEventsFromLine)
+}
+
+func (s *Server) appendTranscript(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time, parse transcriptLineParser) (int, time.Time, int64, string, error) {
+	router := s.newSidechainRouter(sessionPath, cursor)
+	written, latest, offset, lastHash, err := s.appendTranscriptWith(sessionPath, sessionID, cursor, hookTime, parse, router)
+	if flushErr := router.flush(); err == nil {
+		err = flushErr
+	}
+	return written, latest, offset, lastHash, err
+}
+
+// appendTranscriptWith reads transcript lines past the cursor's offset and
+// hands their events to router.
+func (s *Server) appendTranscriptWith(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time, parse transcriptLineParser, router *sidechainRouter) (int, time.Time, int64, string, error) {
 	if cursor == nil || cursor.TranscriptPath == "" {
 		return 0, time.Time{}, cursor.LastOffset, cursor.LastLineHash, nil
 	}
@@ -223,7 +322,8 @@ func (s *Server) appendClaudeTranscript(sessionPath, sessionID string, cursor *S
 			continue
 		}
 
-		events, lineTime, parseErr := claudeEventsFromLine(trimmed, sessionID, hookTime)
+		router.noteLine(trimmed)
+		events, lineTime, parseErr := parse(trimmed, sessionID, hookTime)
 		if parseErr != nil {
 			s.logger.Warn("failed to parse transcript line", "session_id", sessionID, "error", parseErr)
 			if errors.Is(err, io.EOF) {
@@ -234,11 +334,11 @@ func (s *Server) appendClaudeTranscript(sessionPath, sessionID string, cursor *S
 		lastEventTime = maxTime(lastEventTime, lineTime)
 
 		for _, event := range events {
-			wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+			n, wroteAt, err := router.write(sessionPath, cursor, event)
 			if err != nil {
 				return eventsWritten, lastEventTime, offset, lastHash, err
 			}
-			eventsWritten++
+			eventsWritten += n
 			lastEventTime = maxTime(lastEventTime, wroteAt)
 		}
 		if errors.Is(err, io.EOF) {
@@ -258,7 +358,9 @@ func claudeEventsFromLine(line []byte, sessionID string, fallback time.Time) ([]
 	ts := hookTimestamp(record, fallback)
 	events := []map[string]interface{}{}
 
-	if role := claudeRole(record); role != "" {
+	if eventType, data := claudeMarker(record); eventType != "" {
+		events = append(events, buildEvent(eventType, sessionID, "claude-code", ts, data))
+	} else if role := claudeRole(record); role != "" {
 		content := normalizeContent(extractMessageContent(record))
 		if len(content) > 0 {
 			data := map[string]interface{}{
@@ -282,9 +384,204 @@ func claudeEventsFromLine(line []byte, sessionID string, fallback time.Time) ([]
 		events = append(events, buildEvent("tool_result", sessionID, "claude-code", ts, toolResult))
 	}
 
+	if claudeRole(record) == "assistant" {
+		attachUsage(events, extractMessageUsage(record), extractMessageID(record), extractMessageModel(record))
+	}
+
+	// The Task result names the sub-agent whose transcript holds its work.
+	if agentID := toolUseResultAgentID(record); agentID != "" {
+		for _, event := range events {
+			if event["event_type"] == "tool_result" {
+				event["data"].(map[string]interface{})["agent_id"] = agentID
+			}
+		}
+	}
+
+	// Sub-agent records are routed to a child session by the writer.
+	if sidechain, _ := record["isSidechain"].(bool); sidechain {
+		ref := sidechainRef{
+			AgentID:    toStringValue(record["agentId"]),
+			UUID:       toStringValue(record["uuid"]),
+			ParentUUID: toStringValue(record["parentUuid"]),
+		}
+		if claudeRole(record) == "user" {
+			ref.Prompt = messageText(extractMessageContent(record))
+		}
+		for _, event := range events {
+			event[sidechainEventKey] = ref
+		}
+	}
+
 	return events, ts, nil
 }
 
+func toolUseResultAgentID(record map[string]interface{}) string {
+	result, ok := record["toolUseResult"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	agentID, _ := result["agentId"].(string)
+	return agentID
+}
+
+// extractMessageUsage returns message.usage from an assistant transcript
+// record, keeping only the token counters.
+func extractMessageUsage(record map[string]interface{}) map[string]interface{} {
+	message, ok := record["message"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	usage, ok := parseTokenUsage(message["usage"])
+	if !ok {
+		return nil
+	}
+	return usageMap(usage)
+}
+
+func extractMessageID(record map[string]interface{}) string {
+	if message, ok := record["message"].(map[string]interface{}); ok {
+		if id, ok := message["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// attachUsage records a turn's token usage on the first event built from it,
+// which is the message event unless the line only carried tool calls.
+func attachUsage(events []map[string]interface{}, usage map[string]interface{}, messageID, model string) {
+	if usage == nil || len(events) == 0 {
+		return
+	}
+	data, ok := events[0]["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	data["usage"] = usage
+	if messageID != "" {
+		data["message_id"] = messageID
+	}
+	if model != "" {
+		data["model"] = model
+	}
+}
+
+func usageMap(usage events.TokenUsage) map[string]interface{} {
+	return map[string]interface{}{
+		"input_tokens":                usage.InputTokens,
+		"output_tokens":               usage.OutputTokens,
+		"cache_creation_input_tokens": usage.CacheCreationInputTokens,
+		"cache_read_input_tokens":     usage.CacheReadInputTokens,
+	}
+}
+
+// attachSessionUsage copies the session's token totals and cost onto its
+// session_end event. Callers hold the session lock.
+func (s *Server) attachSessionUsage(event map[string]interface{}, cursor *SessionCursor) {
+	if cursor == nil || cursor.Metadata == nil || cursor.Metadata.Usage == nil {
+		return
+	}
+	data, ok := event["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	md := cursor.Metadata
+	data["usage"] = usageMap(*md.Usage)
+	byModel := make(map[string]interface{}, len(md.UsageByModel))
+	for model, usage := range md.UsageByModel {
+		byModel[model] = usageMap(usage)
+	}
+	data["usage_by_model"] = byModel
+	data["cost_usd"] = events.SessionCost(md.UsageByModel, s.pricing)
+}
+
+// claudeMarker maps transcript records that are not part of the dialogue
+// (titles, compaction boundaries and summaries, system notices, hook and
+// other injected context) to a typed event. It returns "" for dialogue
+// records and for records without text worth keeping.
+func claudeMarker(record map[string]interface{}) (string, map[string]interface{}) {
+	recordType, _ := record["type"].(string)
+	switch recordType {
+	case "summary":
+		summary, _ := record["summary"].(string)
+		if strings.TrimSpace(summary) == "" {
+			return "", nil
+		}
+		data := map[string]interface{}{"kind": "title", "summary": summary}
+		setIfNotEmpty(data, "leaf_uuid", toStringValue(record["leafUuid"]))
+		return "summary", data
+	case "system":
+		subtype, _ := record["subtype"].(string)
+		content := messageText(record["content"])
+		if subtype == "compact_boundary" {
+			data := map[string]interface{}{}
+			setIfNotEmpty(data, "content", content)
+			if meta, ok := record["compactMetadata"].(map[string]interface{}); ok {
+				setIfNotEmpty(data, "trigger", toStringValue(meta["trigger"]))
+				if tokens, ok := toInt(meta["preTokens"]); ok {
+					data["pre_tokens"] = tokens
+				}
+			}
+			return "compaction", data
+		}
+		if content == "" {
+			// Bookkeeping such as turn_duration carries no text.
+			return "", nil
+		}
+		data := map[string]interface{}{"content": content}
+		setIfNotEmpty(data, "subtype", subtype)
+		setIfNotEmpty(data, "level", toStringValue(record["level"]))
+		return "system_notice", data
+	case "attachment":
+		attachment, _ := record["attachment"].(map[string]interface{})
+		kind, _ := attachment["type"].(string)
+		content := attachmentText(attachment["content"])
+		if !strings.HasPrefix(kind, "hook") || content == "" {
+			return "", nil
+		}
+		data := map[string]interface{}{"subtype": kind, "content": content}
+		setIfNotEmpty(data, "hook_name", toStringValue(attachment["hookName"]))
+		setIfNotEmpty(data, "hook_event", toStringValue(attachment["hookEvent"]))
+		return "system_notice", data
+	case "user":
+		if compact, _ := record["isCompactSummary"].(bool); compact {
+			summary := messageText(extractMessageContent(record))
+			if summary == "" {
+				return "", nil
+			}
+			return "summary", map[string]interface{}{"kind": "compaction", "summary": summary}
+		}
+		if meta, _ := record["isMeta"].(bool); meta {
+			// Context Claude Code injects as a user turn (command caveats,
+			// hook output), not something the user typed.
+			content := messageText(extractMessageContent(record))
+			if content == "" {
+				return "", nil
+			}
+			return "system_notice", map[string]interface{}{"subtype": "meta", "content": content}
+		}
+	}
+	return "", nil
+}
+
+// attachmentText reads hook output, which is a string or a list of strings.
+func attachmentText(raw interface{}) string {
+	items, ok := raw.([]interface{})
+	if !ok {
+		return messageText(raw)
+	}
+	var texts []string
+	for _, item := range items {
+		if text, ok := item.(string); ok && strings.TrimSpace(text) != "" {
+			texts = append(texts, strings.TrimSpace(text))
+		}
+	}
+	if len(texts) == 0 {
+		return messageText(raw)
+	}
+	return strings.Join(texts, "\n")
+}
+
 func claudeRole(record map[string]interface{}) string {
 	if value, ok := record["type"].(string); ok {
 		switch value {
@@ -471,15 +768,27 @@ func buildEvent(eventType, sessionID, tool string, ts time.Time, data map[string
 }
 
 func (s *Server) appendEvent(sessionPath string, cursor *SessionCursor, event map[string]interface{}) (time.Time, error) {
+	s.redactor.RedactEvent(event)
 	eventJSON, err := json.Marshal(event)
 	if err != nil {
 		return time.Time{}, err
 	}
-	if _, err := appendJSONL(sessionPath, eventJSON); err != nil {
+	if err := recoverLastSeq(sessionPath, cursor); err != nil {
+		return time.Time{}, err
+	}
+	eventJSON, seq, err := stampEvent(cursor, event, eventJSON)
+	if err != nil {
 		return time.Time{}, err
 	}
+	if _, err := s.appendLine(sessionPath, cursor, eventJSON); err != nil {
+		return time.Time{}, err
+	}
+	cursor.LastSeq = seq
 	meta := extractEventMetadata(event)
 	updateCursorMetadata(cursor, meta, sessionPath)
+	if meta.EventType == "session_end" {
+		s.enqueueAutoPush(meta.SessionID, meta.Tool)
+	}
 	return meta.Timestamp, nil
 }
 
@@ -10,7 +10,6 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 )
 
@@ -34,6 +33,7 @@ func CleanupEmptySessions(baseDir string, retentionHours int) (int, error) {
 	}
 
 	deleted := 0
+	var removed []string
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -45,7 +45,7 @@ func CleanupEmptySessions(baseDir string, retentionHours int) (int, error) {
 		}
 
 		for _, file := range files {
-			if file.IsDir() || !strings.HasSuffix(file.Name(), ".jsonl") {
+			if file.IsDir() || !IsSessionFileName(file.Name()) {
 				continue
 			}
 			filePath := filepath.Join(dayDir, file.Name())
@@ -59,6 +59,7 @@ func CleanupEmptySessions(baseDir string, retentionHours int) (int, error) {
 			if isEmpty && !createdAt.IsZero() && createdAt.Before(cutoff) {
 				if err := os.Remove(filePath); err == nil {
 					deleted++
+					removed = append(removed, filePath)
 				}
 			}
 		}
@@ -70,13 +71,22 @@ func CleanupEmptySessions(baseDir string, retentionHours int) (int, error) {
 		}
 	}
 
+	if len(removed) > 0 {
+		if idx, ok, err := OpenSessionIndexIfExists(baseDir); err == nil && ok {
+			for _, path := range removed {
+				_ = idx.RemovePath(path)
+			}
+			idx.Close()
+		}
+	}
+
 	return deleted, nil
 }
 
 // isEmptySession checks if a session file has zero messages.
 // Returns (isEmpty, createdAt, error).
 func isEmptySession(path string) (bool, time.Time, error) {
-	file, err := os.Open(path)
+	file, err := OpenSessionFile(path)
 	if err != nil {
 		return false, time.Time{}, err
 	}
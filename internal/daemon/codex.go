@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const codexTool = "codex-cli"
+
+// codexCapturer tails OpenAI Codex CLI rollout files
+// (~/.codex/sessions/YYYY/MM/DD/rollout-*.jsonl). Codex has no session
+// hooks, so a notify wrapper is expected to send session_id and
+// transcript_path with each capture.
+type codexCapturer struct{}
+
+func (codexCapturer) Tool() string { return codexTool }
+
+func (c codexCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	return s.captureTranscript(capturePayload{Tool: c.Tool(), Event: event}, sessionID, hookTime, c.appender(s))
+}
+
+func (codexCapturer) appender(s *Server) transcriptAppender {
+	return s.lineAppender(codexEventsFromLine)
+}
+
+// codexEventsFromLine handles both rollout layouts: current files wrap each
+// item as {"timestamp", "type": "response_item", "payload": {...}}, older
+// ones write the response item directly.
+func codexEventsFromLine(line []byte, sessionID string, fallback time.Time) ([]map[string]interface{}, time.Time, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	ts := hookTimestamp(record, fallback)
+	item := record
+	if payload, ok := record["payload"].(map[string]interface{}); ok {
+		if recordType, _ := record["type"].(string); recordType != "response_item" {
+			return nil, ts, nil
+		}
+		item = payload
+	}
+
+	events := []map[string]interface{}{}
+	switch itemType, _ := item["type"].(string); itemType {
+	case "message":
+		role, _ := item["role"].(string)
+		if role != "user" && role != "assistant" {
+			break
+		}
+		content := codexContent(item["content"])
+		if len(content) == 0 {
+			break
+		}
+		data := map[string]interface{}{
+			"role":    role,
+			"content": content,
+		}
+		events = append(events, buildEvent("message", sessionID, codexTool, ts, data))
+	case "reasoning":
+		var content []map[string]interface{}
+		if summary, ok := item["summary"].([]interface{}); ok {
+			for _, part := range summary {
+				if block, ok := part.(map[string]interface{}); ok {
+					if text, _ := block["text"].(string); text != "" {
+						content = append(content, map[string]interface{}{"type": "thinking", "text": text})
+					}
+				}
+			}
+		}
+		if len(content) > 0 {
+			data := map[string]interface{}{
+				"role":    "assistant",
+				"content": content,
+			}
+			events = append(events, buildEvent("message", sessionID, codexTool, ts, data))
+		}
+	case "function_call", "custom_tool_call", "local_shell_call":
+		callID := toStringValue(item["call_id"])
+		name := toStringValue(item["name"])
+		if itemType == "local_shell_call" {
+			name = "shell"
+		}
+		if callID == "" || name == "" {
+			break
+		}
+		data := map[string]interface{}{
+			"tool_use_id": callID,
+			"tool_name":   name,
+			"input":       codexToolInput(item),
+		}
+		events = append(events, buildEvent("tool_use", sessionID, codexTool, ts, data))
+	case "function_call_output", "custom_tool_call_output":
+		callID := toStringValue(item["call_id"])
+		if callID == "" {
+			break
+		}
+		output, isError := codexToolOutput(item["output"])
+		data := map[string]interface{}{
+			"tool_use_id": callID,
+			"content":     output,
+			"is_error":    isError,
+		}
+		events = append(events, buildEvent("tool_result", sessionID, codexTool, ts, data))
+	}
+
+	return events, ts, nil
+}
+
+// codexContent keeps user and assistant text, dropping the environment and
+// instruction preambles Codex injects as user messages.
+func codexContent(raw interface{}) []map[string]interface{} {
+	parts, ok := raw.([]interface{})
+	if !ok {
+		return normalizeContent(raw)
+	}
+	content := make([]map[string]interface{}, 0, len(parts))
+	for _, part := range parts {
+		block, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch blockType, _ := block["type"].(string); blockType {
+		case "input_text", "output_text", "text":
+			text, _ := block["text"].(string)
+			if text == "" || strings.HasPrefix(text, "<environment_context>") || strings.HasPrefix(text, "<user_instructions>") {
+				continue
+			}
+			content = append(content, map[string]interface{}{"type": "text", "text": text})
+		}
+	}
+	return content
+}
+
+func codexToolInput(item map[string]interface{}) map[string]interface{} {
+	switch value := item["arguments"].(type) {
+	case string:
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &args); err == nil {
+			return args
+		}
+		return map[string]interface{}{"arguments": value}
+	case map[string]interface{}:
+		return value
+	}
+	if action, ok := item["action"].(map[string]interface{}); ok {
+		return action
+	}
+	if input, ok := item["input"].(string); ok {
+		return map[string]interface{}{"input": input}
+	}
+	return map[string]interface{}{}
+}
+
+// codexToolOutput unwraps the {"output": ..., "metadata": {"exit_code": n}}
+// envelope shell calls report, treating a non-zero exit code as an error.
+func codexToolOutput(raw interface{}) (interface{}, bool) {
+	text, ok := raw.(string)
+	if !ok {
+		return raw, false
+	}
+	var envelope struct {
+		Output   interface{} `json:"output"`
+		Metadata struct {
+			ExitCode *int `json:"exit_code"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(text), &envelope); err != nil || envelope.Output == nil {
+		return text, false
+	}
+	isError := envelope.Metadata.ExitCode != nil && *envelope.Metadata.ExitCode != 0
+	return envelope.Output, isError
+}
@@ -0,0 +1,637 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+// Encrypted files use envelope encryption. The first line is a JSON header
+// carrying a random per-file data key wrapped with the master key; every
+// following line is one AES-256-GCM sealed JSONL line, base64 encoded, so
+// files stay appendable line by line. Plaintext and encrypted files can sit
+// side by side: readers tell them apart by the header.
+const (
+	encryptionVersion = "v1"
+	encryptionMarker  = `{"tabs_encryption":`
+
+	keyFileVersion = 1
+	argonTime      = 3
+	argonMemoryKiB = 64 * 1024
+	argonThreads   = 4
+)
+
+var (
+	errNoEncryptionKey = errors.New("session file is encrypted but no encryption key is loaded")
+	dataKeyAAD         = []byte("tabs data key")
+	lineAAD            = []byte("tabs session line")
+)
+
+type encryptionHeader struct {
+	Version string `json:"tabs_encryption"`
+	KeyID   string `json:"key_id"`
+	DataKey string `json:"data_key"` // nonce || sealed data key, base64
+}
+
+// keyFile is the on-disk form of the master key. With a passphrase only the
+// KDF parameters are stored, and KeyID lets a wrong passphrase be told apart
+// from a damaged file.
+type keyFile struct {
+	Version   int    `json:"version"`
+	Key       string `json:"key,omitempty"`
+	KDF       string `json:"kdf,omitempty"`
+	Salt      string `json:"salt,omitempty"`
+	Time      uint32 `json:"time,omitempty"`
+	MemoryKiB uint32 `json:"memory_kib,omitempty"`
+	Threads   uint8  `json:"threads,omitempty"`
+	KeyID     string `json:"key_id"`
+}
+
+// sessionCrypt is the process-wide encryption state. Session files are read
+// from several places (daemon, push, local UI), all through OpenSessionFile,
+// so the key is configured once per process rather than threaded through.
+type sessionCrypt struct {
+	mu      sync.RWMutex
+	enabled bool   // encrypt new session files and cursor state
+	key     []byte // master key; nil when none is loaded
+	keyID   string
+}
+
+var crypt sessionCrypt
+
+// ConfigureEncryption loads the master key for this process. The key is
+// loaded whenever the key file exists, so encrypted files stay readable after
+// encryption is switched off. A key that cannot be loaded leaves the previous
+// state in place: a running daemon keeps writing with the key it has rather
+// than being left enabled with none, and a starting one refuses to run.
+func ConfigureEncryption(baseDir string, cfg config.EncryptionConfig) error {
+	key, keyID, err := loadMasterKey(baseDir, cfg)
+	if err != nil && !(os.IsNotExist(err) && !cfg.Enabled) {
+		return err
+	}
+	crypt.mu.Lock()
+	defer crypt.mu.Unlock()
+	crypt.enabled = cfg.Enabled
+	crypt.key = key
+	crypt.keyID = keyID
+	return nil
+}
+
+// setEncryptionEnabled switches encryption of new files on or off and keeps
+// the loaded key, so files already encrypted stay readable.
+func setEncryptionEnabled(enabled bool) {
+	crypt.mu.Lock()
+	defer crypt.mu.Unlock()
+	crypt.enabled = enabled
+}
+
+// EncryptionEnabled reports whether new files are encrypted.
+func EncryptionEnabled() bool {
+	crypt.mu.RLock()
+	defer crypt.mu.RUnlock()
+	return crypt.enabled
+}
+
+// KeyFilePath resolves the configured key file, defaulting to
+// <baseDir>/keyfile.
+func KeyFilePath(baseDir string, cfg config.EncryptionConfig) string {
+	if cfg.KeyFile != "" {
+		return config.ExpandHome(cfg.KeyFile)
+	}
+	return filepath.Join(baseDir, "keyfile")
+}
+
+// CreateKeyFile writes a new key file unless one exists. Without a
+// passphrase it holds a random 256-bit key; with one, an Argon2id salt.
+func CreateKeyFile(baseDir string, cfg config.EncryptionConfig) (bool, error) {
+	path := KeyFilePath(baseDir, cfg)
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	kf := keyFile{Version: keyFileVersion}
+	var key []byte
+	if cfg.PassphraseEnv != "" {
+		passphrase := os.Getenv(cfg.PassphraseEnv)
+		if passphrase == "" {
+			return false, fmt.Errorf("%s is not set", cfg.PassphraseEnv)
+		}
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return false, err
+		}
+		kf.KDF = "argon2id"
+		kf.Salt = base64.StdEncoding.EncodeToString(salt)
+		kf.Time, kf.MemoryKiB, kf.Threads = argonTime, argonMemoryKiB, argonThreads
+		key = argon2.IDKey([]byte(passphrase), salt, kf.Time, kf.MemoryKiB, kf.Threads, 32)
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return false, err
+		}
+		kf.Key = base64.StdEncoding.EncodeToString(key)
+	}
+	kf.KeyID = masterKeyID(key)
+	data, err := json.Marshal(kf)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return false, err
+	}
+	return true, file.Sync()
+}
+
+func loadMasterKey(baseDir string, cfg config.EncryptionConfig) ([]byte, string, error) {
+	path := KeyFilePath(baseDir, cfg)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, "", fmt.Errorf("read key file %s: %w", path, err)
+	}
+	var key []byte
+	switch kf.KDF {
+	case "":
+		key, err = base64.StdEncoding.DecodeString(kf.Key)
+		if err != nil || len(key) != 32 {
+			return nil, "", fmt.Errorf("key file %s does not hold a 256-bit key", path)
+		}
+	case "argon2id":
+		if cfg.PassphraseEnv == "" {
+			return nil, "", fmt.Errorf("key file %s needs a passphrase; set encryption.passphrase_env", path)
+		}
+		passphrase := os.Getenv(cfg.PassphraseEnv)
+		if passphrase == "" {
+			return nil, "", fmt.Errorf("%s is not set", cfg.PassphraseEnv)
+		}
+		salt, err := base64.StdEncoding.DecodeString(kf.Salt)
+		if err != nil {
+			return nil, "", fmt.Errorf("key file %s has an invalid salt", path)
+		}
+		key = argon2.IDKey([]byte(passphrase), salt, kf.Time, kf.MemoryKiB, kf.Threads, 32)
+	default:
+		return nil, "", fmt.Errorf("key file %s uses unknown kdf %q", path, kf.KDF)
+	}
+	keyID := masterKeyID(key)
+	if kf.KeyID != "" && kf.KeyID != keyID {
+		return nil, "", errors.New("encryption passphrase does not match the key file")
+	}
+	return key, keyID, nil
+}
+
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("tabs key id"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// currentKey returns the master key for writing, and whether new files
+// should be encrypted at all.
+func currentKey() (key []byte, keyID string, enabled bool) {
+	crypt.mu.RLock()
+	defer crypt.mu.RUnlock()
+	return crypt.key, crypt.keyID, crypt.enabled
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func unseal(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newEncryptionHeader creates a data key for a new file and returns the
+// header line (with newline) and the data key.
+func newEncryptionHeader() ([]byte, []byte, error) {
+	key, keyID, _ := currentKey()
+	if key == nil {
+		return nil, nil, errors.New("encryption is enabled but no encryption key is loaded")
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := seal(key, dataKey, dataKeyAAD)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := json.Marshal(encryptionHeader{
+		Version: encryptionVersion,
+		KeyID:   keyID,
+		DataKey: base64.StdEncoding.EncodeToString(wrapped),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(header, '\n'), dataKey, nil
+}
+
+func isEncryptionHeader(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(line), []byte(encryptionMarker))
+}
+
+// openEncryptionHeader unwraps the data key of an encrypted file.
+func openEncryptionHeader(line []byte) ([]byte, error) {
+	var header encryptionHeader
+	if err := json.Unmarshal(bytes.TrimSpace(line), &header); err != nil {
+		return nil, fmt.Errorf("decode encryption header: %w", err)
+	}
+	if header.Version != encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %q", header.Version)
+	}
+	key, keyID, _ := currentKey()
+	if key == nil {
+		return nil, errNoEncryptionKey
+	}
+	if header.KeyID != keyID {
+		return nil, fmt.Errorf("session file was encrypted with key %s, loaded key is %s", header.KeyID, keyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(header.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %w", err)
+	}
+	dataKey, err := unseal(key, wrapped, dataKeyAAD)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// sealLine encrypts one JSONL line (without its newline) and returns the
+// encoded line with a newline.
+func sealLine(dataKey, line []byte) ([]byte, error) {
+	sealed, err := seal(dataKey, bytes.TrimRight(line, "\n"), lineAAD)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(sealed))+1)
+	base64.StdEncoding.Encode(out, sealed)
+	out[len(out)-1] = '\n'
+	return out, nil
+}
+
+func openLine(dataKey, line []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return nil, err
+	}
+	return unseal(dataKey, sealed, lineAAD)
+}
+
+// decryptSessionReader returns a reader yielding plaintext JSONL for r,
+// which may be plaintext or encrypted. Lines that fail to decrypt, such as a
+// torn final line, are dropped the way readers drop unparseable JSON.
+func decryptSessionReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	first, err := br.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !isEncryptionHeader(first) {
+		return io.MultiReader(bytes.NewReader(first), br), nil
+	}
+	dataKey, err := openEncryptionHeader(first)
+	if err != nil {
+		return nil, err
+	}
+	return &lineDecrypter{src: br, dataKey: dataKey}, nil
+}
+
+type lineDecrypter struct {
+	src     *bufio.Reader
+	dataKey []byte
+	buf     []byte
+	done    bool
+}
+
+func (d *lineDecrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		line, err := d.src.ReadBytes('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			d.done = true
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		plain, openErr := openLine(d.dataKey, line)
+		if openErr != nil {
+			continue
+		}
+		d.buf = append(plain, '\n')
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// appendSessionLine writes line to an open session file, encrypting it when
+// the file is encrypted or is new while encryption is enabled. Plaintext
+// files written before encryption was enabled stay plaintext until
+// `tabs-cli encrypt-existing` migrates them. The caller holds the file lock.
+func appendSessionLine(file *os.File, line []byte) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	var dataKey []byte
+	if info.Size() == 0 {
+		if _, _, enabled := currentKey(); enabled {
+			header, key, err := newEncryptionHeader()
+			if err != nil {
+				return err
+			}
+			if _, err := file.Write(header); err != nil {
+				return err
+			}
+			dataKey = key
+		}
+	} else {
+		first, err := readFirstLine(file)
+		if err != nil {
+			return err
+		}
+		if isEncryptionHeader(first) {
+			if dataKey, err = openEncryptionHeader(first); err != nil {
+				return err
+			}
+		}
+	}
+	if dataKey != nil {
+		if line, err = sealLine(dataKey, line); err != nil {
+			return err
+		}
+	}
+	_, err = file.Write(ensureNewline(line))
+	return err
+}
+
+func readFirstLine(file *os.File) ([]byte, error) {
+	buf := make([]byte, 512)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	}
+	return buf, nil
+}
+
+// sealDocument encrypts a whole small file, such as cursor state, in the
+// same header-plus-line format. Without encryption enabled it returns data
+// unchanged.
+func sealDocument(data []byte) ([]byte, error) {
+	if _, _, enabled := currentKey(); !enabled {
+		return data, nil
+	}
+	header, dataKey, err := newEncryptionHeader()
+	if err != nil {
+		return nil, err
+	}
+	line, err := sealLine(dataKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, line...), nil
+}
+
+// openDocument reverses sealDocument; plaintext passes through.
+func openDocument(data []byte) ([]byte, error) {
+	if !isEncryptionHeader(data) {
+		return data, nil
+	}
+	header, rest, _ := bytes.Cut(data, []byte{'\n'})
+	dataKey, err := openEncryptionHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	return openLine(dataKey, rest)
+}
+
+// EncryptResult reports an encrypt-existing migration.
+type EncryptResult struct {
+	SessionFiles     int `json:"session_files"`
+	CursorFiles      int `json:"cursor_files"`
+	AlreadyEncrypted int `json:"already_encrypted"`
+}
+
+// EncryptExisting rewrites plaintext session files (live and archived) and
+// cursor state in encrypted form. Each file is rewritten under its session
+// lock through a temporary file and a rename, so captures never see a
+// half-written file.
+func (s *Server) EncryptExisting() (EncryptResult, error) {
+	var result EncryptResult
+	if key, _, enabled := currentKey(); !enabled || key == nil {
+		return result, errors.New("encryption is not enabled or no key is loaded")
+	}
+
+	days, err := os.ReadDir(SessionsDir(s.baseDir))
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(s.baseDir), day.Name())
+		files, err := os.ReadDir(dayDir)
+		if err != nil {
+			return result, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !IsSessionFileName(file.Name()) {
+				continue
+			}
+			encrypted, err := s.encryptSessionFile(filepath.Join(dayDir, file.Name()), sessionIDFromFileName(file.Name()))
+			if err != nil {
+				return result, err
+			}
+			if encrypted {
+				result.SessionFiles++
+			} else {
+				result.AlreadyEncrypted++
+			}
+		}
+	}
+
+	ids, err := listCursorSessions(s.baseDir)
+	if err != nil {
+		return result, err
+	}
+	for _, id := range ids {
+		encrypted, err := s.encryptCursorFile(cursorStatePath(s.baseDir, id), id)
+		if err != nil {
+			return result, err
+		}
+		if encrypted {
+			result.CursorFiles++
+		} else {
+			result.AlreadyEncrypted++
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) encryptSessionFile(path, sessionID string) (bool, error) {
+	defer s.lockSession(sessionID)()
+
+	archived := isArchivedSessionFile(path)
+	first, err := peekSessionHeader(path, archived)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if isEncryptionHeader(first) {
+		return false, nil
+	}
+	err = rewriteFile(path, path, func(dst io.Writer, src io.Reader) error {
+		var zw *gzip.Writer
+		if archived {
+			zr, err := gzip.NewReader(src)
+			if err != nil {
+				return err
+			}
+			defer zr.Close()
+			src = zr
+			zw = gzip.NewWriter(dst)
+			dst = zw
+		}
+		header, dataKey, err := newEncryptionHeader()
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(header); err != nil {
+			return err
+		}
+		reader := bufio.NewReader(src)
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				sealed, err := sealLine(dataKey, line)
+				if err != nil {
+					return err
+				}
+				if _, err := dst.Write(sealed); err != nil {
+					return err
+				}
+			}
+			if readErr != nil {
+				if errors.Is(readErr, io.EOF) {
+					break
+				}
+				return readErr
+			}
+		}
+		if zw != nil {
+			return zw.Close()
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+// peekSessionHeader returns the first line of a session file, decompressing
+// archived files.
+func peekSessionHeader(path string, archived bool) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var src io.Reader = file
+	if archived {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+	line, err := bufio.NewReader(src).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return line, nil
+}
+
+// encryptCursorFile seals a cursor file as it is, without re-saving it
+// through saveCursorState: that would bump UpdatedAt, which startup
+// reconciliation compares against transcript mtimes.
+func (s *Server) encryptCursorFile(path, sessionID string) (bool, error) {
+	defer s.lockSession(sessionID)()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if isEncryptionHeader(data) {
+		return false, nil
+	}
+	sealed, err := sealDocument(data)
+	if err != nil {
+		return false, err
+	}
+	return true, writeFileAtomic(path, sealed, 0o600)
+}
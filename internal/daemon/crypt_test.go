@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func enableTestEncryption(t *testing.T, baseDir string, cfg config.EncryptionConfig) {
+	t.Helper()
+	cfg.Enabled = true
+	if _, err := CreateKeyFile(baseDir, cfg); err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	if err := ConfigureEncryption(baseDir, cfg); err != nil {
+		t.Fatalf("configure encryption: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = ConfigureEncryption(t.TempDir(), config.EncryptionConfig{})
+	})
+}
+
+func TestEncryptExistingAndAppend(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "6f708192-0000-4000-8000-000000000001"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	if err := os.WriteFile(transcriptPath, []byte(`{"type":"user","message":{"role":"user","content":"the plaintext prompt"},"timestamp":"2026-01-01T12:00:00Z"}`+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "UserPromptSubmit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+
+	enableTestEncryption(t, baseDir, config.EncryptionConfig{})
+	result, err := srv.EncryptExisting()
+	if err != nil {
+		t.Fatalf("encrypt existing: %v", err)
+	}
+	if result.SessionFiles != 1 || result.CursorFiles != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if again, err := srv.EncryptExisting(); err != nil || again.AlreadyEncrypted != 2 || again.SessionFiles != 0 {
+		t.Fatalf("second run should skip encrypted files: %+v err=%v", again, err)
+	}
+
+	file, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	_, _ = file.WriteString(`{"type":"user","message":{"role":"user","content":"a later secret"},"timestamp":"2026-01-01T12:05:00Z"}` + "\n")
+	file.Close()
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture after encryption: %v", err)
+	}
+
+	for _, raw := range []string{path, cursorStatePath(baseDir, sessionID)} {
+		data, err := os.ReadFile(raw)
+		if err != nil {
+			t.Fatalf("read %s: %v", raw, err)
+		}
+		if !isEncryptionHeader(data) || bytes.Contains(data, []byte("plaintext prompt")) || bytes.Contains(data, []byte("later secret")) {
+			t.Fatalf("%s is not encrypted:\n%s", raw, data)
+		}
+	}
+	if got := eventTypes(readEvents(t, path)); got != "session_start,message,hook,message,hook" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	cursor, err := loadCursorState(baseDir, sessionID)
+	if err != nil || cursor.Metadata == nil || cursor.Metadata.MessageCount != 2 {
+		t.Fatalf("cursor state unreadable: %+v err=%v", cursor, err)
+	}
+
+	// Archiving keeps the encrypted lines and readers still decrypt them.
+	archived, err := compressSessionFile(path)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	md, err := ReplaySessionMetadata(archived)
+	if err != nil || md.MessageCount != 2 {
+		t.Fatalf("replay archived: %+v err=%v", md, err)
+	}
+
+	// Without the key, reads fail instead of returning ciphertext.
+	_ = ConfigureEncryption(t.TempDir(), config.EncryptionConfig{})
+	if _, err := ReplaySessionMetadata(archived); err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Fatalf("expected a missing key error, got %v", err)
+	}
+}
+
+func TestEncryptionFailsClosedWithoutKey(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("TABS_TEST_PASSPHRASE", "correct horse")
+	cfg := config.EncryptionConfig{PassphraseEnv: "TABS_TEST_PASSPHRASE"}
+	enableTestEncryption(t, baseDir, cfg)
+	path := filepath.Join(baseDir, "session.jsonl")
+	if _, err := appendJSONL(path, []byte(`{"event_type":"message"}`), config.FsyncAlways); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	// A key that cannot be loaded keeps the one already in use.
+	t.Setenv("TABS_TEST_PASSPHRASE", "wrong horse")
+	cfg.Enabled = true
+	if err := ConfigureEncryption(baseDir, cfg); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a passphrase mismatch, got %v", err)
+	}
+	if !EncryptionEnabled() {
+		t.Fatalf("expected encryption to stay enabled")
+	}
+	if _, err := appendJSONL(path, []byte(`{"event_type":"message"}`), config.FsyncAlways); err != nil {
+		t.Fatalf("expected appends to keep the loaded key: %v", err)
+	}
+
+	// A process that never loaded the key cannot append to encrypted files.
+	_ = ConfigureEncryption(t.TempDir(), config.EncryptionConfig{})
+	if _, err := appendJSONL(path, []byte(`{"event_type":"message"}`), config.FsyncAlways); err == nil {
+		t.Fatalf("expected appends to encrypted files to be refused without a key")
+	}
+}
+
+func TestConfigureAppliesEncryptionAndPrivacyDespiteRedactionError(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	cfg := config.Default()
+	cfg.Encryption = config.EncryptionConfig{Enabled: true}
+	if _, err := CreateKeyFile(baseDir, cfg.Encryption); err != nil {
+		t.Fatalf("create key file: %v", err)
+	}
+	t.Cleanup(func() { _ = ConfigureEncryption(t.TempDir(), config.EncryptionConfig{}) })
+	cfg.Privacy.IgnoreCwds = []string{"/work/private"}
+	cfg.Redaction = config.RedactionConfig{Enabled: true, Patterns: []string{"(unclosed"}}
+
+	if err := srv.Configure(cfg); err == nil || !strings.Contains(err.Error(), "redaction") {
+		t.Fatalf("expected a redaction error, got %v", err)
+	}
+	if !EncryptionEnabled() {
+		t.Fatalf("expected encryption to be applied")
+	}
+	if !srv.privacy.ignores("7a8b9c0d-0000-4000-8000-000000000009", "claude-code", "/work/private/api") {
+		t.Fatalf("expected privacy rules to be applied")
+	}
+
+	// A key that cannot be loaded is an error too.
+	cfg.Redaction = config.RedactionConfig{}
+	cfg.Encryption = config.EncryptionConfig{Enabled: true, PassphraseEnv: "TABS_TEST_UNSET_PASSPHRASE", KeyFile: filepath.Join(t.TempDir(), "missing")}
+	if err := srv.Configure(cfg); err == nil || !strings.Contains(err.Error(), "encryption") {
+		t.Fatalf("expected an encryption error, got %v", err)
+	}
+}
@@ -34,14 +34,10 @@ func StartCursorPoller(ctx context.Context, srv *Server, cfg config.Config) {
 		interval = 2 * time.Second
 	}
 
-	srv.mu.Lock()
 	srv.state.SetCursorPolling(true)
-	srv.mu.Unlock()
 	go func() {
 		defer func() {
-			srv.mu.Lock()
 			srv.state.SetCursorPolling(false)
-			srv.mu.Unlock()
 		}()
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -60,8 +56,7 @@ func StartCursorPoller(ctx context.Context, srv *Server, cfg config.Config) {
 }
 
 func (s *Server) captureCursor(req capturePayload, sessionID string, hookTime time.Time) (int, time.Time, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockSession(sessionID)()
 
 	cursor, err := loadCursorState(s.baseDir, sessionID)
 	if err != nil {
@@ -81,19 +76,23 @@ func (s *Server) captureCursor(req capturePayload, sessionID string, hookTime ti
 	lastEventTime := time.Time{}
 	hookEvent := extractCursorHookEvent(req.Event)
 
-	if hookEvent == "beforeSubmitPrompt" {
+	// Files attached to a prompt are read before beforeSubmitPrompt fires, so
+	// any hook but stop may open the session.
+	if hookEvent == "beforeSubmitPrompt" || cursorToolHooks[hookEvent] {
 		if needsSessionStart(cursor) {
 			start := buildCursorSessionStart(req.Event, sessionID, hookTime)
 			if start != nil {
-				wroteAt, err := s.appendEvent(sessionPath, cursor, start)
+				written, wroteAt, err := s.appendBoundaryEvent(sessionPath, cursor, start)
 				if err != nil {
 					return eventsWritten, lastEventTime, err
 				}
-				eventsWritten++
+				eventsWritten += written
 				lastEventTime = maxTime(lastEventTime, wroteAt)
 			}
 		}
+	}
 
+	if hookEvent == "beforeSubmitPrompt" {
 		if prompt, ok := req.Event["prompt"].(string); ok && strings.TrimSpace(prompt) != "" {
 			msg := buildCursorMessage(sessionID, hookTime, "user", prompt)
 			wroteAt, err := s.appendEvent(sessionPath, cursor, msg)
@@ -102,24 +101,37 @@ func (s *Server) captureCursor(req capturePayload, sessionID string, hookTime ti
 			}
 			eventsWritten++
 			lastEventTime = maxTime(lastEventTime, wroteAt)
+			composerState(cursor).notePrompt(prompt)
+		}
+	}
+
+	if cursorToolHooks[hookEvent] {
+		composerState(cursor).HookTools = true
+	}
+	for _, event := range cursorToolEvents(hookEvent, req.Event, sessionID, hookTime) {
+		wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+		if err != nil {
+			return eventsWritten, lastEventTime, err
 		}
+		eventsWritten++
+		lastEventTime = maxTime(lastEventTime, wroteAt)
 	}
 
 	if hookEvent == "stop" {
 		if cursor.Metadata == nil || cursor.Metadata.EndedAt == "" {
 			end := buildCursorSessionEnd(req.Event, sessionID, hookTime)
 			if end != nil {
-				wroteAt, err := s.appendEvent(sessionPath, cursor, end)
+				written, wroteAt, err := s.appendBoundaryEvent(sessionPath, cursor, end)
 				if err != nil {
 					return eventsWritten, lastEventTime, err
 				}
-				eventsWritten++
+				eventsWritten += written
 				lastEventTime = maxTime(lastEventTime, wroteAt)
 			}
 		}
 	}
 
-	if err := saveCursorState(s.baseDir, cursor); err != nil {
+	if err := s.saveCursor(cursor); err != nil {
 		return eventsWritten, lastEventTime, err
 	}
 
@@ -178,6 +190,20 @@ func (s *Server) pollCursorDB(path string) error {
 	}
 	defer db.Close()
 
+	tables, err := cursorTables(db)
+	if err != nil {
+		return fmt.Errorf("query cursor db: %w", err)
+	}
+	if tables["cursorDiskKV"] {
+		if err := s.pollCursorComposers(db, path); err != nil {
+			return fmt.Errorf("query cursor composers: %w", err)
+		}
+	}
+	if !tables["ItemTable"] {
+		return nil
+	}
+
+	// Older versions keep a single chat blob in ItemTable.
 	rows, err := db.Query(`SELECT value FROM ItemTable WHERE [key] = 'workbench.panel.aichat.view.aichat.chatdata'`)
 	if err != nil {
 		return fmt.Errorf("query cursor db: %w", err)
@@ -201,13 +227,35 @@ func (s *Server) pollCursorDB(path string) error {
 	return nil
 }
 
+func cursorTables(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name IN ('ItemTable', 'cursorDiskKV')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			tables[name] = true
+		}
+	}
+	return tables, rows.Err()
+}
+
+func composerState(cursor *SessionCursor) *ComposerState {
+	if cursor.Composer == nil {
+		cursor.Composer = &ComposerState{}
+	}
+	return cursor.Composer
+}
+
 func (s *Server) processCursorConversation(conv cursorConversation) {
 	if conv.ID == "" {
 		return
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lockSession(conv.ID)()
 
 	cursor, err := loadCursorState(s.baseDir, conv.ID)
 	if err != nil {
@@ -221,6 +269,15 @@ func (s *Server) processCursorConversation(conv cursorConversation) {
 	if len(conv.Messages) == 0 {
 		return
 	}
+	cwd := ""
+	if len(conv.WorkspaceRoots) > 0 {
+		cwd = conv.WorkspaceRoots[0]
+	} else if cursor.Metadata != nil {
+		cwd = cursor.Metadata.Cwd
+	}
+	if s.suppressSession(conv.ID, "cursor", cwd) || s.privacy.unknownCwdSuppressed(cwd) {
+		return
+	}
 
 	if needsSessionStart(cursor) {
 		data := map[string]interface{}{}
@@ -231,8 +288,8 @@ func (s *Server) processCursorConversation(conv cursorConversation) {
 		}
 		start := buildEvent("session_start", conv.ID, "cursor", time.Now().UTC(), data)
 		if sessionPath, err := s.state.EnsureSessionFile(s.baseDir, conv.ID, "cursor", time.Now().UTC()); err == nil {
-			if _, err := s.appendEvent(sessionPath, cursor, start); err == nil {
-				s.state.RecordEvent(conv.ID, time.Now().UTC(), 1)
+			if written, _, err := s.appendBoundaryEvent(sessionPath, cursor, start); err == nil {
+				s.state.RecordEvent(conv.ID, time.Now().UTC(), written)
 			}
 		}
 	}
@@ -271,7 +328,7 @@ func (s *Server) processCursorConversation(conv cursorConversation) {
 	}
 
 	if written > 0 {
-		_ = saveCursorState(s.baseDir, cursor)
+		_ = s.saveCursor(cursor)
 		s.state.RecordEvent(conv.ID, lastEventTime, written)
 	}
 }
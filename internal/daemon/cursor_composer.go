@@ -0,0 +1,527 @@
+package daemon
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ComposerState tracks how far a Cursor composer conversation has been
+// copied. The composer's lastUpdatedAt is the change marker: a composer whose
+// marker has not moved is skipped without reading its bubbles.
+type ComposerState struct {
+	UpdatedAt  int64    `json:"updated_at,omitempty"`  // lastUpdatedAt of the last fully copied version
+	Consumed   int      `json:"consumed,omitempty"`    // conversation bubbles copied
+	LastBubble string   `json:"last_bubble,omitempty"` // id of the last copied bubble
+	Prompts    []string `json:"prompts,omitempty"`     // hashes of prompts already written by beforeSubmitPrompt
+	HookTools  bool     `json:"hook_tools,omitempty"`  // tool hooks reported calls for this conversation
+}
+
+const maxComposerPrompts = 20
+
+// cursorHookToolNames are the composer tools that Cursor's tool hooks
+// already report. Once a conversation has sent tool hooks, the poller skips
+// these so each call is written once.
+var cursorHookToolNames = map[string]bool{
+	"run_terminal_cmd": true,
+	"read_file":        true,
+	"edit_file":        true,
+	"search_replace":   true,
+}
+
+type cursorComposer struct {
+	ComposerID    string          `json:"composerId"`
+	CreatedAt     int64           `json:"createdAt"`
+	LastUpdatedAt int64           `json:"lastUpdatedAt"`
+	Status        string          `json:"status"`
+	Headers       []cursorHeader  `json:"fullConversationHeadersOnly"`
+	Conversation  []cursorBubble  `json:"conversation"` // bubbles stored inline by older versions
+	ModelConfig   cursorModelInfo `json:"modelConfig"`
+	Workspace     string          `json:"-"` // folder of the Cursor workspace that owns the composer
+}
+
+type cursorHeader struct {
+	BubbleID string `json:"bubbleId"`
+	Type     int    `json:"type"`
+}
+
+type cursorModelInfo struct {
+	ModelName string `json:"modelName"`
+}
+
+type cursorBubble struct {
+	BubbleID   string          `json:"bubbleId"`
+	Type       int             `json:"type"` // 1 user, 2 assistant
+	Text       string          `json:"text"`
+	CreatedAt  string          `json:"createdAt"`
+	ModelInfo  cursorModelInfo `json:"modelInfo"`
+	TimingInfo struct {
+		ClientStartTime float64 `json:"clientStartTime"`
+	} `json:"timingInfo"`
+	Thinking *struct {
+		Text string `json:"text"`
+	} `json:"thinking"`
+	CodeBlocks []struct {
+		Content    string                 `json:"content"`
+		LanguageID string                 `json:"languageId"`
+		URI        map[string]interface{} `json:"uri"`
+	} `json:"codeBlocks"`
+	ToolFormerData *struct {
+		ToolCallID string `json:"toolCallId"`
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		RawArgs    string `json:"rawArgs"`
+		Result     string `json:"result"`
+	} `json:"toolFormerData"`
+}
+
+// pollCursorComposers copies new bubbles of every composer whose
+// lastUpdatedAt moved since the last poll. Composer ids are the
+// conversation_id Cursor hooks send, so both land in the same session.
+// dbPath locates the workspace storage that maps composers to folders.
+func (s *Server) pollCursorComposers(db *sql.DB, dbPath string) error {
+	rows, err := db.Query(`
+		SELECT substr(key, 14),
+			CASE WHEN json_valid(CAST(value AS TEXT))
+				THEN COALESCE(json_extract(CAST(value AS TEXT), '$.lastUpdatedAt'), json_extract(CAST(value AS TEXT), '$.createdAt'), 0)
+				ELSE 0 END
+		FROM cursorDiskKV WHERE key LIKE 'composerData:%'`)
+	if err != nil {
+		return err
+	}
+	markers := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var marker int64
+		if err := rows.Scan(&id, &marker); err != nil || id == "" {
+			continue
+		}
+		markers[id] = marker
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	var workspaces map[string]string
+	for id, marker := range markers {
+		if !s.composerChanged(id, marker) {
+			continue
+		}
+		if workspaces == nil {
+			workspaces = cursorComposerWorkspaces(dbPath)
+		}
+		var raw []byte
+		if err := db.QueryRow(`SELECT value FROM cursorDiskKV WHERE key = ?`, "composerData:"+id).Scan(&raw); err != nil {
+			continue
+		}
+		var composer cursorComposer
+		if err := json.Unmarshal(raw, &composer); err != nil {
+			continue
+		}
+		composer.ComposerID = id
+		composer.Workspace = workspaces[id]
+		if err := s.processCursorComposer(db, composer, marker); err != nil {
+			s.logger.Warn("cursor composer copy failed", "session_id", id, "error", err)
+		}
+	}
+	return nil
+}
+
+// cursorComposerWorkspaces maps composer ids to the folder of the workspace
+// they were started in. Cursor keeps one directory per workspace under
+// workspaceStorage, next to the globalStorage directory of dbPath: its
+// workspace.json names the folder and its state.vscdb lists the workspace's
+// composers. Multi-root workspaces name no single folder and are skipped.
+func cursorComposerWorkspaces(dbPath string) map[string]string {
+	workspaces := make(map[string]string)
+	root := filepath.Join(filepath.Dir(filepath.Dir(dbPath)), "workspaceStorage")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return workspaces
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		folder := cursorWorkspaceFolder(filepath.Join(dir, "workspace.json"))
+		if folder == "" {
+			continue
+		}
+		ids, err := cursorWorkspaceComposers(filepath.Join(dir, "state.vscdb"))
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			workspaces[id] = folder
+		}
+	}
+	return workspaces
+}
+
+func cursorWorkspaceFolder(path string) string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var workspace struct {
+		Folder string `json:"folder"`
+	}
+	if err := json.Unmarshal(raw, &workspace); err != nil || workspace.Folder == "" {
+		return ""
+	}
+	u, err := url.Parse(workspace.Folder)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func cursorWorkspaceComposers(path string) ([]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var raw []byte
+	if err := db.QueryRow(`SELECT value FROM ItemTable WHERE [key] = 'composer.composerData'`).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var data struct {
+		AllComposers []struct {
+			ComposerID string `json:"composerId"`
+		} `json:"allComposers"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(data.AllComposers))
+	for _, composer := range data.AllComposers {
+		if composer.ComposerID != "" {
+			ids = append(ids, composer.ComposerID)
+		}
+	}
+	return ids, nil
+}
+
+// composerChanged reports whether a composer moved past the marker it was
+// last copied at. Markers are loaded from cursor state on first sight.
+func (s *Server) composerChanged(id string, marker int64) bool {
+	s.markersMu.Lock()
+	defer s.markersMu.Unlock()
+	if s.composerMarkers == nil {
+		s.composerMarkers = make(map[string]int64)
+	}
+	seen, ok := s.composerMarkers[id]
+	if !ok {
+		if cursor, err := loadCursorState(s.baseDir, id); err == nil && cursor != nil && cursor.Composer != nil {
+			seen = cursor.Composer.UpdatedAt
+		}
+		s.composerMarkers[id] = seen
+	}
+	return marker == 0 || marker > seen
+}
+
+func (s *Server) setComposerMarker(id string, marker int64) {
+	s.markersMu.Lock()
+	defer s.markersMu.Unlock()
+	if s.composerMarkers == nil {
+		s.composerMarkers = make(map[string]int64)
+	}
+	s.composerMarkers[id] = marker
+}
+
+func (s *Server) processCursorComposer(db *sql.DB, composer cursorComposer, marker int64) error {
+	defer s.lockSession(composer.ComposerID)()
+
+	cursor, err := loadCursorState(s.baseDir, composer.ComposerID)
+	if err != nil {
+		return err
+	}
+	if cursor == nil {
+		return errors.New("failed to read cursor state")
+	}
+	cwd := composer.Workspace
+	if cursor.Metadata != nil && cursor.Metadata.Cwd != "" {
+		cwd = cursor.Metadata.Cwd
+	}
+	if s.suppressSession(composer.ComposerID, "cursor", cwd) || s.privacy.unknownCwdSuppressed(cwd) {
+		// Remember the marker so the composer is not re-read every poll. A
+		// composer skipped for want of a cwd is copied from where it left
+		// off once it changes after a hook or its workspace tells where it
+		// runs.
+		s.setComposerMarker(composer.ComposerID, marker)
+		return nil
+	}
+	state := composerState(cursor)
+
+	headers := composer.Headers
+	if len(headers) == 0 {
+		for _, bubble := range composer.Conversation {
+			headers = append(headers, cursorHeader{BubbleID: bubble.BubbleID, Type: bubble.Type})
+		}
+	}
+	start := composerResumeIndex(headers, state)
+	if start >= len(headers) {
+		state.UpdatedAt = marker
+		s.setComposerMarker(composer.ComposerID, marker)
+		return s.saveCursor(cursor)
+	}
+
+	now := time.Now().UTC()
+	fallback := now
+	if composer.LastUpdatedAt > 0 {
+		fallback = time.UnixMilli(composer.LastUpdatedAt).UTC()
+	}
+	sessionPath, err := s.state.EnsureSessionFile(s.baseDir, composer.ComposerID, "cursor", now)
+	if err != nil {
+		return err
+	}
+
+	written := 0
+	lastEventTime := time.Time{}
+	if needsSessionStart(cursor) {
+		ts := fallback
+		if composer.CreatedAt > 0 {
+			ts = time.UnixMilli(composer.CreatedAt).UTC()
+		}
+		data := map[string]interface{}{}
+		if composer.ModelConfig.ModelName != "" {
+			data["model"] = composer.ModelConfig.ModelName
+		}
+		if cwd != "" {
+			data["cwd"] = cwd
+		}
+		if len(data) == 0 {
+			data["metadata"] = map[string]interface{}{}
+		}
+		n, wroteAt, err := s.appendBoundaryEvent(sessionPath, cursor, buildEvent("session_start", composer.ComposerID, "cursor", ts, data))
+		if err != nil {
+			return err
+		}
+		written += n
+		lastEventTime = maxTime(lastEventTime, wroteAt)
+	}
+
+	inline := make(map[string]cursorBubble, len(composer.Conversation))
+	for _, bubble := range composer.Conversation {
+		inline[bubble.BubbleID] = bubble
+	}
+	generating := composer.Status == "generating"
+	complete := true
+	for i := start; i < len(headers); i++ {
+		bubble, ok := inline[headers[i].BubbleID]
+		if !ok {
+			bubble, ok = loadCursorBubble(db, composer.ComposerID, headers[i].BubbleID)
+		}
+		if !ok {
+			// Headers can be written before their bubble.
+			complete = false
+			break
+		}
+		if generating && !cursorBubbleSettled(bubble, i == len(headers)-1) {
+			complete = false
+			break
+		}
+		for _, event := range cursorBubbleEvents(composer, bubble, state, fallback) {
+			wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+			if err != nil {
+				return err
+			}
+			written++
+			lastEventTime = maxTime(lastEventTime, wroteAt)
+		}
+		state.Consumed = i + 1
+		state.LastBubble = headers[i].BubbleID
+	}
+	if complete {
+		state.UpdatedAt = marker
+		s.setComposerMarker(composer.ComposerID, marker)
+	}
+	if err := s.saveCursor(cursor); err != nil {
+		return err
+	}
+	if written > 0 {
+		s.state.RecordEvent(composer.ComposerID, lastEventTime, written)
+	}
+	return nil
+}
+
+// composerResumeIndex finds the first bubble not yet copied. When Cursor
+// rewrites a conversation (a prompt edited and resent), the last copied
+// bubble moves or disappears; copying resumes after it if it is still there.
+func composerResumeIndex(headers []cursorHeader, state *ComposerState) int {
+	if state.LastBubble == "" {
+		return 0
+	}
+	if state.Consumed > 0 && state.Consumed <= len(headers) && headers[state.Consumed-1].BubbleID == state.LastBubble {
+		return state.Consumed
+	}
+	for i, header := range headers {
+		if header.BubbleID == state.LastBubble {
+			return i + 1
+		}
+	}
+	if state.Consumed > len(headers) {
+		return len(headers)
+	}
+	return state.Consumed
+}
+
+func loadCursorBubble(db *sql.DB, composerID, bubbleID string) (cursorBubble, bool) {
+	var raw []byte
+	if err := db.QueryRow(`SELECT value FROM cursorDiskKV WHERE key = ?`, "bubbleId:"+composerID+":"+bubbleID).Scan(&raw); err != nil {
+		return cursorBubble{}, false
+	}
+	var bubble cursorBubble
+	if err := json.Unmarshal(raw, &bubble); err != nil {
+		return cursorBubble{}, false
+	}
+	if bubble.BubbleID == "" {
+		bubble.BubbleID = bubbleID
+	}
+	return bubble, true
+}
+
+// cursorBubbleSettled reports whether a bubble of a generating composer is
+// final: its tool call finished, and it is not the reply still streaming.
+func cursorBubbleSettled(bubble cursorBubble, last bool) bool {
+	if tool := bubble.ToolFormerData; tool != nil && tool.Name != "" {
+		switch tool.Status {
+		case "completed", "error", "cancelled":
+			return true
+		default:
+			return false
+		}
+	}
+	return !(last && bubble.Type == 2)
+}
+
+func cursorBubbleEvents(composer cursorComposer, bubble cursorBubble, state *ComposerState, fallback time.Time) []map[string]interface{} {
+	sessionID := composer.ComposerID
+	ts := cursorBubbleTime(bubble, fallback)
+	var events []map[string]interface{}
+
+	if bubble.Type == 1 {
+		text := strings.TrimSpace(bubble.Text)
+		if text == "" {
+			return nil
+		}
+		if state.consumePrompt(text) {
+			return nil
+		}
+		return append(events, buildCursorMessage(sessionID, ts, "user", bubble.Text))
+	}
+
+	var content []map[string]interface{}
+	if bubble.Thinking != nil && strings.TrimSpace(bubble.Thinking.Text) != "" {
+		content = append(content, map[string]interface{}{"type": "thinking", "text": bubble.Thinking.Text})
+	}
+	if strings.TrimSpace(bubble.Text) != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": bubble.Text})
+	}
+	for _, block := range bubble.CodeBlocks {
+		if strings.TrimSpace(block.Content) == "" {
+			continue
+		}
+		part := map[string]interface{}{"type": "code", "text": block.Content}
+		setIfNotEmpty(part, "language", block.LanguageID)
+		setIfNotEmpty(part, "file_path", cursorURIPath(block.URI))
+		content = append(content, part)
+	}
+	model := bubble.ModelInfo.ModelName
+	if model == "" {
+		model = composer.ModelConfig.ModelName
+	}
+	if len(content) > 0 {
+		data := map[string]interface{}{"role": "assistant", "content": content}
+		setIfNotEmpty(data, "model", model)
+		events = append(events, buildEvent("message", sessionID, "cursor", ts, data))
+	}
+
+	tool := bubble.ToolFormerData
+	if tool == nil || tool.Name == "" || (state.HookTools && cursorHookCovered(tool.Name)) {
+		return events
+	}
+	toolUseID := tool.ToolCallID
+	if toolUseID == "" {
+		toolUseID = "cursor_" + bubble.BubbleID
+	}
+	input := map[string]interface{}{}
+	if tool.RawArgs != "" {
+		if err := json.Unmarshal([]byte(tool.RawArgs), &input); err != nil {
+			input = map[string]interface{}{"input": tool.RawArgs}
+		}
+	}
+	data := map[string]interface{}{"tool_use_id": toolUseID, "tool_name": tool.Name, "input": input}
+	setIfNotEmpty(data, "model", model)
+	events = append(events, buildEvent("tool_use", sessionID, "cursor", ts, data))
+	switch tool.Status {
+	case "completed", "error", "cancelled":
+		result := tool.Result
+		if result == "" && tool.Status == "cancelled" {
+			result = "cancelled"
+		}
+		events = append(events, buildEvent("tool_result", sessionID, "cursor", ts, map[string]interface{}{
+			"tool_use_id": toolUseID,
+			"content":     result,
+			"is_error":    tool.Status != "completed",
+		}))
+	}
+	return events
+}
+
+func cursorHookCovered(name string) bool {
+	return cursorHookToolNames[name] || strings.HasPrefix(name, "mcp_")
+}
+
+func cursorBubbleTime(bubble cursorBubble, fallback time.Time) time.Time {
+	if bubble.CreatedAt != "" {
+		if ts, err := time.Parse(time.RFC3339Nano, bubble.CreatedAt); err == nil {
+			return ts
+		}
+	}
+	if bubble.TimingInfo.ClientStartTime > 0 {
+		return time.UnixMilli(int64(bubble.TimingInfo.ClientStartTime)).UTC()
+	}
+	return fallback
+}
+
+func cursorURIPath(uri map[string]interface{}) string {
+	for _, key := range []string{"fsPath", "path"} {
+		if value, ok := uri[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// notePrompt remembers a prompt written by beforeSubmitPrompt so the poller
+// does not write its bubble again.
+// Only the latest maxComposerPrompts are kept, for when no poller runs.
+func (c *ComposerState) notePrompt(prompt string) {
+	c.Prompts = append(c.Prompts, hashLine([]byte(strings.TrimSpace(prompt))))
+	if len(c.Prompts) > maxComposerPrompts {
+		c.Prompts = c.Prompts[len(c.Prompts)-maxComposerPrompts:]
+	}
+}
+
+func (c *ComposerState) consumePrompt(prompt string) bool {
+	hash := hashLine([]byte(strings.TrimSpace(prompt)))
+	for i, seen := range c.Prompts {
+		if seen == hash {
+			c.Prompts = append(c.Prompts[:i], c.Prompts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
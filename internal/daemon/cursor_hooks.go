@@ -0,0 +1,139 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cursorToolHooks are the Cursor agent hooks that describe a tool call.
+var cursorToolHooks = map[string]bool{
+	"beforeShellExecution": true,
+	"beforeMCPExecution":   true,
+	"beforeReadFile":       true,
+	"afterFileEdit":        true,
+}
+
+// cursorToolEvents converts a Cursor tool hook into a tool_use event, plus a
+// tool_result when the payload already carries the outcome: afterFileEdit
+// fires once the edit is applied and beforeReadFile hands over the content
+// about to be read. Shell and MCP hooks fire before the call runs, so their
+// results are not known. File edits use the Edit and MultiEdit input shape
+// so they land in the changed-files ledger.
+func cursorToolEvents(hookEvent string, event map[string]interface{}, sessionID string, hookTime time.Time) []map[string]interface{} {
+	ts := hookTimestamp(event, hookTime)
+	var toolName, result string
+	input := map[string]interface{}{}
+	switch hookEvent {
+	case "beforeShellExecution":
+		command := toStringValue(event["command"])
+		if command == "" {
+			return nil
+		}
+		toolName = "Shell"
+		input["command"] = command
+		setIfNotEmpty(input, "cwd", toStringValue(event["cwd"]))
+	case "beforeMCPExecution":
+		toolName = toStringValue(event["tool_name"])
+		if toolName == "" {
+			return nil
+		}
+		switch raw := event["tool_input"].(type) {
+		case string:
+			var parsed map[string]interface{}
+			if err := json.Unmarshal([]byte(raw), &parsed); err == nil {
+				input = parsed
+			} else if raw != "" {
+				input["input"] = raw
+			}
+		case map[string]interface{}:
+			input = raw
+		}
+	case "beforeReadFile":
+		path := toStringValue(event["file_path"])
+		if path == "" {
+			return nil
+		}
+		toolName = "Read"
+		input["file_path"] = path
+		result = toStringValue(event["content"])
+	case "afterFileEdit":
+		path := toStringValue(event["file_path"])
+		if path == "" {
+			return nil
+		}
+		edits := cursorFileEdits(event["edits"])
+		input["file_path"] = path
+		switch len(edits) {
+		case 0:
+			return nil
+		case 1:
+			toolName = "Edit"
+			input["old_string"] = edits[0]["old_string"]
+			input["new_string"] = edits[0]["new_string"]
+		default:
+			toolName = "MultiEdit"
+			input["edits"] = edits
+		}
+		result = fmt.Sprintf("Applied %d edit(s) to %s", len(edits), path)
+	default:
+		return nil
+	}
+
+	toolUseID := cursorToolUseID(hookEvent, event, ts)
+	data := map[string]interface{}{
+		"tool_use_id": toolUseID,
+		"tool_name":   toolName,
+		"input":       input,
+	}
+	if hookEvent == "beforeMCPExecution" {
+		server := toStringValue(event["url"])
+		if server == "" {
+			server = toStringValue(event["command"])
+		}
+		setIfNotEmpty(data, "mcp_server", server)
+	}
+	events := []map[string]interface{}{buildEvent("tool_use", sessionID, "cursor", ts, data)}
+	if result != "" {
+		events = append(events, buildEvent("tool_result", sessionID, "cursor", ts, map[string]interface{}{
+			"tool_use_id": toolUseID,
+			"content":     result,
+			"is_error":    false,
+		}))
+	}
+	return events
+}
+
+func cursorFileEdits(raw interface{}) []map[string]interface{} {
+	items, _ := raw.([]interface{})
+	edits := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		edit, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		oldString, _ := edit["old_string"].(string)
+		newString, _ := edit["new_string"].(string)
+		if oldString == "" && newString == "" {
+			continue
+		}
+		edits = append(edits, map[string]interface{}{"old_string": oldString, "new_string": newString})
+	}
+	return edits
+}
+
+// cursorToolUseID derives an id for a hook call. Cursor hooks carry no call
+// id, so the generation, the hook, what it acts on and when it fired stand
+// in for one.
+func cursorToolUseID(hookEvent string, event map[string]interface{}, ts time.Time) string {
+	key := strings.Join([]string{
+		toStringValue(event["generation_id"]),
+		hookEvent,
+		toStringValue(event["command"]),
+		toStringValue(event["file_path"]),
+		toStringValue(event["tool_name"]),
+		ts.UTC().Format(time.RFC3339Nano),
+	}, "\x00")
+	return "cursor_" + hashLine([]byte(key))[:24]
+}
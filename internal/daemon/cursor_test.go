@@ -9,7 +9,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseCursorConversation(t *testing.T) {
@@ -153,3 +156,231 @@ func TestPollCursorDBWritesSession(t *testing.T) {
 		t.Fatalf("expected session_start and message events, got %v", types)
 	}
 }
+
+func TestCaptureCursorToolHooks(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "conv-tools"
+	base := func(name string, fields map[string]interface{}) map[string]interface{} {
+		event := map[string]interface{}{
+			"conversation_id": sessionID,
+			"generation_id":   "gen-1",
+			"hook_event_name": name,
+			"workspace_roots": []interface{}{"/work/app"},
+		}
+		for key, value := range fields {
+			event[key] = value
+		}
+		return event
+	}
+	hooks := []map[string]interface{}{
+		base("beforeReadFile", map[string]interface{}{"file_path": "/work/app/main.go", "content": "package main\n"}),
+		base("beforeSubmitPrompt", map[string]interface{}{"prompt": "rename the server"}),
+		base("beforeShellExecution", map[string]interface{}{"command": "go test ./...", "cwd": "/work/app"}),
+		base("beforeMCPExecution", map[string]interface{}{"tool_name": "search_docs", "tool_input": `{"query":"rename"}`, "url": "https://mcp.example.com"}),
+		base("afterFileEdit", map[string]interface{}{"file_path": "/work/app/main.go", "edits": []interface{}{
+			map[string]interface{}{"old_string": "oldServer", "new_string": "newServer"},
+		}}),
+		base("stop", map[string]interface{}{"status": "completed"}),
+	}
+	for _, hook := range hooks {
+		if _, _, err := srv.captureCursor(capturePayload{Tool: "cursor", Event: hook}, sessionID, time.Now()); err != nil {
+			t.Fatalf("capture %v: %v", hook["hook_event_name"], err)
+		}
+	}
+
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "cursor")
+	events := readEvents(t, path)
+	if got := eventTypes(events); got != "session_start,tool_use,tool_result,message,tool_use,tool_use,tool_use,tool_result,session_end" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	if data := events[0]["data"].(map[string]interface{}); data["cwd"] != "/work/app" {
+		t.Fatalf("unexpected session_start: %+v", data)
+	}
+	read := events[1]["data"].(map[string]interface{})
+	if read["tool_name"] != "Read" || events[2]["data"].(map[string]interface{})["tool_use_id"] != read["tool_use_id"] {
+		t.Fatalf("read result not paired with its call: %+v", read)
+	}
+	shell := events[4]["data"].(map[string]interface{})
+	if shell["tool_name"] != "Shell" || shell["input"].(map[string]interface{})["command"] != "go test ./..." {
+		t.Fatalf("unexpected shell call: %+v", shell)
+	}
+	mcp := events[5]["data"].(map[string]interface{})
+	if mcp["tool_name"] != "search_docs" || mcp["input"].(map[string]interface{})["query"] != "rename" || mcp["mcp_server"] != "https://mcp.example.com" {
+		t.Fatalf("unexpected MCP call: %+v", mcp)
+	}
+	edit := events[6]["data"].(map[string]interface{})
+	if edit["tool_name"] != "Edit" || edit["input"].(map[string]interface{})["new_string"] != "newServer" {
+		t.Fatalf("unexpected edit: %+v", edit)
+	}
+
+	md, err := ReplaySessionMetadata(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if md.ToolUseCount != 4 || md.MessageCount != 1 {
+		t.Fatalf("unexpected counts: tools=%d messages=%d", md.ToolUseCount, md.MessageCount)
+	}
+}
+
+func TestPollCursorComposers(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	composerID := "c0ffee00-1111-4222-8333-944455556666"
+	dbPath := filepath.Join(t.TempDir(), "state.vscdb")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE cursorDiskKV (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	put := func(key, value string) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO cursorDiskKV (key, value) VALUES (?, ?)`, key, value); err != nil {
+			t.Fatalf("insert %s: %v", key, err)
+		}
+	}
+	composer := func(updatedAt int64, bubbles ...string) string {
+		headers := make([]string, 0, len(bubbles))
+		for _, id := range bubbles {
+			headers = append(headers, `{"bubbleId":"`+id+`","type":1}`)
+		}
+		return `{"composerId":"` + composerID + `","createdAt":1767268800000,"lastUpdatedAt":` + strconv.FormatInt(updatedAt, 10) +
+			`,"status":"completed","modelConfig":{"modelName":"claude-4-sonnet"},"fullConversationHeadersOnly":[` + strings.Join(headers, ",") + `]}`
+	}
+	put("bubbleId:"+composerID+":b1", `{"bubbleId":"b1","type":1,"text":"add a health check","createdAt":"2026-01-01T12:00:01Z"}`)
+	put("bubbleId:"+composerID+":b2", `{"bubbleId":"b2","type":2,"text":"Here it is","createdAt":"2026-01-01T12:00:02Z","modelInfo":{"modelName":"gpt-5"},"codeBlocks":[{"content":"func health() {}","languageId":"go","uri":{"fsPath":"/work/app/health.go"}}]}`)
+	put("bubbleId:"+composerID+":b3", `{"bubbleId":"b3","type":2,"createdAt":"2026-01-01T12:00:03Z","toolFormerData":{"toolCallId":"call_1","name":"list_dir","status":"completed","rawArgs":"{\"path\":\".\"}","result":"health.go"}}`)
+	put("composerData:"+composerID, composer(1767268803000, "b1", "b2", "b3"))
+
+	// The prompt already came in through beforeSubmitPrompt.
+	hook := map[string]interface{}{"conversation_id": composerID, "hook_event_name": "beforeSubmitPrompt", "prompt": "add a health check"}
+	if _, _, err := srv.captureCursor(capturePayload{Tool: "cursor", Event: hook}, composerID, time.Now()); err != nil {
+		t.Fatalf("capture hook: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := srv.pollCursorDB(dbPath); err != nil {
+			t.Fatalf("poll cursor db: %v", err)
+		}
+	}
+
+	path, _, _ := findExistingSessionFile(baseDir, composerID, "cursor")
+	events := readEvents(t, path)
+	if got := eventTypes(events); got != "session_start,message,message,tool_use,tool_result" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	reply := events[2]["data"].(map[string]interface{})
+	content := reply["content"].([]interface{})
+	code := content[1].(map[string]interface{})
+	if reply["model"] != "gpt-5" || code["type"] != "code" || code["language"] != "go" || code["file_path"] != "/work/app/health.go" {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	call := events[3]["data"].(map[string]interface{})
+	if call["tool_use_id"] != "call_1" || call["input"].(map[string]interface{})["path"] != "." {
+		t.Fatalf("unexpected tool call: %+v", call)
+	}
+
+	// Only bubbles added after the last poll are copied.
+	put("bubbleId:"+composerID+":b4", `{"bubbleId":"b4","type":1,"text":"thanks","createdAt":"2026-01-01T12:01:00Z"}`)
+	put("composerData:"+composerID, composer(1767268860000, "b1", "b2", "b3", "b4"))
+	if err := srv.pollCursorDB(dbPath); err != nil {
+		t.Fatalf("poll cursor db: %v", err)
+	}
+	if got := eventTypes(readEvents(t, path)); got != "session_start,message,message,tool_use,tool_result,message" {
+		t.Fatalf("unexpected events after update: %s", got)
+	}
+}
+
+func TestPollCursorComposersUsesWorkspaceFolder(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	userDir := t.TempDir()
+	secret := "/work/secret"
+	public := "/work/public"
+	srv.privacy.setRules(PrivacyRules{IgnoreCwds: []string{secret}})
+
+	openDB := func(path, table string) *sql.DB {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec(`CREATE TABLE ` + table + ` (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB)`); err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+		return db
+	}
+	workspace := func(hash, folder string, composers ...string) {
+		t.Helper()
+		dir := filepath.Join(userDir, "workspaceStorage", hash)
+		db := openDB(filepath.Join(dir, "state.vscdb"), "ItemTable")
+		entries := make([]string, 0, len(composers))
+		for _, id := range composers {
+			entries = append(entries, `{"composerId":"`+id+`"}`)
+		}
+		if _, err := db.Exec(`INSERT INTO ItemTable (key, value) VALUES ('composer.composerData', ?)`, `{"allComposers":[`+strings.Join(entries, ",")+`]}`); err != nil {
+			t.Fatalf("insert composers: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "workspace.json"), []byte(`{"folder":"file://`+filepath.ToSlash(folder)+`"}`), 0o600); err != nil {
+			t.Fatalf("write workspace.json: %v", err)
+		}
+	}
+	secretID := "c0ffee00-1111-4222-8333-000000000001"
+	publicID := "c0ffee00-1111-4222-8333-000000000002"
+	unknownID := "c0ffee00-1111-4222-8333-000000000003"
+	workspace("aaa", secret, secretID)
+	workspace("bbb", public, publicID)
+
+	dbPath := filepath.Join(userDir, "globalStorage", "state.vscdb")
+	global := openDB(dbPath, "cursorDiskKV")
+	for _, id := range []string{secretID, publicID, unknownID} {
+		value := `{"composerId":"` + id + `","createdAt":1767268800000,"lastUpdatedAt":1767268801000,"status":"completed",` +
+			`"conversation":[{"bubbleId":"b1","type":1,"text":"prompt in ` + id + `","createdAt":"2026-01-01T12:00:01Z"}]}`
+		if _, err := global.Exec(`INSERT INTO cursorDiskKV (key, value) VALUES (?, ?)`, "composerData:"+id, value); err != nil {
+			t.Fatalf("insert composer: %v", err)
+		}
+	}
+	if err := srv.pollCursorDB(dbPath); err != nil {
+		t.Fatalf("poll cursor db: %v", err)
+	}
+
+	// The composer of the ignored workspace is dropped and remembered; the
+	// one whose workspace is unknown is held back while privacy rules exist.
+	for _, id := range []string{secretID, unknownID} {
+		if path, _, _ := findExistingSessionFile(baseDir, id, "cursor"); path != "" {
+			t.Fatalf("expected no session file for %s, got %s", id, path)
+		}
+	}
+	if got := srv.privacy.suppressedCount(); got != 1 {
+		t.Fatalf("expected 1 suppressed session, got %d", got)
+	}
+	path, _, _ := findExistingSessionFile(baseDir, publicID, "cursor")
+	events := readEvents(t, path)
+	if got := eventTypes(events); got != "session_start,message" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	if cwd := events[0]["data"].(map[string]interface{})["cwd"]; cwd != public {
+		t.Fatalf("expected session_start cwd %s, got %v", public, cwd)
+	}
+
+	// A local-only rule holds it back too; without rules it is copied.
+	srv.privacy.setRules(PrivacyRules{LocalOnlyCwds: []string{"/work/other"}})
+	srv.setComposerMarker(unknownID, 0)
+	if err := srv.pollCursorDB(dbPath); err != nil {
+		t.Fatalf("poll cursor db: %v", err)
+	}
+	if path, _, _ := findExistingSessionFile(baseDir, unknownID, "cursor"); path != "" {
+		t.Fatalf("expected local-only rules to hold back a composer with no cwd")
+	}
+	srv.privacy.setRules(PrivacyRules{})
+	srv.setComposerMarker(unknownID, 0)
+	if err := srv.pollCursorDB(dbPath); err != nil {
+		t.Fatalf("poll cursor db: %v", err)
+	}
+	if path, _, _ := findExistingSessionFile(baseDir, unknownID, "cursor"); path == "" {
+		t.Fatalf("expected the composer to be copied once no ignore rules apply")
+	}
+}
@@ -0,0 +1,197 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+const geminiTool = "gemini-cli"
+
+// geminiCapturer reads Gemini CLI chat recordings
+// (~/.gemini/tmp/<project>/chats/session-*.json). Gemini rewrites the whole
+// file on every update, so progress is tracked by message index instead of
+// byte offset. Its hook payloads carry session_id, transcript_path and
+// hook_event_name like Claude Code's.
+type geminiCapturer struct{}
+
+func (geminiCapturer) Tool() string { return geminiTool }
+
+func (c geminiCapturer) Capture(s *Server, event map[string]interface{}, sessionID string, hookTime time.Time) (int, time.Time, error) {
+	return s.captureTranscript(capturePayload{Tool: c.Tool(), Event: event}, sessionID, hookTime, c.appender(s))
+}
+
+func (geminiCapturer) appender(s *Server) transcriptAppender {
+	return s.appendGeminiChat
+}
+
+type geminiChat struct {
+	Messages []geminiMessage `json:"messages"`
+}
+
+type geminiMessage struct {
+	Timestamp string           `json:"timestamp"`
+	Type      string           `json:"type"`
+	Content   interface{}      `json:"content"`
+	Model     string           `json:"model"`
+	Thoughts  []geminiThought  `json:"thoughts"`
+	ToolCalls []geminiToolCall `json:"toolCalls"`
+	Tokens    *geminiTokens    `json:"tokens"`
+}
+
+// geminiTokens mirrors Gemini's usage metadata. Input includes the cached
+// prompt tokens; thoughts are billed as output.
+type geminiTokens struct {
+	Input    int64 `json:"input"`
+	Output   int64 `json:"output"`
+	Cached   int64 `json:"cached"`
+	Thoughts int64 `json:"thoughts"`
+}
+
+func (t geminiTokens) usage() events.TokenUsage {
+	input := t.Input - t.Cached
+	if input < 0 {
+		input = 0
+	}
+	return events.TokenUsage{InputTokens: input, OutputTokens: t.Output + t.Thoughts, CacheReadInputTokens: t.Cached}
+}
+
+type geminiThought struct {
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+}
+
+type geminiToolCall struct {
+	ID     string                 `json:"id"`
+	Name   string                 `json:"name"`
+	Args   map[string]interface{} `json:"args"`
+	Result interface{}            `json:"result"`
+	Status string                 `json:"status"`
+}
+
+func (s *Server) appendGeminiChat(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+	if cursor == nil || cursor.TranscriptPath == "" {
+		return 0, time.Time{}, nil
+	}
+	data, err := os.ReadFile(cursor.TranscriptPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+	var chat geminiChat
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	start := cursor.LastIndex
+	if start > len(chat.Messages) {
+		// The recording was replaced; start over.
+		start = 0
+	}
+
+	eventsWritten := 0
+	lastEventTime := time.Time{}
+	for i := start; i < len(chat.Messages); i++ {
+		for _, event := range geminiEvents(chat.Messages[i], sessionID, hookTime) {
+			wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+			if err != nil {
+				return eventsWritten, lastEventTime, err
+			}
+			eventsWritten++
+			lastEventTime = maxTime(lastEventTime, wroteAt)
+		}
+		cursor.LastIndex = i + 1
+	}
+	return eventsWritten, lastEventTime, nil
+}
+
+func geminiEvents(msg geminiMessage, sessionID string, fallback time.Time) []map[string]interface{} {
+	ts := hookTimestamp(map[string]interface{}{"timestamp": msg.Timestamp}, fallback)
+	events := []map[string]interface{}{}
+
+	var role string
+	switch msg.Type {
+	case "user":
+		role = "user"
+	case "gemini":
+		role = "assistant"
+	default:
+		// info, warning and error entries are UI notices, not conversation.
+		return events
+	}
+
+	var content []map[string]interface{}
+	if role == "assistant" {
+		for _, thought := range msg.Thoughts {
+			text := thought.Description
+			if thought.Subject != "" {
+				text = thought.Subject + ": " + text
+			}
+			if text != "" {
+				content = append(content, map[string]interface{}{"type": "thinking", "text": text})
+			}
+		}
+	}
+	content = append(content, geminiContent(msg.Content)...)
+	if len(content) > 0 {
+		data := map[string]interface{}{
+			"role":    role,
+			"content": content,
+		}
+		if role == "assistant" && msg.Model != "" {
+			data["model"] = msg.Model
+		}
+		events = append(events, buildEvent("message", sessionID, geminiTool, ts, data))
+	}
+
+	for _, call := range msg.ToolCalls {
+		if call.ID == "" || call.Name == "" {
+			continue
+		}
+		events = append(events, buildEvent("tool_use", sessionID, geminiTool, ts, map[string]interface{}{
+			"tool_use_id": call.ID,
+			"tool_name":   call.Name,
+			"input":       call.Args,
+		}))
+		if call.Result == nil {
+			continue
+		}
+		events = append(events, buildEvent("tool_result", sessionID, geminiTool, ts, map[string]interface{}{
+			"tool_use_id": call.ID,
+			"content":     call.Result,
+			"is_error":    call.Status == "error",
+		}))
+	}
+	if role == "assistant" && msg.Tokens != nil {
+		if usage := msg.Tokens.usage(); !usage.IsZero() {
+			attachUsage(events, usageMap(usage), "", msg.Model)
+		}
+	}
+	return events
+}
+
+// geminiContent accepts either a plain string or a list of Gemini parts.
+func geminiContent(raw interface{}) []map[string]interface{} {
+	parts, ok := raw.([]interface{})
+	if !ok {
+		return normalizeContent(raw)
+	}
+	content := make([]map[string]interface{}, 0, len(parts))
+	for _, part := range parts {
+		switch value := part.(type) {
+		case string:
+			if value != "" {
+				content = append(content, map[string]interface{}{"type": "text", "text": value})
+			}
+		case map[string]interface{}:
+			if text, _ := value["text"].(string); text != "" {
+				content = append(content, map[string]interface{}{"type": "text", "text": text})
+			}
+		}
+	}
+	return content
+}
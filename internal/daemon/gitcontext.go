@@ -0,0 +1,181 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+const (
+	gitTimeout       = 2 * time.Second
+	maxGitDirtyFiles = 200
+)
+
+// GitContext is the repository state of a session's working directory.
+type GitContext struct {
+	RepoRoot   string
+	RemoteURL  string
+	Branch     string
+	HeadSHA    string
+	DirtyFiles []string
+	DirtyCount int
+}
+
+// collectGitContext runs local git in dir. It reports false when dir is not
+// inside a work tree or git is unavailable.
+func collectGitContext(dir string) (GitContext, bool) {
+	if strings.TrimSpace(dir) == "" {
+		return GitContext{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	root, err := runGit(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil || root == "" {
+		return GitContext{}, false
+	}
+	gc := GitContext{RepoRoot: root}
+
+	// An unborn branch has no HEAD commit yet; symbolic-ref still names it.
+	gc.HeadSHA, _ = runGit(ctx, root, "rev-parse", "--verify", "-q", "HEAD")
+	gc.Branch, _ = runGit(ctx, root, "symbolic-ref", "--short", "-q", "HEAD")
+	gc.RemoteURL = events.StripURLCredentials(gitRemoteURL(ctx, root, gc.Branch))
+
+	if status, err := runGitRaw(ctx, root, "status", "--porcelain=v1", "-z", "--untracked-files=normal"); err == nil {
+		gc.DirtyFiles, gc.DirtyCount = parseGitStatus(status)
+	}
+	return gc, true
+}
+
+// gitRemoteURL prefers the branch's upstream remote, then origin, then the
+// first configured remote.
+func gitRemoteURL(ctx context.Context, dir, branch string) string {
+	var candidates []string
+	if branch != "" {
+		if remote, err := runGit(ctx, dir, "config", "--get", "branch."+branch+".remote"); err == nil && remote != "" && remote != "." {
+			candidates = append(candidates, remote)
+		}
+	}
+	candidates = append(candidates, "origin")
+	if remotes, err := runGit(ctx, dir, "remote"); err == nil && remotes != "" {
+		candidates = append(candidates, strings.Fields(remotes)[0])
+	}
+	for _, remote := range candidates {
+		if remoteURL, err := runGit(ctx, dir, "remote", "get-url", remote); err == nil && remoteURL != "" {
+			return remoteURL
+		}
+	}
+	return ""
+}
+
+// parseGitStatus returns the paths from `git status --porcelain=v1 -z`,
+// capped at maxGitDirtyFiles, along with the uncapped count.
+func parseGitStatus(raw []byte) ([]string, int) {
+	files := []string{}
+	count := 0
+	entries := bytes.Split(raw, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		count++
+		if len(files) < maxGitDirtyFiles {
+			files = append(files, string(entry[3:]))
+		}
+		// Renames and copies are followed by their source path.
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return files, count
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := runGitRaw(ctx, dir, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+func runGitRaw(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_OPTIONAL_LOCKS=0", "GIT_TERMINAL_PROMPT=0")
+	return cmd.Output()
+}
+
+func buildGitContextEvent(gc GitContext, phase, sessionID, tool string, ts time.Time) map[string]interface{} {
+	data := map[string]interface{}{
+		"phase":       phase,
+		"repo_root":   gc.RepoRoot,
+		"dirty_files": gc.DirtyFiles,
+		"dirty_count": gc.DirtyCount,
+	}
+	if gc.RemoteURL != "" {
+		data["remote_url"] = gc.RemoteURL
+	}
+	if gc.Branch != "" {
+		data["branch"] = gc.Branch
+	}
+	if gc.HeadSHA != "" {
+		data["head_sha"] = gc.HeadSHA
+	}
+	return buildEvent("git_context", sessionID, tool, ts, data)
+}
+
+// appendBoundaryEvent writes a session_start or session_end event together
+// with a git_context snapshot of the session's cwd: after the start, and
+// before the end so session_end stays last. Callers hold the session lock.
+func (s *Server) appendBoundaryEvent(sessionPath string, cursor *SessionCursor, event map[string]interface{}) (int, time.Time, error) {
+	meta := extractEventMetadata(event)
+	written := 0
+	latest := time.Time{}
+
+	if meta.EventType == "session_end" {
+		n, wroteAt, err := s.appendGitContext(sessionPath, cursor, meta)
+		if err != nil {
+			return written, latest, err
+		}
+		written += n
+		latest = maxTime(latest, wroteAt)
+	}
+
+	wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+	if err != nil {
+		return written, latest, err
+	}
+	written++
+	latest = maxTime(latest, wroteAt)
+
+	if meta.EventType == "session_start" {
+		n, wroteAt, err := s.appendGitContext(sessionPath, cursor, meta)
+		if err != nil {
+			return written, latest, err
+		}
+		written += n
+		latest = maxTime(latest, wroteAt)
+	}
+	return written, latest, nil
+}
+
+func (s *Server) appendGitContext(sessionPath string, cursor *SessionCursor, boundary eventMetadata) (int, time.Time, error) {
+	if !s.gitContext || cursor == nil || cursor.Metadata == nil {
+		return 0, time.Time{}, nil
+	}
+	gc, ok := collectGitContext(cursor.Metadata.Cwd)
+	if !ok {
+		return 0, time.Time{}, nil
+	}
+	ts := boundary.Timestamp
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	event := buildGitContextEvent(gc, boundary.EventType, boundary.SessionID, boundary.Tool, ts)
+	wroteAt, err := s.appendEvent(sessionPath, cursor, event)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return 1, wroteAt, nil
+}
@@ -0,0 +1,36 @@
+package daemon
+
+import "time"
+
+// boundaryHooks already produce session_start and session_end; every other
+// Claude Code hook is recorded as a hook event.
+var boundaryHooks = map[string]bool{"SessionStart": true, "SessionEnd": true}
+
+// buildHookEvent turns a Claude Code hook payload into a hook event stamped
+// with the time the hook fired. Tool inputs and prompts are left out: the
+// transcript already carries them as tool_use and message events.
+func buildHookEvent(hook map[string]interface{}, sessionID, tool string, hookTime time.Time) map[string]interface{} {
+	name, _ := hook["hook_event_name"].(string)
+	if name == "" || boundaryHooks[name] {
+		return nil
+	}
+	data := map[string]interface{}{"hook_event_name": name}
+	setIfNotEmpty(data, "permission_mode", toStringValue(hook["permission_mode"]))
+	switch name {
+	case "PreToolUse", "PostToolUse", "PermissionRequest":
+		setIfNotEmpty(data, "tool_name", toStringValue(hook["tool_name"]))
+		setIfNotEmpty(data, "tool_use_id", toStringValue(hook["tool_use_id"]))
+	case "Notification":
+		setIfNotEmpty(data, "message", toStringValue(hook["message"]))
+		setIfNotEmpty(data, "notification_type", toStringValue(hook["notification_type"]))
+	case "Stop", "SubagentStop":
+		if active, ok := hook["stop_hook_active"].(bool); ok {
+			data["stop_hook_active"] = active
+		}
+		setIfNotEmpty(data, "agent_id", toStringValue(hook["agent_id"]))
+	case "PreCompact":
+		setIfNotEmpty(data, "trigger", toStringValue(hook["trigger"]))
+		setIfNotEmpty(data, "custom_instructions", toStringValue(hook["custom_instructions"]))
+	}
+	return buildEvent("hook", sessionID, tool, hookTimestamp(hook, hookTime), data)
+}
@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+func TestHookEventsRecordTiming(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "3c4d5e6f-0000-4000-8000-000000000001"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	if err := os.WriteFile(transcriptPath, nil, 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	hooks := []struct {
+		offset time.Duration
+		event  map[string]interface{}
+	}{
+		{0, map[string]interface{}{"hook_event_name": "UserPromptSubmit", "prompt": "fix the build"}},
+		{time.Second, map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash", "tool_use_id": "toolu_1", "tool_input": map[string]interface{}{"command": "go build"}}},
+		{3 * time.Second, map[string]interface{}{"hook_event_name": "PostToolUse", "tool_name": "Bash", "tool_use_id": "toolu_1"}},
+		{4 * time.Second, map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash", "tool_use_id": "toolu_2"}},
+		{5 * time.Second, map[string]interface{}{"hook_event_name": "Notification", "message": "Claude needs your permission to use Bash", "notification_type": "permission_prompt"}},
+		{9 * time.Second, map[string]interface{}{"hook_event_name": "PostToolUse", "tool_name": "Bash", "tool_use_id": "toolu_2"}},
+		{10 * time.Second, map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash", "tool_use_id": "toolu_3"}},
+		{11 * time.Second, map[string]interface{}{"hook_event_name": "Notification", "message": "Claude needs your permission to use Bash", "notification_type": "permission_prompt"}},
+		{14 * time.Second, map[string]interface{}{"hook_event_name": "Stop", "stop_hook_active": false}},
+	}
+	for _, h := range hooks {
+		h.event["session_id"] = sessionID
+		h.event["transcript_path"] = transcriptPath
+		h.event["permission_mode"] = "default"
+		h.event["timestamp"] = start.Add(h.offset).Format(time.RFC3339Nano)
+		if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: h.event}, sessionID, time.Now()); err != nil {
+			t.Fatalf("capture %v: %v", h.event["hook_event_name"], err)
+		}
+	}
+
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	hookEvents := readEvents(t, path)
+	if got := eventTypes(hookEvents); got != "session_start,hook,hook,hook,hook,hook,hook,hook,hook,hook" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	pre := hookEvents[2]
+	data := pre["data"].(map[string]interface{})
+	if pre["timestamp"] != "2026-01-01T12:00:01Z" || data["tool_use_id"] != "toolu_1" || data["permission_mode"] != "default" {
+		t.Fatalf("unexpected PreToolUse event: %+v", pre)
+	}
+	if _, ok := data["tool_input"]; ok {
+		t.Fatalf("tool input must stay in the transcript events: %+v", data)
+	}
+	if data := hookEvents[5]["data"].(map[string]interface{}); data["notification_type"] != "permission_prompt" {
+		t.Fatalf("unexpected Notification event: %+v", data)
+	}
+
+	md, err := ReplaySessionMetadata(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	timing := md.HookTiming.Report()
+	if timing == nil {
+		t.Fatalf("expected hook timing")
+	}
+	if timing.ToolLatency != (events.DurationStats{Count: 2, TotalMS: 7000, MaxMS: 5000}) {
+		t.Fatalf("unexpected tool latency: %+v", timing.ToolLatency)
+	}
+	if timing.ResponseTime != (events.DurationStats{Count: 1, TotalMS: 14000, MaxMS: 14000}) {
+		t.Fatalf("unexpected response time: %+v", timing.ResponseTime)
+	}
+	if timing.InputWait != (events.DurationStats{Count: 2, TotalMS: 7000, MaxMS: 4000}) {
+		t.Fatalf("unexpected input wait: %+v", timing.InputWait)
+	}
+	if timing.PermissionPrompts != 2 || timing.PermissionsGranted != 1 || timing.PermissionsDenied != 1 || timing.Pending != nil {
+		t.Fatalf("unexpected permission counts: %+v", timing)
+	}
+}
@@ -0,0 +1,339 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type importPayload struct {
+	ProjectsDir string `json:"projects_dir"`
+	Since       string `json:"since"`
+	Cwd         string `json:"cwd"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+// ImportOptions controls a historical backfill of Claude Code transcripts.
+type ImportOptions struct {
+	ProjectsDir string
+	Since       time.Time
+	Cwd         string
+	DryRun      bool
+}
+
+// ImportResult summarizes a backfill run.
+type ImportResult struct {
+	ProjectsDir      string            `json:"projects_dir"`
+	DryRun           bool              `json:"dry_run"`
+	SessionsScanned  int               `json:"sessions_scanned"`
+	SessionsImported int               `json:"sessions_imported"`
+	SessionsSkipped  int               `json:"sessions_skipped"`
+	EventsWritten    int               `json:"events_written"`
+	Sessions         []ImportedSession `json:"sessions"`
+}
+
+// ImportedSession reports what happened to a single transcript.
+type ImportedSession struct {
+	SessionID      string `json:"session_id"`
+	TranscriptPath string `json:"transcript_path"`
+	Cwd            string `json:"cwd,omitempty"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	Events         int    `json:"events"`
+	Skipped        string `json:"skipped,omitempty"`
+}
+
+// DefaultClaudeProjectsDir is where Claude Code keeps per-project transcripts.
+func DefaultClaudeProjectsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".claude", "projects"), nil
+}
+
+// ImportClaudeProjects walks the Claude Code projects directory and converts
+// transcripts that hooks never captured (or only partially captured) into the
+// standard session layout. Cursor state makes repeated runs idempotent.
+func (s *Server) ImportClaudeProjects(opts ImportOptions) (ImportResult, error) {
+	result := ImportResult{ProjectsDir: opts.ProjectsDir, DryRun: opts.DryRun, Sessions: []ImportedSession{}}
+	if strings.TrimSpace(opts.ProjectsDir) == "" {
+		dir, err := DefaultClaudeProjectsDir()
+		if err != nil {
+			return result, err
+		}
+		opts.ProjectsDir = dir
+		result.ProjectsDir = dir
+	}
+
+	transcripts, err := findClaudeTranscripts(opts.ProjectsDir)
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range transcripts {
+		result.SessionsScanned++
+		imported, err := s.importClaudeTranscript(path, opts)
+		if err != nil {
+			s.logger.Warn("import transcript failed", "path", path, "error", err)
+			imported.Skipped = "error: " + err.Error()
+		}
+		if imported.Skipped != "" {
+			result.SessionsSkipped++
+		} else {
+			result.SessionsImported++
+			result.EventsWritten += imported.Events
+		}
+		result.Sessions = append(result.Sessions, imported)
+	}
+	return result, nil
+}
+
+func findClaudeTranscripts(projectsDir string) ([]string, error) {
+	projects, err := os.ReadDir(projectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, project := range projects {
+		if !project.IsDir() {
+			continue
+		}
+		projectDir := filepath.Join(projectsDir, project.Name())
+		files, err := os.ReadDir(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+				continue
+			}
+			// Sub-agent transcripts belong to their parent session.
+			if strings.HasPrefix(name, "agent-") {
+				continue
+			}
+			paths = append(paths, filepath.Join(projectDir, name))
+		}
+	}
+	// Oldest first, so a resumed conversation finds the session it
+	// continues already imported.
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := modTimes[paths[i]], modTimes[paths[j]]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return paths[i] < paths[j]
+	})
+	return paths, nil
+}
+
+func (s *Server) importClaudeTranscript(path string, opts ImportOptions) (ImportedSession, error) {
+	sessionID := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+	imported := ImportedSession{SessionID: sessionID, TranscriptPath: path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return imported, err
+	}
+	if !opts.Since.IsZero() && info.ModTime().Before(opts.Since) {
+		imported.Skipped = "older_than_since"
+		return imported, nil
+	}
+
+	header, err := readTranscriptHeader(path)
+	if err != nil {
+		return imported, err
+	}
+	imported.Cwd = header.Cwd
+	if !header.CreatedAt.IsZero() {
+		imported.CreatedAt = header.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if opts.Cwd != "" && !strings.HasPrefix(header.Cwd, opts.Cwd) {
+		imported.Skipped = "cwd_mismatch"
+		return imported, nil
+	}
+	createdAt := header.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = info.ModTime().UTC()
+	}
+
+	defer s.lockSession(sessionID)()
+
+	if s.privacy.ignores(sessionID, "claude-code", header.Cwd) {
+		imported.Skipped = "privacy_ignored"
+		return imported, nil
+	}
+	cursor, err := loadCursorState(s.baseDir, sessionID)
+	if err != nil {
+		return imported, err
+	}
+	if cursor.TranscriptPath != "" && cursor.TranscriptPath != path {
+		imported.Skipped = "captured_from_other_transcript"
+		return imported, nil
+	}
+	if cursor.LastOffset >= info.Size() {
+		imported.Skipped = "up_to_date"
+		return imported, nil
+	}
+
+	if opts.DryRun {
+		count, err := countTranscriptEvents(path, sessionID, cursor.LastOffset, createdAt)
+		if err != nil {
+			return imported, err
+		}
+		if needsSessionStart(cursor) {
+			count++
+		}
+		imported.Events = count
+		return imported, nil
+	}
+
+	cursor.TranscriptPath = path
+	sessionPath, err := s.state.EnsureSessionFile(s.baseDir, sessionID, "claude-code", createdAt)
+	if err != nil {
+		return imported, err
+	}
+
+	lastEventTime := time.Time{}
+	if needsSessionStart(cursor) {
+		hook := map[string]interface{}{"timestamp": createdAt.UTC().Format(time.RFC3339Nano)}
+		if header.Cwd != "" {
+			hook["cwd"] = header.Cwd
+		}
+		start := buildSessionStartEvent(hook, sessionID, "claude-code", createdAt)
+		if data, ok := start["data"].(map[string]interface{}); ok {
+			data["source"] = "import"
+		}
+		wroteAt, err := s.appendEvent(sessionPath, cursor, start)
+		if err != nil {
+			return imported, err
+		}
+		imported.Events++
+		lastEventTime = wroteAt
+	}
+
+	linked, linkedAt, err := s.resolveContinuation(sessionPath, cursor, createdAt)
+	if err != nil {
+		return imported, err
+	}
+	imported.Events += linked
+	lastEventTime = maxTime(lastEventTime, linkedAt)
+
+	written, latest, newOffset, lastHash, err := s.appendClaudeTranscript(sessionPath, sessionID, cursor, createdAt)
+	if err != nil {
+		return imported, err
+	}
+	imported.Events += written
+	lastEventTime = maxTime(lastEventTime, latest)
+	if newOffset >= 0 {
+		cursor.LastOffset = newOffset
+	}
+	if lastHash != "" {
+		cursor.LastLineHash = lastHash
+	}
+	written, latest, err = s.appendClaudeSubagents(sessionPath, sessionID, cursor, createdAt)
+	if err != nil {
+		return imported, err
+	}
+	imported.Events += written
+	lastEventTime = maxTime(lastEventTime, latest)
+	if err := s.saveCursor(cursor); err != nil {
+		return imported, err
+	}
+	s.state.RecordEvent(sessionID, lastEventTime, imported.Events)
+	return imported, nil
+}
+
+type transcriptHeader struct {
+	Cwd       string
+	CreatedAt time.Time
+}
+
+// readTranscriptHeader scans the first records of a transcript for the
+// working directory and the earliest timestamp.
+func readTranscriptHeader(path string) (transcriptHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return transcriptHeader{}, err
+	}
+	defer file.Close()
+
+	var header transcriptHeader
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		if header.Cwd == "" {
+			if cwd, ok := record["cwd"].(string); ok {
+				header.Cwd = cwd
+			}
+		}
+		if header.CreatedAt.IsZero() {
+			header.CreatedAt = hookTimestamp(record, time.Time{})
+		}
+		if header.Cwd != "" && !header.CreatedAt.IsZero() {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+func countTranscriptEvents(path, sessionID string, offset int64, fallback time.Time) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return count, err
+		}
+		if !bytes.HasSuffix(line, []byte{'\n'}) {
+			break
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if events, _, parseErr := claudeEventsFromLine(trimmed, sessionID, fallback); parseErr == nil {
+				count += len(events)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	return count, nil
+}
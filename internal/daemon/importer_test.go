@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeImportTranscript(t *testing.T, projectsDir, project, sessionID string, lines []string) string {
+	t.Helper()
+	dir := filepath.Join(projectsDir, project)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := filepath.Join(dir, sessionID+".jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	return path
+}
+
+func TestImportClaudeProjectsIsIdempotent(t *testing.T) {
+	baseDir := t.TempDir()
+	projectsDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sessionID := "5e1f0c2a-1111-4222-8333-944455556666"
+	path := writeImportTranscript(t, projectsDir, "-work-app", sessionID, []string{
+		`{"type":"user","cwd":"/work/app","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"assistant","cwd":"/work/app","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]},"timestamp":"2026-01-01T12:00:01Z"}`,
+	})
+	writeImportTranscript(t, projectsDir, "-work-app", "agent-1234", []string{
+		`{"type":"user","cwd":"/work/app","message":{"role":"user","content":"sub"},"timestamp":"2026-01-01T12:00:00Z"}`,
+	})
+
+	dry, err := srv.ImportClaudeProjects(ImportOptions{ProjectsDir: projectsDir, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.SessionsScanned != 1 || dry.SessionsImported != 1 || dry.Sessions[0].Events != 3 {
+		t.Fatalf("unexpected dry run result: %+v", dry)
+	}
+	if _, found, _ := findExistingSessionFile(baseDir, sessionID, "claude-code"); found {
+		t.Fatalf("dry run must not write session files")
+	}
+
+	first, err := srv.ImportClaudeProjects(ImportOptions{ProjectsDir: projectsDir})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if first.SessionsImported != 1 || first.EventsWritten != 3 {
+		t.Fatalf("unexpected import result: %+v", first)
+	}
+	sessionPath, found, err := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if err != nil || !found {
+		t.Fatalf("expected session file, found=%v err=%v", found, err)
+	}
+	if !strings.Contains(sessionPath, "2026-01-01") {
+		t.Fatalf("expected session filed under transcript date, got %s", sessionPath)
+	}
+
+	cursor, err := loadCursorState(baseDir, sessionID)
+	if err != nil {
+		t.Fatalf("load cursor: %v", err)
+	}
+	if cursor.TranscriptPath != path || cursor.Metadata == nil || cursor.Metadata.Cwd != "/work/app" {
+		t.Fatalf("unexpected cursor after import: %+v", cursor)
+	}
+
+	second, err := srv.ImportClaudeProjects(ImportOptions{ProjectsDir: projectsDir})
+	if err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	if second.SessionsImported != 0 || second.Sessions[0].Skipped != "up_to_date" {
+		t.Fatalf("expected re-import to skip, got %+v", second)
+	}
+}
+
+func TestImportClaudeProjectsFiltersByCwd(t *testing.T) {
+	baseDir := t.TempDir()
+	projectsDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	writeImportTranscript(t, projectsDir, "-work-app", "aaaaaaaa-1111-4222-8333-944455556666", []string{
+		`{"type":"user","cwd":"/work/app","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}`,
+	})
+	writeImportTranscript(t, projectsDir, "-other", "bbbbbbbb-1111-4222-8333-944455556666", []string{
+		`{"type":"user","cwd":"/other","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}`,
+	})
+
+	result, err := srv.ImportClaudeProjects(ImportOptions{ProjectsDir: projectsDir, Cwd: "/work"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.SessionsImported != 1 || result.SessionsSkipped != 1 {
+		t.Fatalf("expected one import and one skip, got %+v", result)
+	}
+}
@@ -0,0 +1,604 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+	"github.com/victorarias/tabs/internal/events"
+	_ "modernc.org/sqlite"
+)
+
+// indexSchemaVersion is stored in PRAGMA user_version. On mismatch the
+// sessions table is recreated and reseeded from the session files.
+const indexSchemaVersion = 3
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	session_id       TEXT NOT NULL,
+	tool             TEXT NOT NULL,
+	file_path        TEXT NOT NULL,
+	created_at       TEXT NOT NULL DEFAULT '',
+	ended_at         TEXT NOT NULL DEFAULT '',
+	last_event_at    TEXT NOT NULL DEFAULT '',
+	cwd              TEXT NOT NULL DEFAULT '',
+	summary          TEXT NOT NULL DEFAULT '',
+	duration_seconds INTEGER NOT NULL DEFAULT 0,
+	message_count    INTEGER NOT NULL DEFAULT 0,
+	tool_use_count   INTEGER NOT NULL DEFAULT 0,
+	input_tokens     INTEGER NOT NULL DEFAULT 0,
+	output_tokens    INTEGER NOT NULL DEFAULT 0,
+	cache_creation_input_tokens INTEGER NOT NULL DEFAULT 0,
+	cache_read_input_tokens     INTEGER NOT NULL DEFAULT 0,
+	cost_usd         REAL NOT NULL DEFAULT 0,
+	parent_session_id TEXT NOT NULL DEFAULT '',
+	parent_relation  TEXT NOT NULL DEFAULT '',
+	updated_at       TEXT NOT NULL,
+	PRIMARY KEY (session_id, tool)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_created_at ON sessions(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_cwd ON sessions(cwd);
+CREATE INDEX IF NOT EXISTS idx_sessions_tool ON sessions(tool);
+CREATE INDEX IF NOT EXISTS idx_sessions_parent ON sessions(parent_session_id);
+
+-- transcript_uuids maps transcript record uuids to the session that first
+-- wrote them, to recognize resumed conversations. Session files don't keep
+-- the uuids, so this table survives schema resets and rebuilds.
+CREATE TABLE IF NOT EXISTS transcript_uuids (
+	uuid       TEXT NOT NULL,
+	tool       TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	PRIMARY KEY (uuid, tool)
+);
+`
+
+// SessionIndex is the daemon's SQLite index of session files, so lookups
+// and listings don't have to walk every day directory. The JSONL files stay
+// the source of truth; RebuildSessionIndex regenerates the index from them.
+type SessionIndex struct {
+	db *sql.DB
+	// fresh is set when the table was just created and has no rows yet.
+	fresh bool
+}
+
+// IndexedSession is one row of the session index.
+type IndexedSession struct {
+	SessionID       string `json:"session_id"`
+	Tool            string `json:"tool"`
+	FilePath        string `json:"file_path"`
+	CreatedAt       string `json:"created_at,omitempty"`
+	EndedAt         string `json:"ended_at,omitempty"`
+	LastEventAt     string `json:"last_event_at,omitempty"`
+	Cwd             string `json:"cwd,omitempty"`
+	Summary         string `json:"summary,omitempty"`
+	DurationSeconds int    `json:"duration_seconds"`
+	MessageCount    int    `json:"message_count"`
+	ToolUseCount    int    `json:"tool_use_count"`
+
+	Usage   events.TokenUsage `json:"usage"`
+	CostUSD float64           `json:"cost_usd"`
+
+	ParentSessionID string `json:"parent_session_id,omitempty"`
+	ParentRelation  string `json:"parent_relation,omitempty"`
+}
+
+// IndexQuery filters and paginates List. Date is YYYY-MM-DD in UTC and Cwd
+// matches as a prefix. A zero Limit returns every match.
+type IndexQuery struct {
+	Tool   string
+	Date   string
+	Cwd    string
+	Limit  int
+	Offset int
+}
+
+// RebuildResult reports a full index rebuild.
+type RebuildResult struct {
+	FilesScanned    int `json:"files_scanned"`
+	SessionsIndexed int `json:"sessions_indexed"`
+	Errors          int `json:"errors"`
+}
+
+// OpenSessionIndex opens (creating if needed) the index at IndexPath.
+func OpenSessionIndex(baseDir string) (*SessionIndex, error) {
+	path := IndexPath(baseDir)
+	// Summaries hold prompt text, so create the file owner-only before
+	// SQLite does; its WAL files inherit the mode.
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps writers from contending with each other
+	// inside the process; other processes are handled by busy_timeout.
+	db.SetMaxOpenConns(1)
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("read session index version: %w", err)
+	}
+	fresh := version != indexSchemaVersion
+	if fresh {
+		if _, err := db.Exec(`DROP TABLE IF EXISTS sessions`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("reset session index: %w", err)
+		}
+	}
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init session index: %w", err)
+	}
+	if fresh {
+		if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, indexSchemaVersion)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("init session index: %w", err)
+		}
+	}
+	return &SessionIndex{db: db, fresh: fresh}, nil
+}
+
+// OpenSessionIndexIfExists opens the index only when the daemon has already
+// created it, so read-only callers never leave an empty index behind.
+func OpenSessionIndexIfExists(baseDir string) (*SessionIndex, bool, error) {
+	if _, err := os.Stat(IndexPath(baseDir)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	idx, err := OpenSessionIndex(baseDir)
+	if err != nil {
+		return nil, false, err
+	}
+	return idx, true, nil
+}
+
+func (idx *SessionIndex) Close() error {
+	if idx == nil {
+		return nil
+	}
+	return idx.db.Close()
+}
+
+// Upsert records or replaces a session row.
+func (idx *SessionIndex) Upsert(entry IndexedSession) error {
+	if idx == nil {
+		return nil
+	}
+	return upsertIndexed(idx.db, entry)
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func upsertIndexed(db sqlExecer, entry IndexedSession) error {
+	if entry.SessionID == "" || entry.Tool == "" || entry.FilePath == "" {
+		return fmt.Errorf("index entry missing session_id, tool or file_path")
+	}
+	// The summary is taken from the first prompt, so it is sealed like the
+	// session file. cwd stays plaintext: List filters on it in SQL.
+	summary := []byte(entry.Summary)
+	if len(summary) > 0 {
+		var err error
+		if summary, err = sealDocument(summary); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`
+INSERT INTO sessions (session_id, tool, file_path, created_at, ended_at, last_event_at, cwd, summary,
+	duration_seconds, message_count, tool_use_count, input_tokens, output_tokens,
+	cache_creation_input_tokens, cache_read_input_tokens, cost_usd, parent_session_id, parent_relation,
+	updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (session_id, tool) DO UPDATE SET
+	file_path = excluded.file_path,
+	created_at = excluded.created_at,
+	ended_at = excluded.ended_at,
+	last_event_at = excluded.last_event_at,
+	cwd = excluded.cwd,
+	summary = excluded.summary,
+	duration_seconds = excluded.duration_seconds,
+	message_count = excluded.message_count,
+	tool_use_count = excluded.tool_use_count,
+	input_tokens = excluded.input_tokens,
+	output_tokens = excluded.output_tokens,
+	cache_creation_input_tokens = excluded.cache_creation_input_tokens,
+	cache_read_input_tokens = excluded.cache_read_input_tokens,
+	cost_usd = excluded.cost_usd,
+	parent_session_id = excluded.parent_session_id,
+	parent_relation = excluded.parent_relation,
+	updated_at = excluded.updated_at`,
+		entry.SessionID, entry.Tool, entry.FilePath, entry.CreatedAt, entry.EndedAt, entry.LastEventAt,
+		entry.Cwd, string(summary), entry.DurationSeconds, entry.MessageCount, entry.ToolUseCount,
+		entry.Usage.InputTokens, entry.Usage.OutputTokens, entry.Usage.CacheCreationInputTokens,
+		entry.Usage.CacheReadInputTokens, entry.CostUSD, entry.ParentSessionID, entry.ParentRelation,
+		time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// Lookup returns the indexed session for a session id and tool. An empty
+// tool matches the most recently created session with that id.
+func (idx *SessionIndex) Lookup(sessionID, tool string) (IndexedSession, bool, error) {
+	if idx == nil {
+		return IndexedSession{}, false, nil
+	}
+	query := `SELECT ` + indexColumns + ` FROM sessions WHERE session_id = ?`
+	args := []interface{}{sessionID}
+	if tool != "" {
+		query += ` AND tool = ?`
+		args = append(args, tool)
+	}
+	query += ` ORDER BY created_at DESC LIMIT 1`
+	entry, err := scanIndexed(idx.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return IndexedSession{}, false, nil
+	}
+	if err != nil {
+		return IndexedSession{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Children returns the sessions whose parent is sessionID through relation
+// (subagent or continuation), oldest first.
+func (idx *SessionIndex) Children(sessionID, tool, relation string) ([]IndexedSession, error) {
+	if idx == nil {
+		return nil, nil
+	}
+	rows, err := idx.db.Query(`SELECT `+indexColumns+` FROM sessions
+		WHERE parent_session_id = ? AND tool = ? AND parent_relation = ?
+		ORDER BY created_at, session_id`, sessionID, tool, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []IndexedSession
+	for rows.Next() {
+		entry, err := scanIndexed(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RecordUUIDs remembers the transcript record uuids a session wrote. A uuid
+// already owned by an earlier session keeps its owner.
+func (idx *SessionIndex) RecordUUIDs(sessionID, tool string, uuids []string) error {
+	if idx == nil || len(uuids) == 0 {
+		return nil
+	}
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO transcript_uuids (uuid, tool, session_id) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range uuids {
+		if _, err := stmt.Exec(id, tool, sessionID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UUIDSession returns the session that wrote a transcript record uuid, or
+// "" when none did.
+func (idx *SessionIndex) UUIDSession(uuid, tool string) (string, error) {
+	if idx == nil {
+		return "", nil
+	}
+	var sessionID string
+	err := idx.db.QueryRow(`SELECT session_id FROM transcript_uuids WHERE uuid = ? AND tool = ?`, uuid, tool).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return sessionID, err
+}
+
+// RemovePath drops the row pointing at a session file that was deleted.
+func (idx *SessionIndex) RemovePath(path string) error {
+	if idx == nil {
+		return nil
+	}
+	_, err := idx.db.Exec(`DELETE FROM sessions WHERE file_path = ?`, path)
+	return err
+}
+
+// List returns matching sessions newest first, plus the total match count
+// before pagination.
+func (idx *SessionIndex) List(q IndexQuery) ([]IndexedSession, int, error) {
+	var where []string
+	var args []interface{}
+	if q.Tool != "" {
+		where = append(where, "tool = ?")
+		args = append(args, q.Tool)
+	}
+	if q.Date != "" {
+		where = append(where, "substr(created_at, 1, 10) = ?")
+		args = append(args, q.Date)
+	}
+	if q.Cwd != "" {
+		where = append(where, "substr(cwd, 1, ?) = ?")
+		args = append(args, len(q.Cwd), q.Cwd)
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := idx.db.QueryRow(`SELECT COUNT(*) FROM sessions`+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + indexColumns + ` FROM sessions` + clause + ` ORDER BY created_at DESC, session_id`
+	if q.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, q.Limit, q.Offset)
+	} else if q.Offset > 0 {
+		query += ` LIMIT -1 OFFSET ?`
+		args = append(args, q.Offset)
+	}
+	rows, err := idx.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []IndexedSession
+	for rows.Next() {
+		entry, err := scanIndexed(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+const indexColumns = `session_id, tool, file_path, created_at, ended_at, last_event_at, cwd, summary,
+	duration_seconds, message_count, tool_use_count, input_tokens, output_tokens,
+	cache_creation_input_tokens, cache_read_input_tokens, cost_usd, parent_session_id, parent_relation`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIndexed(row rowScanner) (IndexedSession, error) {
+	var entry IndexedSession
+	err := row.Scan(&entry.SessionID, &entry.Tool, &entry.FilePath, &entry.CreatedAt, &entry.EndedAt,
+		&entry.LastEventAt, &entry.Cwd, &entry.Summary, &entry.DurationSeconds, &entry.MessageCount,
+		&entry.ToolUseCount, &entry.Usage.InputTokens, &entry.Usage.OutputTokens,
+		&entry.Usage.CacheCreationInputTokens, &entry.Usage.CacheReadInputTokens, &entry.CostUSD,
+		&entry.ParentSessionID, &entry.ParentRelation)
+	if err != nil {
+		return entry, err
+	}
+	// A summary that cannot be opened, without the key, reads as empty
+	// rather than failing the whole listing.
+	summary, openErr := openDocument([]byte(entry.Summary))
+	if openErr != nil {
+		summary = nil
+	}
+	entry.Summary = string(summary)
+	return entry, nil
+}
+
+// indexEntryFromMetadata converts cursor metadata into an index row.
+func indexEntryFromMetadata(md *SessionMetadata) IndexedSession {
+	entry := IndexedSession{
+		SessionID:       md.SessionID,
+		Tool:            md.Tool,
+		FilePath:        md.FilePath,
+		CreatedAt:       md.CreatedAt,
+		EndedAt:         md.EndedAt,
+		LastEventAt:     md.LastEventAt,
+		Cwd:             md.Cwd,
+		Summary:         md.Summary,
+		DurationSeconds: md.DurationSeconds,
+		MessageCount:    md.MessageCount,
+		ToolUseCount:    md.ToolUseCount,
+		CostUSD:         md.CostUSD,
+		ParentSessionID: md.ParentSessionID,
+		ParentRelation:  md.ParentRelation,
+	}
+	if md.Usage != nil {
+		entry.Usage = *md.Usage
+	}
+	return entry
+}
+
+// RebuildSessionIndex replaces the index contents with metadata replayed
+// from every session file on disk. When a session has more than one file,
+// the newest one (by filename timestamp) wins, matching
+// findExistingSessionFile.
+func RebuildSessionIndex(baseDir string, idx *SessionIndex, prices map[string]config.ModelPrice) (RebuildResult, error) {
+	var result RebuildResult
+	sessionsDir := SessionsDir(baseDir)
+	days, err := os.ReadDir(sessionsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+
+	type candidate struct {
+		entry IndexedSession
+		ts    int64
+	}
+	best := make(map[string]candidate)
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(sessionsDir, day.Name())
+		files, err := os.ReadDir(dayDir)
+		if err != nil {
+			return result, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !IsSessionFileName(file.Name()) {
+				continue
+			}
+			result.FilesScanned++
+			path := filepath.Join(dayDir, file.Name())
+			md, err := ReplaySessionMetadata(path)
+			if err != nil {
+				result.Errors++
+				continue
+			}
+			md.CostUSD = events.SessionCost(md.UsageByModel, prices)
+			if md.SessionID == "" || md.Tool == "" {
+				continue
+			}
+			ts := sessionFileTimestamp(file.Name(), md.SessionID, md.Tool)
+			key := sessionKey(md.SessionID, md.Tool)
+			if current, ok := best[key]; ok && current.ts > ts {
+				continue
+			}
+			best[key] = candidate{entry: indexEntryFromMetadata(md), ts: ts}
+		}
+	}
+
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM sessions`); err != nil {
+		return result, err
+	}
+	for _, c := range best {
+		if err := upsertIndexed(tx, c.entry); err != nil {
+			return result, err
+		}
+		result.SessionsIndexed++
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ReplaySessionMetadata rebuilds cursor metadata (counts, summary, token
+// usage) from a session file.
+func ReplaySessionMetadata(path string) (*SessionMetadata, error) {
+	file, err := OpenSessionFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cursor := &SessionCursor{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && bytes.HasSuffix(line, []byte{'\n'}) {
+			var event map[string]interface{}
+			if jsonErr := json.Unmarshal(bytes.TrimSpace(line), &event); jsonErr == nil {
+				updateCursorMetadata(cursor, extractEventMetadata(event), path)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cursor.Metadata == nil {
+		return &SessionMetadata{}, nil
+	}
+	return cursor.Metadata, nil
+}
+
+func sessionFileTimestamp(name, sessionID, tool string) int64 {
+	prefix := sessionID + "-" + tool + "-"
+	ts, err := strconv.ParseInt(TrimSessionExt(strings.TrimPrefix(name, prefix)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return ts
+}
+
+// indexSession records a cursor's metadata in the index. Index failures are
+// logged rather than returned: the session file and cursor are already
+// durable and a rebuild recovers the row. Callers hold the session lock.
+func (s *Server) indexSession(cursor *SessionCursor) {
+	if s.index == nil || cursor == nil || cursor.Metadata == nil || cursor.Metadata.FilePath == "" {
+		return
+	}
+	if err := s.index.Upsert(indexEntryFromMetadata(cursor.Metadata)); err != nil {
+		s.logger.Warn("session index update failed", "session_id", cursor.SessionID, "error", err)
+	}
+}
+
+// saveCursor persists a cursor and refreshes its index row. Callers hold the
+// session lock.
+func (s *Server) saveCursor(cursor *SessionCursor) error {
+	if cursor != nil && cursor.Metadata != nil && cursor.Metadata.UsageByModel != nil {
+		cursor.Metadata.CostUSD = events.SessionCost(cursor.Metadata.UsageByModel, s.pricing)
+	}
+	if cursor != nil && cursor.unsynced && cursor.Metadata != nil {
+		// Under FsyncBatch the events go to disk before the cursor that
+		// claims them, so a crash never leaves the cursor ahead of the file.
+		if err := syncFile(cursor.Metadata.FilePath); err != nil {
+			return err
+		}
+		cursor.unsynced = false
+	}
+	if err := saveCursorState(s.baseDir, cursor); err != nil {
+		return err
+	}
+	s.indexSession(cursor)
+	return nil
+}
+
+// seedIndex populates a newly created (or schema-reset) index from the
+// existing session files so earlier history is listed.
+func (s *Server) seedIndex() {
+	s.mu.Lock()
+	seed := s.indexCreated
+	s.indexCreated = false
+	s.mu.Unlock()
+	if !seed {
+		return
+	}
+	result, err := s.RebuildIndex()
+	if err != nil {
+		s.logger.Warn("session index seed failed", "error", err)
+		return
+	}
+	s.logger.Info("session index seeded", "sessions", result.SessionsIndexed)
+}
+
+// RebuildIndex regenerates the session index from the files on disk.
+func (s *Server) RebuildIndex() (RebuildResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return RebuildResult{}, fmt.Errorf("session index unavailable")
+	}
+	return RebuildSessionIndex(s.baseDir, s.index, s.pricing)
+}
@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestSessionIndexTracksCaptures(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer srv.index.Close()
+
+	sessionID := "7a2b3c4d-1111-4222-8333-944455556666"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	lines := `{"type":"user","cwd":"/work/app","message":{"role":"user","content":"fix the login bug"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n" +
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"done"}]},"timestamp":"2026-01-01T12:00:05Z"}` + "\n"
+	if err := os.WriteFile(transcriptPath, []byte(lines), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "cwd": "/work/app", "hook_event_name": "Stop"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	entry, found, err := srv.index.Lookup(sessionID, "claude-code")
+	if err != nil || !found {
+		t.Fatalf("expected indexed session, found=%v err=%v", found, err)
+	}
+	sessionPath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if entry.FilePath != sessionPath {
+		t.Fatalf("expected file path %q, got %q", sessionPath, entry.FilePath)
+	}
+	if entry.Summary != "fix the login bug" || entry.MessageCount != 2 || entry.LastEventAt == "" {
+		t.Fatalf("unexpected index entry: %+v", entry)
+	}
+
+	// Drift: a stale row for a file that no longer exists, and the real row
+	// missing. A rebuild restores the row from disk and drops the stale one.
+	if err := srv.index.RemovePath(sessionPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := srv.index.Upsert(IndexedSession{SessionID: "gone", Tool: "claude-code", FilePath: "/nope.jsonl"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	result, err := srv.RebuildIndex()
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if result.FilesScanned != 1 || result.SessionsIndexed != 1 {
+		t.Fatalf("unexpected rebuild result: %+v", result)
+	}
+	rebuilt, found, err := srv.index.Lookup(sessionID, "")
+	if err != nil || !found {
+		t.Fatalf("expected rebuilt session, found=%v err=%v", found, err)
+	}
+	if rebuilt.Summary != entry.Summary || rebuilt.MessageCount != entry.MessageCount || rebuilt.Cwd != "/work/app" {
+		t.Fatalf("rebuilt entry differs: %+v vs %+v", rebuilt, entry)
+	}
+	if _, found, _ := srv.index.Lookup("gone", "claude-code"); found {
+		t.Fatalf("expected stale row to be dropped")
+	}
+}
+
+func TestSessionIndexListFiltersAndPaginates(t *testing.T) {
+	idx, err := OpenSessionIndex(t.TempDir())
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	defer idx.Close()
+
+	rows := []IndexedSession{
+		{SessionID: "a", Tool: "claude-code", FilePath: "/a", CreatedAt: "2026-01-01T09:00:00Z", Cwd: "/work/app"},
+		{SessionID: "b", Tool: "claude-code", FilePath: "/b", CreatedAt: "2026-01-02T09:00:00Z", Cwd: "/work/app/sub"},
+		{SessionID: "c", Tool: "cursor", FilePath: "/c", CreatedAt: "2026-01-02T10:00:00Z", Cwd: "/work/other"},
+		{SessionID: "d", Tool: "claude-code", FilePath: "/d", CreatedAt: "2026-01-03T09:00:00Z", Cwd: "/home"},
+	}
+	for _, row := range rows {
+		if err := idx.Upsert(row); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+
+	page, total, err := idx.List(IndexQuery{Tool: "claude-code", Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 3 || len(page) != 2 || page[0].SessionID != "d" || page[1].SessionID != "b" {
+		t.Fatalf("unexpected first page: total=%d %+v", total, page)
+	}
+	page, _, err = idx.List(IndexQuery{Tool: "claude-code", Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page) != 1 || page[0].SessionID != "a" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	page, total, err = idx.List(IndexQuery{Cwd: "/work/app"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 2 || len(page) != 2 {
+		t.Fatalf("expected cwd prefix match on 2 sessions, got %d", total)
+	}
+	_, total, err = idx.List(IndexQuery{Date: "2026-01-02"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 sessions on date, got %d", total)
+	}
+}
+
+func TestSessionIndexSealsSummary(t *testing.T) {
+	baseDir := t.TempDir()
+	enableTestEncryption(t, baseDir, config.EncryptionConfig{})
+	idx, err := OpenSessionIndex(baseDir)
+	if err != nil {
+		t.Fatalf("open index: %v", err)
+	}
+	defer idx.Close()
+
+	row := IndexedSession{SessionID: "a", Tool: "claude-code", FilePath: "/a", CreatedAt: "2026-01-01T09:00:00Z", Cwd: "/work/app", Summary: "the plaintext prompt"}
+	if err := idx.Upsert(row); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	var stored string
+	if err := idx.db.QueryRow(`SELECT summary FROM sessions WHERE session_id = 'a'`).Scan(&stored); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if strings.Contains(stored, "plaintext") {
+		t.Fatalf("summary stored in plaintext: %q", stored)
+	}
+	entry, ok, err := idx.Lookup("a", "claude-code")
+	if err != nil || !ok || entry.Summary != row.Summary || entry.Cwd != row.Cwd {
+		t.Fatalf("lookup: %+v ok=%v err=%v", entry, ok, err)
+	}
+}
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// transcriptRecordRef is the part of a Claude transcript record that links
+// it into the conversation tree.
+type transcriptRecordRef struct {
+	UUID       string `json:"uuid"`
+	ParentUUID string `json:"parentUuid"`
+}
+
+func parseRecordRef(line []byte) (transcriptRecordRef, bool) {
+	var ref transcriptRecordRef
+	if !bytes.Contains(line, []byte(`"uuid"`)) {
+		return ref, false
+	}
+	if err := json.Unmarshal(line, &ref); err != nil || ref.UUID == "" {
+		return ref, false
+	}
+	return ref, true
+}
+
+// continuation is what resolveContinuation learned about a transcript's
+// leading records.
+type continuation struct {
+	ParentSessionID string
+	ParentUUID      string
+	Inherited       int   // leading records copied from earlier sessions
+	PrefixEnd       int64 // byte offset just past the last inherited record
+	PrefixHash      string
+}
+
+// resolveContinuation links a session started with --resume or --continue
+// to the session it carries on. Claude Code starts such a transcript with
+// the earlier conversation, records keeping their uuids, or chains its first
+// record to the earlier session's last one through parentUuid. Copied
+// records are skipped so each session holds only its own messages, and a
+// continuation event names the parent. It runs once per session, before
+// any transcript line has been read. Callers hold the session lock.
+func (s *Server) resolveContinuation(sessionPath string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+	if s.index == nil || cursor.LineageChecked || cursor.TranscriptPath == "" {
+		return 0, time.Time{}, nil
+	}
+	if cursor.LastOffset > 0 {
+		cursor.LineageChecked = true
+		return 0, time.Time{}, nil
+	}
+	tool := ""
+	if cursor.Metadata != nil {
+		tool = cursor.Metadata.Tool
+	}
+
+	found, decided, err := s.scanContinuation(cursor.TranscriptPath, cursor.SessionID, tool)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+	if !decided && found.ParentSessionID == "" {
+		// Nothing but untagged records yet; look again on the next hook.
+		return 0, time.Time{}, nil
+	}
+	cursor.LineageChecked = true
+	if found.ParentSessionID == "" {
+		return 0, time.Time{}, nil
+	}
+	if found.PrefixEnd > 0 {
+		cursor.LastOffset = found.PrefixEnd
+		cursor.LastLineHash = found.PrefixHash
+	}
+
+	ts := hookTime
+	if cursor.Metadata != nil {
+		if created, err := time.Parse(time.RFC3339Nano, cursor.Metadata.CreatedAt); err == nil {
+			ts = created
+		}
+	}
+	data := map[string]interface{}{
+		"parent_session_id": found.ParentSessionID,
+		"inherited_records": found.Inherited,
+	}
+	setIfNotEmpty(data, "parent_uuid", found.ParentUUID)
+	wroteAt, err := s.appendEvent(sessionPath, cursor, buildEvent("continuation", cursor.SessionID, tool, ts, data))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return 1, wroteAt, nil
+}
+
+// scanContinuation reads leading records until it finds one that belongs to
+// sessionID. decided reports whether such a record was found.
+func (s *Server) scanContinuation(path, sessionID, tool string) (continuation, bool, error) {
+	var found continuation
+	file, err := os.Open(path)
+	if err != nil {
+		return found, false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 || !bytes.HasSuffix(line, []byte{'\n'}) {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return found, false, err
+			}
+			return found, false, nil
+		}
+		offset += int64(len(line))
+		trimmed := bytes.TrimSpace(line)
+		ref, ok := parseRecordRef(trimmed)
+		if !ok {
+			// Summaries and other untagged records ride along with the prefix.
+			continue
+		}
+		owner, err := s.index.UUIDSession(ref.UUID, tool)
+		if err != nil {
+			return found, false, err
+		}
+		if owner != "" && owner != sessionID {
+			// The newest ancestor owns the last copied record.
+			found.ParentSessionID = owner
+			found.ParentUUID = ref.UUID
+			found.Inherited++
+			found.PrefixEnd = offset
+			found.PrefixHash = hashLine(trimmed)
+			continue
+		}
+		if found.Inherited == 0 && ref.ParentUUID != "" {
+			owner, err := s.index.UUIDSession(ref.ParentUUID, tool)
+			if err != nil {
+				return found, false, err
+			}
+			if owner != "" && owner != sessionID {
+				found.ParentSessionID = owner
+				found.ParentUUID = ref.ParentUUID
+			}
+		}
+		return found, true, nil
+	}
+}
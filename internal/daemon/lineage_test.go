@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureTestTranscript(t *testing.T, srv *Server, sessionID, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": path, "hook_event_name": "Stop"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture %s: %v", sessionID, err)
+	}
+}
+
+func TestResumedTranscriptSkipsInheritedHistory(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	dir := t.TempDir()
+	first := "1a2b3c4d-0000-4000-8000-000000000001"
+	resumed := "1a2b3c4d-0000-4000-8000-000000000002"
+	history := []string{
+		`{"type":"user","uuid":"u1","parentUuid":null,"message":{"role":"user","content":"add a flag"},"timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"assistant","uuid":"a1","parentUuid":"u1","message":{"role":"assistant","content":[{"type":"text","text":"Added --verbose"}]},"timestamp":"2026-01-01T12:00:01Z"}`,
+	}
+	captureTestTranscript(t, srv, first, filepath.Join(dir, first+".jsonl"), history)
+
+	lines := append([]string{`{"type":"summary","summary":"Add a flag","leafUuid":"a1"}`}, history...)
+	lines = append(lines,
+		`{"type":"user","uuid":"u2","parentUuid":"a1","message":{"role":"user","content":"now document it"},"timestamp":"2026-01-02T09:00:00Z"}`,
+		`{"type":"assistant","uuid":"a2","parentUuid":"u2","message":{"role":"assistant","content":[{"type":"text","text":"Documented"}]},"timestamp":"2026-01-02T09:00:01Z"}`,
+	)
+	captureTestTranscript(t, srv, resumed, filepath.Join(dir, resumed+".jsonl"), lines)
+
+	path, _, _ := findExistingSessionFile(baseDir, resumed, "claude-code")
+	events := readEvents(t, path)
+	if got := eventTypes(events); got != "session_start,continuation,message,message,hook" {
+		t.Fatalf("unexpected resumed events: %s", got)
+	}
+	data := events[1]["data"].(map[string]interface{})
+	if data["parent_session_id"] != first || data["parent_uuid"] != "a1" || data["inherited_records"] != float64(2) {
+		t.Fatalf("unexpected continuation: %+v", data)
+	}
+
+	entry, ok, err := srv.index.Lookup(resumed, "claude-code")
+	if err != nil || !ok {
+		t.Fatalf("lookup: ok=%v err=%v", ok, err)
+	}
+	if entry.ParentSessionID != first || entry.ParentRelation != "continuation" || entry.MessageCount != 2 || entry.Summary != "now document it" {
+		t.Fatalf("unexpected index entry: %+v", entry)
+	}
+	children, err := srv.index.Children(first, "claude-code", "continuation")
+	if err != nil || len(children) != 1 || children[0].SessionID != resumed {
+		t.Fatalf("unexpected continuations: %+v err=%v", children, err)
+	}
+}
+
+func TestContinuationByParentUUID(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	dir := t.TempDir()
+	first := "2b3c4d5e-0000-4000-8000-000000000001"
+	next := "2b3c4d5e-0000-4000-8000-000000000002"
+	captureTestTranscript(t, srv, first, filepath.Join(dir, first+".jsonl"), []string{
+		`{"type":"user","uuid":"p1","parentUuid":null,"message":{"role":"user","content":"hi"},"timestamp":"2026-01-01T12:00:00Z"}`,
+	})
+	captureTestTranscript(t, srv, next, filepath.Join(dir, next+".jsonl"), []string{
+		`{"type":"user","uuid":"p2","parentUuid":"p1","message":{"role":"user","content":"again"},"timestamp":"2026-01-01T13:00:00Z"}`,
+	})
+
+	path, _, _ := findExistingSessionFile(baseDir, next, "claude-code")
+	events := readEvents(t, path)
+	if got := eventTypes(events); got != "session_start,continuation,message,hook" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	if data := events[1]["data"].(map[string]interface{}); data["parent_session_id"] != first || data["inherited_records"] != float64(0) {
+		t.Fatalf("unexpected continuation: %+v", data)
+	}
+
+	// A fresh conversation is not linked to anything.
+	other := "2b3c4d5e-0000-4000-8000-000000000003"
+	captureTestTranscript(t, srv, other, filepath.Join(dir, other+".jsonl"), []string{
+		`{"type":"user","uuid":"q1","parentUuid":null,"message":{"role":"user","content":"new work"},"timestamp":"2026-01-01T14:00:00Z"}`,
+	})
+	path, _, _ = findExistingSessionFile(baseDir, other, "claude-code")
+	if got := eventTypes(readEvents(t, path)); got != "session_start,message,hook" {
+		t.Fatalf("unexpected events for a new conversation: %s", got)
+	}
+}
@@ -0,0 +1,57 @@
+package daemon
+
+import "sync"
+
+// sessionLocks hands out one mutex per session id. Everything that reads
+// and writes a session's cursor state or JSONL file holds that session's
+// lock, so independent sessions are captured in parallel. Entries are
+// reference counted and dropped once no goroutine holds or waits for them.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock blocks until the session is free and returns its unlock function.
+// A goroutine never holds two session locks except a parent session taking
+// the locks of its sub-agent sessions, so lock order is always parent first.
+func (l *sessionLocks) lock(sessionID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	entry, ok := l.locks[sessionID]
+	if !ok {
+		entry = &sessionLock{}
+		l.locks[sessionID] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		l.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(l.locks, sessionID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// lockSession takes the store lock shared and the session's lock
+// exclusively. Callers must not call it again for a second session while
+// holding one: a recursive read lock deadlocks once a writer is waiting.
+func (s *Server) lockSession(sessionID string) func() {
+	s.mu.RLock()
+	unlock := s.sessionLocks.lock(sessionID)
+	return func() {
+		unlock()
+		s.mu.RUnlock()
+	}
+}
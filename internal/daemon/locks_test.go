@@ -0,0 +1,181 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionLocksSerializeOneSession(t *testing.T) {
+	var locks sessionLocks
+	unlockA := locks.lock("a")
+	unlockB := locks.lock("b") // other sessions are not blocked
+
+	acquired := make(chan struct{})
+	go func() {
+		defer locks.lock("a")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("second holder of session a did not wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockA()
+	<-acquired
+	unlockB()
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected released locks to be dropped, got %d", len(locks.locks))
+	}
+}
+
+// sendRequest writes one request on a fresh connection and decodes the reply.
+func sendRequest(socketPath, kind string, payload interface{}) (response, error) {
+	var resp response
+	conn, err := net.DialTimeout("unix", socketPath, 2*time.Second)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	req := map[string]interface{}{"version": protocolVersion, "type": kind, "payload": payload}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return resp, err
+	}
+	err = json.Unmarshal(bytesTrimSpace(line), &resp)
+	return resp, err
+}
+
+func TestConcurrentCapturesKeepSessionFilesIntact(t *testing.T) {
+	const (
+		sessions = 16
+		prompts  = 25
+	)
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := srv.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Serve(ctx) }()
+	defer func() {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	transcripts := t.TempDir()
+	ids := make([]string, sessions)
+	var requests sync.WaitGroup
+	errs := make(chan error, sessions*prompts*2)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("5c6d7e8f-0000-4000-8000-%012d", i)
+		path := filepath.Join(transcripts, ids[i]+".jsonl")
+		requests.Add(1)
+		// One writer per session appends to its transcript and fires a hook
+		// per line without waiting, so hooks of a session race each other
+		// as well as other sessions.
+		go func(id, path string) {
+			defer requests.Done()
+			for n := 0; n < prompts; n++ {
+				line := fmt.Sprintf(`{"type":"user","message":{"role":"user","content":"prompt %s-%02d"},"timestamp":"2026-01-01T12:00:%02dZ"}`, id, n, n)
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+				if err == nil {
+					_, err = file.WriteString(line + "\n")
+					file.Close()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				hook := map[string]interface{}{"session_id": id, "transcript_path": path, "cwd": "/work/app", "hook_event_name": "UserPromptSubmit"}
+				requests.Add(2)
+				go func() {
+					defer requests.Done()
+					resp, err := sendRequest(srv.socketPath, "capture_event", map[string]interface{}{"tool": "claude-code", "event": hook})
+					if err == nil && resp.Status != "ok" {
+						err = fmt.Errorf("capture_event: %+v", resp.Error)
+					}
+					if err != nil {
+						errs <- err
+					}
+				}()
+				go func() {
+					defer requests.Done()
+					if _, err := sendRequest(srv.socketPath, "daemon_status", map[string]interface{}{}); err != nil {
+						errs <- err
+					}
+				}()
+			}
+		}(ids[i], path)
+	}
+	requests.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("request failed: %v", err)
+	}
+	waitForCaptures(t, srv.captures)
+
+	for _, id := range ids {
+		path, ok, err := findExistingSessionFile(baseDir, id, "claude-code")
+		if err != nil || !ok {
+			t.Fatalf("session %s not written: %v", id, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read session: %v", err)
+		}
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			t.Fatalf("session %s does not end with a complete line", id)
+		}
+		var messages []string
+		for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			var event map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("session %s line %d is not JSON: %v", id, i+1, err)
+			}
+			if i == 0 && event["event_type"] != "session_start" {
+				t.Fatalf("session %s starts with %v", id, event["event_type"])
+			}
+			if event["event_type"] == "message" {
+				messages = append(messages, line)
+			}
+		}
+		if len(messages) != prompts {
+			t.Fatalf("session %s: expected %d messages, got %d", id, prompts, len(messages))
+		}
+		for n, line := range messages {
+			if want := fmt.Sprintf("prompt %s-%02d", id, n); !strings.Contains(line, want) {
+				t.Fatalf("session %s message %d out of order: %s", id, n, line)
+			}
+		}
+	}
+
+	status := srv.state.Snapshot(0)
+	if status.SessionsCaptured != sessions || status.EventsProcessed < sessions*(prompts+1) {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if stats := srv.captures.Stats(); stats.Processed != sessions*prompts || stats.Failed != 0 {
+		t.Fatalf("unexpected capture stats: %+v", stats)
+	}
+}
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionMark records user-facing facts about a session that are not part
+// of its event stream: whether it was shared, whether it was starred and
+// whether the privacy rules dropped it. The retention policy keeps pushed and
+// starred sessions.
+type SessionMark struct {
+	SessionID string `json:"session_id"`
+	Tool      string `json:"tool"`
+	PushedAt  string `json:"pushed_at,omitempty"`
+	RemoteURL string `json:"remote_url,omitempty"`
+	Starred   bool   `json:"starred,omitempty"`
+	// Suppressed sessions matched an ignore rule; nothing of them is written.
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// marksMu serializes read-modify-write cycles on SessionMarksPath. Pushes
+// run outside the server lock, so the file has its own.
+var marksMu sync.Mutex
+
+func loadSessionMarks(baseDir string) (map[string]SessionMark, error) {
+	marks := make(map[string]SessionMark)
+	data, err := os.ReadFile(SessionMarksPath(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return marks, nil
+		}
+		return marks, err
+	}
+	var entries []SessionMark
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return marks, err
+	}
+	for _, entry := range entries {
+		marks[sessionKey(entry.SessionID, entry.Tool)] = entry
+	}
+	return marks, nil
+}
+
+// updateSessionMark applies fn to a session's mark and persists the file.
+// Marks left with nothing set are dropped.
+func updateSessionMark(baseDir, sessionID, tool string, fn func(*SessionMark)) error {
+	marksMu.Lock()
+	defer marksMu.Unlock()
+
+	marks, err := loadSessionMarks(baseDir)
+	if err != nil {
+		return err
+	}
+	key := sessionKey(sessionID, tool)
+	mark, ok := marks[key]
+	if !ok {
+		mark = SessionMark{SessionID: sessionID, Tool: tool}
+	}
+	fn(&mark)
+	if mark.PushedAt == "" && !mark.Starred && !mark.Suppressed {
+		delete(marks, key)
+	} else {
+		marks[key] = mark
+	}
+	return saveSessionMarksLocked(baseDir, marks)
+}
+
+// forgetSessionMarks drops the marks of deleted sessions.
+func forgetSessionMarks(baseDir string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	marksMu.Lock()
+	defer marksMu.Unlock()
+
+	marks, err := loadSessionMarks(baseDir)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, key := range keys {
+		if _, ok := marks[key]; ok {
+			delete(marks, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveSessionMarksLocked(baseDir, marks)
+}
+
+func saveSessionMarksLocked(baseDir string, marks map[string]SessionMark) error {
+	entries := make([]SessionMark, 0, len(marks))
+	for _, mark := range marks {
+		entries = append(entries, mark)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sessionKey(entries[i].SessionID, entries[i].Tool) < sessionKey(entries[j].SessionID, entries[j].Tool)
+	})
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(SessionMarksPath(baseDir), data, 0o600)
+}
+
+func markSessionPushed(baseDir, sessionID, tool, url string, now time.Time) error {
+	return updateSessionMark(baseDir, sessionID, tool, func(mark *SessionMark) {
+		mark.PushedAt = now.UTC().Format(time.RFC3339Nano)
+		if url != "" {
+			mark.RemoteURL = url
+		}
+	})
+}
+
+// StarSession stars or unstars a session. Starred sessions are kept by the
+// retention policy.
+func StarSession(baseDir, sessionID, tool string, starred bool) error {
+	return updateSessionMark(baseDir, sessionID, tool, func(mark *SessionMark) {
+		mark.Starred = starred
+	})
+}
+
+func markSessionSuppressed(baseDir, sessionID, tool string) error {
+	return updateSessionMark(baseDir, sessionID, tool, func(mark *SessionMark) {
+		mark.Suppressed = true
+	})
+}
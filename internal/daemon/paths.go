@@ -57,3 +57,20 @@ func StateDir(baseDir string) string {
 func SessionsDir(baseDir string) string {
 	return filepath.Join(baseDir, "sessions")
 }
+
+func UploadQueuePath(baseDir string) string {
+	return filepath.Join(baseDir, "upload-queue.json")
+}
+
+func IndexPath(baseDir string) string {
+	return filepath.Join(baseDir, "index.db")
+}
+
+// CaptureJournalDir holds hook events acknowledged but not yet written.
+func CaptureJournalDir(baseDir string) string {
+	return filepath.Join(baseDir, "capture-journal")
+}
+
+func SessionMarksPath(baseDir string) string {
+	return filepath.Join(baseDir, "session-marks.json")
+}
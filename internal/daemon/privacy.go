@@ -0,0 +1,233 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+// Files that opt a directory tree out of capture. The nearest one found
+// walking up from the session cwd applies.
+const (
+	tabsIgnoreFile  = ".tabsignore" // any content: do not capture
+	tabsProjectFile = ".tabs.toml"  // [capture] mode = "full" | "local-only" | "ignore"
+)
+
+// PrivacyRules decides from its cwd whether a session is captured and
+// whether it may be pushed.
+type PrivacyRules struct {
+	IgnoreCwds    []string // sessions under these paths are dropped
+	LocalOnlyCwds []string // sessions under these paths are never pushed
+}
+
+// PrivacyMatch is the capture mode that applies to a cwd and the rule that
+// set it.
+type PrivacyMatch struct {
+	Mode   string // config.CaptureFull, CaptureLocalOnly or CaptureIgnore
+	Source string // config key or directory file; "" when nothing matched
+}
+
+// PrivacyRulesFromConfig builds the rules from the [privacy] settings.
+func PrivacyRulesFromConfig(cfg config.PrivacyConfig) PrivacyRules {
+	return PrivacyRules{
+		IgnoreCwds:    cleanCwdList(cfg.IgnoreCwds),
+		LocalOnlyCwds: cleanCwdList(cfg.LocalOnlyCwds),
+	}
+}
+
+func cleanCwdList(dirs []string) []string {
+	out := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			out = append(out, filepath.Clean(config.ExpandHome(dir)))
+		}
+	}
+	return out
+}
+
+// Configured reports whether any global rule is set.
+func (r PrivacyRules) Configured() bool {
+	return len(r.IgnoreCwds) > 0 || len(r.LocalOnlyCwds) > 0
+}
+
+// Match returns the most restrictive of the global rules and the nearest
+// directory file. A session whose cwd is unknown may belong to any
+// directory, so with global rules set it is local-only.
+func (r PrivacyRules) Match(cwd string) PrivacyMatch {
+	match := PrivacyMatch{Mode: config.CaptureFull}
+	cwd = strings.TrimSpace(cwd)
+	if cwd == "" {
+		if r.Configured() {
+			match = PrivacyMatch{Mode: config.CaptureLocalOnly, Source: "unknown cwd"}
+		}
+		return match
+	}
+	cwd = filepath.Clean(cwd)
+	switch {
+	case cwdExcluded(cwd, r.IgnoreCwds):
+		return PrivacyMatch{Mode: config.CaptureIgnore, Source: "privacy.ignore_cwds"}
+	case cwdExcluded(cwd, r.LocalOnlyCwds):
+		match = PrivacyMatch{Mode: config.CaptureLocalOnly, Source: "privacy.local_only_cwds"}
+	}
+	if project := projectCaptureMode(cwd); captureRank(project.Mode) > captureRank(match.Mode) {
+		match = project
+	}
+	return match
+}
+
+// projectCaptureMode walks up from cwd to the nearest directory file that
+// sets a capture mode.
+func projectCaptureMode(cwd string) PrivacyMatch {
+	if !filepath.IsAbs(cwd) {
+		return PrivacyMatch{Mode: config.CaptureFull}
+	}
+	for dir := cwd; ; {
+		ignorePath := filepath.Join(dir, tabsIgnoreFile)
+		if _, err := os.Stat(ignorePath); err == nil {
+			return PrivacyMatch{Mode: config.CaptureIgnore, Source: ignorePath}
+		}
+		projectPath := filepath.Join(dir, tabsProjectFile)
+		if data, err := os.ReadFile(projectPath); err == nil {
+			project, err := config.ParseProjectConfig(data)
+			if err != nil {
+				// A broken opt-out must not leak the session.
+				return PrivacyMatch{Mode: config.CaptureIgnore, Source: projectPath}
+			}
+			if project.CaptureMode != "" {
+				return PrivacyMatch{Mode: project.CaptureMode, Source: projectPath}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return PrivacyMatch{Mode: config.CaptureFull}
+		}
+		dir = parent
+	}
+}
+
+func captureRank(mode string) int {
+	switch mode {
+	case config.CaptureIgnore:
+		return 2
+	case config.CaptureLocalOnly:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// hookEventCwd returns the working directory a hook event reports: cwd for
+// Claude Code, the first workspace root for Cursor.
+func hookEventCwd(event map[string]interface{}) string {
+	if cwd, ok := event["cwd"].(string); ok && cwd != "" {
+		return cwd
+	}
+	if roots, ok := event["workspace_roots"].([]interface{}); ok && len(roots) > 0 {
+		if root, ok := roots[0].(string); ok {
+			return root
+		}
+	}
+	return ""
+}
+
+// privacyState holds the rules and the sessions they dropped. It has its
+// own lock so a hook can be checked before it is acknowledged without
+// waiting on a capture.
+type privacyState struct {
+	mu         sync.Mutex
+	baseDir    string
+	rules      PrivacyRules
+	suppressed map[string]bool // session key -> an event was dropped since start
+}
+
+// loadPrivacyState remembers the sessions dropped by earlier daemon runs.
+func loadPrivacyState(baseDir string) *privacyState {
+	p := &privacyState{baseDir: baseDir, suppressed: make(map[string]bool)}
+	if marks, err := loadSessionMarks(baseDir); err == nil {
+		for key, mark := range marks {
+			if mark.Suppressed {
+				p.suppressed[key] = false
+			}
+		}
+	}
+	return p
+}
+
+func (p *privacyState) setRules(rules PrivacyRules) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+}
+
+// ignores reports whether a session is dropped, without recording it.
+func (p *privacyState) ignores(sessionID, tool, cwd string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.suppressed[sessionKey(sessionID, tool)]; ok {
+		return true
+	}
+	return p.rules.Match(cwd).Mode == config.CaptureIgnore
+}
+
+// unknownCwdSuppressed reports whether a polled conversation whose cwd is
+// not known must be skipped: with any global rule set it may belong to an
+// ignored or local-only directory, so it is not written until its cwd is
+// known.
+func (p *privacyState) unknownCwdSuppressed(cwd string) bool {
+	if cwd != "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rules.Configured()
+}
+
+// suppressedCount is the number of sessions whose events were dropped since
+// the daemon started.
+func (p *privacyState) suppressedCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count := 0
+	for _, dropped := range p.suppressed {
+		if dropped {
+			count++
+		}
+	}
+	return count
+}
+
+// suppressSession reports whether a session is dropped by the privacy rules.
+// Dropped sessions are remembered in the session marks, so later events that
+// carry no cwd, and Cursor conversations polled after a restart, are dropped
+// too.
+func (s *Server) suppressSession(sessionID, tool, cwd string) bool {
+	p := s.privacy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := sessionKey(sessionID, tool)
+	if _, ok := p.suppressed[key]; ok {
+		p.suppressed[key] = true
+		return true
+	}
+	if cwd == "" {
+		return false
+	}
+	match := p.rules.Match(cwd)
+	if match.Mode != config.CaptureIgnore {
+		return false
+	}
+	s.logger.Debug("session suppressed by privacy rule", "session_id", sessionID, "rule", match.Source)
+	p.suppressed[key] = true
+	if err := markSessionSuppressed(s.baseDir, sessionID, tool); err != nil {
+		s.logger.Warn("session mark save failed", "session_id", sessionID, "error", err)
+	}
+	return true
+}
+
+// captureSuppressed checks a hook event against the privacy rules.
+func (s *Server) captureSuppressed(tool, sessionID string, event map[string]interface{}) bool {
+	return s.suppressSession(sessionID, tool, hookEventCwd(event))
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestPrivacyRulesMatch(t *testing.T) {
+	root := t.TempDir()
+	for dir, files := range map[string]map[string]string{
+		"secret":          {tabsIgnoreFile: ""},
+		"client":          {tabsProjectFile: "[capture]\nmode = \"local-only\" # never share\n"},
+		"client/oss":      {tabsProjectFile: "[capture]\nmode = \"full\"\n"},
+		"client/oss/docs": {tabsProjectFile: "[other]\nmode = \"ignore\"\n"},
+		"broken":          {tabsProjectFile: "[capture]\nmode = \"sometimes\"\n"},
+		"app/src":         nil,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(root, dir, name), []byte(content), 0o644); err != nil {
+				t.Fatalf("write %s: %v", name, err)
+			}
+		}
+	}
+
+	rules := PrivacyRulesFromConfig(config.PrivacyConfig{
+		IgnoreCwds:    []string{filepath.Join(root, "app", "private")},
+		LocalOnlyCwds: []string{filepath.Join(root, "client", "oss", "internal")},
+	})
+	cases := []struct {
+		cwd    string
+		mode   string
+		source string
+	}{
+		{"app/src", config.CaptureFull, ""},
+		{"app/private/x", config.CaptureIgnore, "privacy.ignore_cwds"},
+		{"secret/deep/dir", config.CaptureIgnore, "secret/" + tabsIgnoreFile},
+		{"client/api", config.CaptureLocalOnly, "client/" + tabsProjectFile},
+		// The nearest file wins, but never beats a stricter global rule.
+		{"client/oss", config.CaptureFull, ""},
+		{"client/oss/docs", config.CaptureFull, ""},
+		{"client/oss/internal", config.CaptureLocalOnly, "privacy.local_only_cwds"},
+		{"broken", config.CaptureIgnore, "broken/" + tabsProjectFile},
+	}
+	for _, tc := range cases {
+		got := rules.Match(filepath.Join(root, tc.cwd))
+		source := got.Source
+		if rel, err := filepath.Rel(root, source); err == nil && filepath.IsAbs(source) {
+			source = filepath.ToSlash(rel)
+		}
+		if got.Mode != tc.mode || (tc.source != "" && source != tc.source) {
+			t.Errorf("%s: got %+v, want mode %s from %s", tc.cwd, got, tc.mode, tc.source)
+		}
+	}
+	// An unknown cwd may be under any rule, so it is never pushed.
+	if got := rules.Match(""); got.Mode != config.CaptureLocalOnly {
+		t.Errorf("empty cwd: got %+v", got)
+	}
+	if got := (PrivacyRules{}).Match(""); got.Mode != config.CaptureFull {
+		t.Errorf("empty cwd without rules: got %+v", got)
+	}
+}
+
+func TestSuppressedSessionsAreDroppedAndRemembered(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	secret := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secret, tabsIgnoreFile), nil, 0o644); err != nil {
+		t.Fatalf("write ignore file: %v", err)
+	}
+	srv.privacy.setRules(PrivacyRulesFromConfig(config.PrivacyConfig{IgnoreCwds: []string{"/work/private"}}))
+
+	claudeID := "7a8b9c0d-0000-4000-8000-000000000001"
+	if !srv.captureSuppressed("claude-code", claudeID, map[string]interface{}{"session_id": claudeID, "cwd": "/work/private/api"}) {
+		t.Fatalf("expected the ignore_cwds session to be suppressed")
+	}
+	if !srv.captureSuppressed("claude-code", claudeID, map[string]interface{}{"session_id": claudeID}) {
+		t.Fatalf("expected later events without a cwd to be suppressed")
+	}
+	cursorID := "7a8b9c0d-0000-4000-8000-000000000002"
+	if !srv.captureSuppressed("cursor", cursorID, map[string]interface{}{"conversation_id": cursorID, "workspace_roots": []interface{}{secret}}) {
+		t.Fatalf("expected the .tabsignore workspace to be suppressed")
+	}
+	if srv.captureSuppressed("claude-code", "7a8b9c0d-0000-4000-8000-000000000003", map[string]interface{}{"cwd": "/work/public"}) {
+		t.Fatalf("unrelated session suppressed")
+	}
+	if got := srv.privacy.suppressedCount(); got != 2 {
+		t.Fatalf("expected 2 suppressed sessions, got %d", got)
+	}
+
+	// After a restart the composer poller has no cwd to go on; the session
+	// marks still drop the conversation and nothing is written for it.
+	srv.index.Close()
+	restarted := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer restarted.index.Close()
+	restarted.composerMarkers = make(map[string]int64)
+	composer := cursorComposer{ComposerID: cursorID, LastUpdatedAt: 1, Conversation: []cursorBubble{{BubbleID: "b1", Type: 1, Text: "secret prompt"}}}
+	if err := restarted.processCursorComposer(nil, composer, 1); err != nil {
+		t.Fatalf("process composer: %v", err)
+	}
+	if _, ok, _ := findExistingSessionFile(baseDir, cursorID, "cursor"); ok {
+		t.Fatalf("suppressed composer was written")
+	}
+	if got := restarted.privacy.suppressedCount(); got != 1 {
+		t.Fatalf("expected 1 suppressed session after restart, got %d", got)
+	}
+}
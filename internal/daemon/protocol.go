@@ -0,0 +1,248 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// Socket protocol versions. A 1.0 connection carries one request and is
+// closed after the response, which is all the tabs-cli hook commands need.
+// 1.1 adds the hello handshake, connections that stay open for further
+// requests and capture_event batches. Both are accepted, so hook scripts
+// running an older tabs-cli keep working after a daemon upgrade.
+const (
+	protocolVersion10 = "1.0"
+	protocolVersion11 = "1.1"
+
+	protocolVersion = protocolVersion11 // newest
+)
+
+var supportedVersions = []string{protocolVersion10, protocolVersion11}
+
+// Capabilities advertised by hello on 1.1 connections.
+const (
+	capabilityPersistent   = "persistent_connections"
+	capabilityCaptureBatch = "capture_batch"
+)
+
+const (
+	requestTimeout  = 5 * time.Second  // reading the first request and handling each one
+	idleTimeout     = 60 * time.Second // a 1.1 connection waiting for its next request
+	maxCaptureBatch = 500
+
+	captureBatchItemTimeout = 50 * time.Millisecond // added to requestTimeout per batched event
+	batchIDTTL              = 10 * time.Minute      // how long a batch_id is remembered
+)
+
+// protocolConn is a client connection and the version its current request
+// used, which the response echoes.
+type protocolConn struct {
+	net.Conn
+	version string
+	reused  bool // answered a request and waits for more; guarded by connsMu
+}
+
+func supportedVersion(version string) bool {
+	for _, v := range supportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+type helloPayload struct {
+	Client string `json:"client"`
+}
+
+// handleHello reports what the daemon speaks. A client sends it as the
+// first request of a 1.1 connection; the capabilities only apply to 1.1
+// requests, so a hello sent as 1.0 gets none.
+func (s *Server) handleHello(conn *protocolConn, payload json.RawMessage) {
+	var req helloPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.writeResponse(conn, errorResponse("invalid_payload", "Invalid hello payload"))
+			return
+		}
+	}
+	capabilities := []string{}
+	if conn.version != protocolVersion10 {
+		capabilities = []string{capabilityPersistent, capabilityCaptureBatch}
+	}
+	if req.Client != "" {
+		s.logger.Debug("socket client connected", "client", req.Client, "version", conn.version)
+	}
+	s.writeResponse(conn, okResponse(map[string]interface{}{
+		"protocol_version":   conn.version,
+		"supported_versions": supportedVersions,
+		"capabilities":       capabilities,
+		"max_capture_batch":  maxCaptureBatch,
+	}))
+}
+
+// captureResult is the outcome of one event of a capture_event batch.
+type captureResult struct {
+	Status string         `json:"status"`
+	Data   interface{}    `json:"data,omitempty"`
+	Error  *responseError `json:"error,omitempty"`
+}
+
+// captureBatch is a capture_event batch sent with a batch_id. done is
+// closed once resp is set.
+type captureBatch struct {
+	done chan struct{}
+	resp response
+	at   time.Time
+}
+
+// handleCaptureBatch journals an array of capture_event payloads in order.
+// Events are judged one by one: a bad event gets an error result and the
+// rest are still captured, so the client only resends the failed ones.
+// Every event is journaled with its own fsync, so the request deadline
+// grows with the batch. A batch resent with the same batch_id, for example
+// after the client timed out, gets the first one's results instead of
+// being captured again.
+func (s *Server) handleCaptureBatch(conn *protocolConn, payload json.RawMessage, batchID string) {
+	if conn.version == protocolVersion10 {
+		s.writeResponse(conn, errorResponse("invalid_payload", "Batched capture_event requires protocol 1.1"))
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(payload, &items); err != nil {
+		s.writeResponse(conn, errorResponse("invalid_payload", "Invalid capture payload"))
+		return
+	}
+	if len(items) == 0 {
+		s.writeResponse(conn, errorResponse("invalid_payload", "Empty capture batch"))
+		return
+	}
+	if len(items) > maxCaptureBatch {
+		s.writeResponse(conn, errorResponse("batch_too_large", "Capture batch exceeds max_capture_batch"))
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout + time.Duration(len(items))*captureBatchItemTimeout))
+	if batchID == "" {
+		s.writeResponse(conn, s.captureBatch(items))
+		return
+	}
+	batch, first := s.claimBatch(batchID, time.Now())
+	if first {
+		batch.resp = s.captureBatch(items)
+		close(batch.done)
+	} else {
+		<-batch.done
+	}
+	s.writeResponse(conn, batch.resp)
+}
+
+func (s *Server) captureBatch(items []json.RawMessage) response {
+	results := make([]captureResult, len(items))
+	var failed int
+	for i, item := range items {
+		resp := s.capture(item)
+		results[i] = captureResult{Status: resp.Status, Data: resp.Data, Error: resp.Error}
+		if resp.Status != "ok" {
+			failed++
+		}
+	}
+	return okResponse(map[string]interface{}{
+		"results":  results,
+		"accepted": len(items) - failed,
+		"failed":   failed,
+	})
+}
+
+// claimBatch returns the batch recorded for batchID and whether the caller
+// registered it and must capture it. Batches older than batchIDTTL are
+// forgotten.
+func (s *Server) claimBatch(batchID string, now time.Time) (*captureBatch, bool) {
+	s.batchesMu.Lock()
+	defer s.batchesMu.Unlock()
+	for id, batch := range s.batches {
+		if now.Sub(batch.at) > batchIDTTL && batchDone(batch) {
+			delete(s.batches, id)
+		}
+	}
+	if batch, ok := s.batches[batchID]; ok {
+		return batch, false
+	}
+	if s.batches == nil {
+		s.batches = make(map[string]*captureBatch)
+	}
+	batch := &captureBatch{done: make(chan struct{}), at: now}
+	s.batches[batchID] = batch
+	return batch, true
+}
+
+func batchDone(batch *captureBatch) bool {
+	select {
+	case <-batch.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func isJSONArray(payload json.RawMessage) bool {
+	trimmed := bytesTrimSpace(payload)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// trackConn registers a connection unless the server is shutting down.
+func (s *Server) trackConn(conn *protocolConn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.closing {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*protocolConn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackConn(conn *protocolConn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, conn)
+}
+
+// armConn sets the deadline for reading the next request. It holds connsMu
+// so a deadline set here cannot replace the one closeIdleConns just set.
+func (s *Server) armConn(conn *protocolConn, first bool) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.closing && !first {
+		return false
+	}
+	timeout := requestTimeout
+	if !first {
+		conn.reused = true
+		timeout = idleTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return true
+}
+
+// closeIdleConns stops new requests on open connections: a 1.1 connection
+// waiting for its next request returns at once, and one in the middle of a
+// request returns after answering it. First requests are still served.
+func (s *Server) closeIdleConns() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.closing = true
+	for conn := range s.conns {
+		if conn.reused {
+			_ = conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startSocketServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := srv.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = srv.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		_ = srv.Shutdown(shutdownCtx)
+	})
+	return srv, baseDir
+}
+
+// socketClient sends requests over one connection.
+type socketClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialSocket(t *testing.T, srv *Server) *socketClient {
+	t.Helper()
+	conn, err := net.DialTimeout("unix", srv.socketPath, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &socketClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *socketClient) send(t *testing.T, version, kind string, payload interface{}) response {
+	t.Helper()
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := map[string]interface{}{"version": version, "type": kind, "payload": payload}
+	if err := json.NewEncoder(c.conn).Encode(req); err != nil {
+		t.Fatalf("send %s: %v", kind, err)
+	}
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read %s response: %v", kind, err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		t.Fatalf("decode %s response: %v", kind, err)
+	}
+	return resp
+}
+
+func TestProtocol10ClosesAfterOneRequest(t *testing.T) {
+	srv, _ := startSocketServer(t)
+	client := dialSocket(t, srv)
+	resp := client.send(t, "1.0", "daemon_status", map[string]interface{}{})
+	if resp.Status != "ok" || resp.Version != "1.0" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if _, err := client.reader.ReadBytes('\n'); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the daemon to close a 1.0 connection, got %v", err)
+	}
+
+	client = dialSocket(t, srv)
+	batch := []interface{}{map[string]interface{}{"tool": "claude-code", "event": map[string]interface{}{"session_id": "x"}}}
+	if resp := client.send(t, "1.0", "capture_event", batch); resp.Status != "error" || resp.Error.Code != "invalid_payload" {
+		t.Fatalf("expected 1.0 batch to be refused, got %+v", resp)
+	}
+
+	client = dialSocket(t, srv)
+	if resp := client.send(t, "2.0", "hello", nil); resp.Status != "error" || resp.Error.Code != "unsupported_version" {
+		t.Fatalf("expected unsupported_version, got %+v", resp)
+	}
+}
+
+func TestProtocol11PersistentConnectionAndBatch(t *testing.T) {
+	srv, baseDir := startSocketServer(t)
+	client := dialSocket(t, srv)
+
+	resp := client.send(t, "1.1", "hello", map[string]interface{}{"client": "protocol-test"})
+	var hello struct {
+		ProtocolVersion   string   `json:"protocol_version"`
+		SupportedVersions []string `json:"supported_versions"`
+		Capabilities      []string `json:"capabilities"`
+		MaxCaptureBatch   int      `json:"max_capture_batch"`
+	}
+	data, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(data, &hello); err != nil || resp.Status != "ok" || resp.Version != "1.1" {
+		t.Fatalf("unexpected hello: %+v (%v)", resp, err)
+	}
+	if hello.ProtocolVersion != "1.1" || len(hello.SupportedVersions) != 2 || len(hello.Capabilities) != 2 || hello.MaxCaptureBatch != maxCaptureBatch {
+		t.Fatalf("unexpected hello data: %+v", hello)
+	}
+
+	sessionID := "6e7f8091-0000-4000-8000-000000000001"
+	transcript := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	line := `{"type":"user","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(transcript, []byte(line), 0o600); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := func(name string) map[string]interface{} {
+		return map[string]interface{}{"tool": "claude-code", "event": map[string]interface{}{
+			"session_id": sessionID, "transcript_path": transcript, "cwd": "/work/app", "hook_event_name": name,
+		}}
+	}
+	batch := []interface{}{
+		hook("SessionStart"),
+		map[string]interface{}{"tool": "claude-code", "event": map[string]interface{}{"cwd": "/work/app"}},
+		hook("UserPromptSubmit"),
+	}
+	resp = client.send(t, "1.1", "capture_event", batch)
+	var result struct {
+		Results  []captureResult `json:"results"`
+		Accepted int             `json:"accepted"`
+		Failed   int             `json:"failed"`
+	}
+	data, _ = json.Marshal(resp.Data)
+	if err := json.Unmarshal(data, &result); err != nil || resp.Status != "ok" {
+		t.Fatalf("unexpected batch response: %+v (%v)", resp, err)
+	}
+	if result.Accepted != 2 || result.Failed != 1 || len(result.Results) != 3 {
+		t.Fatalf("unexpected batch result: %+v", result)
+	}
+	if r := result.Results[1]; r.Status != "error" || r.Error == nil || r.Error.Code != "invalid_payload" {
+		t.Fatalf("expected the event without session_id to fail alone: %+v", r)
+	}
+
+	// The connection stays open for more requests, single ones included.
+	if resp := client.send(t, "1.1", "capture_event", hook("Stop")); resp.Status != "ok" {
+		t.Fatalf("single capture on a 1.1 connection: %+v", resp)
+	}
+	if resp := client.send(t, "1.1", "daemon_status", nil); resp.Status != "ok" {
+		t.Fatalf("status on a 1.1 connection: %+v", resp)
+	}
+	waitForCaptures(t, srv.captures)
+	if stats := srv.captures.Stats(); stats.Processed != 3 || stats.Failed != 0 {
+		t.Fatalf("unexpected capture stats: %+v", stats)
+	}
+	path, ok, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if !ok {
+		t.Fatalf("session file not written")
+	}
+	if types := eventTypes(readEvents(t, path)); types != "session_start,message,hook,hook" {
+		t.Fatalf("unexpected events: %v", types)
+	}
+}
+
+func TestCaptureBatchIDIsIdempotent(t *testing.T) {
+	srv, baseDir := startSocketServer(t)
+	client := dialSocket(t, srv)
+
+	sessionID := "6e7f8091-0000-4000-8000-000000000002"
+	transcript := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	line := `{"type":"user","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(transcript, []byte(line), 0o600); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := func(name string) map[string]interface{} {
+		return map[string]interface{}{"tool": "claude-code", "event": map[string]interface{}{
+			"session_id": sessionID, "transcript_path": transcript, "cwd": "/work/app", "hook_event_name": name,
+		}}
+	}
+	req := map[string]interface{}{
+		"version":  "1.1",
+		"type":     "capture_event",
+		"batch_id": "batch-1",
+		"payload":  []interface{}{hook("SessionStart"), hook("Stop")},
+	}
+	// The same batch is sent again, as a client does after a timeout.
+	var first string
+	for i := 0; i < 2; i++ {
+		_ = client.conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := json.NewEncoder(client.conn).Encode(req); err != nil {
+			t.Fatalf("send batch: %v", err)
+		}
+		line, err := client.reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("read batch response: %v", err)
+		}
+		if i == 0 {
+			first = string(line)
+		} else if string(line) != first {
+			t.Fatalf("resent batch got a different response:\n%s\n%s", first, line)
+		}
+	}
+
+	waitForCaptures(t, srv.captures)
+	if stats := srv.captures.Stats(); stats.Processed != 2 {
+		t.Fatalf("expected the batch to be captured once: %+v", stats)
+	}
+	path, ok, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if !ok {
+		t.Fatalf("session file not written")
+	}
+	if types := eventTypes(readEvents(t, path)); types != "session_start,message,hook" {
+		t.Fatalf("unexpected events: %v", types)
+	}
+}
+
+func TestShutdownEndsIdleConnections(t *testing.T) {
+	srv, _ := startSocketServer(t)
+	client := dialSocket(t, srv)
+	if resp := client.send(t, "1.1", "hello", nil); resp.Status != "ok" {
+		t.Fatalf("hello: %+v", resp)
+	}
+
+	// The connection now waits for its next request; shutdown must not wait
+	// for the idle timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown with an idle connection: %v", err)
+	}
+	if _, err := client.reader.ReadBytes('\n'); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the idle connection to be closed, got %v", err)
+	}
+}
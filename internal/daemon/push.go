@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/victorarias/tabs/internal/config"
+	"github.com/victorarias/tabs/internal/events"
 )
 
 type pushPayload struct {
@@ -32,12 +33,15 @@ type uploadRequest struct {
 }
 
 type uploadSession struct {
-	SessionID string        `json:"session_id"`
-	Tool      string        `json:"tool"`
-	CreatedAt string        `json:"created_at,omitempty"`
-	EndedAt   string        `json:"ended_at,omitempty"`
-	Cwd       string        `json:"cwd,omitempty"`
-	Events    []uploadEvent `json:"events"`
+	SessionID    string                       `json:"session_id"`
+	Tool         string                       `json:"tool"`
+	CreatedAt    string                       `json:"created_at,omitempty"`
+	EndedAt      string                       `json:"ended_at,omitempty"`
+	Cwd          string                       `json:"cwd,omitempty"`
+	Usage        *events.TokenUsage           `json:"usage,omitempty"`
+	UsageByModel map[string]events.TokenUsage `json:"usage_by_model,omitempty"`
+	CostUSD      *float64                     `json:"cost_usd,omitempty"`
+	Events       []uploadEvent                `json:"events"`
 }
 
 type uploadEvent struct {
@@ -46,6 +50,8 @@ type uploadEvent struct {
 	Tool      string          `json:"tool"`
 	SessionID string          `json:"session_id"`
 	Data      json.RawMessage `json:"data"`
+	Seq       int64           `json:"seq,omitempty"`
+	EventID   string          `json:"event_id,omitempty"`
 }
 
 type pushResult struct {
@@ -66,8 +72,8 @@ func handlePushSession(baseDir string, payload pushPayload) (pushResult, error)
 	if payload.SessionID == "" || payload.Tool == "" {
 		return pushResult{}, &pushError{Code: "invalid_payload", Message: "session_id and tool are required"}
 	}
-	if payload.Tool != "claude-code" && payload.Tool != "cursor" {
-		return pushResult{}, &pushError{Code: "invalid_payload", Message: "tool must be claude-code or cursor"}
+	if !IsRegisteredTool(payload.Tool) {
+		return pushResult{}, &pushError{Code: "invalid_payload", Message: "tool must be one of: " + strings.Join(RegisteredTools(), ", ")}
 	}
 
 	cfgPath, err := config.Path()
@@ -89,7 +95,7 @@ func handlePushSession(baseDir string, payload pushPayload) (pushResult, error)
 		return pushResult{}, &pushError{Code: "no_api_key", Message: "API key not configured"}
 	}
 
-	path, ok, err := findExistingSessionFile(baseDir, payload.SessionID, payload.Tool)
+	path, ok, err := locateSessionFile(baseDir, payload.SessionID, payload.Tool)
 	if err != nil {
 		return pushResult{}, &pushError{Code: "storage_error", Message: "failed to locate session file"}
 	}
@@ -97,29 +103,78 @@ func handlePushSession(baseDir string, payload pushPayload) (pushResult, error)
 		return pushResult{}, &pushError{Code: "session_not_found", Message: "session not found"}
 	}
 
-	events, meta, err := readSessionEvents(path)
+	sessionEvents, meta, err := readSessionEvents(path)
 	if err != nil {
 		return pushResult{}, &pushError{Code: "storage_error", Message: err.Error()}
 	}
-	if len(events) == 0 {
+	if len(sessionEvents) == 0 {
 		return pushResult{}, &pushError{Code: "storage_error", Message: "session contains no events"}
 	}
+	if match := PrivacyRulesFromConfig(cfg.Privacy).Match(meta.Cwd); match.Mode != config.CaptureFull {
+		return pushResult{}, &pushError{Code: "push_forbidden", Message: "session is local-only (" + match.Source + ")"}
+	}
 
 	resolvedTags := mergeTags(cfg.Remote.DefaultTags, payload.Tags)
 
+	var usage *events.TokenUsage
+	var byModel map[string]events.TokenUsage
+	var cost *float64
+	if md, err := ReplaySessionMetadata(path); err == nil && md.Usage != nil {
+		usage = md.Usage
+		byModel = md.UsageByModel
+		value := events.SessionCost(md.UsageByModel, cfg.Pricing)
+		cost = &value
+	}
+
 	req := uploadRequest{
 		Session: uploadSession{
-			SessionID: payload.SessionID,
-			Tool:      payload.Tool,
-			CreatedAt: meta.CreatedAt,
-			EndedAt:   meta.EndedAt,
-			Cwd:       meta.Cwd,
-			Events:    events,
+			SessionID:    payload.SessionID,
+			Tool:         payload.Tool,
+			CreatedAt:    meta.CreatedAt,
+			EndedAt:      meta.EndedAt,
+			Cwd:          meta.Cwd,
+			Usage:        usage,
+			UsageByModel: byModel,
+			CostUSD:      cost,
+			Events:       sessionEvents,
 		},
 		Tags: resolvedTags,
 	}
 
-	return pushToRemote(cfg, req)
+	result, err := pushToRemote(cfg, req)
+	if perr, ok := err.(*pushError); err == nil || (ok && perr.Code == "duplicate_session") {
+		// Either way the remote holds a copy; the retention policy keeps it.
+		_ = markSessionPushed(baseDir, payload.SessionID, payload.Tool, result.URL, time.Now())
+	}
+	if err != nil {
+		return result, err
+	}
+	// Sub-agents are stored as their own sessions; share them along with the
+	// parent. One that is already uploaded or missing locally is skipped.
+	for _, childID := range subagentSessionIDs(sessionEvents) {
+		_, _ = handlePushSession(baseDir, pushPayload{SessionID: childID, Tool: payload.Tool, Tags: payload.Tags})
+	}
+	return result, nil
+}
+
+// subagentSessionIDs lists the child sessions named by subagent events.
+func subagentSessionIDs(events []uploadEvent) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.EventType != "subagent" {
+			continue
+		}
+		var data struct {
+			ChildSessionID string `json:"child_session_id"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err != nil || data.ChildSessionID == "" || seen[data.ChildSessionID] {
+			continue
+		}
+		seen[data.ChildSessionID] = true
+		ids = append(ids, data.ChildSessionID)
+	}
+	return ids
 }
 
 type sessionMeta struct {
@@ -129,7 +184,7 @@ type sessionMeta struct {
 }
 
 func readSessionEvents(path string) ([]uploadEvent, sessionMeta, error) {
-	file, err := os.Open(path)
+	file, err := OpenSessionFile(path)
 	if err != nil {
 		return nil, sessionMeta{}, err
 	}
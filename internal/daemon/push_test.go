@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestPushRefusesUnknownCwdWithPrivacyRules(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	var uploads atomic.Int32
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"remote-1","url":"https://tabs.example/sessions/remote-1"}`))
+	}))
+	defer remote.Close()
+
+	cfg := config.Default()
+	cfg.Remote.ServerURL = remote.URL
+	cfg.Remote.APIKey = "tabs_0123456789abcdef0123456789abcdef"
+	cfg.Privacy.LocalOnlyCwds = []string{"/work/client"}
+	cfgPath := filepath.Join(home, ".tabs", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := config.Write(cfgPath, cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	// A session whose start never recorded a cwd.
+	baseDir := t.TempDir()
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer srv.index.Close()
+	sessionID := "0b4f7d8e-1111-4222-8333-944455556677"
+	sessionPath, err := srv.state.EnsureSessionFile(baseDir, sessionID, "cursor", time.Now())
+	if err != nil {
+		t.Fatalf("ensure session file: %v", err)
+	}
+	cursor := &SessionCursor{SessionID: sessionID}
+	for _, event := range []map[string]interface{}{
+		buildEvent("session_start", sessionID, "cursor", time.Now(), map[string]interface{}{"metadata": map[string]interface{}{}}),
+		buildCursorMessage(sessionID, time.Now(), "user", "hello"),
+	} {
+		if _, err := srv.appendEvent(sessionPath, cursor, event); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	payload := pushPayload{SessionID: sessionID, Tool: "cursor"}
+	_, err = handlePushSession(baseDir, payload)
+	var perr *pushError
+	if !errors.As(err, &perr) || perr.Code != "push_forbidden" {
+		t.Fatalf("expected push_forbidden for an unknown cwd, got %v", err)
+	}
+	if got := uploads.Load(); got != 0 {
+		t.Fatalf("expected nothing uploaded, got %d uploads", got)
+	}
+
+	// Without privacy rules nothing restricts the session.
+	cfg.Privacy = config.PrivacyConfig{}
+	if err := config.Write(cfgPath, cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := handlePushSession(baseDir, payload); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if got := uploads.Load(); got != 1 {
+		t.Fatalf("expected one upload, got %d", got)
+	}
+}
@@ -0,0 +1,257 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	queueStatusPending = "pending"
+	queueStatusFailed  = "failed"
+
+	queueBaseBackoff = 30 * time.Second
+	queueMaxBackoff  = time.Hour
+	queuePollEvery   = 10 * time.Second
+)
+
+// UploadQueueEntry is one session waiting to be pushed to the remote server.
+type UploadQueueEntry struct {
+	SessionID     string `json:"session_id"`
+	Tool          string `json:"tool"`
+	Status        string `json:"status"`
+	EnqueuedAt    string `json:"enqueued_at"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorCode string `json:"last_error_code,omitempty"`
+}
+
+// uploadQueue is the durable outbound queue behind remote.auto_push. It is
+// persisted to UploadQueuePath after every mutation so pending uploads
+// survive daemon restarts.
+type uploadQueue struct {
+	mu      sync.Mutex
+	path    string
+	entries []UploadQueueEntry
+}
+
+func loadUploadQueue(baseDir string) (*uploadQueue, error) {
+	q := &uploadQueue{path: UploadQueuePath(baseDir)}
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		return q, err
+	}
+	if err := json.Unmarshal(data, &q.entries); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// Enqueue adds a session, or re-arms it if it is already queued. A re-armed
+// entry starts over, so earlier failures do not stretch its backoff.
+func (q *uploadQueue) Enqueue(sessionID, tool string, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stamp := now.UTC().Format(time.RFC3339Nano)
+	for i := range q.entries {
+		entry := &q.entries[i]
+		if entry.SessionID != sessionID || entry.Tool != tool {
+			continue
+		}
+		entry.Status = queueStatusPending
+		entry.NextAttemptAt = stamp
+		entry.Attempts = 0
+		entry.LastError = ""
+		entry.LastErrorCode = ""
+		return q.saveLocked()
+	}
+	q.entries = append(q.entries, UploadQueueEntry{
+		SessionID:     sessionID,
+		Tool:          tool,
+		Status:        queueStatusPending,
+		EnqueuedAt:    stamp,
+		NextAttemptAt: stamp,
+	})
+	return q.saveLocked()
+}
+
+// Due returns pending entries whose next attempt time has passed.
+func (q *uploadQueue) Due(now time.Time) []UploadQueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []UploadQueueEntry
+	for _, entry := range q.entries {
+		if entry.Status != queueStatusPending {
+			continue
+		}
+		if next, err := time.Parse(time.RFC3339Nano, entry.NextAttemptAt); err == nil && next.After(now) {
+			continue
+		}
+		due = append(due, entry)
+	}
+	return due
+}
+
+// Complete drops an entry after a successful (or already-uploaded) push.
+func (q *uploadQueue) Complete(sessionID, tool string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := q.entries[:0]
+	for _, entry := range q.entries {
+		if entry.SessionID == sessionID && entry.Tool == tool {
+			continue
+		}
+		out = append(out, entry)
+	}
+	q.entries = out
+	return q.saveLocked()
+}
+
+// Fail records a failed attempt. Retryable failures are rescheduled with
+// exponential backoff; anything else parks the entry as failed.
+func (q *uploadQueue) Fail(sessionID, tool, code, message string, retry bool, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.entries {
+		entry := &q.entries[i]
+		if entry.SessionID != sessionID || entry.Tool != tool {
+			continue
+		}
+		entry.Attempts++
+		entry.LastErrorCode = code
+		entry.LastError = message
+		if retry {
+			entry.Status = queueStatusPending
+			entry.NextAttemptAt = now.Add(queueBackoff(entry.Attempts)).UTC().Format(time.RFC3339Nano)
+		} else {
+			entry.Status = queueStatusFailed
+			entry.NextAttemptAt = ""
+		}
+		break
+	}
+	return q.saveLocked()
+}
+
+// Snapshot returns a copy of the queue ordered by enqueue time.
+func (q *uploadQueue) Snapshot() []UploadQueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]UploadQueueEntry, len(q.entries))
+	copy(out, q.entries)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].EnqueuedAt < out[j].EnqueuedAt
+	})
+	return out
+}
+
+func (q *uploadQueue) saveLocked() error {
+	entries := q.entries
+	if entries == nil {
+		entries = []UploadQueueEntry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path, data, 0o600)
+}
+
+func queueBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := queueBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= queueMaxBackoff {
+			return queueMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// StartUploadQueue drains the auto-push queue in the background. It is a
+// no-op unless remote.auto_push is enabled.
+func StartUploadQueue(ctx context.Context, srv *Server) {
+	if !srv.autoPush.Load() {
+		return
+	}
+	srv.logger.Info("starting auto-push upload queue", "pending", len(srv.queue.Snapshot()))
+
+	go func() {
+		srv.drainUploadQueue()
+
+		ticker := time.NewTicker(queuePollEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				srv.drainUploadQueue()
+			}
+		}
+	}()
+}
+
+func (s *Server) drainUploadQueue() {
+	for _, entry := range s.queue.Due(time.Now().UTC()) {
+		s.processQueueEntry(entry)
+	}
+}
+
+func (s *Server) processQueueEntry(entry UploadQueueEntry) {
+	logger := s.logger
+	result, err := handlePushSession(s.baseDir, pushPayload{SessionID: entry.SessionID, Tool: entry.Tool})
+	if err == nil {
+		logger.Info("auto-push uploaded session", "session_id", entry.SessionID, "remote_id", result.RemoteID)
+		if err := s.queue.Complete(entry.SessionID, entry.Tool); err != nil {
+			logger.Warn("upload queue save failed", "error", err)
+		}
+		return
+	}
+
+	code, message := "storage_error", err.Error()
+	if perr, ok := err.(*pushError); ok {
+		code, message = perr.Code, perr.Message
+	}
+	switch code {
+	case "duplicate_session":
+		logger.Info("auto-push skipped already uploaded session", "session_id", entry.SessionID)
+		err = s.queue.Complete(entry.SessionID, entry.Tool)
+	case "push_forbidden":
+		logger.Info("auto-push skipped local-only session", "session_id", entry.SessionID, "reason", message)
+		err = s.queue.Complete(entry.SessionID, entry.Tool)
+	case "network_error":
+		logger.Warn("auto-push failed, will retry", "session_id", entry.SessionID, "attempts", entry.Attempts+1, "error", message)
+		err = s.queue.Fail(entry.SessionID, entry.Tool, code, message, true, time.Now().UTC())
+	default:
+		logger.Warn("auto-push failed", "session_id", entry.SessionID, "code", code, "error", message)
+		err = s.queue.Fail(entry.SessionID, entry.Tool, code, message, false, time.Now().UTC())
+	}
+	if err != nil {
+		logger.Warn("upload queue save failed", "error", err)
+	}
+}
+
+// enqueueAutoPush is called whenever a session_end event is persisted.
+func (s *Server) enqueueAutoPush(sessionID, tool string) {
+	if !s.autoPush.Load() || s.queue == nil {
+		return
+	}
+	if err := s.queue.Enqueue(sessionID, tool, time.Now().UTC()); err != nil {
+		s.logger.Warn("enqueue auto-push failed", "session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestUploadQueuePersistsAndBacksOff(t *testing.T) {
+	baseDir := t.TempDir()
+	q, err := loadUploadQueue(baseDir)
+	if err != nil {
+		t.Fatalf("load queue: %v", err)
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := q.Enqueue("sess-1", "claude-code", now); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if due := q.Due(now); len(due) != 1 {
+		t.Fatalf("expected 1 due entry, got %d", len(due))
+	}
+
+	if err := q.Fail("sess-1", "claude-code", "network_error", "offline", true, now); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if due := q.Due(now.Add(10 * time.Second)); len(due) != 0 {
+		t.Fatalf("expected entry to back off, got %d due", len(due))
+	}
+	if due := q.Due(now.Add(queueBaseBackoff)); len(due) != 1 {
+		t.Fatalf("expected entry due after backoff, got %d", len(due))
+	}
+
+	reloaded, err := loadUploadQueue(baseDir)
+	if err != nil {
+		t.Fatalf("reload queue: %v", err)
+	}
+	entries := reloaded.Snapshot()
+	if len(entries) != 1 || entries[0].Attempts != 1 || entries[0].LastErrorCode != "network_error" {
+		t.Fatalf("expected persisted entry with 1 attempt, got %+v", entries)
+	}
+
+	if err := reloaded.Fail("sess-1", "claude-code", "invalid_api_key", "bad key", false, now); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if due := reloaded.Due(now.Add(24 * time.Hour)); len(due) != 0 {
+		t.Fatalf("failed entries must not be retried automatically")
+	}
+}
+
+func TestUploadQueueReenqueueResetsAttempts(t *testing.T) {
+	q, err := loadUploadQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("load queue: %v", err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := q.Enqueue("sess-1", "claude-code", now); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := q.Fail("sess-1", "claude-code", "network_error", "offline", true, now); err != nil {
+			t.Fatalf("fail: %v", err)
+		}
+	}
+
+	later := now.Add(time.Minute)
+	if err := q.Enqueue("sess-1", "claude-code", later); err != nil {
+		t.Fatalf("re-enqueue: %v", err)
+	}
+	entries := q.Snapshot()
+	if len(entries) != 1 || entries[0].Attempts != 0 || entries[0].LastError != "" || entries[0].LastErrorCode != "" {
+		t.Fatalf("expected re-enqueue to reset attempts and errors, got %+v", entries)
+	}
+	if due := q.Due(later); len(due) != 1 {
+		t.Fatalf("expected re-enqueued entry to be due, got %d", len(due))
+	}
+
+	// The next failure backs off from the base again.
+	if err := q.Fail("sess-1", "claude-code", "network_error", "offline", true, later); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if due := q.Due(later.Add(queueBaseBackoff)); len(due) != 1 {
+		t.Fatalf("expected base backoff after re-enqueue, got %d due", len(due))
+	}
+}
+
+func TestQueueBackoffCaps(t *testing.T) {
+	if got := queueBackoff(1); got != queueBaseBackoff {
+		t.Fatalf("expected base backoff, got %s", got)
+	}
+	if got := queueBackoff(3); got != 4*queueBaseBackoff {
+		t.Fatalf("expected 4x backoff, got %s", got)
+	}
+	if got := queueBackoff(50); got != queueMaxBackoff {
+		t.Fatalf("expected capped backoff, got %s", got)
+	}
+}
+
+func TestProcessQueueEntryDuplicateCompletes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer remote.Close()
+
+	cfg := config.Default()
+	cfg.Remote.ServerURL = remote.URL
+	cfg.Remote.APIKey = "tabs_0123456789abcdef0123456789abcdef"
+	cfg.Remote.AutoPush = true
+	if err := os.MkdirAll(filepath.Join(home, ".tabs"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := config.Write(filepath.Join(home, ".tabs", "config.toml"), cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	baseDir := t.TempDir()
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := srv.Configure(cfg); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+
+	sessionID := "0b4f7d8e-1111-4222-8333-944455556666"
+	sessionPath, err := srv.state.EnsureSessionFile(baseDir, sessionID, "claude-code", time.Now())
+	if err != nil {
+		t.Fatalf("ensure session file: %v", err)
+	}
+	cursor := &SessionCursor{SessionID: sessionID}
+	start := buildEvent("session_start", sessionID, "claude-code", time.Now(), map[string]interface{}{"cwd": "/tmp/project"})
+	if _, err := srv.appendEvent(sessionPath, cursor, start); err != nil {
+		t.Fatalf("append start: %v", err)
+	}
+	end := buildEvent("session_end", sessionID, "claude-code", time.Now(), map[string]interface{}{"reason": "exit"})
+	if _, err := srv.appendEvent(sessionPath, cursor, end); err != nil {
+		t.Fatalf("append end: %v", err)
+	}
+
+	if got := len(srv.queue.Snapshot()); got != 1 {
+		t.Fatalf("expected session_end to enqueue, got %d entries", got)
+	}
+	srv.drainUploadQueue()
+	if got := len(srv.queue.Snapshot()); got != 0 {
+		t.Fatalf("expected duplicate_session to complete entry, got %d entries", got)
+	}
+}
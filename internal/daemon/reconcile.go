@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReconcileResult reports the startup catch-up pass over cursor state.
+type ReconcileResult struct {
+	InProgress        bool   `json:"in_progress"`
+	StartedAt         string `json:"started_at"`
+	FinishedAt        string `json:"finished_at,omitempty"`
+	SessionsScanned   int    `json:"sessions_scanned"`
+	SessionsRecovered int    `json:"sessions_recovered"`
+	EventsRecovered   int    `json:"events_recovered"`
+	Errors            int    `json:"errors"`
+}
+
+// StartReconciliation catches up transcripts that grew while the daemon was
+// down, after seeding the session index if it was just created. It runs in
+// the background so the socket is available immediately.
+func StartReconciliation(ctx context.Context, srv *Server) {
+	go func() {
+		srv.seedIndex()
+		result := srv.ReconcileCursors(ctx)
+		srv.logger.Info("startup reconciliation finished",
+			"sessions_scanned", result.SessionsScanned,
+			"sessions_recovered", result.SessionsRecovered,
+			"events_recovered", result.EventsRecovered,
+			"errors", result.Errors)
+	}()
+}
+
+// ReconcileCursors walks state/ and, for every cursor with a transcript that
+// changed since the cursor was last saved, appends the entries past the
+// cursor's position.
+func (s *Server) ReconcileCursors(ctx context.Context) ReconcileResult {
+	result := ReconcileResult{InProgress: true, StartedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	s.setReconcileResult(result)
+
+	sessionIDs, err := listCursorSessions(s.baseDir)
+	if err != nil {
+		s.logger.Warn("reconcile: list state failed", "error", err)
+		result.Errors++
+	}
+
+	for _, sessionID := range sessionIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		result.SessionsScanned++
+		written, _, err := s.tailSession(sessionID, true)
+		if err != nil {
+			s.logger.Warn("reconcile session failed", "session_id", sessionID, "error", err)
+			result.Errors++
+			continue
+		}
+		if written > 0 {
+			result.SessionsRecovered++
+			result.EventsRecovered += written
+		}
+	}
+
+	result.InProgress = false
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	s.setReconcileResult(result)
+	return result
+}
+
+func (s *Server) setReconcileResult(result ReconcileResult) {
+	s.state.SetReconcile(result)
+}
+
+func listCursorSessions(baseDir string) ([]string, error) {
+	entries, err := os.ReadDir(StateDir(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// tailSession appends transcript entries past the session's cursor. With
+// onlyIfModified it skips transcripts untouched since the cursor was saved.
+// It reports whether the session has ended.
+func (s *Server) tailSession(sessionID string, onlyIfModified bool) (int, bool, error) {
+	defer s.lockSession(sessionID)()
+
+	cursor, err := loadCursorState(s.baseDir, sessionID)
+	if err != nil {
+		return 0, false, err
+	}
+	if cursor.TranscriptPath == "" || cursor.Metadata == nil || cursor.Metadata.Tool == "" {
+		return 0, false, nil
+	}
+	ended := cursor.Metadata.EndedAt != ""
+	if s.suppressSession(sessionID, cursor.Metadata.Tool, cursor.Metadata.Cwd) {
+		return 0, ended, nil
+	}
+	capturer, ok := LookupCapturer(cursor.Metadata.Tool)
+	if !ok {
+		return 0, ended, nil
+	}
+	tailer, ok := capturer.(transcriptCapturer)
+	if !ok {
+		return 0, ended, nil
+	}
+
+	info, err := os.Stat(cursor.TranscriptPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ended, nil
+		}
+		return 0, ended, err
+	}
+	if onlyIfModified {
+		if updated, err := time.Parse(time.RFC3339Nano, cursor.UpdatedAt); err == nil && !info.ModTime().After(updated) {
+			return 0, ended, nil
+		}
+	}
+
+	createdAt := time.Now().UTC()
+	if ts, err := time.Parse(time.RFC3339Nano, cursor.Metadata.CreatedAt); err == nil {
+		createdAt = ts
+	}
+	sessionPath, err := s.state.EnsureSessionFile(s.baseDir, sessionID, cursor.Metadata.Tool, createdAt)
+	if err != nil {
+		return 0, ended, err
+	}
+
+	written, latest, err := tailer.appender(s)(sessionPath, sessionID, cursor, info.ModTime().UTC())
+	if err != nil {
+		return written, ended, err
+	}
+	if err := s.saveCursor(cursor); err != nil {
+		return written, ended, err
+	}
+	s.state.RecordEvent(sessionID, latest, written)
+	return written, cursor.Metadata.EndedAt != "", nil
+}
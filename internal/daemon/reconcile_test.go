@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReconcileCursorsCatchesUpTranscript(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sessionID := "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	first := `{"type":"user","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(transcriptPath, []byte(first), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+
+	hook := map[string]interface{}{
+		"session_id":      sessionID,
+		"transcript_path": transcriptPath,
+		"cwd":             "/work",
+		"hook_event_name": "UserPromptSubmit",
+	}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	// The daemon goes away; Claude Code keeps writing.
+	more := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]},"timestamp":"2026-01-01T12:00:01Z"}` + "\n" +
+		`{"type":"user","message":{"role":"user","content":"bye"},"timestamp":"2026-01-01T12:00:02Z"}` + "\n"
+	f, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	if _, err := f.WriteString(more); err != nil {
+		t.Fatalf("append transcript: %v", err)
+	}
+	f.Close()
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(transcriptPath, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	restarted := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result := restarted.ReconcileCursors(context.Background())
+	if result.SessionsScanned != 1 || result.SessionsRecovered != 1 || result.EventsRecovered != 2 {
+		t.Fatalf("unexpected reconcile result: %+v", result)
+	}
+	status := restarted.state.Snapshot(0)
+	if status.Reconcile == nil || status.Reconcile.InProgress || status.Reconcile.EventsRecovered != 2 {
+		t.Fatalf("expected reconcile result in status, got %+v", status.Reconcile)
+	}
+
+	again := restarted.ReconcileCursors(context.Background())
+	if again.EventsRecovered != 0 {
+		t.Fatalf("expected second pass to recover nothing, got %+v", again)
+	}
+}
@@ -0,0 +1,243 @@
+package daemon
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+const redactionHighEntropy = "high_entropy"
+
+// Redactor scrubs secrets from normalized events before they are persisted.
+type Redactor struct {
+	rules   []redactRule
+	entropy bool
+}
+
+type redactRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var builtinRedactRules = []struct {
+	name    string
+	pattern string
+}{
+	{"private_key", `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{"aws_access_key", `\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`},
+	{"aws_secret_key", `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`},
+	{"github_token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`},
+	{"jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\b`},
+	{"tabs_api_key", `\btabs_[A-Za-z0-9_-]{31,}\b`},
+}
+
+// Envelope keys of a tabs event or hook payload. They are only skipped at
+// the top level: the same names inside tool input or output are user
+// content like any other. Path-valued keys are skipped too, since the
+// entropy detector fires on long path segments and a redacted
+// transcript_path or cwd breaks transcript lookups and privacy rules.
+var redactEnvelopeKeys = map[string]struct{}{
+	"event_type": {},
+	"timestamp":  {},
+	"tool":       {},
+	"metadata":   {},
+
+	"transcript_path": {},
+	"cwd":             {},
+	"workspace_roots": {},
+}
+
+// Keys whose values are identifiers rather than user content, skipped at the
+// top level and in the event's data block, otherwise the entropy detector
+// would eat tool_use ids.
+var redactIDKeys = map[string]struct{}{
+	"session_id":         {},
+	"tool_use_id":        {},
+	"child_session_id":   {},
+	"parent_session_id":  {},
+	"parent_tool_use_id": {},
+	"agent_id":           {},
+	"parent_uuid":        {},
+}
+
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+
+// NewRedactor builds a redactor from config. Built-in detectors listed in
+// DisabledRules are skipped; user patterns are reported as custom_<n>.
+func NewRedactor(cfg config.RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return &Redactor{}, nil
+	}
+	disabled := make(map[string]struct{}, len(cfg.DisabledRules))
+	for _, name := range cfg.DisabledRules {
+		disabled[strings.TrimSpace(name)] = struct{}{}
+	}
+
+	r := &Redactor{}
+	for _, rule := range builtinRedactRules {
+		if _, skip := disabled[rule.name]; skip {
+			continue
+		}
+		r.rules = append(r.rules, redactRule{name: rule.name, pattern: regexp.MustCompile(rule.pattern)})
+	}
+	for i, raw := range cfg.Patterns {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %d: %w", i+1, err)
+		}
+		r.rules = append(r.rules, redactRule{name: fmt.Sprintf("custom_%d", i+1), pattern: pattern})
+	}
+	if _, skip := disabled[redactionHighEntropy]; !skip {
+		r.entropy = true
+	}
+	return r, nil
+}
+
+func defaultRedactor() *Redactor {
+	r, err := NewRedactor(config.Default().Redaction)
+	if err != nil {
+		return &Redactor{}
+	}
+	return r
+}
+
+// RedactEvent rewrites secrets in place and records the rules that fired under
+// event["metadata"]["redactions"]. It returns the sorted rule names.
+func (r *Redactor) RedactEvent(event map[string]interface{}) []string {
+	if r == nil || event == nil || (len(r.rules) == 0 && !r.entropy) {
+		return nil
+	}
+	fired := make(map[string]struct{})
+	for key, value := range event {
+		if _, skip := redactEnvelopeKeys[key]; skip {
+			continue
+		}
+		if _, skip := redactIDKeys[key]; skip {
+			continue
+		}
+		if data, ok := value.(map[string]interface{}); ok && key == "data" {
+			for dataKey, item := range data {
+				if _, skip := redactIDKeys[dataKey]; !skip {
+					data[dataKey] = r.redactValue(item, fired)
+				}
+			}
+			continue
+		}
+		event[key] = r.redactValue(value, fired)
+	}
+	if len(fired) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(fired))
+	for name := range fired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metadata, _ := event["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["redactions"] = names
+	event["metadata"] = metadata
+	return names
+}
+
+func (r *Redactor) redactValue(value interface{}, fired map[string]struct{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redactString(v, fired)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = r.redactValue(item, fired)
+		}
+		return v
+	case []map[string]interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item, fired).(map[string]interface{})
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(item, fired)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// redactString replaces every match in text and adds the rule names to fired.
+func (r *Redactor) redactString(text string, fired map[string]struct{}) string {
+	if text == "" {
+		return text
+	}
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(text) {
+			continue
+		}
+		text = rule.pattern.ReplaceAllString(text, redactionMarker(rule.name))
+		fired[rule.name] = struct{}{}
+	}
+	if r.entropy {
+		text = entropyCandidate.ReplaceAllStringFunc(text, func(token string) string {
+			if !looksLikeSecret(token) {
+				return token
+			}
+			fired[redactionHighEntropy] = struct{}{}
+			return redactionMarker(redactionHighEntropy)
+		})
+	}
+	return text
+}
+
+func redactionMarker(rule string) string {
+	return "[REDACTED:" + rule + "]"
+}
+
+// looksLikeSecret flags long tokens that mix character classes and carry more
+// entropy than hex digests or UUIDs, which top out at 4 bits per character.
+func looksLikeSecret(token string) bool {
+	var lower, upper, digit bool
+	for _, ch := range token {
+		switch {
+		case ch >= 'a' && ch <= 'z':
+			lower = true
+		case ch >= 'A' && ch <= 'Z':
+			upper = true
+		case ch >= '0' && ch <= '9':
+			digit = true
+		}
+	}
+	if !lower || !upper || !digit {
+		return false
+	}
+	return shannonEntropy(token) >= 4.5
+}
+
+func shannonEntropy(token string) float64 {
+	if token == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, ch := range token {
+		counts[ch]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
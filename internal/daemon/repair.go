@@ -0,0 +1,341 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// repairTailWindow is how much of a session file startup repair reads at a
+// time while looking for its last newline.
+const repairTailWindow = 64 << 10
+
+// CorruptLine is a session file line that does not hold a readable event.
+type CorruptLine struct {
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"` // in the decompressed stream for archives
+	Reason string `json:"reason"`
+}
+
+// SessionFileCheck is the fsck report for one session file.
+type SessionFileCheck struct {
+	Path     string        `json:"path"`
+	Events   int           `json:"events"`
+	Corrupt  []CorruptLine `json:"corrupt,omitempty"`
+	TornTail int64         `json:"torn_tail,omitempty"` // bytes after the last newline
+	Error    string        `json:"error,omitempty"`     // the file could not be read at all
+}
+
+func (c SessionFileCheck) OK() bool {
+	return c.Error == "" && c.TornTail == 0 && len(c.Corrupt) == 0
+}
+
+// FsckResult is the report of CheckSessions; Problems lists only the files
+// that are not OK.
+type FsckResult struct {
+	FilesChecked int                `json:"files_checked"`
+	Events       int                `json:"events"`
+	Problems     []SessionFileCheck `json:"problems,omitempty"`
+}
+
+// RepairResult reports the startup repair of live session files.
+type RepairResult struct {
+	FilesChecked      int   `json:"files_checked"`
+	FilesRepaired     int   `json:"files_repaired"`
+	BytesTruncated    int64 `json:"bytes_truncated"`
+	CursorsReconciled int   `json:"cursors_reconciled"`
+}
+
+// sessionLine is one newline-terminated line of a stored session file.
+type sessionLine struct {
+	Offset int64
+	End    int64  // offset just past the newline
+	Event  []byte // plaintext event; nil for the encryption header and blank lines
+	Reason string // why the line is not a readable event
+}
+
+// scanSessionLines reads a session file's stored lines, decrypting them when
+// the file is encrypted, and returns the length of a trailing fragment with
+// no newline. An encryption header that cannot be opened is an error rather
+// than a corrupt line: without the key nothing can be judged.
+func scanSessionLines(r io.Reader, fn func(sessionLine)) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	var dataKey []byte
+	for first := true; ; first = false {
+		raw, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if errors.Is(err, io.EOF) {
+			return int64(len(raw)), nil
+		}
+		line := sessionLine{Offset: offset, End: offset + int64(len(raw))}
+		offset = line.End
+		trimmed := bytes.TrimSpace(raw)
+		switch {
+		case first && isEncryptionHeader(trimmed):
+			if dataKey, err = openEncryptionHeader(trimmed); err != nil {
+				return 0, err
+			}
+		case len(trimmed) == 0:
+		case dataKey != nil:
+			plain, openErr := openLine(dataKey, trimmed)
+			if openErr != nil {
+				line.Reason = "cannot decrypt line"
+				break
+			}
+			line.Event, line.Reason = plain, eventProblem(plain)
+		default:
+			line.Event, line.Reason = trimmed, eventProblem(trimmed)
+		}
+		fn(line)
+	}
+}
+
+// eventProblem returns why a plaintext line is not a tabs event, or "".
+func eventProblem(line []byte) string {
+	var event struct {
+		EventType string `json:"event_type"`
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(line, &event); err != nil {
+		return "invalid JSON"
+	}
+	if event.EventType == "" {
+		return "missing event_type"
+	}
+	if event.Timestamp == "" {
+		return "missing timestamp"
+	}
+	return ""
+}
+
+// CheckSessionFile validates every line of a live or archived session file.
+func CheckSessionFile(path string) SessionFileCheck {
+	check := SessionFileCheck{Path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer file.Close()
+	var src io.Reader = file
+	if isArchivedSessionFile(path) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			check.Error = err.Error()
+			return check
+		}
+		defer zr.Close()
+		src = zr
+	}
+	lineNo := 0
+	torn, err := scanSessionLines(src, func(line sessionLine) {
+		lineNo++
+		switch {
+		case line.Reason != "":
+			check.Corrupt = append(check.Corrupt, CorruptLine{Line: lineNo, Offset: line.Offset, Reason: line.Reason})
+		case line.Event != nil:
+			check.Events++
+		}
+	})
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.TornTail = torn
+	return check
+}
+
+// CheckSessions validates every session file under baseDir. It only reads,
+// so it is safe to run while the daemon is capturing: a line being appended
+// at that moment can show up as a torn tail.
+func CheckSessions(baseDir string) (FsckResult, error) {
+	var result FsckResult
+	err := walkSessionFiles(baseDir, func(path string) {
+		check := CheckSessionFile(path)
+		result.FilesChecked++
+		result.Events += check.Events
+		if !check.OK() {
+			result.Problems = append(result.Problems, check)
+		}
+	})
+	return result, err
+}
+
+func walkSessionFiles(baseDir string, fn func(path string)) error {
+	days, err := os.ReadDir(SessionsDir(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(baseDir), day.Name())
+		files, err := os.ReadDir(dayDir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !file.IsDir() && IsSessionFileName(file.Name()) {
+				fn(filepath.Join(dayDir, file.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+// RepairSessions truncates torn tails left by a crash and pulls back cursors
+// that point past the end of their session file. It runs at startup, before
+// journaled captures are replayed. Archived files are written through a
+// rename and cannot be torn, so only live files are checked.
+func (s *Server) RepairSessions() RepairResult {
+	var result RepairResult
+	err := walkSessionFiles(s.baseDir, func(path string) {
+		if isArchivedSessionFile(path) {
+			return
+		}
+		result.FilesChecked++
+		removed, reconciled, err := s.repairSession(path, sessionIDFromFileName(filepath.Base(path)))
+		if err != nil {
+			s.logger.Warn("session repair failed", "path", path, "error", err)
+			return
+		}
+		if removed > 0 {
+			s.logger.Warn("truncated torn session tail", "path", path, "bytes", removed)
+			result.FilesRepaired++
+			result.BytesTruncated += removed
+		}
+		if reconciled {
+			result.CursorsReconciled++
+		}
+	})
+	if err != nil {
+		s.logger.Warn("session repair scan failed", "error", err)
+	}
+	if result.FilesRepaired > 0 || result.CursorsReconciled > 0 {
+		s.logger.Info("repaired session files", "files", result.FilesRepaired, "bytes_truncated", result.BytesTruncated, "cursors", result.CursorsReconciled)
+	}
+	return result
+}
+
+func (s *Server) repairSession(path, sessionID string) (int64, bool, error) {
+	defer s.lockSession(sessionID)()
+	removed, size, err := repairSessionFile(path)
+	if err != nil || sessionID == "" {
+		return removed, false, err
+	}
+
+	// Cursors of tools without a transcript track the session file itself;
+	// one that is past the end would skip the next event's dedup check
+	// against a line that is gone.
+	cursor, err := loadCursorState(s.baseDir, sessionID)
+	if err != nil || cursor.TranscriptPath != "" || cursor.LastOffset <= size {
+		return removed, false, err
+	}
+	if cursor.Metadata != nil && cursor.Metadata.FilePath != "" && cursor.Metadata.FilePath != path {
+		return removed, false, nil
+	}
+	last, err := lastSessionEvent(path)
+	if err != nil {
+		return removed, false, err
+	}
+	cursor.LastOffset = size
+	cursor.LastLineHash = ""
+	cursor.LastSeq = 0
+	if last != nil {
+		// Lost events hand their seqs back, so re-sent ones get the ids
+		// they had before.
+		unstamped, seq, err := unstampEvent(last)
+		if err != nil {
+			return removed, false, err
+		}
+		cursor.LastLineHash = hashLine(unstamped)
+		cursor.LastSeq = seq
+	}
+	if err := s.saveCursor(cursor); err != nil {
+		return removed, false, err
+	}
+	return removed, true, nil
+}
+
+// repairSessionFile truncates a live session file after its last newline
+// and returns the bytes removed and the resulting size. Only a fragment with
+// no newline can be a write the crash cut short; complete lines that are not
+// readable events are left in place for fsck to report, since dropping them
+// and everything after would lose data.
+func repairSessionFile(path string) (int64, int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := info.Size()
+	keep, err := lastLineEnd(file, size)
+	if err != nil || keep >= size {
+		return 0, size, err
+	}
+	if err := file.Truncate(keep); err != nil {
+		return 0, size, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, keep, err
+	}
+	return size - keep, keep, nil
+}
+
+// lastLineEnd returns the offset just past the last newline of a file, or 0
+// when it has none. It reads backwards from the end, so an intact file, the
+// common case at every startup, costs a single small read.
+func lastLineEnd(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, repairTailWindow)
+	for end := size; end > 0; {
+		start := end - repairTailWindow
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// lastSessionEvent returns the plaintext of the last readable event.
+func lastSessionEvent(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var last []byte
+	_, err = scanSessionLines(file, func(line sessionLine) {
+		if line.Reason == "" && line.Event != nil {
+			last = line.Event
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return last, nil
+}
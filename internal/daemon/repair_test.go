@@ -0,0 +1,219 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestCheckAndRepairSessionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "5d6e7f80-0000-4000-8000-000000000001-codex-cli-1767225600.jsonl")
+	good := `{"event_type":"message","timestamp":"2026-01-01T12:00:00Z"}`
+	content := good + "\n" +
+		"not json\n" +
+		`{"timestamp":"2026-01-01T12:00:01Z"}` + "\n" +
+		good + "\n" +
+		`{"event_type":"mess`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+
+	check := CheckSessionFile(path)
+	if check.Events != 2 || check.TornTail != int64(len(`{"event_type":"mess`)) || len(check.Corrupt) != 2 {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+	if c := check.Corrupt[0]; c.Line != 2 || c.Offset != int64(len(good)+1) || c.Reason != "invalid JSON" {
+		t.Fatalf("unexpected corrupt line: %+v", c)
+	}
+	if c := check.Corrupt[1]; c.Line != 3 || c.Reason != "missing event_type" {
+		t.Fatalf("unexpected corrupt line: %+v", c)
+	}
+
+	// Only the tail goes; corrupt lines before the last event are kept for
+	// fsck to report.
+	removed, size, err := repairSessionFile(path)
+	if err != nil || removed != int64(len(`{"event_type":"mess`)) || size != int64(len(content))-removed {
+		t.Fatalf("repair: removed=%d size=%d err=%v", removed, size, err)
+	}
+	if check := CheckSessionFile(path); check.TornTail != 0 || len(check.Corrupt) != 2 || check.Events != 2 {
+		t.Fatalf("unexpected check after repair: %+v", check)
+	}
+
+	// Zeroed blocks after a crash: only the newline-less run of NULs goes,
+	// complete lines that are not events stay for fsck to report.
+	if err := os.WriteFile(path, []byte(good+"\n"+"\x00\x00\x00\n\x00\x00"), 0o600); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+	if removed, _, err := repairSessionFile(path); err != nil || removed != 2 {
+		t.Fatalf("repair zeroed tail: removed=%d err=%v", removed, err)
+	}
+	if removed, _, err := repairSessionFile(path); err != nil || removed != 0 {
+		t.Fatalf("repair of an intact file removed %d bytes (err=%v)", removed, err)
+	}
+	if check := CheckSessionFile(path); check.TornTail != 0 || len(check.Corrupt) != 1 || check.Events != 1 {
+		t.Fatalf("unexpected check after repair: %+v", check)
+	}
+
+	// A file with no newline at all is one torn line.
+	if err := os.WriteFile(path, []byte(`{"event_type":"mess`), 0o600); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+	if removed, size, err := repairSessionFile(path); err != nil || removed != int64(len(`{"event_type":"mess`)) || size != 0 {
+		t.Fatalf("repair torn only line: removed=%d size=%d err=%v", removed, size, err)
+	}
+}
+
+func TestRepairSessionsReconcilesEventCursor(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "5d6e7f80-0000-4000-8000-000000000002"
+	capturer := EventCapturer{Name: "codex-cli"}
+	hookTime := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, text := range []string{"one", "two", "three"} {
+		event := map[string]interface{}{"event_type": "message", "data": map[string]interface{}{"role": "user", "content": text}}
+		if _, _, err := capturer.Capture(srv, event, sessionID, hookTime.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("capture: %v", err)
+		}
+	}
+	path, ok, _ := findExistingSessionFile(baseDir, sessionID, "codex-cli")
+	if !ok {
+		t.Fatalf("session file not written")
+	}
+
+	// The OS lost the last event and left a torn fragment, while the cursor
+	// saved after it survived.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(path, []byte(lines[0]+lines[1]+`{"event_ty`), 0o600); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+
+	result := srv.RepairSessions()
+	if result.FilesChecked != 1 || result.FilesRepaired != 1 || result.CursorsReconciled != 1 {
+		t.Fatalf("unexpected repair result: %+v", result)
+	}
+	cursor, err := loadCursorState(baseDir, sessionID)
+	if err != nil {
+		t.Fatalf("load cursor: %v", err)
+	}
+	unstamped, _, err := unstampEvent([]byte(strings.TrimSpace(lines[1])))
+	if err != nil {
+		t.Fatalf("unstamp: %v", err)
+	}
+	if cursor.LastOffset != int64(len(lines[0]+lines[1])) || cursor.LastLineHash != hashLine(unstamped) || cursor.LastSeq != 2 {
+		t.Fatalf("cursor not reconciled: offset=%d seq=%d", cursor.LastOffset, cursor.LastSeq)
+	}
+
+	// Re-sending the lost event writes it again instead of being taken for
+	// a duplicate of the line that is gone.
+	event := map[string]interface{}{"event_type": "message", "data": map[string]interface{}{"role": "user", "content": "three"}}
+	if n, _, err := capturer.Capture(srv, event, sessionID, hookTime.Add(2*time.Second)); err != nil || n != 1 {
+		t.Fatalf("recapture: n=%d err=%v", n, err)
+	}
+	if check := CheckSessionFile(path); !check.OK() || check.Events != 3 {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+	// It also takes back the seq and event_id of the lost copy.
+	var lost map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[2]), &lost); err != nil {
+		t.Fatalf("decode lost event: %v", err)
+	}
+	if last := readEvents(t, path)[2]; last["seq"] != float64(3) || last["event_id"] != lost["event_id"] {
+		t.Fatalf("re-sent event not stamped like the lost one: %v", last)
+	}
+	if result := srv.RepairSessions(); result.FilesRepaired != 0 || result.CursorsReconciled != 0 {
+		t.Fatalf("second repair changed something: %+v", result)
+	}
+}
+
+func TestRepairEncryptedSessionTail(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	enableTestEncryption(t, baseDir, config.EncryptionConfig{})
+	sessionID := "5d6e7f80-0000-4000-8000-000000000003"
+	event := map[string]interface{}{"event_type": "message", "data": map[string]interface{}{"role": "user", "content": "secret"}}
+	if _, _, err := (EventCapturer{Name: "codex-cli"}).Capture(srv, event, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "codex-cli")
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	// A complete line that does not decrypt, like a half-written sealed line
+	// followed by a later newline.
+	_, _ = file.WriteString("c2VhbGVk\n")
+	file.Close()
+
+	if check := CheckSessionFile(path); len(check.Corrupt) != 1 || check.Corrupt[0].Reason != "cannot decrypt line" || check.Events != 1 {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+	// Only the torn fragment goes; the complete line is kept.
+	file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	_, _ = file.WriteString("c2Vh")
+	file.Close()
+	if result := srv.RepairSessions(); result.FilesRepaired != 1 || result.BytesTruncated != int64(len("c2Vh")) {
+		t.Fatalf("unexpected repair result: %+v", result)
+	}
+	fsck, err := CheckSessions(baseDir)
+	if err != nil || fsck.FilesChecked != 1 || fsck.Events != 1 || len(fsck.Problems) != 1 || len(fsck.Problems[0].Corrupt) != 1 {
+		t.Fatalf("unexpected fsck: %+v err=%v", fsck, err)
+	}
+}
+
+func TestFsyncBatchSyncsBeforeCursorSave(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	srv.fsync = config.FsyncBatch
+	path := filepath.Join(baseDir, "session.jsonl")
+	cursor := &SessionCursor{SessionID: "5d6e7f80-0000-4000-8000-000000000004"}
+	if _, err := srv.appendEvent(path, cursor, buildEvent("message", cursor.SessionID, "codex-cli", time.Now(), map[string]interface{}{})); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if !cursor.unsynced {
+		t.Fatalf("expected the cursor to be marked unsynced")
+	}
+	if err := srv.saveCursor(cursor); err != nil || cursor.unsynced {
+		t.Fatalf("save cursor: unsynced=%v err=%v", cursor.unsynced, err)
+	}
+}
+
+func TestRepairSessionsKeepsCorruptFinalLine(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "5d6e7f80-0000-4000-8000-000000000005"
+	event := map[string]interface{}{"event_type": "message", "data": map[string]interface{}{"role": "user", "content": "hello"}}
+	if _, _, err := (EventCapturer{Name: "codex-cli"}).Capture(srv, event, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "codex-cli")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	// A complete final line that is not a valid event, say one a user edited
+	// by hand, is not a crash artifact and must survive every startup.
+	corrupt := `{"event_type":"message","data":{"content":"edited"}}` + "\n"
+	if err := os.WriteFile(path, append(before, corrupt...), 0o600); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if result := srv.RepairSessions(); result.FilesRepaired != 0 || result.BytesTruncated != 0 {
+			t.Fatalf("repair %d changed the file: %+v", i, result)
+		}
+	}
+	after, err := os.ReadFile(path)
+	if err != nil || string(after) != string(before)+corrupt {
+		t.Fatalf("corrupt final line not kept: %q (err=%v)", after, err)
+	}
+	if check := CheckSessionFile(path); len(check.Corrupt) != 1 || check.Corrupt[0].Line != 2 || check.Corrupt[0].Reason != "missing timestamp" {
+		t.Fatalf("fsck does not report the corrupt line: %+v", check)
+	}
+}
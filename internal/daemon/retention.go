@@ -0,0 +1,433 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+// retentionGrace protects recently active sessions and freshly written
+// cursor files from deletion, whatever the policy says.
+const retentionGrace = 24 * time.Hour
+
+// RetentionPolicy decides which local sessions may be deleted.
+type RetentionPolicy struct {
+	MaxAgeDays   int      // delete sessions idle for longer; 0 disables
+	MaxDiskBytes int64    // evict oldest sessions beyond this total; 0 disables
+	KeepPushed   bool     // keep sessions that were pushed to the remote server
+	KeepStarred  bool     // keep starred sessions
+	ExcludeCwds  []string // keep sessions whose cwd is under one of these paths
+}
+
+// RetentionPolicyFromConfig builds the policy from the [local] settings.
+func RetentionPolicyFromConfig(cfg config.LocalConfig) RetentionPolicy {
+	excludes := make([]string, 0, len(cfg.RetentionExcludeCwds))
+	for _, dir := range cfg.RetentionExcludeCwds {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			excludes = append(excludes, filepath.Clean(config.ExpandHome(dir)))
+		}
+	}
+	return RetentionPolicy{
+		MaxAgeDays:   cfg.RetentionDays,
+		MaxDiskBytes: int64(cfg.MaxDiskMB) * 1024 * 1024,
+		KeepPushed:   cfg.RetentionKeepPushed,
+		KeepStarred:  cfg.RetentionKeepStarred,
+		ExcludeCwds:  excludes,
+	}
+}
+
+// RetentionCandidate is a session file the policy deletes.
+type RetentionCandidate struct {
+	SessionID    string `json:"session_id"`
+	Tool         string `json:"tool"`
+	Cwd          string `json:"cwd,omitempty"`
+	Path         string `json:"path"`
+	Bytes        int64  `json:"bytes"`
+	LastActivity string `json:"last_activity"`
+	Reason       string `json:"reason"` // max_age or max_disk
+}
+
+// RetentionResult reports one retention pass.
+type RetentionResult struct {
+	DryRun          bool                 `json:"dry_run"`
+	SessionsScanned int                  `json:"sessions_scanned"`
+	BytesScanned    int64                `json:"bytes_scanned"`
+	Deleted         []RetentionCandidate `json:"deleted"`
+	BytesFreed      int64                `json:"bytes_freed"`
+	Kept            map[string]int       `json:"kept,omitempty"` // sessions the policy matched but a keep rule saved, by rule
+	OrphanCursors   []string             `json:"orphan_cursors"` // session ids whose state/ cursor file has no session file
+}
+
+type retentionFile struct {
+	RetentionCandidate
+	last    time.Time
+	modTime time.Time
+	keep    string // keep rule that protects the session, if any
+}
+
+// ApplyRetention deletes the session files the policy selects and garbage
+// collects cursor files left without a session. Sessions older than
+// MaxAgeDays go first; if the remaining files still exceed MaxDiskBytes the
+// oldest unprotected ones are evicted until they fit. With dryRun nothing is
+// removed and the result lists what would be.
+func (s *Server) ApplyRetention(policy RetentionPolicy, dryRun bool) (RetentionResult, error) {
+	result := RetentionResult{DryRun: dryRun, Deleted: []RetentionCandidate{}, OrphanCursors: []string{}}
+	now := time.Now()
+
+	files, err := scanRetentionFiles(s.baseDir)
+	if err != nil {
+		return result, err
+	}
+	marks, err := loadSessionMarks(s.baseDir)
+	if err != nil {
+		// Without the marks, keep rules cannot be honoured.
+		return result, err
+	}
+
+	var total int64
+	for i := range files {
+		file := &files[i]
+		total += file.Bytes
+		mark := marks[sessionKey(file.SessionID, file.Tool)]
+		switch {
+		case now.Sub(file.last) < retentionGrace:
+			file.keep = "recent"
+		case policy.KeepStarred && mark.Starred:
+			file.keep = "starred"
+		case policy.KeepPushed && mark.PushedAt != "":
+			file.keep = "pushed"
+		case cwdExcluded(file.Cwd, policy.ExcludeCwds):
+			file.keep = "excluded_cwd"
+		}
+	}
+	result.SessionsScanned = len(files)
+	result.BytesScanned = total
+
+	// Oldest first, so disk eviction can walk the slice.
+	sort.SliceStable(files, func(i, j int) bool { return files[i].last.Before(files[j].last) })
+	doomed := make(map[string]bool)
+	saved := make(map[string]string) // path -> keep rule, for sessions a rule selected
+	if policy.MaxAgeDays > 0 {
+		cutoff := now.Add(-time.Duration(policy.MaxAgeDays) * 24 * time.Hour)
+		for i := range files {
+			file := &files[i]
+			if !file.last.Before(cutoff) {
+				continue
+			}
+			if file.keep != "" {
+				saved[file.Path] = file.keep
+				continue
+			}
+			file.Reason = "max_age"
+			doomed[file.Path] = true
+			total -= file.Bytes
+		}
+	}
+	if policy.MaxDiskBytes > 0 {
+		for i := range files {
+			if total <= policy.MaxDiskBytes {
+				break
+			}
+			file := &files[i]
+			if doomed[file.Path] {
+				continue
+			}
+			if file.keep != "" {
+				saved[file.Path] = file.keep
+				continue
+			}
+			file.Reason = "max_disk"
+			doomed[file.Path] = true
+			total -= file.Bytes
+		}
+	}
+	for _, rule := range saved {
+		if rule == "recent" {
+			continue
+		}
+		if result.Kept == nil {
+			result.Kept = make(map[string]int)
+		}
+		result.Kept[rule]++
+	}
+
+	var forgotten []string
+	for _, file := range files {
+		if !doomed[file.Path] {
+			continue
+		}
+		if !dryRun {
+			ok, err := s.deleteSessionFile(file)
+			if err != nil {
+				return result, err
+			}
+			if !ok {
+				continue
+			}
+			forgotten = append(forgotten, sessionKey(file.SessionID, file.Tool))
+		}
+		result.Deleted = append(result.Deleted, file.RetentionCandidate)
+		result.BytesFreed += file.Bytes
+	}
+	if err := forgetSessionMarks(s.baseDir, forgotten); err != nil {
+		s.logger.Warn("session marks update failed", "error", err)
+	}
+	if !dryRun {
+		removeEmptyDayDirs(s.baseDir)
+	}
+
+	orphans, err := s.collectOrphanCursors(doomed, now, dryRun)
+	if err != nil {
+		return result, err
+	}
+	result.OrphanCursors = orphans
+	return result, nil
+}
+
+func scanRetentionFiles(baseDir string) ([]retentionFile, error) {
+	days, err := os.ReadDir(SessionsDir(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []retentionFile
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(baseDir), day.Name())
+		entries, err := os.ReadDir(dayDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !IsSessionFileName(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(dayDir, entry.Name())
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			md, err := ReplaySessionMetadata(path)
+			if err != nil || md.SessionID == "" {
+				continue
+			}
+			last := sessionLastActivity(md, info.ModTime())
+			files = append(files, retentionFile{
+				RetentionCandidate: RetentionCandidate{
+					SessionID:    md.SessionID,
+					Tool:         md.Tool,
+					Cwd:          md.Cwd,
+					Path:         path,
+					Bytes:        info.Size(),
+					LastActivity: last.UTC().Format(time.RFC3339Nano),
+				},
+				last:    last,
+				modTime: info.ModTime(),
+			})
+		}
+	}
+	return files, nil
+}
+
+// sessionLastActivity prefers the session's own timestamps; the file's
+// modification time changes when it is archived.
+func sessionLastActivity(md *SessionMetadata, modTime time.Time) time.Time {
+	for _, value := range []string{md.LastEventAt, md.EndedAt, md.CreatedAt} {
+		if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return ts
+		}
+	}
+	return modTime
+}
+
+func cwdExcluded(cwd string, excludes []string) bool {
+	if cwd == "" {
+		return false
+	}
+	cwd = filepath.Clean(cwd)
+	for _, dir := range excludes {
+		if cwd == dir || strings.HasPrefix(cwd, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteSessionFile removes a session file under its session lock, unless
+// it was written to since the scan.
+func (s *Server) deleteSessionFile(file retentionFile) (bool, error) {
+	defer s.lockSession(file.SessionID)()
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return false, nil
+	}
+	if info.Size() != file.Bytes || !info.ModTime().Equal(file.modTime) {
+		return false, nil
+	}
+	if err := os.Remove(file.Path); err != nil {
+		return false, err
+	}
+	s.state.forgetSessionFile(file.SessionID, file.Tool, file.Path)
+	if s.index != nil {
+		_ = s.index.RemovePath(file.Path)
+	}
+	return true, nil
+}
+
+// collectOrphanCursors removes state/ cursor files whose session has no
+// session file left, counting the doomed ones as gone. Cursors touched within
+// retentionGrace are skipped: a capture saves its cursor before the first
+// event lands.
+func (s *Server) collectOrphanCursors(doomed map[string]bool, now time.Time, dryRun bool) ([]string, error) {
+	ids, err := listCursorSessions(s.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	present, err := sessionFileIDs(s.baseDir, doomed)
+	if err != nil {
+		return nil, err
+	}
+	orphans := []string{}
+	for _, id := range ids {
+		if present[id] {
+			continue
+		}
+		path := cursorStatePath(s.baseDir, id)
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) < retentionGrace {
+			continue
+		}
+		if !dryRun {
+			removed, err := s.removeOrphanCursor(id, path)
+			if err != nil {
+				return orphans, err
+			}
+			if !removed {
+				continue
+			}
+		}
+		orphans = append(orphans, id)
+	}
+	return orphans, nil
+}
+
+// sessionFileIDs collects the session ids named by session files, skipping
+// the paths in exclude. Names are <session-id>-<tool>-<timestamp>.jsonl.
+func sessionFileIDs(baseDir string, exclude map[string]bool) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	days, err := os.ReadDir(SessionsDir(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ids, nil
+		}
+		return nil, err
+	}
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(baseDir), day.Name())
+		entries, err := os.ReadDir(dayDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !IsSessionFileName(name) || exclude[filepath.Join(dayDir, name)] {
+				continue
+			}
+			if id := sessionIDFromFileName(name); id != "" {
+				ids[id] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+func sessionIDFromFileName(name string) string {
+	stem := TrimSessionExt(name)
+	cut := strings.LastIndex(stem, "-")
+	if cut < 0 {
+		return ""
+	}
+	stem = stem[:cut]
+	for _, tool := range RegisteredTools() {
+		if id, ok := strings.CutSuffix(stem, "-"+tool); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// removeOrphanCursor deletes a cursor file under its session lock, unless a
+// capture created the session file since the scan.
+func (s *Server) removeOrphanCursor(sessionID, path string) (bool, error) {
+	defer s.lockSession(sessionID)()
+	for _, tool := range RegisteredTools() {
+		if _, ok, err := findExistingSessionFile(s.baseDir, sessionID, tool); err != nil || ok {
+			return false, err
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+func removeEmptyDayDirs(baseDir string) {
+	days, err := os.ReadDir(SessionsDir(baseDir))
+	if err != nil {
+		return
+	}
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(SessionsDir(baseDir), day.Name())
+		if remaining, err := os.ReadDir(dayDir); err == nil && len(remaining) == 0 {
+			_ = os.Remove(dayDir)
+		}
+	}
+}
+
+// StartRetentionRoutine applies the retention policy once on startup and
+// then every hour, next to the empty session cleanup.
+func StartRetentionRoutine(ctx context.Context, srv *Server) {
+	srv.logger.Info("starting session retention routine")
+	go func() {
+		runRetention(srv)
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runRetention(srv)
+			}
+		}
+	}()
+}
+
+func runRetention(srv *Server) {
+	srv.mu.RLock()
+	policy := srv.retention
+	srv.mu.RUnlock()
+	result, err := srv.ApplyRetention(policy, false)
+	if err != nil {
+		srv.logger.Error("session retention failed", "error", err)
+		return
+	}
+	if len(result.Deleted) > 0 || len(result.OrphanCursors) > 0 {
+		srv.logger.Info("applied session retention", "deleted", len(result.Deleted), "bytes_freed", result.BytesFreed, "orphan_cursors", len(result.OrphanCursors))
+	}
+}
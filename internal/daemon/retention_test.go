@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func captureEndedSession(t *testing.T, srv *Server, baseDir, sessionID, cwd string, at time.Time) string {
+	t.Helper()
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	line := `{"type":"user","message":{"role":"user","content":"work"},"timestamp":"` + at.UTC().Format(time.RFC3339) + `"}`
+	if err := os.WriteFile(transcriptPath, []byte(line+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	end := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "cwd": cwd, "hook_event_name": "SessionEnd", "reason": "exit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: end}, sessionID, at.Add(time.Minute)); err != nil {
+		t.Fatalf("capture %s: %v", sessionID, err)
+	}
+	path, ok, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if !ok {
+		t.Fatalf("session file for %s not written", sessionID)
+	}
+	// Cursor files saved just now would be inside the grace period.
+	old := time.Now().Add(-2 * retentionGrace)
+	_ = os.Chtimes(cursorStatePath(baseDir, sessionID), old, old)
+	return path
+}
+
+func TestApplyRetentionKeepRules(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	old := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	plain := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-00000000000a", "/work/app", old)
+	pushed := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-00000000000b", "/work/app", old)
+	starred := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-00000000000c", "/work/app", old)
+	excluded := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-00000000000d", "/work/secret/api", old)
+	recent := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-00000000000e", "/work/app", time.Now().Add(-time.Hour))
+	if err := markSessionPushed(baseDir, "5e6f7081-0000-4000-8000-00000000000b", "claude-code", "https://tabs.example/s/1", time.Now()); err != nil {
+		t.Fatalf("mark pushed: %v", err)
+	}
+	if err := StarSession(baseDir, "5e6f7081-0000-4000-8000-00000000000c", "claude-code", true); err != nil {
+		t.Fatalf("star: %v", err)
+	}
+	orphanID := "5e6f7081-0000-4000-8000-0000000000ff"
+	orphan := cursorStatePath(baseDir, orphanID)
+	if err := os.WriteFile(orphan, []byte(`{"session_id":"`+orphanID+`"}`), 0o600); err != nil {
+		t.Fatalf("write orphan cursor: %v", err)
+	}
+	stale := time.Now().Add(-2 * retentionGrace)
+	_ = os.Chtimes(orphan, stale, stale)
+
+	policy := RetentionPolicy{MaxAgeDays: 30, KeepPushed: true, KeepStarred: true, ExcludeCwds: []string{"/work/secret"}}
+	preview, err := srv.ApplyRetention(policy, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(preview.Deleted) != 1 || preview.Deleted[0].Path != plain || preview.Deleted[0].Reason != "max_age" {
+		t.Fatalf("unexpected dry run deletions: %+v", preview.Deleted)
+	}
+	wantOrphans := []string{"5e6f7081-0000-4000-8000-00000000000a", orphanID}
+	if !reflect.DeepEqual(preview.OrphanCursors, wantOrphans) {
+		t.Fatalf("unexpected dry run orphans: %v", preview.OrphanCursors)
+	}
+	if _, err := os.Stat(plain); err != nil {
+		t.Fatalf("dry run removed a session file: %v", err)
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Fatalf("dry run removed a cursor file: %v", err)
+	}
+
+	result, err := srv.ApplyRetention(policy, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.BytesFreed != preview.BytesFreed {
+		t.Fatalf("apply differs from dry run: %+v", result)
+	}
+	wantKept := map[string]int{"pushed": 1, "starred": 1, "excluded_cwd": 1}
+	if !reflect.DeepEqual(result.Kept, wantKept) {
+		t.Fatalf("unexpected kept counts: %v", result.Kept)
+	}
+	if !reflect.DeepEqual(result.OrphanCursors, wantOrphans) {
+		t.Fatalf("unexpected orphans: %v", result.OrphanCursors)
+	}
+	if _, err := os.Stat(plain); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be deleted, stat err=%v", plain, err)
+	}
+	for _, path := range []string{pushed, starred, excluded, recent, cursorStatePath(baseDir, "5e6f7081-0000-4000-8000-00000000000b")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected %s to be kept: %v", path, err)
+		}
+	}
+	for _, path := range []string{orphan, cursorStatePath(baseDir, "5e6f7081-0000-4000-8000-00000000000a")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected cursor %s to be collected, stat err=%v", path, err)
+		}
+	}
+	if _, ok, _ := srv.index.Lookup("5e6f7081-0000-4000-8000-00000000000a", "claude-code"); ok {
+		t.Fatalf("deleted session still indexed")
+	}
+}
+
+func TestApplyRetentionEvictsOldestBeyondDiskLimit(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	oldest := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-000000000011", "/work/app", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	older := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-000000000012", "/work/app", time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC))
+	recent := captureEndedSession(t, srv, baseDir, "5e6f7081-0000-4000-8000-000000000013", "/work/app", time.Now().Add(-time.Hour))
+
+	var total, oldestSize int64
+	for _, path := range []string{oldest, older, recent} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		total += info.Size()
+		if path == oldest {
+			oldestSize = info.Size()
+		}
+	}
+
+	result, err := srv.ApplyRetention(RetentionPolicy{MaxDiskBytes: total - oldestSize}, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0].Path != oldest || result.Deleted[0].Reason != "max_disk" {
+		t.Fatalf("unexpected deletions: %+v", result.Deleted)
+	}
+	if _, err := os.Stat(older); err != nil {
+		t.Fatalf("expected the newer session to stay: %v", err)
+	}
+
+	// A limit nothing can meet still never touches recent sessions.
+	result, err = srv.ApplyRetention(RetentionPolicy{MaxDiskBytes: 1}, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0].Path != older {
+		t.Fatalf("unexpected deletions: %+v", result.Deleted)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Fatalf("recent session evicted: %v", err)
+	}
+}
@@ -11,12 +11,14 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/victorarias/tabs/internal/config"
 	"github.com/victorarias/tabs/internal/logging"
 )
 
-const protocolVersion = "1.0"
+const importTimeout = 10 * time.Minute
 
 type Server struct {
 	baseDir    string
@@ -24,20 +26,101 @@ type Server struct {
 	logger     *slog.Logger
 	listener   net.Listener
 	wg         sync.WaitGroup
-	mu         sync.Mutex
+	mu         sync.RWMutex // settings; held shared by session work
 	state      *State
+	redactor   *Redactor
+	autoPush   atomic.Bool
+	queue      *uploadQueue
+	watcher    atomic.Pointer[transcriptWatcher]
+	index      *SessionIndex
+
+	indexCreated      bool
+	claudeProjectsDir string
+	liveTail          bool
+	gitContext        bool
+	pricing           map[string]config.ModelPrice
+	fsync             string // local.fsync
+	sessionLocks      sessionLocks
+	markersMu         sync.Mutex
+	composerMarkers   map[string]int64 // Cursor composer lastUpdatedAt already copied
+	retention         RetentionPolicy
+	privacy           *privacyState
+	captures          *captureQueue
+
+	connsMu sync.Mutex
+	conns   map[*protocolConn]struct{} // open connections, so Shutdown can end idle ones
+	closing bool
+
+	batchesMu sync.Mutex
+	batches   map[string]*captureBatch // recent capture batches by batch_id
 }
 
 func NewServer(baseDir string, logger *slog.Logger) *Server {
 	if logger == nil {
 		logger = logging.New("info", os.Stdout)
 	}
-	return &Server{
+	queue, err := loadUploadQueue(baseDir)
+	if err != nil {
+		logger.Warn("upload queue load failed", "error", err)
+	}
+	index, err := OpenSessionIndex(baseDir)
+	if err != nil {
+		// Lookups fall back to scanning the sessions directory.
+		logger.Warn("session index unavailable", "error", err)
+	}
+	state := NewState()
+	state.index = index
+	srv := &Server{
 		baseDir:    baseDir,
 		socketPath: SocketPath(baseDir),
 		logger:     logger,
-		state:      NewState(),
+		state:      state,
+		redactor:   defaultRedactor(),
+		queue:      queue,
+		index:      index,
+
+		indexCreated: index != nil && index.fresh,
+		gitContext:   true,
+		pricing:      config.DefaultPricing(),
+		fsync:        config.FsyncAlways,
+		retention:    RetentionPolicy{KeepPushed: true, KeepStarred: true},
+		privacy:      loadPrivacyState(baseDir),
+	}
+	srv.captures = newCaptureQueue(CaptureJournalDir(baseDir), srv.processCaptureJob, logger)
+	return srv
+}
+
+// Configure applies daemon-relevant settings from the loaded config. The
+// privacy rules and encryption are applied first and every setting is
+// applied even when another fails, so a bad redaction pattern cannot leave
+// sessions unencrypted or ignored directories captured. Any error is
+// returned, and the daemon refuses to start on it.
+func (s *Server) Configure(cfg config.Config) error {
+	s.privacy.setRules(PrivacyRulesFromConfig(cfg.Privacy))
+	var errs []error
+	if err := ConfigureEncryption(s.baseDir, cfg.Encryption); err != nil {
+		errs = append(errs, fmt.Errorf("encryption: %w", err))
+	}
+	redactor, err := NewRedactor(cfg.Redaction)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("redaction: %w", err))
 	}
+	s.mu.Lock()
+	if redactor != nil {
+		s.redactor = redactor
+	}
+	s.autoPush.Store(cfg.Remote.AutoPush)
+	s.claudeProjectsDir = config.ExpandHome(cfg.ClaudeCode.ProjectsDir)
+	s.liveTail = cfg.Local.LiveTail
+	s.gitContext = cfg.Local.GitContext
+	s.pricing = cfg.Pricing
+	s.fsync = cfg.Local.Fsync
+	if s.fsync == "" {
+		s.fsync = config.FsyncAlways
+	}
+	s.retention = RetentionPolicyFromConfig(cfg.Local)
+	s.mu.Unlock()
+	return errors.Join(errs...)
 }
 
 func (s *Server) Listen() error {
@@ -82,6 +165,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if s.listener != nil {
 		_ = s.listener.Close()
 	}
+	s.closeIdleConns()
 	done := make(chan struct{})
 	go func() {
 		s.wg.Wait()
@@ -93,70 +177,118 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return ctx.Err()
 	case <-done:
 	}
+	if err := s.captures.Close(ctx); err != nil {
+		return err
+	}
 
 	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index.Close()
 }
 
-func (s *Server) handleConn(conn net.Conn) {
+func (s *Server) handleConn(netConn net.Conn) {
 	defer s.wg.Done()
-	defer conn.Close()
+	defer netConn.Close()
+	conn := &protocolConn{Conn: netConn, version: protocolVersion10}
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
 
-	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
 	reader := bufio.NewReader(conn)
-	line, err := reader.ReadBytes('\n')
-	if err != nil {
-		if errors.Is(err, io.EOF) {
+	for first := true; ; first = false {
+		// A 1.1 connection waits for its next request up to the idle
+		// timeout; Shutdown cuts the wait short.
+		if !s.armConn(conn, first) {
+			return
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) || (!first && isTimeout(err)) {
+				return
+			}
+			s.logger.Error("read request failed", "error", err)
 			return
 		}
-		s.logger.Error("read request failed", "error", err)
-		return
-	}
-
-	var req request
-	if err := json.Unmarshal(bytesTrimSpace(line), &req); err != nil {
-		s.writeResponse(conn, errorResponse("invalid_json", "Invalid JSON request"))
-		return
-	}
 
-	if req.Version != protocolVersion {
-		s.writeResponse(conn, errorResponse("unsupported_version", "Unsupported protocol version"))
-		return
+		var req request
+		if err := json.Unmarshal(bytesTrimSpace(line), &req); err != nil {
+			s.writeResponse(conn, errorResponse("invalid_json", "Invalid JSON request"))
+			return
+		}
+		if !supportedVersion(req.Version) {
+			s.writeResponse(conn, errorResponse("unsupported_version", "Unsupported protocol version"))
+			return
+		}
+		conn.version = req.Version
+		_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+		s.dispatch(conn, req)
+		if req.Version == protocolVersion10 {
+			return
+		}
 	}
+}
 
+func (s *Server) dispatch(conn *protocolConn, req request) {
 	switch req.Type {
+	case "hello":
+		s.handleHello(conn, req.Payload)
 	case "capture_event":
-		s.handleCapture(conn, req.Payload)
+		s.handleCapture(conn, req.Payload, req.BatchID)
 	case "push_session":
 		s.handlePush(conn, req.Payload)
 	case "daemon_status":
 		s.handleStatus(conn)
+	case "import_sessions":
+		s.handleImport(conn, req.Payload)
+	case "rebuild_index":
+		s.handleRebuildIndex(conn)
+	case "cleanup_sessions":
+		s.handleCleanup(conn, req.Payload)
+	case "star_session":
+		s.handleStar(conn, req.Payload)
+	case "encrypt_existing":
+		s.handleEncryptExisting(conn, req.Payload)
 	default:
 		s.writeResponse(conn, errorResponse("unsupported_type", "Unsupported request type"))
 	}
 }
 
-func (s *Server) handleCapture(conn net.Conn, payload json.RawMessage) {
+func (s *Server) handleCapture(conn *protocolConn, payload json.RawMessage, batchID string) {
+	if isJSONArray(payload) {
+		s.handleCaptureBatch(conn, payload, batchID)
+		return
+	}
+	s.writeResponse(conn, s.capture(payload))
+}
+
+// capture journals one capture_event payload and returns its response.
+func (s *Server) capture(payload json.RawMessage) response {
 	var req capturePayload
 	if err := json.Unmarshal(payload, &req); err != nil {
-		s.writeResponse(conn, errorResponse("invalid_payload", "Invalid capture payload"))
-		return
+		return errorResponse("invalid_payload", "Invalid capture payload")
 	}
-	if req.Tool != "claude-code" && req.Tool != "cursor" {
-		s.writeResponse(conn, errorResponse("unknown_tool", "Unsupported tool"))
-		return
+	if _, ok := LookupCapturer(req.Tool); !ok {
+		return errorResponse("unknown_tool", "Unsupported tool")
 	}
 	if req.Event == nil {
-		s.writeResponse(conn, errorResponse("invalid_payload", "Missing event payload"))
-		return
+		return errorResponse("invalid_payload", "Missing event payload")
 	}
 
 	sessionID, ok := req.Event["session_id"].(string)
 	if !ok || sessionID == "" {
-		s.writeResponse(conn, errorResponse("invalid_payload", "Missing required field: session_id"))
-		return
+		return errorResponse("invalid_payload", "Missing required field: session_id")
+	}
+
+	if s.captureSuppressed(req.Tool, sessionID, req.Event) {
+		return okResponse(map[string]interface{}{
+			"session_id":     sessionID,
+			"events_written": 0,
+			"suppressed":     true,
+		})
 	}
 
 	eventTime := time.Now().UTC()
@@ -166,112 +298,76 @@ func (s *Server) handleCapture(conn net.Conn, payload json.RawMessage) {
 		}
 	}
 
-	if req.Tool == "claude-code" {
-		eventsWritten, lastEventTime, err := s.captureClaude(req, sessionID, eventTime)
-		if err != nil {
-			s.writeResponse(conn, errorResponse("storage_error", err.Error()))
-			return
-		}
-		s.mu.Lock()
-		if eventsWritten > 0 {
-			s.state.RecordEvent(sessionID, lastEventTime, eventsWritten)
-		}
-		s.mu.Unlock()
-		data := map[string]interface{}{
-			"session_id":     sessionID,
-			"events_written": eventsWritten,
-		}
-		s.writeResponse(conn, okResponse(data))
-		return
-	}
-	if req.Tool == "cursor" {
-		eventsWritten, lastEventTime, err := s.captureCursor(req, sessionID, eventTime)
-		if err != nil {
-			s.writeResponse(conn, errorResponse("storage_error", err.Error()))
-			return
-		}
-		s.mu.Lock()
-		if eventsWritten > 0 {
-			s.state.RecordEvent(sessionID, lastEventTime, eventsWritten)
-		}
-		s.mu.Unlock()
-		data := map[string]interface{}{
-			"session_id":     sessionID,
-			"events_written": eventsWritten,
-		}
-		s.writeResponse(conn, okResponse(data))
-		return
-	}
+	// The journal is on disk until the job is written, so secrets are
+	// scrubbed before it, not only before the session file.
+	s.mu.RLock()
+	redactor := s.redactor
+	s.mu.RUnlock()
+	redactor.RedactEvent(req.Event)
 
-	normalized, eventJSON, err := normalizeEvent(req.Event, sessionID, req.Tool, eventTime)
-	if err != nil {
-		s.writeResponse(conn, errorResponse("invalid_payload", "Invalid event payload"))
-		return
+	// The hook is answered once the payload is journaled; a worker writes
+	// it, so a large transcript never holds up the agent.
+	job := captureJob{Tool: req.Tool, SessionID: sessionID, Timestamp: eventTime.Format(time.RFC3339Nano), Event: req.Event}
+	if err := s.captures.Enqueue(job, time.Now()); err != nil {
+		return errorResponse("storage_error", err.Error())
 	}
+	return okResponse(map[string]interface{}{
+		"session_id":     sessionID,
+		"events_written": 0,
+		"queued":         true,
+	})
+}
 
-	s.mu.Lock()
-	cursor, cursorErr := loadCursorState(s.baseDir, sessionID)
-	if cursorErr != nil {
-		s.logger.Warn("cursor state load failed", "session_id", sessionID, "error", cursorErr)
+// processCaptureJob writes one journaled hook event.
+func (s *Server) processCaptureJob(job captureJob) error {
+	capturer, ok := LookupCapturer(job.Tool)
+	if !ok {
+		return fmt.Errorf("unsupported tool %q", job.Tool)
 	}
-	if cursor == nil {
-		s.mu.Unlock()
-		s.writeResponse(conn, errorResponse("storage_error", "Failed to read cursor state"))
-		return
+	if s.captureSuppressed(job.Tool, job.SessionID, job.Event) {
+		return nil
 	}
-
-	lineHash := hashLine(eventJSON)
-	if cursor.LastLineHash == lineHash {
-		s.mu.Unlock()
-		data := map[string]interface{}{
-			"session_id":     sessionID,
-			"events_written": 0,
-		}
-		s.writeResponse(conn, okResponse(data))
-		return
+	eventTime := time.Now().UTC()
+	if ts, err := time.Parse(time.RFC3339Nano, job.Timestamp); err == nil {
+		eventTime = ts
 	}
-
-	sessionPath, err := s.state.EnsureSessionFile(s.baseDir, sessionID, req.Tool, eventTime)
+	eventsWritten, lastEventTime, err := capturer.Capture(s, job.Event, job.SessionID, eventTime)
 	if err != nil {
-		s.mu.Unlock()
-		s.writeResponse(conn, errorResponse("storage_error", "Failed to resolve session file"))
-		return
+		return err
 	}
-
-	lastOffset, err := appendJSONL(sessionPath, eventJSON)
-	if err != nil {
-		s.mu.Unlock()
-		s.writeResponse(conn, errorResponse("storage_error", "Failed to append event"))
-		return
+	if eventsWritten > 0 {
+		s.state.RecordEvent(job.SessionID, lastEventTime, eventsWritten)
 	}
+	return nil
+}
 
-	meta := extractEventMetadata(normalized)
-	updateCursorState(cursor, meta, normalized, lineHash, lastOffset, sessionPath)
-	if err := saveCursorState(s.baseDir, cursor); err != nil {
-		s.mu.Unlock()
-		s.writeResponse(conn, errorResponse("storage_error", "Failed to update cursor state"))
+// ResumeCaptures schedules hook events a previous run acknowledged but did
+// not write.
+func (s *Server) ResumeCaptures() {
+	count, err := s.captures.Replay()
+	if err != nil {
+		s.logger.Warn("capture journal replay failed", "error", err)
 		return
 	}
-
-	s.state.RecordEvent(sessionID, eventTime, 1)
-	s.mu.Unlock()
-
-	data := map[string]interface{}{
-		"session_id":     sessionID,
-		"events_written": 1,
+	if count > 0 {
+		s.logger.Info("capture journal replayed", "events", count)
 	}
-	s.writeResponse(conn, okResponse(data))
 }
 
-func (s *Server) handleStatus(conn net.Conn) {
+func (s *Server) handleStatus(conn *protocolConn) {
 	pid := os.Getpid()
-	s.mu.Lock()
+	// Nothing here takes a lock a capture holds, so status stays responsive
+	// while sessions are being written.
 	status := s.state.Snapshot(pid)
-	s.mu.Unlock()
+	status.AutoPush = s.autoPush.Load()
+	status.LiveTailWatches = s.watcher.Load().Count()
+	status.SessionsSuppressed = s.privacy.suppressedCount()
+	status.CaptureQueue = s.captures.Stats()
+	status.UploadQueue = s.queue.Snapshot()
 	s.writeResponse(conn, okResponse(status))
 }
 
-func (s *Server) handlePush(conn net.Conn, payload json.RawMessage) {
+func (s *Server) handlePush(conn *protocolConn, payload json.RawMessage) {
 	var req pushPayload
 	if err := json.Unmarshal(payload, &req); err != nil {
 		s.writeResponse(conn, errorResponse("invalid_payload", "Invalid push payload"))
@@ -299,7 +395,148 @@ func (s *Server) handlePush(conn net.Conn, payload json.RawMessage) {
 	s.writeResponse(conn, okResponse(data))
 }
 
-func (s *Server) writeResponse(conn net.Conn, resp response) {
+func (s *Server) handleImport(conn *protocolConn, payload json.RawMessage) {
+	var req importPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.writeResponse(conn, errorResponse("invalid_payload", "Invalid import payload"))
+			return
+		}
+	}
+	opts := ImportOptions{ProjectsDir: req.ProjectsDir, Cwd: req.Cwd, DryRun: req.DryRun}
+	if opts.ProjectsDir == "" {
+		s.mu.RLock()
+		opts.ProjectsDir = s.claudeProjectsDir
+		s.mu.RUnlock()
+	}
+	if req.Since != "" {
+		since, err := time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			s.writeResponse(conn, errorResponse("invalid_payload", "since must be RFC3339"))
+			return
+		}
+		opts.Since = since
+	}
+
+	// Imports can walk months of history; don't let the default deadline cut
+	// the response off.
+	_ = conn.SetDeadline(time.Now().Add(importTimeout))
+	result, err := s.ImportClaudeProjects(opts)
+	if err != nil {
+		s.writeResponse(conn, errorResponse("storage_error", err.Error()))
+		return
+	}
+	s.logger.Info("import finished", "projects_dir", result.ProjectsDir, "dry_run", result.DryRun, "imported", result.SessionsImported, "skipped", result.SessionsSkipped, "events", result.EventsWritten)
+	s.writeResponse(conn, okResponse(result))
+}
+
+func (s *Server) handleRebuildIndex(conn *protocolConn) {
+	_ = conn.SetDeadline(time.Now().Add(importTimeout))
+	result, err := s.RebuildIndex()
+	if err != nil {
+		s.writeResponse(conn, errorResponse("storage_error", err.Error()))
+		return
+	}
+	s.logger.Info("session index rebuilt", "files", result.FilesScanned, "sessions", result.SessionsIndexed, "errors", result.Errors)
+	s.writeResponse(conn, okResponse(result))
+}
+
+func (s *Server) handleCleanup(conn *protocolConn, payload json.RawMessage) {
+	var req cleanupPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.writeResponse(conn, errorResponse("invalid_payload", "Invalid cleanup payload"))
+			return
+		}
+	}
+	_ = conn.SetDeadline(time.Now().Add(importTimeout))
+	s.mu.RLock()
+	policy := s.retention
+	s.mu.RUnlock()
+	result, err := s.ApplyRetention(policy, req.DryRun)
+	if err != nil {
+		s.writeResponse(conn, errorResponse("storage_error", err.Error()))
+		return
+	}
+	if !req.DryRun {
+		s.logger.Info("session cleanup finished", "deleted", len(result.Deleted), "bytes_freed", result.BytesFreed, "orphan_cursors", len(result.OrphanCursors))
+	}
+	s.writeResponse(conn, okResponse(result))
+}
+
+func (s *Server) handleStar(conn *protocolConn, payload json.RawMessage) {
+	var req starPayload
+	if err := json.Unmarshal(payload, &req); err != nil {
+		s.writeResponse(conn, errorResponse("invalid_payload", "Invalid star payload"))
+		return
+	}
+	if req.SessionID == "" || !IsRegisteredTool(req.Tool) {
+		s.writeResponse(conn, errorResponse("invalid_payload", "session_id and a registered tool are required"))
+		return
+	}
+	if _, ok, err := locateSessionFile(s.baseDir, req.SessionID, req.Tool); err != nil || !ok {
+		s.writeResponse(conn, errorResponse("session_not_found", "session not found"))
+		return
+	}
+	if err := StarSession(s.baseDir, req.SessionID, req.Tool, req.Starred); err != nil {
+		s.writeResponse(conn, errorResponse("storage_error", err.Error()))
+		return
+	}
+	s.writeResponse(conn, okResponse(map[string]interface{}{"session_id": req.SessionID, "tool": req.Tool, "starred": req.Starred}))
+}
+
+func (s *Server) handleEncryptExisting(conn *protocolConn, payload json.RawMessage) {
+	var req encryptPayload
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.writeResponse(conn, errorResponse("invalid_payload", "Invalid encrypt payload"))
+			return
+		}
+	}
+	var enc config.EncryptionConfig
+	if req.Encryption != nil {
+		// The CLI sends the settings it is about to save, so the key is
+		// proven loadable here, in the daemon's environment, before the
+		// config turns encryption on.
+		enc = config.EncryptionConfig{Enabled: true, KeyFile: req.Encryption.KeyFile, PassphraseEnv: req.Encryption.PassphraseEnv}
+	} else {
+		// Older CLIs enable encryption in the config file first.
+		cfgPath, err := config.Path()
+		if err != nil {
+			s.writeResponse(conn, errorResponse("storage_error", "failed to resolve config path"))
+			return
+		}
+		cfg, err := config.Load(cfgPath)
+		if err != nil {
+			s.writeResponse(conn, errorResponse("storage_error", "failed to read config"))
+			return
+		}
+		enc = cfg.Encryption
+	}
+	wasEnabled := EncryptionEnabled()
+	if err := ConfigureEncryption(s.baseDir, enc); err != nil {
+		s.writeResponse(conn, errorResponse("encryption_error", err.Error()))
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(importTimeout))
+	result, err := s.EncryptExisting()
+	if err != nil {
+		if req.Encryption != nil {
+			// The CLI will not save the config, so new files go back to
+			// how they were written before.
+			setEncryptionEnabled(wasEnabled)
+		}
+		s.writeResponse(conn, errorResponse("encryption_error", err.Error()))
+		return
+	}
+	s.logger.Info("encrypted existing files", "session_files", result.SessionFiles, "cursor_files", result.CursorFiles, "already_encrypted", result.AlreadyEncrypted)
+	s.writeResponse(conn, okResponse(result))
+}
+
+// writeResponse answers in the version the request used, so 1.0 clients
+// never see a version they do not know.
+func (s *Server) writeResponse(conn *protocolConn, resp response) {
+	resp.Version = conn.version
 	payload, err := json.Marshal(resp)
 	if err != nil {
 		s.logger.Error("marshal response failed", "error", err)
@@ -315,6 +552,7 @@ type request struct {
 	Version string          `json:"version"`
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	BatchID string          `json:"batch_id,omitempty"` // idempotency key of a capture_event batch
 }
 
 type response struct {
@@ -329,6 +567,25 @@ type responseError struct {
 	Message string `json:"message"`
 }
 
+type cleanupPayload struct {
+	DryRun bool `json:"dry_run"`
+}
+
+type encryptPayload struct {
+	Encryption *encryptionSettings `json:"encryption,omitempty"`
+}
+
+type encryptionSettings struct {
+	KeyFile       string `json:"key_file,omitempty"`
+	PassphraseEnv string `json:"passphrase_env,omitempty"`
+}
+
+type starPayload struct {
+	SessionID string `json:"session_id"`
+	Tool      string `json:"tool"`
+	Starred   bool   `json:"starred"`
+}
+
 type capturePayload struct {
 	Tool      string                 `json:"tool"`
 	Timestamp string                 `json:"timestamp"`
@@ -6,43 +6,63 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// State is the daemon's in-memory bookkeeping. It is safe for concurrent
+// use: the counters are atomic so a status snapshot never waits on a
+// capture, and the session file cache has its own lock.
 type State struct {
 	start           time.Time
-	sessions        map[string]struct{}
-	eventsProcessed int
-	lastEventAt     time.Time
-	sessionFiles    map[string]string
-	cursorPolling   bool
+	sessions        sync.Map // session id -> struct{}
+	sessionCount    atomic.Int64
+	eventsProcessed atomic.Int64
+	lastEventAt     atomic.Int64 // unix nanoseconds
+	cursorPolling   atomic.Bool
+	reconcile       atomic.Pointer[ReconcileResult]
+	index           *SessionIndex
+
+	filesMu      sync.Mutex
+	sessionFiles map[string]string
 }
 
 func NewState() *State {
 	return &State{
 		start:        time.Now().UTC(),
-		sessions:     make(map[string]struct{}),
 		sessionFiles: make(map[string]string),
 	}
 }
 
 type Status struct {
-	PID              int    `json:"pid"`
-	UptimeSeconds    int    `json:"uptime_seconds"`
-	SessionsCaptured int    `json:"sessions_captured"`
-	EventsProcessed  int    `json:"events_processed"`
-	CursorPolling    bool   `json:"cursor_polling"`
-	LastEventAt      string `json:"last_event_at"`
+	PID                int                `json:"pid"`
+	UptimeSeconds      int                `json:"uptime_seconds"`
+	SessionsCaptured   int                `json:"sessions_captured"`
+	EventsProcessed    int                `json:"events_processed"`
+	CursorPolling      bool               `json:"cursor_polling"`
+	LastEventAt        string             `json:"last_event_at"`
+	AutoPush           bool               `json:"auto_push"`
+	UploadQueue        []UploadQueueEntry `json:"upload_queue"`
+	Reconcile          *ReconcileResult   `json:"reconcile,omitempty"`
+	LiveTailWatches    int                `json:"live_tail_watches"`
+	SessionsSuppressed int                `json:"sessions_suppressed"` // sessions dropped by privacy rules since start
+	CaptureQueue       CaptureQueueStats  `json:"capture_queue"`
 }
 
 func (s *State) RecordEvent(sessionID string, ts time.Time, eventsWritten int) {
 	if sessionID == "" || eventsWritten <= 0 {
 		return
 	}
-	s.sessions[sessionID] = struct{}{}
-	s.eventsProcessed += eventsWritten
-	if ts.After(s.lastEventAt) {
-		s.lastEventAt = ts
+	if _, seen := s.sessions.LoadOrStore(sessionID, struct{}{}); !seen {
+		s.sessionCount.Add(1)
+	}
+	s.eventsProcessed.Add(int64(eventsWritten))
+	for {
+		last := s.lastEventAt.Load()
+		if ts.UnixNano() <= last || s.lastEventAt.CompareAndSwap(last, ts.UnixNano()) {
+			return
+		}
 	}
 }
 
@@ -50,48 +70,109 @@ func (s *State) Snapshot(pid int) Status {
 	status := Status{
 		PID:              pid,
 		UptimeSeconds:    int(time.Since(s.start).Seconds()),
-		SessionsCaptured: len(s.sessions),
-		EventsProcessed:  s.eventsProcessed,
-		CursorPolling:    s.cursorPolling,
+		SessionsCaptured: int(s.sessionCount.Load()),
+		EventsProcessed:  int(s.eventsProcessed.Load()),
+		CursorPolling:    s.cursorPolling.Load(),
 	}
-	if !s.lastEventAt.IsZero() {
-		status.LastEventAt = s.lastEventAt.UTC().Format(time.RFC3339Nano)
+	if reconcile := s.reconcile.Load(); reconcile != nil {
+		copied := *reconcile
+		status.Reconcile = &copied
+	}
+	if last := s.lastEventAt.Load(); last != 0 {
+		status.LastEventAt = time.Unix(0, last).UTC().Format(time.RFC3339Nano)
 	}
 	return status
 }
 
 func (s *State) SetCursorPolling(enabled bool) {
-	s.cursorPolling = enabled
+	s.cursorPolling.Store(enabled)
+}
+
+func (s *State) SetReconcile(result ReconcileResult) {
+	s.reconcile.Store(&result)
 }
 
+// EnsureSessionFile returns the file a session appends to, creating its day
+// directory for a new session. Callers hold the session lock, so the cache
+// lock is only taken around map access.
 func (s *State) EnsureSessionFile(baseDir, sessionID, tool string, eventTime time.Time) (string, error) {
 	if sessionID == "" || tool == "" {
 		return "", fmt.Errorf("invalid session or tool")
 	}
 	key := sessionKey(sessionID, tool)
-	if path, ok := s.sessionFiles[key]; ok {
+	s.filesMu.Lock()
+	path, ok := s.sessionFiles[key]
+	s.filesMu.Unlock()
+	if ok {
 		return path, nil
 	}
+	if entry, ok, err := s.index.Lookup(sessionID, tool); err == nil && ok {
+		if _, err := os.Stat(entry.FilePath); err == nil {
+			return s.useSessionFile(key, entry.FilePath)
+		}
+	}
 	if existing, ok, err := findExistingSessionFile(baseDir, sessionID, tool); err != nil {
 		return "", err
 	} else if ok {
-		s.sessionFiles[key] = existing
-		return existing, nil
+		return s.useSessionFile(key, existing)
 	}
 	dateDir := filepath.Join(SessionsDir(baseDir), eventTime.UTC().Format("2006-01-02"))
 	if err := os.MkdirAll(dateDir, 0o700); err != nil {
 		return "", err
 	}
 	filename := fmt.Sprintf("%s-%s-%d.jsonl", sessionID, tool, eventTime.Unix())
-	path := filepath.Join(dateDir, filename)
+	path = filepath.Join(dateDir, filename)
+	s.filesMu.Lock()
+	s.sessionFiles[key] = path
+	s.filesMu.Unlock()
+	return path, nil
+}
+
+// useSessionFile caches the file a session appends to. An archived session
+// that resumes is decompressed first.
+func (s *State) useSessionFile(key, path string) (string, error) {
+	if isArchivedSessionFile(path) {
+		restored, err := restoreSessionFile(path)
+		if err != nil {
+			return "", err
+		}
+		path = restored
+	}
+	s.filesMu.Lock()
 	s.sessionFiles[key] = path
+	s.filesMu.Unlock()
 	return path, nil
 }
 
+// forgetSessionFile drops a cached file that was archived or removed.
+func (s *State) forgetSessionFile(sessionID, tool, path string) {
+	key := sessionKey(sessionID, tool)
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	if cached, ok := s.sessionFiles[key]; ok && cached == path {
+		delete(s.sessionFiles, key)
+	}
+}
+
 func sessionKey(sessionID, tool string) string {
 	return sessionID + "|" + tool
 }
 
+// locateSessionFile resolves a session file through the index when the
+// daemon has built one, falling back to scanning the day directories.
+func locateSessionFile(baseDir, sessionID, tool string) (string, bool, error) {
+	if idx, ok, err := OpenSessionIndexIfExists(baseDir); err == nil && ok {
+		entry, found, err := idx.Lookup(sessionID, tool)
+		idx.Close()
+		if err == nil && found {
+			if _, err := os.Stat(entry.FilePath); err == nil {
+				return entry.FilePath, true, nil
+			}
+		}
+	}
+	return findExistingSessionFile(baseDir, sessionID, tool)
+}
+
 func findExistingSessionFile(baseDir, sessionID, tool string) (string, bool, error) {
 	sessionsDir := SessionsDir(baseDir)
 	entries, err := os.ReadDir(sessionsDir)
@@ -115,15 +196,16 @@ func findExistingSessionFile(baseDir, sessionID, tool string) (string, bool, err
 		}
 		for _, file := range files {
 			name := file.Name()
-			if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".jsonl") {
+			if !strings.HasPrefix(name, prefix) || !IsSessionFileName(name) {
 				continue
 			}
-			tsPart := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".jsonl")
+			tsPart := TrimSessionExt(strings.TrimPrefix(name, prefix))
 			ts, err := strconv.ParseInt(tsPart, 10, 64)
 			if err != nil {
 				continue
 			}
-			if ts > bestTs {
+			// On a tie the live file wins over a leftover archive.
+			if ts > bestTs || (ts == bestTs && !isArchivedSessionFile(name)) {
 				bestTs = ts
 				bestPath = filepath.Join(dayDir, name)
 			}
@@ -0,0 +1,589 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sidechainEventKey carries a sidechainRef from the transcript parser to the
+// writer. It is removed before the event is written.
+const sidechainEventKey = "_sidechain"
+
+const maxPendingTasks = 50
+
+// subagentToolNames spawn a sub-agent whose records are flagged isSidechain.
+var subagentToolNames = map[string]bool{"Task": true, "Agent": true}
+
+// sidechainRef identifies the sub-agent a sidechain transcript record came
+// from. Recent Claude Code versions tag records with agentId; older ones
+// only chain them by uuid/parentUuid.
+type sidechainRef struct {
+	AgentID    string
+	UUID       string
+	ParentUUID string
+	Prompt     string
+}
+
+// SubagentState tracks the sub-agents a session spawned. Each sub-agent is
+// written to a child session whose ID derives from the parent's and the
+// agent key (agentId, or the uuid of an untagged sidechain's first record).
+type SubagentState struct {
+	Pending    []PendingTask            `json:"pending,omitempty"`
+	Links      map[string]*SubagentLink `json:"links,omitempty"`
+	Sidechains map[string]string        `json:"sidechains,omitempty"` // untagged record uuid -> agent key
+	LastKey    string                   `json:"last_key,omitempty"`
+}
+
+// PendingTask is a Task call whose sub-agent has not been seen yet. Only a
+// hash of the prompt is kept, to match the sub-agent's first message.
+type PendingTask struct {
+	ToolUseID    string `json:"tool_use_id"`
+	PromptHash   string `json:"prompt_hash"`
+	SubagentType string `json:"subagent_type,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// SubagentLink ties a child session to the tool call that spawned it.
+type SubagentLink struct {
+	SessionID      string `json:"session_id"`
+	AgentID        string `json:"agent_id,omitempty"`
+	ToolUseID      string `json:"tool_use_id,omitempty"`
+	SubagentType   string `json:"subagent_type,omitempty"`
+	Description    string `json:"description,omitempty"`
+	TranscriptPath string `json:"transcript_path,omitempty"`
+	LastOffset     int64  `json:"last_offset,omitempty"`
+	LastLineHash   string `json:"last_line_hash,omitempty"`
+	Started        bool   `json:"started,omitempty"`
+	Done           bool   `json:"done,omitempty"` // the spawning call returned
+	Ended          bool   `json:"ended,omitempty"`
+	Skipped        bool   `json:"skipped,omitempty"` // warmup sidechain, not captured
+}
+
+// childSessionID derives a stable session ID for a sub-agent, so captures
+// after a restart and re-imports land in the same child session.
+func childSessionID(parentID, agentKey string) string {
+	space, err := uuid.Parse(parentID)
+	if err != nil {
+		space = uuid.NameSpaceOID
+	}
+	return uuid.NewSHA1(space, []byte(parentID+"/"+agentKey)).String()
+}
+
+func subagentState(cursor *SessionCursor) *SubagentState {
+	if cursor.Subagents == nil {
+		cursor.Subagents = &SubagentState{}
+	}
+	state := cursor.Subagents
+	if state.Links == nil {
+		state.Links = make(map[string]*SubagentLink)
+	}
+	if state.Sidechains == nil {
+		state.Sidechains = make(map[string]string)
+	}
+	return state
+}
+
+func (st *SubagentState) link(parentID, key string) *SubagentLink {
+	link := st.Links[key]
+	if link == nil {
+		link = &SubagentLink{SessionID: childSessionID(parentID, key)}
+		st.Links[key] = link
+	}
+	return link
+}
+
+// claimTask links a sub-agent to the pending Task call with the same prompt.
+func (st *SubagentState) claimTask(link *SubagentLink, prompt string) {
+	if link.ToolUseID != "" || strings.TrimSpace(prompt) == "" {
+		return
+	}
+	hash := hashLine([]byte(strings.TrimSpace(prompt)))
+	for i, task := range st.Pending {
+		if task.PromptHash == hash {
+			link.ToolUseID = task.ToolUseID
+			link.SubagentType = task.SubagentType
+			link.Description = task.Description
+			st.Pending = append(st.Pending[:i], st.Pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// takePending removes and returns the pending Task call with toolUseID.
+func (st *SubagentState) takePending(toolUseID string) *PendingTask {
+	for i, task := range st.Pending {
+		if task.ToolUseID == toolUseID {
+			st.Pending = append(st.Pending[:i], st.Pending[i+1:]...)
+			return &task
+		}
+	}
+	return nil
+}
+
+// sidechainRouter writes transcript events, sending sidechain records to
+// the child session of the sub-agent that produced them.
+type sidechainRouter struct {
+	s          *Server
+	parentPath string
+	parent     *SessionCursor
+	// agentKey is set while reading a sub-agent's own transcript, where
+	// every record belongs to that agent.
+	agentKey string
+	children map[string]*childSession
+	// uuids are the parent transcript's record uuids read so far, recorded
+	// in the index on flush to detect later resumes.
+	uuids []string
+}
+
+type childSession struct {
+	path   string
+	cursor *SessionCursor
+	unlock func() // releases the child's session lock on flush
+}
+
+func (s *Server) newSidechainRouter(parentPath string, parent *SessionCursor) *sidechainRouter {
+	return &sidechainRouter{s: s, parentPath: parentPath, parent: parent, children: make(map[string]*childSession)}
+}
+
+// write appends one parsed event and returns the number of events written.
+func (r *sidechainRouter) write(sessionPath string, cursor *SessionCursor, event map[string]interface{}) (int, time.Time, error) {
+	ref, sidechain := event[sidechainEventKey].(sidechainRef)
+	delete(event, sidechainEventKey)
+	if sidechain || r.agentKey != "" {
+		return r.writeSidechain(ref, event)
+	}
+
+	meta := extractEventMetadata(event)
+	if meta.EventType == "tool_use" {
+		r.notePendingTask(meta.Data)
+	}
+	wroteAt, err := r.s.appendEvent(sessionPath, cursor, event)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	written := 1
+	if meta.EventType == "tool_result" {
+		n, linkedAt, err := r.noteTaskResult(meta.Data, meta.Timestamp)
+		if err != nil {
+			return written, wroteAt, err
+		}
+		written += n
+		wroteAt = maxTime(wroteAt, linkedAt)
+	}
+	return written, wroteAt, nil
+}
+
+func (r *sidechainRouter) notePendingTask(data map[string]interface{}) {
+	name, _ := data["tool_name"].(string)
+	if !subagentToolNames[name] {
+		return
+	}
+	input, _ := data["input"].(map[string]interface{})
+	prompt, _ := input["prompt"].(string)
+	toolUseID, _ := data["tool_use_id"].(string)
+	if toolUseID == "" || strings.TrimSpace(prompt) == "" {
+		return
+	}
+	state := subagentState(r.parent)
+	task := PendingTask{ToolUseID: toolUseID, PromptHash: hashLine([]byte(strings.TrimSpace(prompt)))}
+	task.SubagentType, _ = input["subagent_type"].(string)
+	task.Description, _ = input["description"].(string)
+	state.Pending = append(state.Pending, task)
+	if len(state.Pending) > maxPendingTasks {
+		state.Pending = state.Pending[len(state.Pending)-maxPendingTasks:]
+	}
+}
+
+// noteTaskResult handles the result of a Task call: it names the agent when
+// Claude Code reports one, and marks the sub-agent done so its child session
+// can be closed.
+func (r *sidechainRouter) noteTaskResult(data map[string]interface{}, ts time.Time) (int, time.Time, error) {
+	if r.parent.Subagents == nil {
+		return 0, time.Time{}, nil
+	}
+	toolUseID, _ := data["tool_use_id"].(string)
+	if toolUseID == "" {
+		return 0, time.Time{}, nil
+	}
+	state := subagentState(r.parent)
+	task := state.takePending(toolUseID)
+
+	written := 0
+	latest := time.Time{}
+	if agentID, _ := data["agent_id"].(string); agentID != "" {
+		link := state.link(r.parent.SessionID, agentID)
+		link.AgentID = agentID
+		if link.ToolUseID == "" && task != nil {
+			link.ToolUseID = task.ToolUseID
+			link.SubagentType = task.SubagentType
+			link.Description = task.Description
+			if link.Started {
+				wroteAt, err := r.appendLinkEvent(link, ts)
+				if err != nil {
+					return 0, time.Time{}, err
+				}
+				written++
+				latest = wroteAt
+			}
+		}
+	}
+	for _, link := range state.Links {
+		if link.ToolUseID == toolUseID {
+			link.Done = true
+		}
+	}
+	return written, latest, nil
+}
+
+func (r *sidechainRouter) writeSidechain(ref sidechainRef, event map[string]interface{}) (int, time.Time, error) {
+	state := subagentState(r.parent)
+	key := r.resolveKey(state, ref)
+	link := state.link(r.parent.SessionID, key)
+	if link.AgentID == "" {
+		link.AgentID = ref.AgentID
+	}
+	if link.Skipped {
+		return 0, time.Time{}, nil
+	}
+
+	meta := extractEventMetadata(event)
+	written := 0
+	latest := time.Time{}
+	if !link.Started {
+		state.claimTask(link, ref.Prompt)
+		if link.ToolUseID == "" && r.agentKey == "" && isWarmupPrompt(ref.Prompt) {
+			link.Skipped = true
+			return 0, time.Time{}, nil
+		}
+		child, err := r.child(link, meta.Timestamp)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		start := buildSubagentStartEvent(link, r.parent, meta.Tool, meta.Timestamp)
+		wroteAt, err := r.s.appendEvent(child.path, child.cursor, start)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		link.Started = true
+		written++
+		latest = wroteAt
+		if wroteAt, err = r.appendLinkEvent(link, meta.Timestamp); err != nil {
+			return written, latest, err
+		}
+		written++
+		latest = maxTime(latest, wroteAt)
+	}
+
+	child, err := r.child(link, meta.Timestamp)
+	if err != nil {
+		return written, latest, err
+	}
+	event["session_id"] = link.SessionID
+	wroteAt, err := r.s.appendEvent(child.path, child.cursor, event)
+	if err != nil {
+		return written, latest, err
+	}
+	return written + 1, maxTime(latest, wroteAt), nil
+}
+
+// resolveKey finds the agent a sidechain record belongs to. Untagged records
+// follow their parentUuid to the first record of their chain.
+func (r *sidechainRouter) resolveKey(state *SubagentState, ref sidechainRef) string {
+	if r.agentKey != "" {
+		return r.agentKey
+	}
+	if ref.AgentID != "" {
+		return ref.AgentID
+	}
+	key := ""
+	if ref.ParentUUID != "" {
+		key = state.Sidechains[ref.ParentUUID]
+		if key == "" {
+			// The parent record produced no events, so it was never mapped.
+			key = state.LastKey
+		}
+	}
+	if key == "" {
+		key = ref.UUID
+	}
+	if key == "" {
+		key = "sidechain"
+	}
+	if ref.UUID != "" {
+		state.Sidechains[ref.UUID] = key
+	}
+	state.LastKey = key
+	return key
+}
+
+func (r *sidechainRouter) child(link *SubagentLink, ts time.Time) (*childSession, error) {
+	if child, ok := r.children[link.SessionID]; ok {
+		return child, nil
+	}
+	// The parent already holds the store lock shared; taking it again could
+	// deadlock behind a waiting writer, so only the child's own lock is taken.
+	unlock := r.s.sessionLocks.lock(link.SessionID)
+	cursor, err := loadCursorState(r.s.baseDir, link.SessionID)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	path, err := r.s.state.EnsureSessionFile(r.s.baseDir, link.SessionID, subagentTool(r.parent), ts)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	child := &childSession{path: path, cursor: cursor, unlock: unlock}
+	r.children[link.SessionID] = child
+	return child, nil
+}
+
+// appendLinkEvent records a sub-agent in the parent session. It is written
+// again if the spawning tool call is only learned later.
+func (r *sidechainRouter) appendLinkEvent(link *SubagentLink, ts time.Time) (time.Time, error) {
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	data := map[string]interface{}{"child_session_id": link.SessionID}
+	setIfNotEmpty(data, "tool_use_id", link.ToolUseID)
+	setIfNotEmpty(data, "agent_id", link.AgentID)
+	setIfNotEmpty(data, "subagent_type", link.SubagentType)
+	setIfNotEmpty(data, "description", link.Description)
+	event := buildEvent("subagent", r.parent.SessionID, subagentTool(r.parent), ts, data)
+	return r.s.appendEvent(r.parentPath, r.parent, event)
+}
+
+// flush saves the child sessions written during this pass.
+// noteLine remembers the uuid of a parent transcript record.
+func (r *sidechainRouter) noteLine(line []byte) {
+	if r.agentKey != "" {
+		return
+	}
+	if ref, ok := parseRecordRef(line); ok {
+		r.uuids = append(r.uuids, ref.UUID)
+	}
+}
+
+// flush saves the child sessions written during this pass and releases
+// their locks.
+func (r *sidechainRouter) flush() error {
+	defer func() {
+		for id, child := range r.children {
+			child.unlock()
+			delete(r.children, id)
+		}
+	}()
+	if len(r.uuids) > 0 && r.parent.Metadata != nil {
+		if err := r.s.index.RecordUUIDs(r.parent.SessionID, r.parent.Metadata.Tool, r.uuids); err != nil {
+			r.s.logger.Warn("record transcript uuids failed", "session_id", r.parent.SessionID, "error", err)
+		}
+		r.uuids = nil
+	}
+	ids := make([]string, 0, len(r.children))
+	for id := range r.children {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := r.s.saveCursor(r.children[id].cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildSubagentStartEvent(link *SubagentLink, parent *SessionCursor, tool string, ts time.Time) map[string]interface{} {
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	data := map[string]interface{}{"parent_session_id": parent.SessionID}
+	if parent.Metadata != nil {
+		setIfNotEmpty(data, "cwd", parent.Metadata.Cwd)
+	}
+	setIfNotEmpty(data, "parent_tool_use_id", link.ToolUseID)
+	setIfNotEmpty(data, "agent_id", link.AgentID)
+	setIfNotEmpty(data, "subagent_type", link.SubagentType)
+	setIfNotEmpty(data, "description", link.Description)
+	if tool == "" {
+		tool = subagentTool(parent)
+	}
+	return buildEvent("session_start", link.SessionID, tool, ts, data)
+}
+
+func subagentTool(parent *SessionCursor) string {
+	if parent.Metadata != nil && parent.Metadata.Tool != "" {
+		return parent.Metadata.Tool
+	}
+	return "claude-code"
+}
+
+func setIfNotEmpty(data map[string]interface{}, key, value string) {
+	if value != "" {
+		data[key] = value
+	}
+}
+
+// isWarmupPrompt matches the cache warmup Claude Code runs as a sidechain
+// at startup; it is not a sub-agent anyone asked for.
+func isWarmupPrompt(prompt string) bool {
+	return strings.EqualFold(strings.TrimSpace(prompt), "warmup")
+}
+
+// noteSubagentHook registers the agent named by a SubagentStop hook, so its
+// transcript is read even before the Task result names it.
+func noteSubagentHook(cursor *SessionCursor, event map[string]interface{}) {
+	agentID, _ := event["agent_id"].(string)
+	if agentID == "" {
+		return
+	}
+	link := subagentState(cursor).link(cursor.SessionID, agentID)
+	link.AgentID = agentID
+	if path, ok := event["agent_transcript_path"].(string); ok && path != "" {
+		link.TranscriptPath = path
+	}
+}
+
+// appendClaudeSubagents copies new records from known sub-agents' own
+// transcripts, then closes the child sessions whose Task has returned.
+func (s *Server) appendClaudeSubagents(sessionPath, sessionID string, cursor *SessionCursor, hookTime time.Time) (int, time.Time, error) {
+	written := 0
+	latest := time.Time{}
+	if cursor.Subagents == nil {
+		return written, latest, nil
+	}
+	state := subagentState(cursor)
+	keys := make([]string, 0, len(state.Links))
+	for key := range state.Links {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		link := state.Links[key]
+		if link.Ended || link.Skipped || link.AgentID == "" {
+			continue
+		}
+		path := agentTranscriptPath(cursor.TranscriptPath, sessionID, link)
+		if path == "" {
+			continue
+		}
+		link.TranscriptPath = path
+
+		reader := &SessionCursor{SessionID: sessionID, TranscriptPath: path, LastOffset: link.LastOffset, LastLineHash: link.LastLineHash}
+		router := s.newSidechainRouter(sessionPath, cursor)
+		router.agentKey = key
+		n, wroteAt, offset, lastHash, err := s.appendTranscriptWith(sessionPath, sessionID, reader, hookTime, claudeEventsFromLine, router)
+		if flushErr := router.flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			return written, latest, err
+		}
+		link.LastOffset = offset
+		link.LastLineHash = lastHash
+		written += n
+		latest = maxTime(latest, wroteAt)
+	}
+
+	n, wroteAt, err := s.closeSubagents(sessionPath, cursor, hookTime, false)
+	return written + n, maxTime(latest, wroteAt), err
+}
+
+// agentTranscriptPath locates a sub-agent's transcript: named by the hook,
+// under <session>/subagents/ next to the parent transcript, or beside it in
+// older Claude Code versions.
+func agentTranscriptPath(transcriptPath, sessionID string, link *SubagentLink) string {
+	candidates := []string{link.TranscriptPath}
+	if transcriptPath != "" {
+		dir := filepath.Dir(transcriptPath)
+		name := "agent-" + link.AgentID + ".jsonl"
+		candidates = append(candidates, filepath.Join(dir, sessionID, "subagents", name), filepath.Join(dir, name))
+	}
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// closeSubagents writes session_end for started child sessions whose Task
+// returned, or for all of them when the parent session is ending.
+func (s *Server) closeSubagents(parentPath string, parent *SessionCursor, ts time.Time, all bool) (int, time.Time, error) {
+	if parent.Subagents == nil {
+		return 0, time.Time{}, nil
+	}
+	state := subagentState(parent)
+	keys := make([]string, 0, len(state.Links))
+	for key, link := range state.Links {
+		if link.Started && !link.Ended && (all || link.Done) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	written := 0
+	latest := time.Time{}
+	for _, key := range keys {
+		link := state.Links[key]
+		wroteAt, err := s.closeSubagent(parent, link, ts)
+		if err != nil {
+			return written, latest, err
+		}
+		link.Ended = true
+		for recordID, owner := range state.Sidechains {
+			if owner == key {
+				delete(state.Sidechains, recordID)
+			}
+		}
+		written++
+		latest = maxTime(latest, wroteAt)
+	}
+	return written, latest, nil
+}
+
+// closeSubagent writes a sub-agent's session_end under the child's session
+// lock; the caller holds the parent's.
+func (s *Server) closeSubagent(parent *SessionCursor, link *SubagentLink, ts time.Time) (time.Time, error) {
+	defer s.sessionLocks.lock(link.SessionID)()
+	cursor, err := loadCursorState(s.baseDir, link.SessionID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	path, err := s.state.EnsureSessionFile(s.baseDir, link.SessionID, subagentTool(parent), ts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	reason := "parent_ended"
+	if link.Done {
+		reason = "task_completed"
+	}
+	// A sub-agent ends with its last record, not whenever the parent
+	// happens to notice.
+	endAt := ts
+	if cursor.Metadata != nil {
+		if last, err := time.Parse(time.RFC3339Nano, cursor.Metadata.LastEventAt); err == nil {
+			endAt = last
+		}
+	}
+	end := buildEvent("session_end", link.SessionID, subagentTool(parent), endAt, map[string]interface{}{"reason": reason})
+	s.attachSessionUsage(end, cursor)
+	wroteAt, err := s.appendEvent(path, cursor, end)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.saveCursor(cursor); err != nil {
+		return time.Time{}, err
+	}
+	return wroteAt, nil
+}
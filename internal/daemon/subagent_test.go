@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSubagentTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { srv.index.Close() })
+	return srv, baseDir
+}
+
+func eventTypes(events []map[string]interface{}) string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event["event_type"].(string))
+	}
+	return strings.Join(types, ",")
+}
+
+func TestInlineSidechainBecomesChildSession(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "7a1b2c3d-1111-4222-8333-944455556666"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	lines := []string{
+		`{"type":"user","isSidechain":true,"uuid":"w1","parentUuid":null,"message":{"role":"user","content":"Warmup"},"timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"assistant","isSidechain":true,"uuid":"w2","parentUuid":"w1","message":{"role":"assistant","content":[{"type":"text","text":"Ready"}]},"timestamp":"2026-01-01T12:00:01Z"}`,
+		`{"type":"user","uuid":"m1","message":{"role":"user","content":"find the go files"},"timestamp":"2026-01-01T12:00:02Z"}`,
+		`{"type":"assistant","uuid":"m2","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_task1","name":"Task","input":{"description":"List files","prompt":"List every go file","subagent_type":"Explore"}}]},"timestamp":"2026-01-01T12:00:03Z"}`,
+		`{"type":"user","isSidechain":true,"uuid":"s1","parentUuid":null,"message":{"role":"user","content":"List every go file"},"timestamp":"2026-01-01T12:00:04Z"}`,
+		`{"type":"assistant","isSidechain":true,"uuid":"s2","parentUuid":"s1","message":{"role":"assistant","content":[{"type":"text","text":"main.go"}]},"timestamp":"2026-01-01T12:00:05Z"}`,
+		`{"type":"user","uuid":"m3","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_task1","content":"main.go"}]},"timestamp":"2026-01-01T12:00:06Z"}`,
+		`{"type":"assistant","uuid":"m4","message":{"role":"assistant","content":[{"type":"text","text":"Found main.go"}]},"timestamp":"2026-01-01T12:00:07Z"}`,
+	}
+	if err := os.WriteFile(transcriptPath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "SessionEnd"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	parentPath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	parent := readEvents(t, parentPath)
+	if got := eventTypes(parent); got != "session_start,message,tool_use,subagent,tool_result,message,session_end" {
+		t.Fatalf("unexpected parent events: %s", got)
+	}
+	childID := childSessionID(sessionID, "s1")
+	link := parent[3]["data"].(map[string]interface{})
+	if link["child_session_id"] != childID || link["tool_use_id"] != "toolu_task1" || link["subagent_type"] != "Explore" {
+		t.Fatalf("unexpected subagent link: %+v", link)
+	}
+
+	childPath, ok, _ := findExistingSessionFile(baseDir, childID, "claude-code")
+	if !ok {
+		t.Fatalf("child session not written")
+	}
+	child := readEvents(t, childPath)
+	if got := eventTypes(child); got != "session_start,message,message,session_end" {
+		t.Fatalf("unexpected child events: %s", got)
+	}
+	start := child[0]["data"].(map[string]interface{})
+	if start["parent_session_id"] != sessionID || start["parent_tool_use_id"] != "toolu_task1" || start["description"] != "List files" {
+		t.Fatalf("unexpected child start: %+v", start)
+	}
+	if child[1]["session_id"] != childID {
+		t.Fatalf("child events keep the parent session id: %v", child[1]["session_id"])
+	}
+	if end := child[3]; end["timestamp"] != "2026-01-01T12:00:05Z" || end["data"].(map[string]interface{})["reason"] != "task_completed" {
+		t.Fatalf("unexpected child end: %+v", end)
+	}
+
+	if _, ok, _ := findExistingSessionFile(baseDir, childSessionID(sessionID, "w1"), "claude-code"); ok {
+		t.Fatalf("warmup sidechain must not become a child session")
+	}
+}
+
+func TestAgentTranscriptBecomesChildSession(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "8b2c3d4e-2222-4333-8444-a55566667777"
+	projectDir := t.TempDir()
+	transcriptPath := filepath.Join(projectDir, sessionID+".jsonl")
+	main := []string{
+		`{"type":"user","message":{"role":"user","content":"review auth"},"timestamp":"2026-01-01T12:00:00Z"}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_task2","name":"Task","input":{"description":"Review","prompt":"Review auth.go"}}]},"timestamp":"2026-01-01T12:00:01Z"}`,
+	}
+	if err := os.WriteFile(transcriptPath, []byte(strings.Join(main, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	agentDir := filepath.Join(projectDir, sessionID, "subagents")
+	if err := os.MkdirAll(agentDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	agent := []string{
+		`{"type":"user","isSidechain":true,"agentId":"a1b2c3","sessionId":"` + sessionID + `","message":{"role":"user","content":"Review auth.go"},"timestamp":"2026-01-01T12:00:02Z"}`,
+		`{"type":"assistant","isSidechain":true,"agentId":"a1b2c3","sessionId":"` + sessionID + `","message":{"role":"assistant","content":[{"type":"text","text":"Looks fine"}]},"timestamp":"2026-01-01T12:00:03Z"}`,
+	}
+	if err := os.WriteFile(filepath.Join(agentDir, "agent-a1b2c3.jsonl"), []byte(strings.Join(agent, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write agent transcript: %v", err)
+	}
+
+	stop := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "SubagentStop", "agent_id": "a1b2c3"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: stop}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	childID := childSessionID(sessionID, "a1b2c3")
+	childPath, ok, _ := findExistingSessionFile(baseDir, childID, "claude-code")
+	if !ok {
+		t.Fatalf("child session not written")
+	}
+	if got := eventTypes(readEvents(t, childPath)); got != "session_start,message,message" {
+		t.Fatalf("unexpected child events before the Task returned: %s", got)
+	}
+
+	result := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_task2","content":"Looks fine"}]},"toolUseResult":{"agentId":"a1b2c3"},"timestamp":"2026-01-01T12:00:04Z"}` + "\n"
+	file, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	_, _ = file.WriteString(result)
+	file.Close()
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "Stop"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	child := readEvents(t, childPath)
+	if got := eventTypes(child); got != "session_start,message,message,session_end" {
+		t.Fatalf("unexpected child events: %s", got)
+	}
+	start := child[0]["data"].(map[string]interface{})
+	if start["parent_tool_use_id"] != "toolu_task2" || start["agent_id"] != "a1b2c3" {
+		t.Fatalf("unexpected child start: %+v", start)
+	}
+	parentPath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	parent := readEvents(t, parentPath)
+	if got := eventTypes(parent); got != "session_start,message,tool_use,subagent,hook,tool_result,hook" {
+		t.Fatalf("unexpected parent events: %s", got)
+	}
+	if data := parent[5]["data"].(map[string]interface{}); data["agent_id"] != "a1b2c3" {
+		t.Fatalf("expected agent_id on the Task result, got %+v", data)
+	}
+}
@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+func TestClaudeUsageCountsEachTurnOnce(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer srv.index.Close()
+
+	sessionID := "8b3c4d5e-2222-4333-8444-a55566667777"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	// Claude Code writes one line per content block, repeating the turn's
+	// usage on each; msg_1 must only count once.
+	usage := `"usage":{"input_tokens":100,"output_tokens":20,"cache_creation_input_tokens":1000,"cache_read_input_tokens":5000}`
+	lines := `{"type":"user","message":{"role":"user","content":"hi"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n" +
+		`{"type":"assistant","message":{"id":"msg_1","model":"claude-sonnet-4-20250514","role":"assistant","content":[{"type":"text","text":"looking"}],` + usage + `},"timestamp":"2026-01-01T12:00:01Z"}` + "\n" +
+		`{"type":"assistant","message":{"id":"msg_1","model":"claude-sonnet-4-20250514","role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}],` + usage + `},"timestamp":"2026-01-01T12:00:02Z"}` + "\n" +
+		`{"type":"assistant","message":{"id":"msg_2","model":"claude-sonnet-4-20250514","role":"assistant","content":[{"type":"text","text":"done"}],"usage":{"input_tokens":10,"output_tokens":5}},"timestamp":"2026-01-01T12:00:03Z"}` + "\n"
+	if err := os.WriteFile(transcriptPath, []byte(lines), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "SessionEnd", "reason": "exit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+
+	want := events.TokenUsage{InputTokens: 110, OutputTokens: 25, CacheCreationInputTokens: 1000, CacheReadInputTokens: 5000}
+	// 110*3 + 25*15 + 1000*3.75 + 5000*0.3 per million tokens.
+	wantCost := 0.005955
+
+	sessionPath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	end := lastEvent(t, sessionPath)
+	if end["event_type"] != "session_end" {
+		t.Fatalf("expected session_end last, got %v", end["event_type"])
+	}
+	data := end["data"].(map[string]interface{})
+	if got, ok := parseTokenUsage(data["usage"]); !ok || got != want {
+		t.Fatalf("unexpected session_end usage: %v", data["usage"])
+	}
+	if cost, _ := data["cost_usd"].(float64); cost != wantCost {
+		t.Fatalf("expected cost %v, got %v", wantCost, data["cost_usd"])
+	}
+
+	entry, found, err := srv.index.Lookup(sessionID, "claude-code")
+	if err != nil || !found {
+		t.Fatalf("expected indexed session, found=%v err=%v", found, err)
+	}
+	if entry.Usage != want || entry.CostUSD != wantCost {
+		t.Fatalf("unexpected indexed usage: %+v cost=%v", entry.Usage, entry.CostUSD)
+	}
+
+	replayed, err := ReplaySessionMetadata(sessionPath)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed.Usage == nil || *replayed.Usage != want || replayed.CostUSD != wantCost {
+		t.Fatalf("unexpected replayed usage: %+v cost=%v", replayed.Usage, replayed.CostUSD)
+	}
+}
+
+func lastEvent(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	defer file.Close()
+	var last map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		last = nil
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+	}
+	return last
+}
@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	liveTailDebounce = 200 * time.Millisecond
+	liveTailIdle     = 15 * time.Minute
+	liveTailSweep    = time.Minute
+)
+
+// fileNotifier reports paths whose contents changed, and paths it stopped
+// watching on its own because the file was deleted or moved away. The Linux
+// implementation uses inotify; other platforms poll file size and mtime.
+type fileNotifier interface {
+	Add(path string) error
+	Remove(path string) error
+	Events() <-chan fileEvent
+	Close() error
+}
+
+type fileEvent struct {
+	path string
+	gone bool // the watch was dropped; Add the path again to resume
+}
+
+// transcriptWatcher tails transcripts of active sessions so events land in
+// the session file while a turn is still running, not only when the next
+// hook fires. Writes are batched per debounce window; sessions are dropped
+// after session_end or liveTailIdle without writes. Hook captures and tail
+// flushes share the session cursor, so neither duplicates the other.
+type transcriptWatcher struct {
+	srv      *Server
+	notifier fileNotifier
+
+	mu        sync.Mutex
+	byPath    map[string]*watchedTranscript
+	bySession map[string]string
+}
+
+type watchedTranscript struct {
+	sessionID    string
+	path         string
+	lastActivity time.Time
+	pending      bool
+}
+
+// StartLiveTail enables transcript watching when local.live_tail is set.
+func StartLiveTail(ctx context.Context, srv *Server) {
+	srv.mu.RLock()
+	enabled := srv.liveTail
+	srv.mu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	notifier, err := newFileNotifier()
+	if err != nil {
+		srv.logger.Warn("live tail disabled", "error", err)
+		return
+	}
+	w := &transcriptWatcher{
+		srv:       srv,
+		notifier:  notifier,
+		byPath:    make(map[string]*watchedTranscript),
+		bySession: make(map[string]string),
+	}
+	srv.watcher.Store(w)
+	srv.logger.Info("live transcript tailing enabled")
+
+	go w.run(ctx)
+}
+
+func (w *transcriptWatcher) run(ctx context.Context) {
+	sweep := time.NewTicker(liveTailSweep)
+	defer sweep.Stop()
+	defer w.notifier.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.notifier.Events():
+			if !ok {
+				return
+			}
+			if event.gone {
+				w.forget(event.path)
+				continue
+			}
+			w.schedule(event.path)
+		case now := <-sweep.C:
+			w.dropIdle(now)
+		}
+	}
+}
+
+// Watch starts (or refreshes) tailing for a session's transcript.
+func (w *transcriptWatcher) Watch(sessionID, path string) {
+	if w == nil || path == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if current, ok := w.bySession[sessionID]; ok {
+		if current == path {
+			w.byPath[path].lastActivity = time.Now()
+			return
+		}
+		w.removeLocked(sessionID)
+	}
+	if err := w.notifier.Add(path); err != nil {
+		// Usually the transcript does not exist yet; the next hook retries.
+		w.srv.logger.Debug("live tail watch failed", "session_id", sessionID, "path", path, "error", err)
+		return
+	}
+	w.byPath[path] = &watchedTranscript{sessionID: sessionID, path: path, lastActivity: time.Now()}
+	w.bySession[sessionID] = path
+}
+
+// Unwatch stops tailing a session.
+func (w *transcriptWatcher) Unwatch(sessionID string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(sessionID)
+}
+
+// Count returns the number of transcripts being watched.
+func (w *transcriptWatcher) Count() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.bySession)
+}
+
+func (w *transcriptWatcher) removeLocked(sessionID string) {
+	path, ok := w.bySession[sessionID]
+	if !ok {
+		return
+	}
+	delete(w.bySession, sessionID)
+	delete(w.byPath, path)
+	if err := w.notifier.Remove(path); err != nil {
+		w.srv.logger.Debug("live tail unwatch failed", "path", path, "error", err)
+	}
+}
+
+// forget drops a transcript whose watch the notifier dropped, so the next
+// hook's Watch adds it again instead of refreshing a watch that no longer
+// fires.
+func (w *transcriptWatcher) forget(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry, ok := w.byPath[path]
+	if !ok {
+		return
+	}
+	delete(w.byPath, path)
+	if w.bySession[entry.sessionID] == path {
+		delete(w.bySession, entry.sessionID)
+	}
+	w.srv.logger.Debug("live tail watch dropped", "session_id", entry.sessionID, "path", path)
+}
+
+func (w *transcriptWatcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry, ok := w.byPath[path]
+	if !ok {
+		return
+	}
+	entry.lastActivity = time.Now()
+	if entry.pending {
+		return
+	}
+	entry.pending = true
+	time.AfterFunc(liveTailDebounce, func() { w.flush(path) })
+}
+
+func (w *transcriptWatcher) flush(path string) {
+	w.mu.Lock()
+	entry, ok := w.byPath[path]
+	if !ok {
+		w.mu.Unlock()
+		return
+	}
+	entry.pending = false
+	sessionID := entry.sessionID
+	w.mu.Unlock()
+
+	written, ended, err := w.srv.tailSession(sessionID, false)
+	if err != nil {
+		w.srv.logger.Warn("live tail failed", "session_id", sessionID, "error", err)
+		return
+	}
+	if written > 0 {
+		w.srv.logger.Debug("live tail appended events", "session_id", sessionID, "events", written)
+	}
+	if ended {
+		w.Unwatch(sessionID)
+	}
+}
+
+func (w *transcriptWatcher) dropIdle(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for sessionID, path := range w.bySession {
+		if now.Sub(w.byPath[path].lastActivity) >= liveTailIdle {
+			w.removeLocked(sessionID)
+		}
+	}
+}
+
+// trackTranscript keeps the watcher in sync with a session's cursor after a
+// hook capture. Callers hold the session lock.
+func (s *Server) trackTranscript(sessionID string, cursor *SessionCursor) {
+	watcher := s.watcher.Load()
+	if watcher == nil || cursor == nil {
+		return
+	}
+	if cursor.Metadata != nil && cursor.Metadata.EndedAt != "" {
+		watcher.Unwatch(sessionID)
+		return
+	}
+	watcher.Watch(sessionID, cursor.TranscriptPath)
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+
+type inotifyNotifier struct {
+	fd     int
+	file   *os.File
+	events chan fileEvent
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	paths map[int32]string
+	wds   map[string]int32
+}
+
+func newFileNotifier() (fileNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{
+		// A non-blocking fd wrapped in os.File goes through the runtime
+		// poller, so Close unblocks the pending Read. Watch calls use the raw
+		// fd because File.Fd would switch it back to blocking mode.
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan fileEvent, 64),
+		done:   make(chan struct{}),
+		paths:  make(map[int32]string),
+		wds:    make(map[string]int32),
+	}
+	go n.readLoop()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Add(path string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.wds[path]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.paths[int32(wd)] = path
+	n.wds[path] = int32(wd)
+	return nil
+}
+
+func (n *inotifyNotifier) Remove(path string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	wd, ok := n.wds[path]
+	if !ok {
+		return nil
+	}
+	delete(n.wds, path)
+	delete(n.paths, wd)
+	_, err := syscall.InotifyRmWatch(n.fd, uint32(wd))
+	return err
+}
+
+func (n *inotifyNotifier) Events() <-chan fileEvent {
+	return n.events
+}
+
+func (n *inotifyNotifier) Close() error {
+	n.once.Do(func() { close(n.done) })
+	return n.file.Close()
+}
+
+func (n *inotifyNotifier) readLoop() {
+	defer close(n.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			n.mu.Lock()
+			path, ok := n.paths[raw.Wd]
+			gone := ok && raw.Mask&(syscall.IN_IGNORED|syscall.IN_MOVE_SELF|syscall.IN_DELETE_SELF) != 0
+			if gone {
+				// The file is gone or was replaced; the next hook re-adds it.
+				// A moved file keeps its wd, so the kernel watch is removed
+				// too, or it would report on a file at another path.
+				delete(n.paths, raw.Wd)
+				delete(n.wds, path)
+				if raw.Mask&syscall.IN_IGNORED == 0 {
+					_, _ = syscall.InotifyRmWatch(n.fd, uint32(raw.Wd))
+				}
+			}
+			n.mu.Unlock()
+
+			if ok && raw.Mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0 {
+				if !n.send(fileEvent{path: path}) {
+					return
+				}
+			}
+			if gone && !n.send(fileEvent{path: path, gone: true}) {
+				return
+			}
+		}
+	}
+}
+
+func (n *inotifyNotifier) send(event fileEvent) bool {
+	select {
+	case n.events <- event:
+		return true
+	case <-n.done:
+		return false
+	}
+}
@@ -0,0 +1,98 @@
+//go:build !linux
+
+package daemon
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const pollNotifierInterval = time.Second
+
+// pollNotifier is the fallback for platforms without inotify: it stats each
+// watched file once per interval and reports size or mtime changes.
+type pollNotifier struct {
+	events chan fileEvent
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	files map[string]os.FileInfo
+}
+
+func newFileNotifier() (fileNotifier, error) {
+	n := &pollNotifier{
+		events: make(chan fileEvent, 64),
+		done:   make(chan struct{}),
+		files:  make(map[string]os.FileInfo),
+	}
+	go n.loop()
+	return n, nil
+}
+
+func (n *pollNotifier) Add(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.files[path]; !ok {
+		n.files[path] = info
+	}
+	return nil
+}
+
+func (n *pollNotifier) Remove(path string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.files, path)
+	return nil
+}
+
+func (n *pollNotifier) Events() <-chan fileEvent {
+	return n.events
+}
+
+func (n *pollNotifier) Close() error {
+	n.once.Do(func() { close(n.done) })
+	return nil
+}
+
+func (n *pollNotifier) loop() {
+	defer close(n.events)
+	ticker := time.NewTicker(pollNotifierInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		var changed []fileEvent
+		n.mu.Lock()
+		for path, prev := range n.files {
+			info, err := os.Stat(path)
+			if err != nil {
+				delete(n.files, path)
+				changed = append(changed, fileEvent{path: path, gone: true})
+				continue
+			}
+			if info.Size() != prev.Size() || !info.ModTime().Equal(prev.ModTime()) {
+				n.files[path] = info
+				changed = append(changed, fileEvent{path: path})
+			}
+		}
+		n.mu.Unlock()
+
+		for _, event := range changed {
+			select {
+			case n.events <- event:
+			case <-n.done:
+				return
+			}
+		}
+	}
+}
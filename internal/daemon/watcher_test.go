@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveTailAppendsWithoutHook(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv.liveTail = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartLiveTail(ctx, srv)
+	if srv.watcher.Load() == nil {
+		t.Fatalf("expected watcher to start")
+	}
+
+	sessionID := "9d3c2b1a-1111-4222-8333-944455556666"
+	transcriptPath := filepath.Join(t.TempDir(), sessionID+".jsonl")
+	first := `{"type":"user","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(transcriptPath, []byte(first), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "UserPromptSubmit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if got := srv.watcher.Load().Count(); got != 1 {
+		t.Fatalf("expected 1 watched transcript, got %d", got)
+	}
+
+	f, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	f.WriteString(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"streamed reply"}]},"timestamp":"2026-01-01T12:00:01Z"}` + "\n")
+	f.Close()
+
+	sessionPath, _, err := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	if err != nil {
+		t.Fatalf("find session file: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(sessionPath)
+		if strings.Contains(string(data), "streamed reply") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("live tail did not append the new transcript line")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// A hook arriving afterwards records itself but must not duplicate what
+	// the tail wrote.
+	written, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now())
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if written != 1 {
+		t.Fatalf("expected hook after tail to write only the hook event, got %d", written)
+	}
+
+	end := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "SessionEnd", "reason": "exit"}
+	if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: end}, sessionID, time.Now()); err != nil {
+		t.Fatalf("capture end: %v", err)
+	}
+	if got := srv.watcher.Load().Count(); got != 0 {
+		t.Fatalf("expected session_end to unwatch, got %d watches", got)
+	}
+}
+
+func TestLiveTailResumesAfterWatchDropped(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(StateDir(baseDir), 0o700); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	srv := NewServer(baseDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv.liveTail = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartLiveTail(ctx, srv)
+
+	sessionID := "9d3c2b1a-1111-4222-8333-944455556667"
+	dir := t.TempDir()
+	transcriptPath := filepath.Join(dir, sessionID+".jsonl")
+	first := `{"type":"user","message":{"role":"user","content":"hello"},"timestamp":"2026-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(transcriptPath, []byte(first), 0o644); err != nil {
+		t.Fatalf("write transcript: %v", err)
+	}
+	hook := map[string]interface{}{"session_id": sessionID, "transcript_path": transcriptPath, "hook_event_name": "UserPromptSubmit"}
+	capture := func() {
+		t.Helper()
+		if _, _, err := srv.captureClaude(capturePayload{Tool: "claude-code", Event: hook}, sessionID, time.Now()); err != nil {
+			t.Fatalf("capture: %v", err)
+		}
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	capture()
+
+	// Moving the transcript away and back, as an editor saving through a
+	// rename does, drops the watch.
+	moved := filepath.Join(dir, "moved.jsonl")
+	if err := os.Rename(transcriptPath, moved); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	waitFor("the dropped watch to be forgotten", func() bool { return srv.watcher.Load().Count() == 0 })
+	if err := os.Rename(moved, transcriptPath); err != nil {
+		t.Fatalf("rename back: %v", err)
+	}
+
+	// The next hook watches the transcript again, and live tail resumes.
+	capture()
+	if got := srv.watcher.Load().Count(); got != 1 {
+		t.Fatalf("expected the transcript to be watched again, got %d", got)
+	}
+	f, err := os.OpenFile(transcriptPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	f.WriteString(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"after the move"}]},"timestamp":"2026-01-01T12:00:01Z"}` + "\n")
+	f.Close()
+	sessionPath, _, _ := findExistingSessionFile(baseDir, sessionID, "claude-code")
+	waitFor("live tail to append after the move", func() bool {
+		data, _ := os.ReadFile(sessionPath)
+		return strings.Contains(string(data), "after the move")
+	})
+}
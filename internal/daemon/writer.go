@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -8,8 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	"unicode/utf8"
+
+	"github.com/victorarias/tabs/internal/config"
+	"github.com/victorarias/tabs/internal/events"
 )
 
 type SessionCursor struct {
@@ -17,8 +23,15 @@ type SessionCursor struct {
 	TranscriptPath string           `json:"transcript_path,omitempty"`
 	LastOffset     int64            `json:"last_offset"`
 	LastLineHash   string           `json:"last_line_hash"`
+	LastIndex      int              `json:"last_index,omitempty"` // entries consumed from whole-document transcripts
+	LastSeq        int64            `json:"last_seq,omitempty"`   // seq of the last event appended to the session file
 	UpdatedAt      string           `json:"updated_at"`
 	Metadata       *SessionMetadata `json:"metadata,omitempty"`
+	Subagents      *SubagentState   `json:"subagents,omitempty"`
+	LineageChecked bool             `json:"lineage_checked,omitempty"` // resume detection ran
+	Composer       *ComposerState   `json:"composer,omitempty"`        // Cursor composer copy progress
+
+	unsynced bool // events appended to Metadata.FilePath that are not yet synced
 }
 
 type SessionMetadata struct {
@@ -31,6 +44,69 @@ type SessionMetadata struct {
 	MessageCount    int    `json:"message_count,omitempty"`
 	ToolUseCount    int    `json:"tool_use_count,omitempty"`
 	FilePath        string `json:"file_path,omitempty"`
+	LastEventAt     string `json:"last_event_at,omitempty"`
+	Summary         string `json:"summary,omitempty"`
+	ParentSessionID string `json:"parent_session_id,omitempty"`
+	ParentRelation  string `json:"parent_relation,omitempty"` // subagent or continuation
+
+	Usage        *events.TokenUsage           `json:"usage,omitempty"`
+	UsageByModel map[string]events.TokenUsage `json:"usage_by_model,omitempty"`
+	CostUSD      float64                      `json:"cost_usd,omitempty"`
+	LastUsageID  string                       `json:"last_usage_id,omitempty"` // last assistant message id counted into Usage
+
+	HookTiming *events.HookTiming `json:"hook_timing,omitempty"`
+}
+
+// parseTokenUsage reads a usage object from event data.
+func parseTokenUsage(raw interface{}) (events.TokenUsage, bool) {
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return events.TokenUsage{}, false
+	}
+	var usage events.TokenUsage
+	if v, ok := toInt(values["input_tokens"]); ok {
+		usage.InputTokens = int64(v)
+	}
+	if v, ok := toInt(values["output_tokens"]); ok {
+		usage.OutputTokens = int64(v)
+	}
+	if v, ok := toInt(values["cache_creation_input_tokens"]); ok {
+		usage.CacheCreationInputTokens = int64(v)
+	}
+	if v, ok := toInt(values["cache_read_input_tokens"]); ok {
+		usage.CacheReadInputTokens = int64(v)
+	}
+	return usage, !usage.IsZero()
+}
+
+// recordUsage folds an event's usage into the session totals. Claude writes
+// one transcript line per content block and repeats the turn's usage on
+// each, so consecutive events with the same message_id count once.
+func recordUsage(md *SessionMetadata, data map[string]interface{}) {
+	if data == nil {
+		return
+	}
+	usage, ok := parseTokenUsage(data["usage"])
+	if !ok {
+		return
+	}
+	if id, _ := data["message_id"].(string); id != "" {
+		if id == md.LastUsageID {
+			return
+		}
+		md.LastUsageID = id
+	}
+	if md.Usage == nil {
+		md.Usage = &events.TokenUsage{}
+	}
+	md.Usage.Add(usage)
+	model, _ := data["model"].(string)
+	if md.UsageByModel == nil {
+		md.UsageByModel = make(map[string]events.TokenUsage)
+	}
+	byModel := md.UsageByModel[model]
+	byModel.Add(usage)
+	md.UsageByModel[model] = byModel
 }
 
 type eventMetadata struct {
@@ -41,17 +117,20 @@ type eventMetadata struct {
 	Data      map[string]interface{}
 }
 
-func normalizeEvent(event map[string]interface{}, sessionID, tool string, ts time.Time) (map[string]interface{}, []byte, error) {
+func normalizeEvent(event map[string]interface{}, sessionID, tool string, ts time.Time, redactor *Redactor) (map[string]interface{}, []byte, error) {
 	if event == nil {
 		return nil, nil, fmt.Errorf("event payload is nil")
 	}
+	// Redaction rewrites nested values in place; the copy keeps it off the
+	// caller's maps.
 	normalized := make(map[string]interface{}, len(event)+3)
 	for k, v := range event {
-		normalized[k] = v
+		normalized[k] = copyEventValue(v)
 	}
 	normalized["session_id"] = sessionID
 	normalized["tool"] = tool
 	normalized["timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	redactor.RedactEvent(normalized)
 	data, err := json.Marshal(normalized)
 	if err != nil {
 		return nil, nil, err
@@ -59,13 +138,109 @@ func normalizeEvent(event map[string]interface{}, sessionID, tool string, ts tim
 	return normalized, data, nil
 }
 
+// stampEvent gives an event the next seq of its session and an event_id, and
+// returns the line to append. The id hashes the session, the seq and the
+// unstamped line, so an event written again after a crash lost the cursor
+// update gets the id it had the first time and the server drops the copy.
+// The caller sets cursor.LastSeq once the line is appended.
+func stampEvent(cursor *SessionCursor, event map[string]interface{}, line []byte) ([]byte, int64, error) {
+	seq := cursor.LastSeq + 1
+	sessionID, _ := event["session_id"].(string)
+	event["seq"] = seq
+	event["event_id"] = eventID(sessionID, seq, line)
+	stamped, err := json.Marshal(event)
+	return stamped, seq, err
+}
+
+// recoverLastSeq picks the seq count back up from the session file when the
+// cursor has none, because its state file was deleted or could not be read
+// and was replaced by a fresh one. Without it the next events would reuse
+// the seqs, and so the event_ids, already in the file.
+func recoverLastSeq(sessionPath string, cursor *SessionCursor) error {
+	if cursor.LastSeq > 0 {
+		return nil
+	}
+	if info, err := os.Stat(sessionPath); err != nil || info.Size() == 0 {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	last, err := lastSessionEvent(sessionPath)
+	if err != nil || last == nil {
+		return err
+	}
+	_, seq, err := unstampEvent(last)
+	if err != nil {
+		return err
+	}
+	cursor.LastSeq = seq
+	return nil
+}
+
+func eventID(sessionID string, seq int64, line []byte) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%d\n", sessionID, seq)
+	sum.Write(line)
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
+
+// unstampEvent strips seq and event_id from a stored event line, giving the
+// line stampEvent started from, and returns the seq.
+func unstampEvent(line []byte) ([]byte, int64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var event map[string]interface{}
+	if err := decoder.Decode(&event); err != nil {
+		return nil, 0, err
+	}
+	var seq int64
+	if n, ok := event["seq"].(json.Number); ok {
+		seq, _ = n.Int64()
+	}
+	delete(event, "seq")
+	delete(event, "event_id")
+	unstamped, err := json.Marshal(event)
+	return unstamped, seq, err
+}
+
+// copyEventValue deep-copies the maps and slices of a decoded event.
+func copyEventValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = copyEventValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyEventValue(item).(map[string]interface{})
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyEventValue(item)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
 func hashLine(line []byte) string {
 	sum := sha256.Sum256(line)
 	return hex.EncodeToString(sum[:])
 }
 
-func appendJSONL(path string, line []byte) (int64, error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+// appendJSONL appends one line to a session file and returns the new file
+// size. A failed write is cut back off, so the next append never continues
+// a torn line. fsync is the local.fsync mode: FsyncAlways syncs the line, and
+// any mode but FsyncNever syncs the directory entry of a new file.
+func appendJSONL(path string, line []byte, fsync string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
 	if err != nil {
 		return 0, err
 	}
@@ -78,20 +253,51 @@ func appendJSONL(path string, line []byte) (int64, error) {
 		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
 	}()
 
-	line = ensureNewline(line)
-	if _, err := file.Write(line); err != nil {
+	info, err := file.Stat()
+	if err != nil {
 		return 0, err
 	}
-	if err := file.Sync(); err != nil {
+	before := info.Size()
+	if err := appendSessionLine(file, line); err != nil {
+		_ = file.Truncate(before)
 		return 0, err
 	}
-	info, err := file.Stat()
-	if err != nil {
+	if fsync == config.FsyncAlways {
+		if err := file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if before == 0 && fsync != config.FsyncNever {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return 0, err
+		}
+	}
+	if info, err = file.Stat(); err != nil {
 		return 0, err
 	}
 	return info.Size(), nil
 }
 
+// appendLine appends one event line in the configured fsync mode. Under
+// FsyncBatch the cursor is marked so saveCursor syncs the file first.
+func (s *Server) appendLine(sessionPath string, cursor *SessionCursor, line []byte) (int64, error) {
+	size, err := appendJSONL(sessionPath, line, s.fsync)
+	if err == nil && s.fsync == config.FsyncBatch {
+		cursor.unsynced = true
+	}
+	return size, err
+}
+
+// syncFile flushes a file written without FsyncAlways.
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
 func ensureNewline(line []byte) []byte {
 	if len(line) == 0 {
 		return []byte{'\n'}
@@ -114,6 +320,9 @@ func loadCursorState(baseDir, sessionID string) (*SessionCursor, error) {
 		}
 		return nil, err
 	}
+	if data, err = openDocument(data); err != nil {
+		return &SessionCursor{SessionID: sessionID}, fmt.Errorf("decrypt cursor state: %w", err)
+	}
 	var cursor SessionCursor
 	if err := json.Unmarshal(data, &cursor); err != nil {
 		return &SessionCursor{SessionID: sessionID}, fmt.Errorf("decode cursor state: %w", err)
@@ -133,6 +342,9 @@ func saveCursorState(baseDir string, cursor *SessionCursor) error {
 	if err != nil {
 		return err
 	}
+	if data, err = sealDocument(data); err != nil {
+		return err
+	}
 	return writeFileAtomic(cursorStatePath(baseDir, cursor.SessionID), data, 0o600)
 }
 
@@ -225,22 +437,50 @@ func updateCursorMetadata(cursor *SessionCursor, meta eventMetadata, filePath st
 	if md.Tool == "" {
 		md.Tool = meta.Tool
 	}
-	if md.FilePath == "" {
+	if filePath != "" {
+		// Follows the file when it is archived or restored.
 		md.FilePath = filePath
 	}
 	if md.CreatedAt == "" && !meta.Timestamp.IsZero() {
 		md.CreatedAt = meta.Timestamp.UTC().Format(time.RFC3339Nano)
 	}
+	if !meta.Timestamp.IsZero() {
+		if last, err := time.Parse(time.RFC3339Nano, md.LastEventAt); err != nil || meta.Timestamp.After(last) {
+			md.LastEventAt = meta.Timestamp.UTC().Format(time.RFC3339Nano)
+		}
+	}
 	if meta.EventType == "session_start" && meta.Data != nil {
 		if cwd, ok := meta.Data["cwd"].(string); ok && cwd != "" {
 			md.Cwd = cwd
 		}
+		if parent, ok := meta.Data["parent_session_id"].(string); ok && parent != "" {
+			md.ParentSessionID = parent
+			md.ParentRelation = "subagent"
+		}
+	}
+	if meta.EventType == "continuation" && meta.Data != nil {
+		if parent, ok := meta.Data["parent_session_id"].(string); ok && parent != "" {
+			md.ParentSessionID = parent
+			md.ParentRelation = "continuation"
+		}
 	}
 	switch meta.EventType {
 	case "message":
 		md.MessageCount++
+		recordUsage(md, meta.Data)
+		if md.Summary == "" && meta.Data != nil {
+			if role, _ := meta.Data["role"].(string); role == "user" {
+				md.Summary = summarizeText(messageText(meta.Data["content"]))
+			}
+		}
 	case "tool_use":
 		md.ToolUseCount++
+		recordUsage(md, meta.Data)
+	case "hook":
+		if md.HookTiming == nil {
+			md.HookTiming = &events.HookTiming{}
+		}
+		md.HookTiming.Observe(meta.Data, meta.Timestamp)
 	case "session_end":
 		if !meta.Timestamp.IsZero() {
 			md.EndedAt = meta.Timestamp.UTC().Format(time.RFC3339Nano)
@@ -255,8 +495,65 @@ func updateCursorMetadata(cursor *SessionCursor, meta eventMetadata, filePath st
 			if value, ok := toInt(meta.Data["tool_use_count"]); ok {
 				md.ToolUseCount = value
 			}
+			if usage, ok := parseTokenUsage(meta.Data["usage"]); ok {
+				md.Usage = &usage
+			}
+			if byModel, ok := meta.Data["usage_by_model"].(map[string]interface{}); ok {
+				md.UsageByModel = make(map[string]events.TokenUsage, len(byModel))
+				for model, raw := range byModel {
+					if usage, ok := parseTokenUsage(raw); ok {
+						md.UsageByModel[model] = usage
+					}
+				}
+			}
+			if cost, ok := meta.Data["cost_usd"].(float64); ok && cost >= 0 {
+				md.CostUSD = cost
+			}
+		}
+	}
+}
+
+// messageText joins the text parts of a message content array. Content is
+// []map[string]interface{} when freshly normalized and []interface{} after a
+// JSON round trip.
+func messageText(raw interface{}) string {
+	var parts []map[string]interface{}
+	switch value := raw.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case []map[string]interface{}:
+		parts = value
+	case []interface{}:
+		for _, item := range value {
+			if part, ok := item.(map[string]interface{}); ok {
+				parts = append(parts, part)
+			}
+		}
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if kind, _ := part["type"].(string); kind != "" && kind != "text" {
+			continue
+		}
+		if text, ok := part["text"].(string); ok && text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
+}
+
+// summarizeText shortens text to at most 160 bytes, cutting on a rune
+// boundary so the summary stays valid UTF-8.
+func summarizeText(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) > 160 {
+		cut := 160
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
 		}
+		return text[:cut] + "..."
 	}
+	return text
 }
 
 func toInt(value interface{}) (int, bool) {
@@ -5,12 +5,16 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/victorarias/tabs/internal/config"
 )
 
 func TestAppendJSONLAddsNewline(t *testing.T) {
 	baseDir := t.TempDir()
 	path := filepath.Join(baseDir, "events.jsonl")
-	_, err := appendJSONL(path, []byte(`{"event":"one"}`))
+	_, err := appendJSONL(path, []byte(`{"event":"one"}`), config.FsyncAlways)
 	if err != nil {
 		t.Fatalf("append failed: %v", err)
 	}
@@ -34,3 +38,98 @@ func TestEnsureNewline(t *testing.T) {
 		t.Fatalf("expected unchanged, got %q", got)
 	}
 }
+
+func TestAppendEventStampsSeqAndEventID(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	path := filepath.Join(baseDir, "session.jsonl")
+	cursor := &SessionCursor{SessionID: "5d6e7f80-0000-4000-8000-000000000005"}
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	message := func(text string) map[string]interface{} {
+		return buildEvent("message", cursor.SessionID, "codex-cli", ts, map[string]interface{}{"role": "user", "content": text})
+	}
+	for _, text := range []string{"one", "two", "two"} {
+		if _, err := srv.appendEvent(path, cursor, message(text)); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if cursor.LastSeq != 3 {
+		t.Fatalf("expected last seq 3, got %d", cursor.LastSeq)
+	}
+	events := readEvents(t, path)
+	ids := make(map[interface{}]bool)
+	for i, event := range events {
+		if event["seq"] != float64(i+1) {
+			t.Fatalf("event %d has seq %v", i, event["seq"])
+		}
+		ids[event["event_id"]] = true
+	}
+	// Equal events at different seqs are different events.
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 distinct event ids, got %v", ids)
+	}
+
+	// The same event written again at the same seq, as after a crash that
+	// lost the cursor update, keeps its id.
+	cursor.LastSeq = 2
+	if _, err := srv.appendEvent(path, cursor, message("two")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if again := readEvents(t, path)[3]; again["seq"] != float64(3) || again["event_id"] != events[2]["event_id"] {
+		t.Fatalf("rewritten event stamped %v, want %v", again, events[2])
+	}
+}
+
+func TestLostCursorRecoversLastSeq(t *testing.T) {
+	srv, baseDir := newSubagentTestServer(t)
+	sessionID := "5d6e7f80-0000-4000-8000-000000000006"
+	capturer := EventCapturer{Name: "codex-cli"}
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	capture := func(text string) {
+		t.Helper()
+		event := map[string]interface{}{"event_type": "message", "data": map[string]interface{}{"role": "user", "content": text}}
+		if n, _, err := capturer.Capture(srv, event, sessionID, ts); err != nil || n != 1 {
+			t.Fatalf("capture %s: n=%d err=%v", text, n, err)
+		}
+	}
+	capture("one")
+	capture("two")
+
+	// A deleted cursor, like one garbage collected or removed by hand, starts
+	// over at the file's last seq instead of at 0.
+	if err := os.Remove(cursorStatePath(baseDir, sessionID)); err != nil {
+		t.Fatalf("remove cursor: %v", err)
+	}
+	capture("three")
+	// So does one that could not be read and was replaced by a fresh one.
+	if err := os.WriteFile(cursorStatePath(baseDir, sessionID), []byte("not json"), 0o600); err != nil {
+		t.Fatalf("write cursor: %v", err)
+	}
+	capture("four")
+
+	path, _, _ := findExistingSessionFile(baseDir, sessionID, "codex-cli")
+	ids := make(map[interface{}]bool)
+	for i, event := range readEvents(t, path) {
+		if event["seq"] != float64(i+1) {
+			t.Fatalf("event %d has seq %v", i, event["seq"])
+		}
+		ids[event["event_id"]] = true
+	}
+	if len(ids) != 4 {
+		t.Fatalf("expected 4 distinct event ids, got %v", ids)
+	}
+}
+
+func TestSummarizeTextCutsOnRuneBoundary(t *testing.T) {
+	// After 159 ASCII bytes the 160-byte cut falls inside a 3-byte rune.
+	text := strings.Repeat("a", 159) + strings.Repeat("日本語", 10)
+	got := summarizeText(text)
+	if !utf8.ValidString(got) {
+		t.Fatalf("summary is not valid UTF-8: %q", got)
+	}
+	if want := strings.Repeat("a", 159) + "..."; got != want {
+		t.Fatalf("unexpected summary: %q", got)
+	}
+	if got := summarizeText("  héllo  "); got != "héllo" {
+		t.Fatalf("short text changed: %q", got)
+	}
+}
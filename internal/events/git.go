@@ -0,0 +1,31 @@
+package events
+
+import (
+	"net/url"
+	"strings"
+)
+
+// StripURLCredentials drops any user:password from a remote URL so tokens
+// embedded for HTTPS pushes never reach a session file or the server.
+// scp-style remotes (git@host:org/repo) carry no secret and are returned as is.
+func StripURLCredentials(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		return raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		// Unparseable, so cut everything between the scheme and the last '@'.
+		scheme, rest, _ := strings.Cut(raw, "://")
+		if at := strings.LastIndex(rest, "@"); at >= 0 {
+			rest = rest[at+1:]
+		}
+		return scheme + "://" + rest
+	}
+	if parsed.User != nil && parsed.Scheme == "ssh" {
+		parsed.User = url.User(parsed.User.Username())
+	} else {
+		parsed.User = nil
+	}
+	return parsed.String()
+}
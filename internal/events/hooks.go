@@ -0,0 +1,154 @@
+package events
+
+import (
+	"strings"
+	"time"
+)
+
+// HookTiming aggregates durations measured between Claude Code hooks.
+type HookTiming struct {
+	// ToolLatency runs from PreToolUse to PostToolUse of the same call,
+	// including any time spent on a permission prompt.
+	ToolLatency DurationStats `json:"tool_latency"`
+	// ResponseTime runs from UserPromptSubmit to the Stop that ends the turn.
+	ResponseTime DurationStats `json:"response_time"`
+	// InputWait runs from a Notification (permission prompt or idle) to the
+	// next hook, i.e. how long the agent waited on the user.
+	InputWait DurationStats `json:"input_wait"`
+
+	Notifications      int `json:"notifications"`
+	PermissionPrompts  int `json:"permission_prompts"`
+	PermissionsGranted int `json:"permissions_granted"`
+	PermissionsDenied  int `json:"permissions_denied"`
+
+	// Pending holds the open intervals between captures.
+	Pending *HookPending `json:"pending,omitempty"`
+}
+
+// HookPending is the state HookTiming carries from one hook to the next.
+type HookPending struct {
+	Tools        map[string]string `json:"tools,omitempty"` // tool_use_id -> PreToolUse time
+	AskedTool    string            `json:"asked_tool,omitempty"`
+	PromptAt     string            `json:"prompt_at,omitempty"`
+	WaitingSince string            `json:"waiting_since,omitempty"`
+}
+
+// DurationStats summarizes a set of durations in milliseconds.
+type DurationStats struct {
+	Count   int   `json:"count"`
+	TotalMS int64 `json:"total_ms"`
+	MaxMS   int64 `json:"max_ms"`
+}
+
+func (d *DurationStats) add(from string, to time.Time) {
+	start, err := time.Parse(time.RFC3339Nano, from)
+	if err != nil || to.Before(start) {
+		return
+	}
+	ms := to.Sub(start).Milliseconds()
+	d.Count++
+	d.TotalMS += ms
+	if ms > d.MaxMS {
+		d.MaxMS = ms
+	}
+}
+
+// IsZero reports whether no hook was observed.
+func (t HookTiming) IsZero() bool {
+	return t.ToolLatency.Count == 0 && t.ResponseTime.Count == 0 && t.InputWait.Count == 0 &&
+		t.Notifications == 0 && t.PermissionPrompts == 0
+}
+
+// Observe folds one hook event's data into the timings. A permission prompt
+// is attributed to the latest call still waiting for PostToolUse: the call
+// was granted if PostToolUse follows, and denied if the turn ends first.
+func (t *HookTiming) Observe(data map[string]interface{}, ts time.Time) {
+	name, _ := data["hook_event_name"].(string)
+	if name == "" || ts.IsZero() {
+		return
+	}
+	if t.Pending == nil {
+		t.Pending = &HookPending{}
+	}
+	p := t.Pending
+	stamp := ts.UTC().Format(time.RFC3339Nano)
+
+	if name == "Notification" {
+		t.Notifications++
+		kind, _ := data["notification_type"].(string)
+		message, _ := data["message"].(string)
+		if kind == "permission_prompt" || (kind == "" && strings.Contains(strings.ToLower(message), "permission")) {
+			t.PermissionPrompts++
+			if p.AskedTool == "" {
+				p.AskedTool = latestPendingTool(p.Tools)
+			}
+		}
+		if p.WaitingSince == "" {
+			p.WaitingSince = stamp
+		}
+		return
+	}
+
+	// Any other hook means the user answered.
+	if p.WaitingSince != "" {
+		t.InputWait.add(p.WaitingSince, ts)
+		p.WaitingSince = ""
+	}
+	toolUseID, _ := data["tool_use_id"].(string)
+	switch name {
+	case "PreToolUse":
+		if toolUseID != "" {
+			if p.Tools == nil {
+				p.Tools = make(map[string]string)
+			}
+			p.Tools[toolUseID] = stamp
+		}
+	case "PostToolUse":
+		if started, ok := p.Tools[toolUseID]; ok {
+			t.ToolLatency.add(started, ts)
+			delete(p.Tools, toolUseID)
+		}
+		if toolUseID != "" && toolUseID == p.AskedTool {
+			t.PermissionsGranted++
+			p.AskedTool = ""
+		}
+	case "UserPromptSubmit", "Stop":
+		if p.AskedTool != "" {
+			t.PermissionsDenied++
+			p.AskedTool = ""
+		}
+		// Calls that never reached PostToolUse were denied or interrupted.
+		p.Tools = nil
+		if name == "UserPromptSubmit" {
+			p.PromptAt = stamp
+		} else if p.PromptAt != "" {
+			t.ResponseTime.add(p.PromptAt, ts)
+			p.PromptAt = ""
+		}
+	}
+}
+
+// Report returns the timings without the pending state.
+func (t *HookTiming) Report() *HookTiming {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	report := *t
+	report.Pending = nil
+	return &report
+}
+
+func latestPendingTool(tools map[string]string) string {
+	var latestID string
+	var latest time.Time
+	for id, stamp := range tools {
+		ts, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			continue
+		}
+		if latestID == "" || ts.After(latest) || (ts.Equal(latest) && id > latestID) {
+			latestID, latest = id, ts
+		}
+	}
+	return latestID
+}
@@ -0,0 +1,389 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxDiffBytes = 64 * 1024
+	// Snippets whose line counts multiply past this are diffed as a whole
+	// replacement instead of line by line.
+	maxDiffCells = 4_000_000
+	diffContext  = 3
+)
+
+// ledgerOperations maps file-editing tool names to ledger operations. Gemini
+// CLI's replace and write_file take the same inputs as Edit and Write.
+var ledgerOperations = map[string]string{
+	"Edit":       "edit",
+	"MultiEdit":  "multi_edit",
+	"Write":      "write",
+	"replace":    "edit",
+	"write_file": "write",
+}
+
+// LedgerToolNames returns the tool names recorded under a ledger operation
+// ("edit", "multi_edit" or "write"), or every ledger tool when op is empty.
+func LedgerToolNames(op string) []string {
+	var names []string
+	for name, nameOp := range ledgerOperations {
+		if op == "" || op == nameOp {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FileChange is one Edit, MultiEdit or Write call against a file.
+type FileChange struct {
+	ToolUseID string    `json:"tool_use_id"`
+	Operation string    `json:"operation"`
+	Timestamp time.Time `json:"timestamp"`
+	IsError   bool      `json:"is_error,omitempty"`
+	Diff      string    `json:"diff"`
+}
+
+// FileLedgerEntry is everything a session did to one file.
+type FileLedgerEntry struct {
+	Path           string       `json:"path"`
+	Edits          int          `json:"edits"`
+	MultiEdits     int          `json:"multi_edits"`
+	Writes         int          `json:"writes"`
+	LinesAdded     int          `json:"lines_added"`
+	LinesRemoved   int          `json:"lines_removed"`
+	FirstTouchedAt time.Time    `json:"first_touched_at"`
+	LastTouchedAt  time.Time    `json:"last_touched_at"`
+	Changes        []FileChange `json:"changes"`
+}
+
+// FileLedger aggregates file-editing tool calls into per-file entries with
+// unified diffs. Feed it tool_use events in session order. Once a Write
+// reveals a file's full content, later edits are applied to it so their
+// diffs carry real line numbers; otherwise a diff covers only the edited
+// snippet and its line numbers are relative to it.
+type FileLedger struct {
+	entries  map[string]*FileLedgerEntry
+	content  map[string]string
+	failures map[string]bool
+}
+
+func NewFileLedger() *FileLedger {
+	return &FileLedger{
+		entries:  make(map[string]*FileLedgerEntry),
+		content:  make(map[string]string),
+		failures: make(map[string]bool),
+	}
+}
+
+type ledgerEdit struct {
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all"`
+}
+
+type ledgerInput struct {
+	FilePath string `json:"file_path"`
+	ledgerEdit
+	Content string       `json:"content"`
+	Edits   []ledgerEdit `json:"edits"`
+}
+
+// AddToolUse records a tool call. It reports false for tools that do not
+// edit files and for inputs without a file_path.
+func (l *FileLedger) AddToolUse(toolUseID, toolName string, input json.RawMessage, ts time.Time) bool {
+	op, ok := ledgerOperations[toolName]
+	if !ok {
+		return false
+	}
+	var in ledgerInput
+	if err := json.Unmarshal(input, &in); err != nil || strings.TrimSpace(in.FilePath) == "" {
+		return false
+	}
+	path := in.FilePath
+
+	entry := l.entries[path]
+	if entry == nil {
+		entry = &FileLedgerEntry{Path: path, FirstTouchedAt: ts}
+		l.entries[path] = entry
+	}
+	if ts.Before(entry.FirstTouchedAt) {
+		entry.FirstTouchedAt = ts
+	}
+	if ts.After(entry.LastTouchedAt) {
+		entry.LastTouchedAt = ts
+	}
+
+	var edits []ledgerEdit
+	switch op {
+	case "edit":
+		entry.Edits++
+		edits = []ledgerEdit{in.ledgerEdit}
+	case "multi_edit":
+		entry.MultiEdits++
+		edits = in.Edits
+	case "write":
+		entry.Writes++
+	}
+
+	var diff string
+	var added, removed int
+	before, known := l.content[path]
+	after, applied := before, known
+	for _, edit := range edits {
+		if applied {
+			after, applied = applyEdit(after, edit)
+		}
+	}
+	switch {
+	case op == "write":
+		diff, added, removed = unifiedDiff(path, before, in.Content)
+		l.content[path] = in.Content
+	case applied:
+		diff, added, removed = unifiedDiff(path, before, after)
+		l.content[path] = after
+	default:
+		// The file changed in a way the ledger did not see, so only the
+		// snippets can be diffed from here on.
+		delete(l.content, path)
+		var b strings.Builder
+		for _, edit := range edits {
+			part, a, r := unifiedDiff(path, edit.OldString, edit.NewString)
+			if b.Len() > 0 {
+				part = stripDiffHeader(part)
+			}
+			b.WriteString(part)
+			added += a
+			removed += r
+		}
+		diff = b.String()
+	}
+	entry.LinesAdded += added
+	entry.LinesRemoved += removed
+
+	change := FileChange{
+		ToolUseID: toolUseID,
+		Operation: op,
+		Timestamp: ts,
+		IsError:   l.failures[toolUseID],
+		Diff:      truncateDiff(diff),
+	}
+	entry.Changes = append(entry.Changes, change)
+	return true
+}
+
+// MarkError flags a recorded change whose tool_result reported an error. A
+// failed call still appears in the ledger, since the agent attempted it.
+func (l *FileLedger) MarkError(toolUseID string) {
+	if toolUseID == "" {
+		return
+	}
+	l.failures[toolUseID] = true
+	for _, entry := range l.entries {
+		for i := range entry.Changes {
+			if entry.Changes[i].ToolUseID == toolUseID {
+				entry.Changes[i].IsError = true
+			}
+		}
+	}
+}
+
+// Entries returns the ledger sorted by path.
+func (l *FileLedger) Entries() []FileLedgerEntry {
+	entries := make([]FileLedgerEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// applyEdit replays an edit on known file content. It reports false when
+// old_string is not there, which means the file changed outside the ledger.
+func applyEdit(content string, edit ledgerEdit) (string, bool) {
+	if edit.OldString == "" || !strings.Contains(content, edit.OldString) {
+		return content, false
+	}
+	if edit.ReplaceAll {
+		return strings.ReplaceAll(content, edit.OldString, edit.NewString), true
+	}
+	return strings.Replace(content, edit.OldString, edit.NewString, 1), true
+}
+
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedDiff returns a unified diff of before and after with diffContext
+// lines of context, along with the number of added and removed lines.
+func unifiedDiff(path, before, after string) (string, int, int) {
+	ops := diffLines(splitDiffLines(before), splitDiffLines(after))
+
+	var changed []int
+	added, removed := 0, 0
+	for i, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		default:
+			continue
+		}
+		changed = append(changed, i)
+	}
+	if len(changed) == 0 {
+		return "", 0, 0
+	}
+
+	var out strings.Builder
+	name := strings.TrimPrefix(path, "/")
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+	for k := 0; k < len(changed); {
+		// A hunk absorbs following changes separated by at most twice the
+		// context, so their context lines would otherwise overlap.
+		last := k
+		for last+1 < len(changed) && changed[last+1]-changed[last] <= 2*diffContext+1 {
+			last++
+		}
+		lo := max(changed[k]-diffContext, 0)
+		hi := min(changed[last]+diffContext+1, len(ops))
+		writeHunk(&out, ops[lo:hi])
+		k = last + 1
+	}
+	return out.String(), added, removed
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	oldStart, newStart := ops[0].oldLine+1, ops[0].newLine+1
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty side names the line before the change, per diff convention.
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.text)
+		if !strings.HasSuffix(op.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+type diffOp struct {
+	kind    byte
+	text    string
+	oldLine int
+	newLine int
+}
+
+// diffLines computes a line-level edit script from a longest common
+// subsequence table. Inputs too large for the table are diffed as a whole
+// replacement.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i], oldLine: i, newLine: i})
+	}
+
+	n, m := len(midA), len(midB)
+	if n*m > maxDiffCells {
+		for i, line := range midA {
+			ops = append(ops, diffOp{kind: '-', text: line, oldLine: prefix + i, newLine: prefix})
+		}
+		for j, line := range midB {
+			ops = append(ops, diffOp{kind: '+', text: line, oldLine: prefix + n, newLine: prefix + j})
+		}
+	} else {
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && midA[i] == midB[j]:
+				ops = append(ops, diffOp{kind: ' ', text: midA[i], oldLine: prefix + i, newLine: prefix + j})
+				i++
+				j++
+			case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+				ops = append(ops, diffOp{kind: '+', text: midB[j], oldLine: prefix + i, newLine: prefix + j})
+				j++
+			default:
+				ops = append(ops, diffOp{kind: '-', text: midA[i], oldLine: prefix + i, newLine: prefix + j})
+				i++
+			}
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		oi, nj := len(a)-suffix+k, len(b)-suffix+k
+		ops = append(ops, diffOp{kind: ' ', text: a[oi], oldLine: oi, newLine: nj})
+	}
+	return ops
+}
+
+func stripDiffHeader(diff string) string {
+	for i := 0; i < 2; i++ {
+		if idx := strings.IndexByte(diff, '\n'); idx >= 0 {
+			diff = diff[idx+1:]
+		}
+	}
+	return diff
+}
+
+func truncateDiff(diff string) string {
+	if len(diff) <= maxDiffBytes {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:maxDiffBytes], '\n')
+	if cut < 0 {
+		cut = maxDiffBytes
+	}
+	return diff[:cut+1] + "\\ diff truncated\n"
+}
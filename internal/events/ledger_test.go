@@ -0,0 +1,57 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFileLedgerAggregatesEdits(t *testing.T) {
+	ledger := NewFileLedger()
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	input := func(v map[string]interface{}) json.RawMessage {
+		raw, _ := json.Marshal(v)
+		return raw
+	}
+
+	content := "package main\n\nfunc main() {\n\tprintln(\"a\")\n\tprintln(\"b\")\n\tprintln(\"c\")\n\tprintln(\"d\")\n\tprintln(\"e\")\n}\n"
+	ledger.AddToolUse("t1", "Write", input(map[string]interface{}{"file_path": "/work/main.go", "content": content}), base)
+	ledger.AddToolUse("t2", "Edit", input(map[string]interface{}{"file_path": "/work/main.go", "old_string": "println(\"e\")", "new_string": "println(\"E\")"}), base.Add(time.Minute))
+	ledger.AddToolUse("t3", "MultiEdit", input(map[string]interface{}{"file_path": "/work/util.go", "edits": []map[string]interface{}{
+		{"old_string": "x := 1", "new_string": "x := 2"},
+		{"old_string": "y := 1\n", "new_string": "y := 1\nz := 3\n"},
+	}}), base.Add(2*time.Minute))
+	ledger.MarkError("t3")
+	if ledger.AddToolUse("t4", "Read", input(map[string]interface{}{"file_path": "/work/main.go"}), base) {
+		t.Fatalf("Read must not enter the ledger")
+	}
+
+	entries := ledger.Entries()
+	if len(entries) != 2 || entries[0].Path != "/work/main.go" || entries[1].Path != "/work/util.go" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	main := entries[0]
+	if main.Writes != 1 || main.Edits != 1 || main.LinesAdded != 10 || main.LinesRemoved != 1 {
+		t.Fatalf("unexpected main.go counts: %+v", main)
+	}
+	if !main.LastTouchedAt.Equal(base.Add(time.Minute)) {
+		t.Fatalf("unexpected last touched: %v", main.LastTouchedAt)
+	}
+	// The edit is replayed on the written content, so the hunk has real
+	// line numbers and context.
+	wantEdit := "--- a/work/main.go\n+++ b/work/main.go\n@@ -5,5 +5,5 @@\n" +
+		" \tprintln(\"b\")\n \tprintln(\"c\")\n \tprintln(\"d\")\n-\tprintln(\"e\")\n+\tprintln(\"E\")\n }\n"
+	if got := main.Changes[1].Diff; got != wantEdit {
+		t.Fatalf("unexpected edit diff:\n%s", got)
+	}
+
+	util := entries[1]
+	if util.MultiEdits != 1 || util.LinesAdded != 2 || util.LinesRemoved != 1 || !util.Changes[0].IsError {
+		t.Fatalf("unexpected util.go entry: %+v", util)
+	}
+	wantMulti := "--- a/work/util.go\n+++ b/work/util.go\n@@ -1,1 +1,1 @@\n-x := 1\n\\ No newline at end of file\n+x := 2\n\\ No newline at end of file\n" +
+		"@@ -1,1 +1,2 @@\n y := 1\n+z := 3\n"
+	if got := util.Changes[0].Diff; got != wantMulti {
+		t.Fatalf("unexpected multi-edit diff:\n%s", got)
+	}
+}
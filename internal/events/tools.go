@@ -0,0 +1,46 @@
+package events
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	toolsMu sync.RWMutex
+	// tools are the names stored on sessions and events. The daemon registers
+	// a capturer for each built-in one; the server accepts uploads for any.
+	tools = map[string]bool{
+		"aider":       true,
+		"claude-code": true,
+		"codex-cli":   true,
+		"cursor":      true,
+		"gemini-cli":  true,
+	}
+)
+
+// RegisterTool adds a tool name beyond the built-in ones, for integrations
+// that emit tabs events directly.
+func RegisterTool(tool string) {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	tools[tool] = true
+}
+
+// IsTool reports whether tool is a known tool name.
+func IsTool(tool string) bool {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	return tools[tool]
+}
+
+// Tools returns the known tool names in sorted order.
+func Tools() []string {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	names := make([]string, 0, len(tools))
+	for tool := range tools {
+		names = append(names, tool)
+	}
+	sort.Strings(names)
+	return names
+}
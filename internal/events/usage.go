@@ -0,0 +1,40 @@
+package events
+
+import (
+	"math"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+// TokenUsage counts model tokens using the Anthropic usage field names.
+type TokenUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+func (u TokenUsage) IsZero() bool {
+	return u == TokenUsage{}
+}
+
+// SessionCost prices per-model usage. Models missing from the price table
+// contribute tokens but no cost.
+func SessionCost(byModel map[string]TokenUsage, prices map[string]config.ModelPrice) float64 {
+	var total float64
+	for model, usage := range byModel {
+		price, ok := config.LookupPrice(prices, model)
+		if !ok {
+			continue
+		}
+		total += price.Cost(usage.InputTokens, usage.OutputTokens, usage.CacheCreationInputTokens, usage.CacheReadInputTokens)
+	}
+	return math.Round(total*1e6) / 1e6
+}
@@ -0,0 +1,23 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/victorarias/tabs/internal/config"
+)
+
+func TestSessionCostMatchesModelPrefixes(t *testing.T) {
+	prices := map[string]config.ModelPrice{
+		"claude-sonnet-4": {Input: 3, Output: 15},
+		"claude-opus-4":   {Input: 15, Output: 75},
+		"claude-opus-4-5": {Input: 5, Output: 25},
+	}
+	byModel := map[string]TokenUsage{
+		"claude-sonnet-4-20250514": {InputTokens: 1_000_000},
+		"claude-opus-4-5-20251101": {OutputTokens: 1_000_000},
+		"unknown-model":            {InputTokens: 1_000_000},
+	}
+	if cost := SessionCost(byModel, prices); cost != 28 {
+		t.Fatalf("expected cost 28, got %v", cost)
+	}
+}
@@ -0,0 +1,51 @@
+package localserver
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+// GetSessionFiles builds the changed-files ledger for a session from its
+// Edit, MultiEdit and Write tool calls.
+func GetSessionFiles(baseDir, sessionID string) ([]events.FileLedgerEntry, error) {
+	if sessionID == "" {
+		return nil, errors.New("missing session id")
+	}
+	path, err := findSessionFile(baseDir, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	detail, err := loadSessionDetail(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := events.NewFileLedger()
+	for _, event := range detail.Events {
+		data, _ := event["data"].(map[string]interface{})
+		if data == nil {
+			continue
+		}
+		toolUseID, _ := data["tool_use_id"].(string)
+		switch event["event_type"] {
+		case "tool_use":
+			toolName, _ := data["tool_name"].(string)
+			input, err := json.Marshal(data["input"])
+			if err != nil {
+				continue
+			}
+			ledger.AddToolUse(toolUseID, toolName, input, parseEventTime(event))
+		case "tool_result":
+			if isError, _ := data["is_error"].(bool); isError {
+				ledger.MarkError(toolUseID)
+			}
+		}
+	}
+	return ledger.Entries(), nil
+}
@@ -0,0 +1,79 @@
+package localserver
+
+import "github.com/victorarias/tabs/internal/daemon"
+
+// maxLineageDepth bounds walks along resume chains, guarding against loops
+// in bad data.
+const maxLineageDepth = 50
+
+// continuedFrom returns the sessions a resumed session carries on, oldest
+// first, by following continuation events back.
+func continuedFrom(baseDir string, md *daemon.SessionMetadata) []LineageEntry {
+	var chain []LineageEntry
+	seen := map[string]bool{md.SessionID: true}
+	for md.ParentRelation == "continuation" && md.ParentSessionID != "" && len(chain) < maxLineageDepth {
+		parentID := md.ParentSessionID
+		if seen[parentID] {
+			break
+		}
+		seen[parentID] = true
+		entry := LineageEntry{SessionID: parentID}
+		path, err := findSessionFile(baseDir, parentID)
+		if err != nil || path == "" {
+			chain = append(chain, entry)
+			break
+		}
+		parent, err := daemon.ReplaySessionMetadata(path)
+		if err != nil {
+			chain = append(chain, entry)
+			break
+		}
+		entry.CreatedAt = parent.CreatedAt
+		entry.EndedAt = parent.EndedAt
+		entry.Summary = parent.Summary
+		entry.MessageCount = parent.MessageCount
+		chain = append(chain, entry)
+		md = parent
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// continuedBy returns the sessions that resumed this one, and the ones that
+// resumed those, from the daemon's index.
+func continuedBy(baseDir, sessionID, tool string) []LineageEntry {
+	idx, ok, err := daemon.OpenSessionIndexIfExists(baseDir)
+	if err != nil || !ok {
+		return nil
+	}
+	defer idx.Close()
+	return continuationTree(idx, sessionID, tool, map[string]bool{sessionID: true}, 0)
+}
+
+func continuationTree(idx *daemon.SessionIndex, sessionID, tool string, seen map[string]bool, depth int) []LineageEntry {
+	if depth >= maxLineageDepth {
+		return nil
+	}
+	children, err := idx.Children(sessionID, tool, "continuation")
+	if err != nil {
+		return nil
+	}
+	var entries []LineageEntry
+	for _, child := range children {
+		if seen[child.SessionID] {
+			continue
+		}
+		seen[child.SessionID] = true
+		entries = append(entries, LineageEntry{
+			SessionID:    child.SessionID,
+			CreatedAt:    child.CreatedAt,
+			EndedAt:      child.EndedAt,
+			Summary:      child.Summary,
+			MessageCount: child.MessageCount,
+			ContinuedBy:  continuationTree(idx, child.SessionID, tool, seen, depth+1),
+		})
+	}
+	return entries
+}
@@ -144,8 +144,17 @@ func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 		Cwd:  r.URL.Query().Get("cwd"),
 		Q:    r.URL.Query().Get("q"),
 	}
+	var ok bool
+	if filter.Limit, ok = parseNonNegativeInt(r.URL.Query().Get("limit")); !ok {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "limit must be a non-negative integer")
+		return
+	}
+	if filter.Offset, ok = parseNonNegativeInt(r.URL.Query().Get("offset")); !ok {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "offset must be a non-negative integer")
+		return
+	}
 
-	sessions, err := ListSessions(s.baseDir, filter)
+	sessions, total, err := ListSessions(s.baseDir, filter)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load sessions")
 		return
@@ -153,7 +162,7 @@ func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 
 	resp := SessionsResponse{
 		Sessions: sessions,
-		Total:    len(sessions),
+		Total:    total,
 	}
 	s.writeJSON(w, http.StatusOK, resp)
 }
@@ -169,8 +178,22 @@ func (s *Server) handleSessionDetail(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "invalid_request", "Missing session id")
 		return
 	}
+	sessionID, subresource, _ := strings.Cut(sessionID, "/")
+	switch subresource {
+	case "":
+	case "files":
+		s.handleSessionFiles(w, sessionID)
+		return
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
 
-	session, err := GetSession(s.baseDir, sessionID)
+	prices := config.DefaultPricing()
+	if cfg, err := s.loadConfig(); err == nil {
+		prices = cfg.Pricing
+	}
+	session, err := GetSession(s.baseDir, sessionID, prices)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			s.writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
@@ -186,6 +209,21 @@ func (s *Server) handleSessionDetail(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, resp)
 }
 
+func (s *Server) handleSessionFiles(w http.ResponseWriter, sessionID string) {
+	files, err := GetSessionFiles(s.baseDir, sessionID)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load files")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files": files,
+	})
+}
+
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -274,11 +312,16 @@ func (s *Server) handleDaemonStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := map[string]interface{}{
-		"running":           true,
-		"pid":               status.PID,
-		"uptime_seconds":    status.UptimeSeconds,
-		"sessions_captured": status.SessionsCaptured,
-		"events_processed":  status.EventsProcessed,
+		"running":             true,
+		"pid":                 status.PID,
+		"uptime_seconds":      status.UptimeSeconds,
+		"sessions_captured":   status.SessionsCaptured,
+		"sessions_suppressed": status.SessionsSuppressed,
+		"events_processed":    status.EventsProcessed,
+		"auto_push":           status.AutoPush,
+		"upload_queue":        status.UploadQueue,
+		"reconcile":           status.Reconcile,
+		"capture_queue":       status.CaptureQueue,
 	}
 	s.writeJSON(w, http.StatusOK, resp)
 }
@@ -493,6 +536,19 @@ func csrfGuard(port int, next http.Handler) http.Handler {
 	})
 }
 
+// parseNonNegativeInt treats an empty value as zero.
+func parseNonNegativeInt(raw string) (int, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return value, true
+}
+
 func intToString(value int) string {
 	return strconv.Itoa(value)
 }
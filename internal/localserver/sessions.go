@@ -11,16 +11,124 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/victorarias/tabs/internal/config"
+	"github.com/victorarias/tabs/internal/daemon"
+	"github.com/victorarias/tabs/internal/events"
 )
 
 type SessionFilter struct {
-	Tool string
-	Date string
-	Cwd  string
-	Q    string
+	Tool   string
+	Date   string
+	Cwd    string
+	Q      string
+	Limit  int
+	Offset int
 }
 
-func ListSessions(baseDir string, filter SessionFilter) ([]SessionSummary, error) {
+// ListSessions returns a page of matching sessions, newest first, and the
+// total number of matches. It reads the daemon's session index when one
+// exists and falls back to scanning the sessions directory otherwise.
+func ListSessions(baseDir string, filter SessionFilter) ([]SessionSummary, int, error) {
+	idx, ok, err := daemon.OpenSessionIndexIfExists(baseDir)
+	if err == nil && ok {
+		defer idx.Close()
+		summaries, total, err := listIndexedSessions(idx, filter)
+		if err == nil {
+			return summaries, total, nil
+		}
+	}
+
+	summaries, err := scanSessions(baseDir, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(summaries, filter), len(summaries), nil
+}
+
+func listIndexedSessions(idx *daemon.SessionIndex, filter SessionFilter) ([]SessionSummary, int, error) {
+	query := daemon.IndexQuery{Tool: filter.Tool, Date: filter.Date, Cwd: filter.Cwd}
+	if filter.Q == "" {
+		query.Limit = filter.Limit
+		query.Offset = filter.Offset
+		entries, total, err := idx.List(query)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries := make([]SessionSummary, 0, len(entries))
+		for _, entry := range entries {
+			summaries = append(summaries, summaryFromIndex(entry))
+		}
+		return summaries, total, nil
+	}
+
+	// Full-text queries still read events, but only from the files the
+	// index already narrowed down.
+	entries, _, err := idx.List(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	summaries := []SessionSummary{}
+	for _, entry := range entries {
+		summary, matched, err := summarizeSession(entry.FilePath, filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, 0, err
+		}
+		if matched {
+			summaries = append(summaries, summary)
+		}
+	}
+	return paginate(summaries, filter), len(summaries), nil
+}
+
+func summaryFromIndex(entry daemon.IndexedSession) SessionSummary {
+	summary := SessionSummary{
+		SessionID:       entry.SessionID,
+		Tool:            entry.Tool,
+		CreatedAt:       entry.CreatedAt,
+		EndedAt:         entry.EndedAt,
+		Cwd:             entry.Cwd,
+		Summary:         entry.Summary,
+		DurationSeconds: entry.DurationSeconds,
+		MessageCount:    entry.MessageCount,
+		ToolUseCount:    entry.ToolUseCount,
+		FilePath:        entry.FilePath,
+	}
+	if summary.EndedAt == "" {
+		summary.EndedAt = entry.LastEventAt
+	}
+	if !entry.Usage.IsZero() {
+		usage := entry.Usage
+		summary.Usage = &usage
+		summary.CostUSD = entry.CostUSD
+	}
+	if summary.DurationSeconds == 0 {
+		start, startErr := time.Parse(time.RFC3339Nano, entry.CreatedAt)
+		end, endErr := time.Parse(time.RFC3339Nano, summary.EndedAt)
+		if startErr == nil && endErr == nil && end.After(start) {
+			summary.DurationSeconds = int(end.Sub(start).Seconds())
+		}
+	}
+	return summary
+}
+
+func paginate(summaries []SessionSummary, filter SessionFilter) []SessionSummary {
+	if filter.Offset > 0 {
+		if filter.Offset >= len(summaries) {
+			return []SessionSummary{}
+		}
+		summaries = summaries[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(summaries) {
+		summaries = summaries[:filter.Limit]
+	}
+	return summaries
+}
+
+func scanSessions(baseDir string, filter SessionFilter) ([]SessionSummary, error) {
 	sessionsDir := filepath.Join(baseDir, "sessions")
 	entries, err := os.ReadDir(sessionsDir)
 	if err != nil {
@@ -41,7 +149,7 @@ func ListSessions(baseDir string, filter SessionFilter) ([]SessionSummary, error
 			return nil, err
 		}
 		for _, file := range files {
-			if file.IsDir() || !strings.HasSuffix(file.Name(), ".jsonl") {
+			if file.IsDir() || !daemon.IsSessionFileName(file.Name()) {
 				continue
 			}
 			path := filepath.Join(dayDir, file.Name())
@@ -80,7 +188,9 @@ func ListSessions(baseDir string, filter SessionFilter) ([]SessionSummary, error
 	return summaries, nil
 }
 
-func GetSession(baseDir, sessionID string) (SessionDetail, error) {
+// GetSession loads a session's events along with its token usage. Cost is
+// priced with prices unless the session_end event already recorded one.
+func GetSession(baseDir, sessionID string, prices map[string]config.ModelPrice) (SessionDetail, error) {
 	if sessionID == "" {
 		return SessionDetail{}, errors.New("missing session id")
 	}
@@ -91,10 +201,39 @@ func GetSession(baseDir, sessionID string) (SessionDetail, error) {
 	if path == "" {
 		return SessionDetail{}, os.ErrNotExist
 	}
-	return loadSessionDetail(path)
+	detail, err := loadSessionDetail(path)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	md, err := daemon.ReplaySessionMetadata(path)
+	if err == nil && md.Usage != nil && !md.Usage.IsZero() {
+		detail.Usage = md.Usage
+		detail.CostUSD = md.CostUSD
+		if detail.CostUSD == 0 && md.UsageByModel != nil {
+			detail.CostUSD = events.SessionCost(md.UsageByModel, prices)
+		}
+	}
+	detail.Parent = sessionParent(baseDir, detail.Events)
+	detail.Subagents = subagentTree(baseDir, detail.Events, map[string]bool{sessionID: true}, 0)
+	if err == nil {
+		detail.HookTiming = md.HookTiming.Report()
+		detail.ContinuedFrom = continuedFrom(baseDir, md)
+		detail.ContinuedBy = continuedBy(baseDir, detail.SessionID, detail.Tool)
+	}
+	return detail, nil
 }
 
 func findSessionFile(baseDir, sessionID string) (string, error) {
+	if idx, ok, err := daemon.OpenSessionIndexIfExists(baseDir); err == nil && ok {
+		entry, found, err := idx.Lookup(sessionID, "")
+		idx.Close()
+		if err == nil && found {
+			if _, err := os.Stat(entry.FilePath); err == nil {
+				return entry.FilePath, nil
+			}
+		}
+	}
+
 	sessionsDir := filepath.Join(baseDir, "sessions")
 	entries, err := os.ReadDir(sessionsDir)
 	if err != nil {
@@ -117,7 +256,7 @@ func findSessionFile(baseDir, sessionID string) (string, error) {
 		}
 		for _, file := range files {
 			name := file.Name()
-			if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".jsonl") {
+			if file.IsDir() || !strings.HasPrefix(name, prefix) || !daemon.IsSessionFileName(name) {
 				continue
 			}
 			ts := extractTimestamp(name)
@@ -131,7 +270,7 @@ func findSessionFile(baseDir, sessionID string) (string, error) {
 }
 
 func extractTimestamp(filename string) int64 {
-	trimmed := strings.TrimSuffix(filename, ".jsonl")
+	trimmed := daemon.TrimSessionExt(filename)
 	parts := strings.Split(trimmed, "-")
 	if len(parts) < 3 {
 		return -1
@@ -156,7 +295,7 @@ func parseInt64(value string) (int64, error) {
 }
 
 func summarizeSession(path string, filter SessionFilter) (SessionSummary, bool, error) {
-	file, err := os.Open(path)
+	file, err := daemon.OpenSessionFile(path)
 	if err != nil {
 		return SessionSummary{}, false, err
 	}
@@ -308,7 +447,7 @@ func summarizeSession(path string, filter SessionFilter) (SessionSummary, bool,
 }
 
 func loadSessionDetail(path string) (SessionDetail, error) {
-	file, err := os.Open(path)
+	file, err := daemon.OpenSessionFile(path)
 	if err != nil {
 		return SessionDetail{}, err
 	}
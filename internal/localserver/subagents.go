@@ -0,0 +1,100 @@
+package localserver
+
+// maxSubagentDepth bounds the tree; Claude Code sub-agents cannot spawn
+// their own today, so anything deeper is a loop in bad data.
+const maxSubagentDepth = 4
+
+// sessionParent reads the parent link from a sub-agent's session_start. The
+// spawning tool call may only have been recorded in the parent, once known.
+func sessionParent(baseDir string, events []map[string]interface{}) *SessionParent {
+	for _, event := range events {
+		if event["event_type"] != "session_start" {
+			continue
+		}
+		data, _ := event["data"].(map[string]interface{})
+		parentID, _ := data["parent_session_id"].(string)
+		if parentID == "" {
+			return nil
+		}
+		parent := &SessionParent{SessionID: parentID}
+		parent.ToolUseID, _ = data["parent_tool_use_id"].(string)
+		if parent.ToolUseID == "" {
+			sessionID, _ := event["session_id"].(string)
+			if path, err := findSessionFile(baseDir, parentID); err == nil && path != "" {
+				if detail, err := loadSessionDetail(path); err == nil {
+					for _, link := range subagentLinks(detail.Events) {
+						if link.SessionID == sessionID {
+							parent.ToolUseID = link.ToolUseID
+						}
+					}
+				}
+			}
+		}
+		return parent
+	}
+	return nil
+}
+
+// subagentLinks collects the children named by subagent events. A child is
+// recorded again when its spawning tool call is learned, so the last event
+// for each child wins.
+func subagentLinks(events []map[string]interface{}) []SubagentNode {
+	var links []SubagentNode
+	index := make(map[string]int)
+	for _, event := range events {
+		if event["event_type"] != "subagent" {
+			continue
+		}
+		data, _ := event["data"].(map[string]interface{})
+		childID, _ := data["child_session_id"].(string)
+		if childID == "" {
+			continue
+		}
+		node := SubagentNode{SessionID: childID}
+		node.ToolUseID, _ = data["tool_use_id"].(string)
+		node.AgentID, _ = data["agent_id"].(string)
+		node.SubagentType, _ = data["subagent_type"].(string)
+		node.Description, _ = data["description"].(string)
+		if i, ok := index[childID]; ok {
+			links[i] = node
+			continue
+		}
+		index[childID] = len(links)
+		links = append(links, node)
+	}
+	return links
+}
+
+func subagentTree(baseDir string, events []map[string]interface{}, seen map[string]bool, depth int) []SubagentNode {
+	links := subagentLinks(events)
+	if depth >= maxSubagentDepth {
+		return links
+	}
+	for i := range links {
+		node := &links[i]
+		if seen[node.SessionID] {
+			continue
+		}
+		path, err := findSessionFile(baseDir, node.SessionID)
+		if err != nil || path == "" {
+			continue
+		}
+		child, err := loadSessionDetail(path)
+		if err != nil {
+			continue
+		}
+		node.CreatedAt = child.CreatedAt
+		node.EndedAt = child.EndedAt
+		for _, event := range child.Events {
+			switch event["event_type"] {
+			case "message":
+				node.MessageCount++
+			case "tool_use":
+				node.ToolUseCount++
+			}
+		}
+		seen[node.SessionID] = true
+		node.Subagents = subagentTree(baseDir, child.Events, seen, depth+1)
+	}
+	return links
+}
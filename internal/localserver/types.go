@@ -1,16 +1,20 @@
 package localserver
 
+import "github.com/victorarias/tabs/internal/events"
+
 type SessionSummary struct {
-	SessionID       string `json:"session_id"`
-	Tool            string `json:"tool"`
-	CreatedAt       string `json:"created_at"`
-	EndedAt         string `json:"ended_at,omitempty"`
-	Cwd             string `json:"cwd,omitempty"`
-	Summary         string `json:"summary,omitempty"`
-	DurationSeconds int    `json:"duration_seconds,omitempty"`
-	MessageCount    int    `json:"message_count"`
-	ToolUseCount    int    `json:"tool_use_count"`
-	FilePath        string `json:"file_path"`
+	SessionID       string             `json:"session_id"`
+	Tool            string             `json:"tool"`
+	CreatedAt       string             `json:"created_at"`
+	EndedAt         string             `json:"ended_at,omitempty"`
+	Cwd             string             `json:"cwd,omitempty"`
+	Summary         string             `json:"summary,omitempty"`
+	DurationSeconds int                `json:"duration_seconds,omitempty"`
+	MessageCount    int                `json:"message_count"`
+	ToolUseCount    int                `json:"tool_use_count"`
+	Usage           *events.TokenUsage `json:"usage,omitempty"`
+	CostUSD         float64            `json:"cost_usd,omitempty"`
+	FilePath        string             `json:"file_path"`
 }
 
 type SessionDetail struct {
@@ -20,9 +24,48 @@ type SessionDetail struct {
 	EndedAt         string                   `json:"ended_at,omitempty"`
 	Cwd             string                   `json:"cwd,omitempty"`
 	DurationSeconds int                      `json:"duration_seconds,omitempty"`
+	Usage           *events.TokenUsage       `json:"usage,omitempty"`
+	CostUSD         float64                  `json:"cost_usd,omitempty"`
+	HookTiming      *events.HookTiming       `json:"hook_timing,omitempty"`
+	Parent          *SessionParent           `json:"parent,omitempty"`
+	Subagents       []SubagentNode           `json:"subagents,omitempty"`
+	ContinuedFrom   []LineageEntry           `json:"continued_from,omitempty"`
+	ContinuedBy     []LineageEntry           `json:"continued_by,omitempty"`
 	Events          []map[string]interface{} `json:"events"`
 }
 
+// LineageEntry is one session in a chain of resumed conversations. Each
+// session holds only the messages added while it ran.
+type LineageEntry struct {
+	SessionID    string         `json:"session_id"`
+	CreatedAt    string         `json:"created_at,omitempty"`
+	EndedAt      string         `json:"ended_at,omitempty"`
+	Summary      string         `json:"summary,omitempty"`
+	MessageCount int            `json:"message_count"`
+	ContinuedBy  []LineageEntry `json:"continued_by,omitempty"`
+}
+
+// SessionParent points a sub-agent session at the tool call that spawned it.
+type SessionParent struct {
+	SessionID string `json:"session_id"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+}
+
+// SubagentNode is a child session spawned by one of the session's tool
+// calls, with the sub-agents it spawned in turn.
+type SubagentNode struct {
+	SessionID    string         `json:"session_id"`
+	ToolUseID    string         `json:"tool_use_id,omitempty"`
+	AgentID      string         `json:"agent_id,omitempty"`
+	SubagentType string         `json:"subagent_type,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	CreatedAt    string         `json:"created_at,omitempty"`
+	EndedAt      string         `json:"ended_at,omitempty"`
+	MessageCount int            `json:"message_count"`
+	ToolUseCount int            `json:"tool_use_count"`
+	Subagents    []SubagentNode `json:"subagents,omitempty"`
+}
+
 type SessionsResponse struct {
 	Sessions []SessionSummary `json:"sessions"`
 	Total    int              `json:"total"`
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/victorarias/tabs/internal/events"
 )
 
 func (s *Server) listSessions(ctx context.Context, filter SessionFilter) ([]SessionSummary, int, error) {
@@ -34,6 +36,10 @@ func (s *Server) listSessions(ctx context.Context, filter SessionFilter) ([]Sess
 		SELECT
 			s.id, s.tool, s.session_id, s.created_at, s.ended_at, s.cwd,
 			s.uploaded_by, s.uploaded_at, s.duration_seconds, s.message_count, s.tool_use_count,
+			s.input_tokens, s.output_tokens, s.cache_creation_input_tokens, s.cache_read_input_tokens,
+			s.cost_usd::float8, COALESCE(s.cost_source, ''),
+			COALESCE(s.git_repo_root, ''), COALESCE(s.git_remote_url, ''), COALESCE(s.git_branch, ''),
+			COALESCE(s.git_start_sha, ''), COALESCE(s.git_end_sha, ''),
 			first_msg.content,
 			COALESCE(
 				json_agg(json_build_object('key', t.tag_key, 'value', t.tag_value))
@@ -65,6 +71,7 @@ func (s *Server) listSessions(ctx context.Context, filter SessionFilter) ([]Sess
 	var sessions []SessionSummary
 	for rows.Next() {
 		var summary SessionSummary
+		var git GitContext
 		var tagsRaw []byte
 		var contentRaw []byte
 		if err := rows.Scan(
@@ -79,6 +86,17 @@ func (s *Server) listSessions(ctx context.Context, filter SessionFilter) ([]Sess
 			&summary.DurationSeconds,
 			&summary.MessageCount,
 			&summary.ToolUseCount,
+			&summary.Usage.InputTokens,
+			&summary.Usage.OutputTokens,
+			&summary.Usage.CacheCreationInputTokens,
+			&summary.Usage.CacheReadInputTokens,
+			&summary.CostUSD,
+			&summary.CostSource,
+			&git.RepoRoot,
+			&git.RemoteURL,
+			&git.Branch,
+			&git.StartSHA,
+			&git.EndSHA,
 			&contentRaw,
 			&tagsRaw,
 		); err != nil {
@@ -88,6 +106,9 @@ func (s *Server) listSessions(ctx context.Context, filter SessionFilter) ([]Sess
 			_ = json.Unmarshal(tagsRaw, &summary.Tags)
 		}
 		summary.Summary = summarizeContent(contentRaw)
+		if !git.IsZero() {
+			summary.Git = &git
+		}
 		sessions = append(sessions, summary)
 	}
 	if err := rows.Err(); err != nil {
@@ -114,10 +135,20 @@ func (s *Server) getSession(ctx context.Context, id string) (SessionDetail, erro
 	var detail SessionDetail
 	row := s.db.QueryRowContext(ctx, `
 		SELECT id, tool, session_id, created_at, ended_at, cwd, uploaded_by, uploaded_at,
-			duration_seconds, message_count, tool_use_count
+			duration_seconds, message_count, tool_use_count,
+			input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+			cost_usd::float8, COALESCE(cost_source, ''),
+			COALESCE(git_repo_root, ''), COALESCE(git_remote_url, ''), COALESCE(git_branch, ''),
+			COALESCE(git_start_sha, ''), COALESCE(git_end_sha, ''), COALESCE(git_dirty_files, '[]'::jsonb),
+			COALESCE(parent_session_id, ''), COALESCE(parent_tool_use_id, ''), subagents,
+			COALESCE(parent_relation, ''), hook_timing
 		FROM sessions
 		WHERE id = $1
 	`, id)
+	var git GitContext
+	var dirtyRaw []byte
+	var parentID, parentToolUseID, parentRelation string
+	var subagentsRaw, hookTimingRaw []byte
 	if err := row.Scan(
 		&detail.ID,
 		&detail.Tool,
@@ -130,9 +161,61 @@ func (s *Server) getSession(ctx context.Context, id string) (SessionDetail, erro
 		&detail.DurationSeconds,
 		&detail.MessageCount,
 		&detail.ToolUseCount,
+		&detail.Usage.InputTokens,
+		&detail.Usage.OutputTokens,
+		&detail.Usage.CacheCreationInputTokens,
+		&detail.Usage.CacheReadInputTokens,
+		&detail.CostUSD,
+		&detail.CostSource,
+		&git.RepoRoot,
+		&git.RemoteURL,
+		&git.Branch,
+		&git.StartSHA,
+		&git.EndSHA,
+		&dirtyRaw,
+		&parentID,
+		&parentToolUseID,
+		&subagentsRaw,
+		&parentRelation,
+		&hookTimingRaw,
 	); err != nil {
 		return SessionDetail{}, err
 	}
+	if !git.IsZero() {
+		_ = json.Unmarshal(dirtyRaw, &git.DirtyFiles)
+		detail.Git = &git
+	}
+	if len(hookTimingRaw) > 0 {
+		var timing events.HookTiming
+		if err := json.Unmarshal(hookTimingRaw, &timing); err == nil {
+			detail.HookTiming = &timing
+		}
+	}
+
+	if parentID != "" && parentRelation != "continuation" {
+		parent, err := s.sessionParent(ctx, detail.Tool, detail.SessionID, parentID, parentToolUseID)
+		if err != nil {
+			return SessionDetail{}, err
+		}
+		detail.Parent = parent
+	}
+	if parentRelation == "continuation" {
+		from, err := s.continuedFrom(ctx, detail.Tool, parentID)
+		if err != nil {
+			return SessionDetail{}, err
+		}
+		detail.ContinuedFrom = from
+	}
+	continuedBy, err := s.continuedBy(ctx, detail.Tool, detail.SessionID, map[string]bool{detail.SessionID: true}, 0)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	detail.ContinuedBy = continuedBy
+	subagents, err := s.subagentTree(ctx, detail.Tool, detail.SessionID, subagentsRaw, map[string]bool{detail.SessionID: true}, 0)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	detail.Subagents = subagents
 
 	tags, err := s.listSessionTags(ctx, id)
 	if err != nil {
@@ -152,6 +235,12 @@ func (s *Server) getSession(ctx context.Context, id string) (SessionDetail, erro
 	}
 	detail.Tools = tools
 
+	markers, err := s.listMarkers(ctx, id)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	detail.Markers = markers
+
 	return detail, nil
 }
 
@@ -209,10 +298,10 @@ func (s *Server) listMessages(ctx context.Context, sessionID string) ([]MessageD
 
 func (s *Server) listTools(ctx context.Context, sessionID string) ([]ToolDetail, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, timestamp, tool_use_id, tool_name, input, output, is_error
+		SELECT id, timestamp, seq, tool_use_id, tool_name, input, output, is_error
 		FROM tools
 		WHERE session_id = $1
-		ORDER BY timestamp
+		ORDER BY seq, timestamp
 	`, sessionID)
 	if err != nil {
 		return nil, err
@@ -222,7 +311,7 @@ func (s *Server) listTools(ctx context.Context, sessionID string) ([]ToolDetail,
 	var tools []ToolDetail
 	for rows.Next() {
 		var tool ToolDetail
-		if err := rows.Scan(&tool.ID, &tool.Timestamp, &tool.ToolUseID, &tool.ToolName, &tool.Input, &tool.Output, &tool.IsError); err != nil {
+		if err := rows.Scan(&tool.ID, &tool.Timestamp, &tool.Seq, &tool.ToolUseID, &tool.ToolName, &tool.Input, &tool.Output, &tool.IsError); err != nil {
 			return nil, err
 		}
 		tools = append(tools, tool)
@@ -233,6 +322,32 @@ func (s *Server) listTools(ctx context.Context, sessionID string) ([]ToolDetail,
 	return tools, nil
 }
 
+func (s *Server) listMarkers(ctx context.Context, sessionID string) ([]MarkerDetail, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, timestamp, seq, marker_type, data
+		FROM session_markers
+		WHERE session_id = $1
+		ORDER BY seq
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := []MarkerDetail{}
+	for rows.Next() {
+		var marker MarkerDetail
+		if err := rows.Scan(&marker.ID, &marker.Timestamp, &marker.Seq, &marker.Type, &marker.Data); err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return markers, nil
+}
+
 func (s *Server) listTags(ctx context.Context, key string, limit int) ([]TagCount, error) {
 	if limit <= 0 {
 		limit = 100
@@ -332,10 +447,30 @@ func buildSessionWhere(filter SessionFilter) (string, []interface{}) {
 		argIndex++
 	}
 
+	if strings.TrimSpace(filter.Repo) != "" {
+		clauses = append(clauses, fmt.Sprintf("(s.git_remote_url ILIKE $%d OR s.git_repo_root ILIKE $%d)", argIndex, argIndex))
+		args = append(args, "%"+filter.Repo+"%")
+		argIndex++
+	}
+
+	if strings.TrimSpace(filter.Branch) != "" {
+		clauses = append(clauses, fmt.Sprintf("s.git_branch = $%d", argIndex))
+		args = append(args, filter.Branch)
+		argIndex++
+	}
+
+	if strings.TrimSpace(filter.SHA) != "" {
+		clauses = append(clauses, fmt.Sprintf("(s.git_start_sha LIKE $%d OR s.git_end_sha LIKE $%d)", argIndex, argIndex))
+		args = append(args, strings.ToLower(filter.SHA)+"%")
+		argIndex++
+	}
+
 	if strings.TrimSpace(filter.Query) != "" {
 		like := "%" + filter.Query + "%"
 		clauses = append(clauses, fmt.Sprintf(`(
 			s.cwd ILIKE $%d
+			OR s.git_remote_url ILIKE $%d
+			OR s.git_branch ILIKE $%d
 			OR EXISTS (
 				SELECT 1 FROM messages m
 				WHERE m.session_id = s.id AND m.content::text ILIKE $%d
@@ -352,7 +487,7 @@ func buildSessionWhere(filter SessionFilter) (string, []interface{}) {
 					tg.tag_key ILIKE $%d OR tg.tag_value ILIKE $%d
 				)
 			)
-		)`, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex))
+		)`, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex, argIndex))
 		args = append(args, like)
 		argIndex++
 	}
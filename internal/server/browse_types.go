@@ -3,11 +3,16 @@ package server
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/victorarias/tabs/internal/events"
 )
 
 type SessionFilter struct {
 	Tool       string
 	UploadedBy string
+	Repo       string
+	Branch     string
+	SHA        string
 	Tags       []Tag
 	Query      string
 	Page       int
@@ -30,36 +35,86 @@ type Pagination struct {
 }
 
 type SessionSummary struct {
-	ID              string     `json:"id"`
-	Tool            string     `json:"tool"`
-	SessionID       string     `json:"session_id"`
-	CreatedAt       time.Time  `json:"created_at"`
-	EndedAt         *time.Time `json:"ended_at,omitempty"`
-	Cwd             string     `json:"cwd"`
-	UploadedBy      string     `json:"uploaded_by"`
-	UploadedAt      time.Time  `json:"uploaded_at"`
-	DurationSeconds *int       `json:"duration_seconds,omitempty"`
-	MessageCount    int        `json:"message_count"`
-	ToolUseCount    int        `json:"tool_use_count"`
-	Tags            []Tag      `json:"tags"`
-	Summary         string     `json:"summary,omitempty"`
+	ID              string            `json:"id"`
+	Tool            string            `json:"tool"`
+	SessionID       string            `json:"session_id"`
+	CreatedAt       time.Time         `json:"created_at"`
+	EndedAt         *time.Time        `json:"ended_at,omitempty"`
+	Cwd             string            `json:"cwd"`
+	UploadedBy      string            `json:"uploaded_by"`
+	UploadedAt      time.Time         `json:"uploaded_at"`
+	DurationSeconds *int              `json:"duration_seconds,omitempty"`
+	MessageCount    int               `json:"message_count"`
+	ToolUseCount    int               `json:"tool_use_count"`
+	Usage           events.TokenUsage `json:"usage"`
+	CostUSD         *float64          `json:"cost_usd,omitempty"`
+	CostSource      string            `json:"cost_source,omitempty"` // server or client
+	Git             *GitContext       `json:"git,omitempty"`
+	Tags            []Tag             `json:"tags"`
+	Summary         string            `json:"summary,omitempty"`
 }
 
 type SessionDetail struct {
-	ID              string          `json:"id"`
-	Tool            string          `json:"tool"`
-	SessionID       string          `json:"session_id"`
-	CreatedAt       time.Time       `json:"created_at"`
-	EndedAt         *time.Time      `json:"ended_at,omitempty"`
-	Cwd             string          `json:"cwd"`
-	UploadedBy      string          `json:"uploaded_by"`
-	UploadedAt      time.Time       `json:"uploaded_at"`
-	DurationSeconds *int            `json:"duration_seconds,omitempty"`
-	MessageCount    int             `json:"message_count"`
-	ToolUseCount    int             `json:"tool_use_count"`
-	Tags            []Tag           `json:"tags"`
-	Messages        []MessageDetail `json:"messages"`
-	Tools           []ToolDetail    `json:"tools"`
+	ID              string             `json:"id"`
+	Tool            string             `json:"tool"`
+	SessionID       string             `json:"session_id"`
+	CreatedAt       time.Time          `json:"created_at"`
+	EndedAt         *time.Time         `json:"ended_at,omitempty"`
+	Cwd             string             `json:"cwd"`
+	UploadedBy      string             `json:"uploaded_by"`
+	UploadedAt      time.Time          `json:"uploaded_at"`
+	DurationSeconds *int               `json:"duration_seconds,omitempty"`
+	MessageCount    int                `json:"message_count"`
+	ToolUseCount    int                `json:"tool_use_count"`
+	Usage           events.TokenUsage  `json:"usage"`
+	CostUSD         *float64           `json:"cost_usd,omitempty"`
+	CostSource      string             `json:"cost_source,omitempty"` // server or client
+	HookTiming      *events.HookTiming `json:"hook_timing,omitempty"`
+	Git             *GitContext        `json:"git,omitempty"`
+	Parent          *SessionParent     `json:"parent,omitempty"`
+	Subagents       []SubagentNode     `json:"subagents,omitempty"`
+	ContinuedFrom   []LineageEntry     `json:"continued_from,omitempty"`
+	ContinuedBy     []LineageEntry     `json:"continued_by,omitempty"`
+	Tags            []Tag              `json:"tags"`
+	Messages        []MessageDetail    `json:"messages"`
+	Tools           []ToolDetail       `json:"tools"`
+	Markers         []MarkerDetail     `json:"markers"`
+}
+
+// LineageEntry is one session in a chain of resumed conversations. ID is
+// empty for sessions that were never uploaded.
+type LineageEntry struct {
+	ID           string         `json:"id,omitempty"`
+	SessionID    string         `json:"session_id"`
+	CreatedAt    *time.Time     `json:"created_at,omitempty"`
+	EndedAt      *time.Time     `json:"ended_at,omitempty"`
+	UploadedBy   string         `json:"uploaded_by,omitempty"`
+	MessageCount int            `json:"message_count"`
+	ContinuedBy  []LineageEntry `json:"continued_by,omitempty"`
+}
+
+// SessionParent points a sub-agent session at the tool call that spawned
+// it. ID is empty until the parent session is uploaded.
+type SessionParent struct {
+	ID        string `json:"id,omitempty"`
+	SessionID string `json:"session_id"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+}
+
+// SubagentNode is a child session in a session's sub-agent tree. Children the
+// parent recorded but nobody uploaded have no ID and no counts.
+type SubagentNode struct {
+	ID           string         `json:"id,omitempty"`
+	SessionID    string         `json:"session_id"`
+	ToolUseID    string         `json:"tool_use_id,omitempty"`
+	AgentID      string         `json:"agent_id,omitempty"`
+	SubagentType string         `json:"subagent_type,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	CreatedAt    *time.Time     `json:"created_at,omitempty"`
+	EndedAt      *time.Time     `json:"ended_at,omitempty"`
+	MessageCount int            `json:"message_count"`
+	ToolUseCount int            `json:"tool_use_count"`
+	Subagents    []SubagentNode `json:"subagents,omitempty"`
 }
 
 type MessageDetail struct {
@@ -71,9 +126,20 @@ type MessageDetail struct {
 	Content   json.RawMessage `json:"content"`
 }
 
+// MarkerDetail is a timeline marker: a compaction, system_notice or summary
+// event with its data as captured.
+type MarkerDetail struct {
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
 type ToolDetail struct {
 	ID        string          `json:"id"`
 	Timestamp time.Time       `json:"timestamp"`
+	Seq       int             `json:"seq"`
 	ToolUseID string          `json:"tool_use_id"`
 	ToolName  string          `json:"tool_name"`
 	Input     json.RawMessage `json:"input"`
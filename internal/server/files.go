@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/victorarias/tabs/internal/events"
+)
+
+type SessionFilesResponse struct {
+	Files []events.FileLedgerEntry `json:"files"`
+}
+
+type FileSessionsResponse struct {
+	Path     string        `json:"path"`
+	Sessions []FileSession `json:"sessions"`
+}
+
+// FileSession is one session that changed a file matched by GET /api/files.
+// Sessions uploaded before the ledger existed report zero line counts.
+type FileSession struct {
+	ID            string    `json:"id"`
+	SessionID     string    `json:"session_id"`
+	Tool          string    `json:"tool"`
+	CreatedAt     time.Time `json:"created_at"`
+	UploadedBy    string    `json:"uploaded_by"`
+	Cwd           string    `json:"cwd"`
+	FilePath      string    `json:"file_path"`
+	Edits         int       `json:"edits"`
+	MultiEdits    int       `json:"multi_edits"`
+	Writes        int       `json:"writes"`
+	LinesAdded    int       `json:"lines_added"`
+	LinesRemoved  int       `json:"lines_removed"`
+	LastTouchedAt time.Time `json:"last_touched_at"`
+}
+
+func (s *Server) handleSessionFiles(w http.ResponseWriter, r *http.Request, id string) {
+	var exists bool
+	if err := s.db.QueryRowContext(r.Context(), `SELECT true FROM sessions WHERE id = $1`, id).Scan(&exists); err != nil {
+		if isNotFound(err) {
+			s.writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load session")
+		return
+	}
+	files, err := s.listSessionFiles(r.Context(), id)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load files")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, SessionFilesResponse{Files: files})
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireJSONAuth(w, r); !ok {
+		return
+	}
+
+	path := strings.TrimSpace(r.URL.Query().Get("path"))
+	if path == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "Missing path")
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid_request", "limit must be a positive number")
+			return
+		}
+		if parsed > 200 {
+			parsed = 200
+		}
+		limit = parsed
+	}
+
+	sessions, err := s.findFileSessions(r.Context(), path, limit)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load sessions")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, FileSessionsResponse{Path: path, Sessions: sessions})
+}
+
+// listSessionFiles returns the ledger stored at upload. Sessions uploaded
+// before session_files existed get a ledger rebuilt from their tool calls.
+func (s *Server) listSessionFiles(ctx context.Context, sessionID string) ([]events.FileLedgerEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT file_path, edit_count, multi_edit_count, write_count, lines_added, lines_removed,
+			first_touched_at, last_touched_at, changes
+		FROM session_files
+		WHERE session_id = $1
+		ORDER BY file_path
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []events.FileLedgerEntry{}
+	for rows.Next() {
+		var entry events.FileLedgerEntry
+		var changesRaw []byte
+		if err := rows.Scan(&entry.Path, &entry.Edits, &entry.MultiEdits, &entry.Writes,
+			&entry.LinesAdded, &entry.LinesRemoved, &entry.FirstTouchedAt, &entry.LastTouchedAt, &changesRaw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changesRaw, &entry.Changes); err != nil {
+			return nil, err
+		}
+		files = append(files, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return files, nil
+	}
+	return s.rebuildSessionFiles(ctx, sessionID)
+}
+
+func (s *Server) rebuildSessionFiles(ctx context.Context, sessionID string) ([]events.FileLedgerEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tool_use_id, tool_name, input, is_error, timestamp
+		FROM tools
+		WHERE session_id = $1 AND tool_name IN (`+sqlStringList(events.LedgerToolNames(""))+`)
+		ORDER BY seq ASC, timestamp ASC
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ledger := events.NewFileLedger()
+	for rows.Next() {
+		var toolUseID, toolName string
+		var input []byte
+		var isError sql.NullBool
+		var ts time.Time
+		if err := rows.Scan(&toolUseID, &toolName, &input, &isError, &ts); err != nil {
+			return nil, err
+		}
+		ledger.AddToolUse(toolUseID, toolName, input, ts)
+		if isError.Bool {
+			ledger.MarkError(toolUseID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ledger.Entries(), nil
+}
+
+// findFileSessions lists sessions that changed path, newest change first.
+// An absolute path matches exactly; a relative one (src/auth.go) matches
+// any absolute path ending in it, since checkouts live in different places
+// on each machine.
+func (s *Server) findFileSessions(ctx context.Context, path string, limit int) ([]FileSession, error) {
+	ledgerMatch := "f.file_path = $1"
+	toolMatch := "t.input->>'file_path' = $1"
+	arg := path
+	if !strings.HasPrefix(path, "/") {
+		ledgerMatch = `f.file_path LIKE $1 ESCAPE '\'`
+		toolMatch = `t.input->>'file_path' LIKE $1 ESCAPE '\'`
+		arg = "%/" + escapeLike(strings.TrimPrefix(path, "./"))
+	}
+
+	query := `
+		SELECT s.id, s.session_id, s.tool, s.created_at, s.uploaded_by, s.cwd,
+			f.file_path, f.edit_count, f.multi_edit_count, f.write_count,
+			f.lines_added, f.lines_removed, f.last_touched_at
+		FROM session_files f
+		JOIN sessions s ON s.id = f.session_id
+		WHERE ` + ledgerMatch + `
+		UNION ALL
+		SELECT s.id, s.session_id, s.tool, s.created_at, s.uploaded_by, s.cwd,
+			t.input->>'file_path',
+			COUNT(*) FILTER (WHERE t.tool_name IN (` + sqlStringList(events.LedgerToolNames("edit")) + `)),
+			COUNT(*) FILTER (WHERE t.tool_name IN (` + sqlStringList(events.LedgerToolNames("multi_edit")) + `)),
+			COUNT(*) FILTER (WHERE t.tool_name IN (` + sqlStringList(events.LedgerToolNames("write")) + `)),
+			0, 0, MAX(t.timestamp)
+		FROM tools t
+		JOIN sessions s ON s.id = t.session_id
+		WHERE ` + toolMatch + `
+			AND t.tool_name IN (` + sqlStringList(events.LedgerToolNames("")) + `)
+			AND NOT EXISTS (SELECT 1 FROM session_files sf WHERE sf.session_id = s.id)
+		GROUP BY s.id, t.input->>'file_path'
+		ORDER BY 13 DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, arg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []FileSession{}
+	for rows.Next() {
+		var fs FileSession
+		if err := rows.Scan(&fs.ID, &fs.SessionID, &fs.Tool, &fs.CreatedAt, &fs.UploadedBy, &fs.Cwd,
+			&fs.FilePath, &fs.Edits, &fs.MultiEdits, &fs.Writes,
+			&fs.LinesAdded, &fs.LinesRemoved, &fs.LastTouchedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, fs)
+	}
+	return sessions, rows.Err()
+}
+
+// sqlStringList quotes constant names for an IN list.
+func sqlStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
@@ -15,6 +16,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgconn"
+	"github.com/victorarias/tabs/internal/config"
+	"github.com/victorarias/tabs/internal/events"
 )
 
 var errInvalidAPIKey = errors.New("invalid api key")
@@ -45,23 +48,13 @@ func (s *Server) handleUploadSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	normalized, err := normalizeUpload(req)
+	normalized, err := normalizeUpload(req, s.pricing)
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
 
-	exists, err := s.sessionExists(ctx, normalized.Tool, normalized.SessionID)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to check session")
-		return
-	}
-	if exists {
-		s.writeError(w, http.StatusConflict, "duplicate_session", "Session already uploaded")
-		return
-	}
-
-	remoteID, err := s.storeSession(ctx, normalized, keyRecord)
+	remoteID, created, err := s.storeSession(ctx, normalized, keyRecord)
 	if err != nil {
 		if errors.Is(err, errDuplicateSession) {
 			s.writeError(w, http.StatusConflict, "duplicate_session", "Session already uploaded")
@@ -75,7 +68,11 @@ func (s *Server) handleUploadSession(w http.ResponseWriter, r *http.Request) {
 		"id":  remoteID,
 		"url": strings.TrimRight(s.baseURL, "/") + "/sessions/" + remoteID,
 	}
-	s.writeJSON(w, http.StatusCreated, resp)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	s.writeJSON(w, status, resp)
 }
 
 type apiKeyRecord struct {
@@ -113,24 +110,17 @@ func (s *Server) lookupAPIKey(ctx context.Context, key string) (apiKeyRecord, er
 	return record, nil
 }
 
-func (s *Server) sessionExists(ctx context.Context, tool, sessionID string) (bool, error) {
-	var id string
-	err := s.db.QueryRowContext(ctx, `SELECT id FROM sessions WHERE tool = $1 AND session_id = $2`, tool, sessionID).Scan(&id)
-	if err == nil {
-		return true, nil
-	}
-	if errors.Is(err, sql.ErrNoRows) {
-		return false, nil
-	}
-	return false, err
-}
-
 var errDuplicateSession = errors.New("duplicate session")
 
-func (s *Server) storeSession(ctx context.Context, session NormalizedSession, key apiKeyRecord) (string, error) {
+// storeSession stores an upload and reports whether it created the session.
+// A re-upload of a session by the same user is merged into the stored one:
+// its aggregates are replaced and events already stored are skipped by
+// event_id. An upload without event_ids on every event cannot be merged
+// and, like a session uploaded by another user, is a duplicate.
+func (s *Server) storeSession(ctx context.Context, session NormalizedSession, key apiKeyRecord) (string, bool, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	defer tx.Rollback()
 
@@ -142,33 +132,108 @@ func (s *Server) storeSession(ctx context.Context, session NormalizedSession, ke
 	if session.DurationSeconds != nil {
 		duration = *session.DurationSeconds
 	}
+	dirtyFiles, err := json.Marshal(session.Git.DirtyFiles)
+	if err != nil {
+		return "", false, err
+	}
+	if session.Git.DirtyFiles == nil {
+		dirtyFiles = []byte("[]")
+	}
+
+	subagents := []byte("[]")
+	if len(session.Subagents) > 0 {
+		if subagents, err = json.Marshal(session.Subagents); err != nil {
+			return "", false, err
+		}
+	}
+
+	var hookTiming interface{}
+	if session.HookTiming != nil {
+		raw, err := json.Marshal(session.HookTiming)
+		if err != nil {
+			return "", false, err
+		}
+		hookTiming = raw
+	}
+
+	args := []interface{}{
+		session.Tool, session.SessionID, session.CreatedAt, endedAt, session.Cwd, key.UserID, key.ID,
+		duration, session.MessageCount, session.ToolUseCount,
+		session.Usage.InputTokens, session.Usage.OutputTokens, session.Usage.CacheCreationInputTokens,
+		session.Usage.CacheReadInputTokens, session.CostUSD, nullIfEmpty(session.CostSource),
+		nullIfEmpty(session.Git.RepoRoot), nullIfEmpty(session.Git.RemoteURL), nullIfEmpty(session.Git.Branch),
+		nullIfEmpty(session.Git.StartSHA), nullIfEmpty(session.Git.EndSHA), dirtyFiles,
+		nullIfEmpty(session.Parent.SessionID), nullIfEmpty(session.Parent.ToolUseID), nullIfEmpty(session.Parent.AgentID),
+		nullIfEmpty(session.Parent.SubagentType), nullIfEmpty(session.Parent.Description), subagents,
+		nullIfEmpty(session.ParentRelation), hookTiming,
+	}
 
-	var remoteID string
+	var remoteID, uploadedBy string
+	created := false
 	err = tx.QueryRowContext(ctx, `
-		INSERT INTO sessions (
-			tool, session_id, created_at, ended_at, cwd, uploaded_by, api_key_id,
-			duration_seconds, message_count, tool_use_count
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		RETURNING id
-	`, session.Tool, session.SessionID, session.CreatedAt, endedAt, session.Cwd, key.UserID, key.ID,
-		duration, session.MessageCount, session.ToolUseCount).Scan(&remoteID)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == "23505" {
-				return "", errDuplicateSession
+		SELECT id, uploaded_by FROM sessions WHERE tool = $1 AND session_id = $2 FOR UPDATE
+	`, session.Tool, session.SessionID).Scan(&remoteID, &uploadedBy)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		created = true
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO sessions (
+				tool, session_id, created_at, ended_at, cwd, uploaded_by, api_key_id,
+				duration_seconds, message_count, tool_use_count,
+				input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens, cost_usd, cost_source,
+				git_repo_root, git_remote_url, git_branch, git_start_sha, git_end_sha, git_dirty_files,
+				parent_session_id, parent_tool_use_id, agent_id, subagent_type, subagent_description, subagents,
+				parent_relation, hook_timing
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29,$30)
+			RETURNING id
+		`, args...).Scan(&remoteID)
+		if err != nil {
+			if pgErr, ok := err.(*pgconn.PgError); ok {
+				if pgErr.Code == "23505" {
+					return "", false, errDuplicateSession
+				}
 			}
+			return "", false, err
+		}
+	case err != nil:
+		return "", false, err
+	default:
+		if uploadedBy != key.UserID || !session.Mergeable {
+			return "", false, errDuplicateSession
+		}
+		// The re-upload holds every event of the session so far, so its
+		// aggregates replace the stored ones.
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE sessions SET
+				created_at = $3, ended_at = $4, cwd = $5, api_key_id = $7,
+				duration_seconds = $8, message_count = $9, tool_use_count = $10,
+				input_tokens = $11, output_tokens = $12, cache_creation_input_tokens = $13,
+				cache_read_input_tokens = $14, cost_usd = $15, cost_source = $16,
+				git_repo_root = $17, git_remote_url = $18, git_branch = $19,
+				git_start_sha = $20, git_end_sha = $21, git_dirty_files = $22,
+				parent_session_id = $23, parent_tool_use_id = $24, agent_id = $25,
+				subagent_type = $26, subagent_description = $27, subagents = $28,
+				parent_relation = $29, hook_timing = $30
+			WHERE tool = $1 AND session_id = $2 AND uploaded_by = $6
+		`, args...); err != nil {
+			return "", false, err
 		}
-		return "", err
 	}
 
 	if err := insertMessages(ctx, tx, remoteID, session.Messages); err != nil {
-		return "", err
+		return "", false, err
+	}
+	if err := insertMarkers(ctx, tx, remoteID, session.Markers); err != nil {
+		return "", false, err
 	}
 	if err := insertTools(ctx, tx, remoteID, session.Tools); err != nil {
-		return "", err
+		return "", false, err
 	}
 	if err := insertTags(ctx, tx, remoteID, session.Tags); err != nil {
-		return "", err
+		return "", false, err
+	}
+	if err := insertFiles(ctx, tx, remoteID, session.Files); err != nil {
+		return "", false, err
 	}
 
 	if _, err := tx.ExecContext(ctx, `
@@ -176,20 +241,23 @@ func (s *Server) storeSession(ctx context.Context, session NormalizedSession, ke
 		SET last_used_at = NOW(), usage_count = usage_count + 1
 		WHERE id = $1
 	`, key.ID); err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return "", err
+		return "", false, err
 	}
-	return remoteID, nil
+	return remoteID, created, nil
 }
 
 func insertMessages(ctx context.Context, tx *sql.Tx, sessionID string, messages []MessageRecord) error {
 	if len(messages) == 0 {
 		return nil
 	}
-	stmt := `INSERT INTO messages (session_id, timestamp, seq, role, model, content) VALUES ($1,$2,$3,$4,$5,$6)`
+	// An event_id already stored for the session is a duplicate of an event
+	// uploaded before and is skipped.
+	stmt := `INSERT INTO messages (session_id, timestamp, seq, event_id, role, model, content) VALUES ($1,$2,$3,$4,$5,$6,$7)
+		ON CONFLICT (session_id, event_id) DO NOTHING`
 	for _, msg := range messages {
 		var model interface{}
 		if msg.Model != nil && *msg.Model != "" {
@@ -199,7 +267,22 @@ func insertMessages(ctx context.Context, tx *sql.Tx, sessionID string, messages
 		if len(content) == 0 {
 			content = json.RawMessage("[]")
 		}
-		if _, err := tx.ExecContext(ctx, stmt, sessionID, msg.Timestamp, msg.Seq, msg.Role, model, []byte(content)); err != nil {
+		if _, err := tx.ExecContext(ctx, stmt, sessionID, msg.Timestamp, msg.Seq, nullIfEmpty(msg.EventID), msg.Role, model, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertMarkers(ctx context.Context, tx *sql.Tx, sessionID string, markers []MarkerRecord) error {
+	stmt := `INSERT INTO session_markers (session_id, timestamp, seq, event_id, marker_type, data) VALUES ($1,$2,$3,$4,$5,$6)
+		ON CONFLICT (session_id, event_id) DO NOTHING`
+	for _, marker := range markers {
+		data := marker.Data
+		if len(data) == 0 {
+			data = json.RawMessage("{}")
+		}
+		if _, err := tx.ExecContext(ctx, stmt, sessionID, marker.Timestamp, marker.Seq, nullIfEmpty(marker.EventID), marker.MarkerType, []byte(data)); err != nil {
 			return err
 		}
 	}
@@ -211,9 +294,14 @@ func insertTools(ctx context.Context, tx *sql.Tx, sessionID string, tools []Tool
 		return nil
 	}
 	sort.Slice(tools, func(i, j int) bool {
-		return tools[i].Timestamp.Before(tools[j].Timestamp)
+		return tools[i].Seq < tools[j].Seq
 	})
-	stmt := `INSERT INTO tools (session_id, timestamp, tool_use_id, tool_name, input, output, is_error) VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	// A tool call stored before its result arrived gets the result from a
+	// later upload of the same event.
+	stmt := `INSERT INTO tools (session_id, timestamp, seq, event_id, tool_use_id, tool_name, input, output, is_error) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		ON CONFLICT (session_id, event_id) DO UPDATE SET
+			output = COALESCE(EXCLUDED.output, tools.output),
+			is_error = EXCLUDED.is_error OR tools.is_error`
 	for _, tool := range tools {
 		input := tool.Input
 		if len(input) == 0 {
@@ -223,7 +311,7 @@ func insertTools(ctx context.Context, tx *sql.Tx, sessionID string, tools []Tool
 		if len(tool.Output) > 0 {
 			output = []byte(tool.Output)
 		}
-		if _, err := tx.ExecContext(ctx, stmt, sessionID, tool.Timestamp, tool.ToolUseID, tool.ToolName, []byte(input), output, tool.IsError); err != nil {
+		if _, err := tx.ExecContext(ctx, stmt, sessionID, tool.Timestamp, tool.Seq, nullIfEmpty(tool.EventID), tool.ToolUseID, tool.ToolName, []byte(input), output, tool.IsError); err != nil {
 			return err
 		}
 	}
@@ -234,7 +322,8 @@ func insertTags(ctx context.Context, tx *sql.Tx, sessionID string, tags []Tag) e
 	if len(tags) == 0 {
 		return nil
 	}
-	stmt := `INSERT INTO tags (session_id, tag_key, tag_value) VALUES ($1,$2,$3)`
+	stmt := `INSERT INTO tags (session_id, tag_key, tag_value) VALUES ($1,$2,$3)
+		ON CONFLICT (session_id, tag_key, tag_value) DO NOTHING`
 	for _, tag := range tags {
 		if _, err := tx.ExecContext(ctx, stmt, sessionID, tag.Key, tag.Value); err != nil {
 			return err
@@ -243,6 +332,32 @@ func insertTags(ctx context.Context, tx *sql.Tx, sessionID string, tags []Tag) e
 	return nil
 }
 
+func insertFiles(ctx context.Context, tx *sql.Tx, sessionID string, files []events.FileLedgerEntry) error {
+	if len(files) == 0 {
+		return nil
+	}
+	stmt := `INSERT INTO session_files (
+		session_id, file_path, edit_count, multi_edit_count, write_count,
+		lines_added, lines_removed, first_touched_at, last_touched_at, changes
+	) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+	ON CONFLICT (session_id, file_path) DO UPDATE SET
+		edit_count = EXCLUDED.edit_count, multi_edit_count = EXCLUDED.multi_edit_count,
+		write_count = EXCLUDED.write_count, lines_added = EXCLUDED.lines_added,
+		lines_removed = EXCLUDED.lines_removed, first_touched_at = EXCLUDED.first_touched_at,
+		last_touched_at = EXCLUDED.last_touched_at, changes = EXCLUDED.changes`
+	for _, file := range files {
+		changes, err := json.Marshal(file.Changes)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, stmt, sessionID, file.Path, file.Edits, file.MultiEdits, file.Writes,
+			file.LinesAdded, file.LinesRemoved, file.FirstTouchedAt, file.LastTouchedAt, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseBearerToken(header string) (string, error) {
 	parts := strings.Fields(header)
 	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
@@ -254,7 +369,7 @@ func parseBearerToken(header string) (string, error) {
 	return parts[1], nil
 }
 
-func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
+func normalizeUpload(req UploadRequest, prices map[string]config.ModelPrice) (NormalizedSession, error) {
 	if req.Session.SessionID == "" {
 		return NormalizedSession{}, errors.New("missing session.session_id")
 	}
@@ -262,7 +377,7 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 		return NormalizedSession{}, errors.New("session.session_id must be a valid UUID")
 	}
 	if !isValidTool(req.Session.Tool) {
-		return NormalizedSession{}, errors.New("session.tool must be claude-code or cursor")
+		return NormalizedSession{}, fmt.Errorf("session.tool must be one of: %s", strings.Join(events.Tools(), ", "))
 	}
 	if len(req.Session.Events) == 0 {
 		return NormalizedSession{}, errors.New("session.events must not be empty")
@@ -297,15 +412,30 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 	var earliest time.Time
 	var latest time.Time
 	var messages []MessageRecord
+	var markers []MarkerRecord
 	var toolUseCount int
 	toolMap := make(map[string]*ToolRecord)
-	seq := 0
+	ledger := events.NewFileLedger()
 
 	var sessionEndDuration *int
 	var sessionEndMsgCount *int
 	var sessionEndToolCount *int
-
-	for _, event := range req.Session.Events {
+	sessionEnd := reportedUsage{Name: "session_end"}
+	var usage events.TokenUsage
+	usageByModel := make(map[string]events.TokenUsage)
+	var lastUsageID string
+	var hookTiming events.HookTiming
+
+	ordered := orderEvents(req.Session.Events)
+	legacy := unstampedEvents(ordered)
+	normalized.Mergeable = true
+	for _, event := range ordered {
+		if event.EventID == "" {
+			normalized.Mergeable = false
+			break
+		}
+	}
+	for i, event := range ordered {
 		if event.EventType == "" {
 			continue
 		}
@@ -329,7 +459,12 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 		switch event.EventType {
 		case "session_start":
 			var data struct {
-				Cwd string `json:"cwd"`
+				Cwd             string `json:"cwd"`
+				ParentSessionID string `json:"parent_session_id"`
+				ParentToolUseID string `json:"parent_tool_use_id"`
+				AgentID         string `json:"agent_id"`
+				SubagentType    string `json:"subagent_type"`
+				Description     string `json:"description"`
 			}
 			if len(event.Data) > 0 {
 				_ = json.Unmarshal(event.Data, &data)
@@ -337,14 +472,27 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			if normalized.Cwd == "" && strings.TrimSpace(data.Cwd) != "" {
 				normalized.Cwd = strings.TrimSpace(data.Cwd)
 			}
+			if data.ParentSessionID != "" && normalized.Parent.SessionID == "" {
+				normalized.Parent = SubagentLink{
+					SessionID:    data.ParentSessionID,
+					ToolUseID:    data.ParentToolUseID,
+					AgentID:      data.AgentID,
+					SubagentType: data.SubagentType,
+					Description:  data.Description,
+				}
+				normalized.ParentRelation = "subagent"
+			}
 			if normalized.CreatedAt.IsZero() {
 				normalized.CreatedAt = ts
 			}
 		case "session_end":
 			var data struct {
-				DurationSeconds *int `json:"duration_seconds"`
-				MessageCount    *int `json:"message_count"`
-				ToolUseCount    *int `json:"tool_use_count"`
+				DurationSeconds *int                         `json:"duration_seconds"`
+				MessageCount    *int                         `json:"message_count"`
+				ToolUseCount    *int                         `json:"tool_use_count"`
+				Usage           *events.TokenUsage           `json:"usage"`
+				UsageByModel    map[string]events.TokenUsage `json:"usage_by_model"`
+				CostUSD         *float64                     `json:"cost_usd"`
 			}
 			if len(event.Data) > 0 {
 				_ = json.Unmarshal(event.Data, &data)
@@ -362,6 +510,15 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			if data.ToolUseCount != nil {
 				sessionEndToolCount = data.ToolUseCount
 			}
+			if data.Usage != nil {
+				sessionEnd.Usage = data.Usage
+			}
+			if data.UsageByModel != nil {
+				sessionEnd.ByModel = data.UsageByModel
+			}
+			if data.CostUSD != nil {
+				sessionEnd.CostUSD = data.CostUSD
+			}
 		case "message":
 			var data struct {
 				Role    string          `json:"role"`
@@ -374,14 +531,15 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			if data.Role != "user" && data.Role != "assistant" {
 				return NormalizedSession{}, errors.New("message.role must be user or assistant")
 			}
-			seq++
+			addEventUsage(&usage, usageByModel, &lastUsageID, event.Data)
 			var model *string
 			if data.Model != "" {
 				model = &data.Model
 			}
 			messages = append(messages, MessageRecord{
 				Timestamp: ts,
-				Seq:       seq,
+				Seq:       eventSeq(event, i, legacy),
+				EventID:   event.EventID,
 				Role:      data.Role,
 				Model:     model,
 				Content:   data.Content,
@@ -398,15 +556,19 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			if data.ToolUseID == "" || data.ToolName == "" {
 				return NormalizedSession{}, errors.New("tool_use requires tool_use_id and tool_name")
 			}
+			addEventUsage(&usage, usageByModel, &lastUsageID, event.Data)
 			rec, ok := toolMap[data.ToolUseID]
 			if !ok {
 				rec = &ToolRecord{ToolUseID: data.ToolUseID}
 				toolMap[data.ToolUseID] = rec
 			}
 			rec.Timestamp = ts
+			rec.Seq = eventSeq(event, i, legacy)
+			rec.EventID = event.EventID
 			rec.ToolName = data.ToolName
 			rec.Input = data.Input
 			toolUseCount++
+			ledger.AddToolUse(data.ToolUseID, data.ToolName, data.Input, ts)
 		case "tool_result":
 			var data struct {
 				ToolUseID string          `json:"tool_use_id"`
@@ -421,7 +583,7 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			}
 			rec, ok := toolMap[data.ToolUseID]
 			if !ok {
-				rec = &ToolRecord{ToolUseID: data.ToolUseID}
+				rec = &ToolRecord{ToolUseID: data.ToolUseID, Seq: eventSeq(event, i, legacy), EventID: event.EventID}
 				toolMap[data.ToolUseID] = rec
 			}
 			if rec.Timestamp.IsZero() {
@@ -429,6 +591,46 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 			}
 			rec.Output = normalizeToolOutput(data.Content)
 			rec.IsError = data.IsError
+			if data.IsError {
+				ledger.MarkError(data.ToolUseID)
+			}
+		case "git_context":
+			mergeGitContext(&normalized.Git, event.Data)
+		case "subagent":
+			var data struct {
+				ChildSessionID string `json:"child_session_id"`
+				SubagentLink
+			}
+			if err := json.Unmarshal(event.Data, &data); err != nil || data.ChildSessionID == "" {
+				return NormalizedSession{}, errors.New("subagent requires child_session_id")
+			}
+			data.SubagentLink.SessionID = data.ChildSessionID
+			normalized.Subagents = mergeSubagentLink(normalized.Subagents, data.SubagentLink)
+		case "continuation":
+			var data struct {
+				ParentSessionID string `json:"parent_session_id"`
+			}
+			if len(event.Data) > 0 {
+				_ = json.Unmarshal(event.Data, &data)
+			}
+			if data.ParentSessionID != "" && normalized.Parent.SessionID == "" {
+				normalized.Parent = SubagentLink{SessionID: data.ParentSessionID}
+				normalized.ParentRelation = "continuation"
+			}
+		case "compaction", "system_notice", "summary":
+			markers = append(markers, MarkerRecord{
+				Timestamp:  ts,
+				Seq:        eventSeq(event, i, legacy),
+				EventID:    event.EventID,
+				MarkerType: event.EventType,
+				Data:       event.Data,
+			})
+		case "hook":
+			var data map[string]interface{}
+			if len(event.Data) > 0 {
+				_ = json.Unmarshal(event.Data, &data)
+			}
+			hookTiming.Observe(data, ts)
 		case "schema_version":
 			// ignore
 		default:
@@ -452,6 +654,7 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 	}
 
 	normalized.Messages = messages
+	normalized.Markers = markers
 	if sessionEndMsgCount != nil {
 		normalized.MessageCount = *sessionEndMsgCount
 	} else {
@@ -472,16 +675,194 @@ func normalizeUpload(req UploadRequest) (NormalizedSession, error) {
 		normalized.DurationSeconds = &dur
 	}
 
+	// The client's session totals win over what the events add up to: they
+	// survive transcript entries that were never written as events. Totals
+	// below the event sums are inconsistent and ignored, with their cost.
+	normalized.Usage = usage
+	var clientCost *float64
+	request := reportedUsage{Name: "session", Usage: req.Session.Usage, ByModel: req.Session.UsageByModel, CostUSD: req.Session.CostUSD}
+	for _, reported := range []reportedUsage{sessionEnd, request} {
+		if err := reported.validate(); err != nil {
+			return NormalizedSession{}, err
+		}
+		if reported.Usage != nil {
+			if !covers(*reported.Usage, usage) {
+				continue
+			}
+			normalized.Usage = *reported.Usage
+		}
+		// Per-model usage must add up to the totals sent with it.
+		if reported.ByModel != nil {
+			sum := sumUsage(reported.ByModel)
+			if covers(sum, usage) && (reported.Usage == nil || sum == *reported.Usage) {
+				usageByModel = reported.ByModel
+			}
+		}
+		if reported.CostUSD != nil {
+			clientCost = reported.CostUSD
+		}
+	}
+	// The cost is priced here from per-model usage. A client's cost is kept,
+	// labeled as client-reported, only when no model has a server price.
+	if cost, ok := priceUsage(usageByModel, prices); ok {
+		normalized.CostUSD = &cost
+		normalized.CostSource = CostSourceServer
+	} else if clientCost != nil {
+		normalized.CostUSD = clientCost
+		normalized.CostSource = CostSourceClient
+	}
+
 	for _, rec := range toolMap {
 		if rec.ToolName == "" {
 			return NormalizedSession{}, errors.New("tool_result without tool_name")
 		}
 		normalized.Tools = append(normalized.Tools, *rec)
 	}
+	normalized.Files = ledger.Entries()
+	normalized.HookTiming = hookTiming.Report()
 
 	return normalized, nil
 }
 
+// mergeSubagentLink adds a child link. A child is recorded again once its
+// spawning tool call is known, so a later link replaces an earlier one.
+func mergeSubagentLink(links []SubagentLink, link SubagentLink) []SubagentLink {
+	for i := range links {
+		if links[i].SessionID == link.SessionID {
+			links[i] = link
+			return links
+		}
+	}
+	return append(links, link)
+}
+
+// addEventUsage adds a message or tool_use event's token usage to the
+// session and per-model totals. Consecutive events from the same assistant
+// message repeat its usage, so a repeated message_id is counted once.
+func addEventUsage(total *events.TokenUsage, byModel map[string]events.TokenUsage, lastID *string, raw json.RawMessage) {
+	var data struct {
+		Usage     *events.TokenUsage `json:"usage"`
+		MessageID string             `json:"message_id"`
+		Model     string             `json:"model"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil || data.Usage == nil {
+		return
+	}
+	if data.MessageID != "" {
+		if data.MessageID == *lastID {
+			return
+		}
+		*lastID = data.MessageID
+	}
+	total.Add(*data.Usage)
+	model := byModel[data.Model]
+	model.Add(*data.Usage)
+	byModel[data.Model] = model
+}
+
+const (
+	CostSourceServer = "server" // priced by the server from per-model usage
+	CostSourceClient = "client" // reported by the client for unpriced models
+)
+
+// reportedUsage is what a client states about a session's usage, in the
+// request or in its session_end event.
+type reportedUsage struct {
+	Name    string
+	Usage   *events.TokenUsage
+	ByModel map[string]events.TokenUsage
+	CostUSD *float64
+}
+
+func (r reportedUsage) validate() error {
+	if r.Usage != nil && negativeUsage(*r.Usage) {
+		return fmt.Errorf("%s.usage must not be negative", r.Name)
+	}
+	for model, usage := range r.ByModel {
+		if negativeUsage(usage) {
+			return fmt.Errorf("%s.usage_by_model.%s must not be negative", r.Name, model)
+		}
+	}
+	if r.CostUSD != nil && *r.CostUSD < 0 {
+		return fmt.Errorf("%s.cost_usd must not be negative", r.Name)
+	}
+	return nil
+}
+
+func negativeUsage(u events.TokenUsage) bool {
+	return u.InputTokens < 0 || u.OutputTokens < 0 || u.CacheCreationInputTokens < 0 || u.CacheReadInputTokens < 0
+}
+
+// covers reports whether reported totals are at least what the events add
+// up to in every field.
+func covers(reported, counted events.TokenUsage) bool {
+	return reported.InputTokens >= counted.InputTokens &&
+		reported.OutputTokens >= counted.OutputTokens &&
+		reported.CacheCreationInputTokens >= counted.CacheCreationInputTokens &&
+		reported.CacheReadInputTokens >= counted.CacheReadInputTokens
+}
+
+func sumUsage(byModel map[string]events.TokenUsage) events.TokenUsage {
+	var total events.TokenUsage
+	for _, usage := range byModel {
+		total.Add(usage)
+	}
+	return total
+}
+
+// priceUsage prices per-model usage with the server's table. It reports
+// false when no model has a price, so the cost stays unknown rather than
+// zero.
+func priceUsage(byModel map[string]events.TokenUsage, prices map[string]config.ModelPrice) (float64, bool) {
+	for model := range byModel {
+		if _, ok := config.LookupPrice(prices, model); ok {
+			return events.SessionCost(byModel, prices), true
+		}
+	}
+	return 0, false
+}
+
+// mergeGitContext folds a git_context event into the session's git fields.
+// Later snapshots win, except StartSHA, which keeps the first session_start
+// HEAD. Remote URLs are stripped of credentials again in case an older
+// client sent them through.
+func mergeGitContext(git *GitContext, raw json.RawMessage) {
+	var data struct {
+		Phase      string   `json:"phase"`
+		RepoRoot   string   `json:"repo_root"`
+		RemoteURL  string   `json:"remote_url"`
+		Branch     string   `json:"branch"`
+		HeadSHA    string   `json:"head_sha"`
+		DirtyFiles []string `json:"dirty_files"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil || strings.TrimSpace(data.RepoRoot) == "" {
+		return
+	}
+	git.RepoRoot = strings.TrimSpace(data.RepoRoot)
+	if remote := events.StripURLCredentials(data.RemoteURL); remote != "" {
+		git.RemoteURL = remote
+	}
+	if branch := strings.TrimSpace(data.Branch); branch != "" {
+		git.Branch = branch
+	}
+	sha := strings.ToLower(strings.TrimSpace(data.HeadSHA))
+	if sha != "" {
+		if data.Phase == "session_end" || git.StartSHA != "" {
+			git.EndSHA = sha
+		} else {
+			git.StartSHA = sha
+		}
+	}
+	git.DirtyFiles = data.DirtyFiles
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
 func parseTime(value string) (time.Time, error) {
 	if value == "" {
 		return time.Time{}, errors.New("empty timestamp")
@@ -500,12 +881,7 @@ func parseOptionalTime(value string) (time.Time, error) {
 }
 
 func isValidTool(tool string) bool {
-	switch tool {
-	case "claude-code", "cursor":
-		return true
-	default:
-		return false
-	}
+	return events.IsTool(tool)
 }
 
 func normalizeToolOutput(content json.RawMessage) json.RawMessage {
@@ -528,6 +904,49 @@ func normalizeToolOutput(content json.RawMessage) json.RawMessage {
 	return payload
 }
 
+// orderEvents drops events whose event_id was already seen, so an event the
+// daemon wrote twice or a re-sent upload is stored once, and stable-sorts
+// the rest by seq. Events from daemons that predate seq have none and keep
+// their file order ahead of the stamped ones, which were written later.
+func orderEvents(events []Event) []Event {
+	seen := make(map[string]bool, len(events))
+	ordered := make([]Event, 0, len(events))
+	for _, event := range events {
+		if event.EventID != "" {
+			if seen[event.EventID] {
+				continue
+			}
+			seen[event.EventID] = true
+		}
+		ordered = append(ordered, event)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Seq < ordered[j].Seq
+	})
+	return ordered
+}
+
+// eventSeq is the position of an event among the session's events: the
+// seq the daemon stamped on it, or its index in the ordered upload for
+// events from clients that predate seq. Those sort first, so stamped seqs
+// are counted after them.
+func eventSeq(event Event, index, legacy int) int {
+	if event.Seq > 0 {
+		return legacy + int(event.Seq)
+	}
+	return index
+}
+
+// unstampedEvents counts the events without a seq at the head of events
+// ordered by orderEvents.
+func unstampedEvents(events []Event) int {
+	n := 0
+	for n < len(events) && events[n].Seq <= 0 {
+		n++
+	}
+	return n
+}
+
 func dedupeTags(tags []Tag) []Tag {
 	if len(tags) == 0 {
 		return nil
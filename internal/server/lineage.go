@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// maxLineageDepth bounds walks along resume chains, guarding against loops
+// in bad data.
+const maxLineageDepth = 50
+
+// continuedFrom walks continuation links back from parentID and returns the
+// chain oldest first. A parent that was never uploaded ends the chain.
+func (s *Server) continuedFrom(ctx context.Context, tool, parentID string) ([]LineageEntry, error) {
+	var chain []LineageEntry
+	seen := make(map[string]bool)
+	for parentID != "" && !seen[parentID] && len(chain) < maxLineageDepth {
+		seen[parentID] = true
+		entry := LineageEntry{SessionID: parentID}
+		var createdAt sql.NullTime
+		var next, relation string
+		err := s.db.QueryRowContext(ctx, `
+			SELECT id, created_at, ended_at, uploaded_by, message_count,
+				COALESCE(parent_session_id, ''), COALESCE(parent_relation, '')
+			FROM sessions
+			WHERE tool = $1 AND session_id = $2
+		`, tool, parentID).Scan(&entry.ID, &createdAt, &entry.EndedAt, &entry.UploadedBy, &entry.MessageCount, &next, &relation)
+		if errors.Is(err, sql.ErrNoRows) {
+			chain = append(chain, entry)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			entry.CreatedAt = &createdAt.Time
+		}
+		chain = append(chain, entry)
+		if relation != "continuation" {
+			break
+		}
+		parentID = next
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// continuedBy returns the uploaded sessions that resumed sessionID, each
+// with the sessions that resumed it in turn.
+func (s *Server) continuedBy(ctx context.Context, tool, sessionID string, seen map[string]bool, depth int) ([]LineageEntry, error) {
+	if depth >= maxLineageDepth {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, session_id, created_at, ended_at, uploaded_by, message_count
+		FROM sessions
+		WHERE tool = $1 AND parent_session_id = $2 AND parent_relation = 'continuation'
+		ORDER BY created_at ASC
+	`, tool, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var entries []LineageEntry
+	for rows.Next() {
+		var entry LineageEntry
+		var createdAt sql.NullTime
+		if err := rows.Scan(&entry.ID, &entry.SessionID, &createdAt, &entry.EndedAt, &entry.UploadedBy, &entry.MessageCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if createdAt.Valid {
+			entry.CreatedAt = &createdAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range entries {
+		entry := &entries[i]
+		if seen[entry.SessionID] {
+			continue
+		}
+		seen[entry.SessionID] = true
+		children, err := s.continuedBy(ctx, tool, entry.SessionID, seen, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entry.ContinuedBy = children
+	}
+	return entries, nil
+}
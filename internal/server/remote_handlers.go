@@ -27,6 +27,13 @@ func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
 		Tool:       strings.TrimSpace(r.URL.Query().Get("tool")),
 		UploadedBy: strings.TrimSpace(r.URL.Query().Get("uploaded_by")),
 		Query:      strings.TrimSpace(r.URL.Query().Get("q")),
+		Repo:       strings.TrimSpace(r.URL.Query().Get("repo")),
+		Branch:     strings.TrimSpace(r.URL.Query().Get("branch")),
+		SHA:        strings.TrimSpace(r.URL.Query().Get("sha")),
+	}
+	if filter.SHA != "" && !isHexPrefix(filter.SHA) {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "sha must be a hex commit prefix")
+		return
 	}
 	filter.Page = parsePositiveInt(r.URL.Query().Get("page"), 1)
 	filter.Limit = parsePositiveInt(r.URL.Query().Get("limit"), 20)
@@ -63,6 +70,18 @@ func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, resp)
 }
 
+func isHexPrefix(value string) bool {
+	if len(value) > 64 {
+		return false
+	}
+	for _, ch := range value {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
+			return false
+		}
+	}
+	return true
+}
+
 func parsePositiveInt(raw string, fallback int) int {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -99,7 +118,8 @@ func (s *Server) handleSessionDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rawID := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
-	if rawID == "" || rawID == "/" {
+	rawID, subresource, _ := strings.Cut(rawID, "/")
+	if rawID == "" {
 		s.writeError(w, http.StatusBadRequest, "invalid_request", "Missing session id")
 		return
 	}
@@ -108,6 +128,15 @@ func (s *Server) handleSessionDetail(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "invalid_request", "Invalid session id")
 		return
 	}
+	switch subresource {
+	case "":
+	case "files":
+		s.handleSessionFiles(w, r, rawID)
+		return
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
 
 	session, err := s.getSession(r.Context(), rawID)
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/victorarias/tabs/internal/config"
 	"github.com/victorarias/tabs/internal/logging"
 )
 
@@ -19,6 +20,7 @@ type Server struct {
 	baseURL string
 	logger  *slog.Logger
 	auth    Authenticator
+	pricing map[string]config.ModelPrice // prices uploaded usage
 }
 
 func NewServer(db *sql.DB, baseURL string, logger *slog.Logger, auth Authenticator) *Server {
@@ -33,6 +35,7 @@ func NewServer(db *sql.DB, baseURL string, logger *slog.Logger, auth Authenticat
 		baseURL: baseURL,
 		logger:  logger,
 		auth:    auth,
+		pricing: config.DefaultPricing(),
 	}
 }
 
@@ -68,6 +71,8 @@ func (s *Server) routes() http.Handler {
 	mux.HandleFunc("/api/sessions", s.handleSessions)
 	mux.HandleFunc("/api/sessions/", s.handleSessionDetail)
 	mux.HandleFunc("/api/tags", s.handleTags)
+	mux.HandleFunc("/api/usage", s.handleUsage)
+	mux.HandleFunc("/api/files", s.handleFiles)
 	mux.HandleFunc("/api/keys", s.handleKeys)
 	mux.HandleFunc("/api/keys/", s.handleKeyDetail)
 	mux.HandleFunc("/healthz", s.handleHealth)
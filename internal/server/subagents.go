@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// maxSubagentDepth bounds the tree; Claude Code sub-agents cannot spawn
+// their own today, so anything deeper is a loop in bad data.
+const maxSubagentDepth = 4
+
+// sessionParent resolves a sub-agent's parent. The spawning tool call comes
+// from the child's own row or, when it was only learned later, from the
+// links the parent recorded.
+func (s *Server) sessionParent(ctx context.Context, tool, sessionID, parentID, toolUseID string) (*SessionParent, error) {
+	parent := &SessionParent{SessionID: parentID, ToolUseID: toolUseID}
+	var linksRaw []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, subagents FROM sessions WHERE tool = $1 AND session_id = $2
+	`, tool, parentID).Scan(&parent.ID, &linksRaw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return parent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parent.ToolUseID == "" {
+		var links []SubagentLink
+		_ = json.Unmarshal(linksRaw, &links)
+		for _, link := range links {
+			if link.SessionID == sessionID {
+				parent.ToolUseID = link.ToolUseID
+			}
+		}
+	}
+	return parent, nil
+}
+
+// subagentTree merges the children a session recorded with the uploaded
+// sessions that name it as their parent.
+func (s *Server) subagentTree(ctx context.Context, tool, sessionID string, linksRaw []byte, seen map[string]bool, depth int) ([]SubagentNode, error) {
+	var links []SubagentLink
+	_ = json.Unmarshal(linksRaw, &links)
+
+	nodes := make([]SubagentNode, 0, len(links))
+	index := make(map[string]int, len(links))
+	for _, link := range links {
+		index[link.SessionID] = len(nodes)
+		nodes = append(nodes, SubagentNode{
+			SessionID:    link.SessionID,
+			ToolUseID:    link.ToolUseID,
+			AgentID:      link.AgentID,
+			SubagentType: link.SubagentType,
+			Description:  link.Description,
+		})
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, session_id, COALESCE(parent_tool_use_id, ''), COALESCE(agent_id, ''),
+			COALESCE(subagent_type, ''), COALESCE(subagent_description, ''),
+			created_at, ended_at, message_count, tool_use_count, subagents
+		FROM sessions
+		WHERE tool = $1 AND parent_session_id = $2 AND parent_relation = 'subagent'
+		ORDER BY created_at ASC
+	`, tool, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	childLinks := make(map[string][]byte)
+	for rows.Next() {
+		var row SubagentNode
+		var createdAt sql.NullTime
+		var grandchildren []byte
+		if err := rows.Scan(&row.ID, &row.SessionID, &row.ToolUseID, &row.AgentID, &row.SubagentType, &row.Description,
+			&createdAt, &row.EndedAt, &row.MessageCount, &row.ToolUseCount, &grandchildren); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if createdAt.Valid {
+			row.CreatedAt = &createdAt.Time
+		}
+		childLinks[row.SessionID] = grandchildren
+
+		i, ok := index[row.SessionID]
+		if !ok {
+			index[row.SessionID] = len(nodes)
+			nodes = append(nodes, row)
+			continue
+		}
+		node := &nodes[i]
+		node.ID = row.ID
+		node.CreatedAt = row.CreatedAt
+		node.EndedAt = row.EndedAt
+		node.MessageCount = row.MessageCount
+		node.ToolUseCount = row.ToolUseCount
+		if node.ToolUseID == "" {
+			node.ToolUseID = row.ToolUseID
+		}
+		if node.AgentID == "" {
+			node.AgentID = row.AgentID
+		}
+		if node.SubagentType == "" {
+			node.SubagentType = row.SubagentType
+		}
+		if node.Description == "" {
+			node.Description = row.Description
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	if depth+1 >= maxSubagentDepth {
+		return nodes, nil
+	}
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ID == "" || seen[node.SessionID] {
+			continue
+		}
+		seen[node.SessionID] = true
+		children, err := s.subagentTree(ctx, tool, node.SessionID, childLinks[node.SessionID], seen, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node.Subagents = children
+	}
+	return nodes, nil
+}
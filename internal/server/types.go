@@ -3,6 +3,8 @@ package server
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/victorarias/tabs/internal/events"
 )
 
 type UploadRequest struct {
@@ -11,12 +13,15 @@ type UploadRequest struct {
 }
 
 type UploadSession struct {
-	SessionID string  `json:"session_id"`
-	Tool      string  `json:"tool"`
-	CreatedAt string  `json:"created_at"`
-	EndedAt   string  `json:"ended_at"`
-	Cwd       string  `json:"cwd"`
-	Events    []Event `json:"events"`
+	SessionID    string                       `json:"session_id"`
+	Tool         string                       `json:"tool"`
+	CreatedAt    string                       `json:"created_at"`
+	EndedAt      string                       `json:"ended_at"`
+	Cwd          string                       `json:"cwd"`
+	Usage        *events.TokenUsage           `json:"usage"`
+	UsageByModel map[string]events.TokenUsage `json:"usage_by_model"`
+	CostUSD      *float64                     `json:"cost_usd"`
+	Events       []Event                      `json:"events"`
 }
 
 type Event struct {
@@ -25,6 +30,8 @@ type Event struct {
 	Tool      string          `json:"tool"`
 	SessionID string          `json:"session_id"`
 	Data      json.RawMessage `json:"data"`
+	Seq       int64           `json:"seq,omitempty"`
+	EventID   string          `json:"event_id,omitempty"`
 }
 
 type Tag struct {
@@ -41,21 +48,79 @@ type NormalizedSession struct {
 	DurationSeconds *int
 	MessageCount    int
 	ToolUseCount    int
+	Usage           events.TokenUsage
+	CostUSD         *float64
+	CostSource      string // CostSourceServer or CostSourceClient when CostUSD is set
+	Git             GitContext
+	Parent          SubagentLink
+	ParentRelation  string // subagent or continuation
+	Subagents       []SubagentLink
 	Messages        []MessageRecord
+	Markers         []MarkerRecord
+	HookTiming      *events.HookTiming
 	Tools           []ToolRecord
+	Files           []events.FileLedgerEntry
 	Tags            []Tag
+	// Mergeable is set when every event carries an event_id, so a
+	// re-upload of the session can be merged without duplicating rows.
+	Mergeable bool
+}
+
+// GitContext is the repository state a session ran against, merged from its
+// git_context events. StartSHA and EndSHA are HEAD at session start and end.
+type GitContext struct {
+	RepoRoot   string   `json:"repo_root,omitempty"`
+	RemoteURL  string   `json:"remote_url,omitempty"`
+	Branch     string   `json:"branch,omitempty"`
+	StartSHA   string   `json:"start_sha,omitempty"`
+	EndSHA     string   `json:"end_sha,omitempty"`
+	DirtyFiles []string `json:"dirty_files,omitempty"`
+}
+
+// SubagentLink ties a sub-agent session to the tool call that spawned it.
+// On a child session SessionID is the parent's; in a parent's Subagents it
+// is the child's.
+type SubagentLink struct {
+	SessionID    string `json:"session_id"`
+	ToolUseID    string `json:"tool_use_id,omitempty"`
+	AgentID      string `json:"agent_id,omitempty"`
+	SubagentType string `json:"subagent_type,omitempty"`
+	Description  string `json:"description,omitempty"`
 }
 
+func (g GitContext) IsZero() bool {
+	return g.RepoRoot == "" && g.RemoteURL == "" && g.Branch == "" && g.StartSHA == "" && g.EndSHA == ""
+}
+
+// MessageRecord is a user or assistant message. EventID is the event_id
+// of the event it came from, empty for events from older clients.
 type MessageRecord struct {
 	Timestamp time.Time
 	Seq       int
+	EventID   string
 	Role      string
 	Model     *string
 	Content   json.RawMessage
 }
 
+// MarkerRecord is a non-dialogue event shown as a timeline marker. Seq
+// counts the events before it, so markers keep their place among messages
+// with the same timestamp.
+type MarkerRecord struct {
+	Timestamp  time.Time
+	Seq        int
+	EventID    string
+	MarkerType string
+	Data       json.RawMessage
+}
+
+// ToolRecord is a tool call and its result. Seq is the position of the
+// call among the session's events, like MarkerRecord.Seq, and EventID is
+// the event_id of the call, or of the result when the call is missing.
 type ToolRecord struct {
 	Timestamp time.Time
+	Seq       int
+	EventID   string
 	ToolUseID string
 	ToolName  string
 	Input     json.RawMessage
@@ -12,6 +12,9 @@
   const toolIcons = {
     'claude-code': 'Claude',
     cursor: 'Cursor',
+    'codex-cli': 'Codex',
+    'gemini-cli': 'Gemini',
+    aider: 'Aider',
     default: 'Tabs',
   };
 
@@ -58,6 +61,18 @@
     return rem ? `${hours}h ${rem}m` : `${hours}h`;
   };
 
+  const formatUsage = (session) => {
+    const usage = session.usage || {};
+    const tokens = (usage.input_tokens || 0) + (usage.output_tokens || 0) +
+      (usage.cache_creation_input_tokens || 0) + (usage.cache_read_input_tokens || 0);
+    if (!tokens) return '';
+    const compact = tokens >= 1000000 ? `${(tokens / 1000000).toFixed(1)}M` :
+      tokens >= 1000 ? `${Math.round(tokens / 1000)}k` : `${tokens}`;
+    const reported = session.cost_source === 'client' ? ' (client-reported)' : '';
+    const cost = typeof session.cost_usd === 'number' ? ` - $${session.cost_usd.toFixed(2)}${reported}` : '';
+    return ` - ${compact} tokens${cost}`;
+  };
+
   const formatTime = (value) => {
     if (!value) return '';
     const date = new Date(value);
@@ -331,7 +346,7 @@
 
         const stats = document.createElement('div');
         stats.className = 'session-stats';
-        stats.textContent = `${session.message_count} messages - ${session.tool_use_count} tools`;
+        stats.textContent = `${session.message_count} messages - ${session.tool_use_count} tools${formatUsage(session)}`;
         card.appendChild(stats);
 
         card.addEventListener('click', () => navigate(`/sessions/${session.id}`));
@@ -353,6 +368,10 @@
     if (!detail) return;
     const messages = detail.messages || [];
     const tools = detail.tools || [];
+    // A title summary names the conversation; other markers go in the timeline.
+    const isTitle = (marker) => marker.type === 'summary' && marker.data && marker.data.kind === 'title';
+    const markers = (detail.markers || []).filter((marker) => !isTitle(marker));
+    const titles = (detail.markers || []).filter(isTitle).map((marker) => marker.data.summary);
 
     const header = document.createElement('section');
     header.className = 'session-header';
@@ -362,21 +381,103 @@
       tagsHtml = `<div class="session-tags">${detail.tags.map(t => `<span class="session-tag">${escapeHTML(t.key)}:${escapeHTML(t.value)}</span>`).join('')}</div>`;
     }
 
+    let gitHtml = '';
+    if (detail.git) {
+      const git = detail.git;
+      const shas = [git.start_sha, git.end_sha].filter(Boolean).map(sha => sha.slice(0, 12));
+      const parts = [git.remote_url || git.repo_root, git.branch, [...new Set(shas)].join(' → ')].filter(Boolean);
+      const dirty = git.dirty_files && git.dirty_files.length ? ` (${git.dirty_files.length} uncommitted)` : '';
+      gitHtml = `<div class="session-meta-line">${escapeHTML(parts.join(' - '))}${escapeHTML(dirty)}</div>`;
+    }
+
+    let parentHtml = '';
+    if (detail.parent) {
+      const label = `Sub-agent of ${detail.parent.session_id}`;
+      parentHtml = detail.parent.id
+        ? `<div class="session-meta-line"><a href="/sessions/${encodeURIComponent(detail.parent.id)}" data-nav>${escapeHTML(label)}</a></div>`
+        : `<div class="session-meta-line">${escapeHTML(label)}</div>`;
+    }
+
+    // Hook timings: averages over the calls and turns the hooks observed.
+    let timingHtml = '';
+    const timing = detail.hook_timing;
+    if (timing) {
+      const avg = (stats) => stats && stats.count ? `${(stats.total_ms / stats.count / 1000).toFixed(1)}s` : '';
+      const span = (ms) => ms < 60000 ? `${Math.round(ms / 1000)}s` : formatDuration(ms / 1000);
+      const parts = [];
+      if (avg(timing.tool_latency)) parts.push(`tool calls avg ${avg(timing.tool_latency)}`);
+      if (avg(timing.response_time)) parts.push(`responses avg ${avg(timing.response_time)}`);
+      if (timing.input_wait && timing.input_wait.count) {
+        parts.push(`waited on user ${span(timing.input_wait.total_ms)} (${timing.input_wait.count}x)`);
+      }
+      if (timing.permission_prompts) {
+        parts.push(`${timing.permission_prompts} permission prompts (${timing.permissions_granted} granted, ${timing.permissions_denied} denied)`);
+      }
+      if (parts.length) timingHtml = `<div class="session-meta-line">${escapeHTML(parts.join(' - '))}</div>`;
+    }
+
+    // Resumed conversations only hold their own messages; link the sessions
+    // before and after so the whole conversation can be followed.
+    const renderLineage = (prefix, entry) => {
+      const when = entry.created_at ? ` ${formatDate(entry.created_at)} ${formatTime(entry.created_at)}` : '';
+      const text = escapeHTML(`${prefix} ${entry.session_id}${when}`) +
+        escapeHTML(entry.id ? ` - ${entry.message_count} messages` : ' - not uploaded');
+      return entry.id
+        ? `<div class="session-meta-line"><a href="/sessions/${encodeURIComponent(entry.id)}" data-nav>${text}</a></div>`
+        : `<div class="session-meta-line">${text}</div>`;
+    };
+    const flattenContinuations = (entries) => (entries || []).flatMap((entry) => [entry, ...flattenContinuations(entry.continued_by)]);
+    const lineageHtml = [
+      ...(detail.continued_from || []).map((entry) => renderLineage('Continues', entry)),
+      ...flattenContinuations(detail.continued_by).map((entry) => renderLineage('Continued in', entry)),
+    ].join('');
+
+    // Sub-agents hang off the tool call that spawned them; unlinked ones are
+    // listed under the header.
+    const subagentsByToolUse = {};
+    const unlinkedSubagents = [];
+    (detail.subagents || []).forEach((node) => {
+      if (node.tool_use_id) {
+        subagentsByToolUse[node.tool_use_id] = node;
+      } else {
+        unlinkedSubagents.push(node);
+      }
+    });
+    const renderSubagent = (node) => {
+      const label = `Sub-agent${node.subagent_type ? ` (${node.subagent_type})` : ''}: ${node.description || node.session_id}`;
+      const counts = node.id ? ` - ${node.message_count} messages - ${node.tool_use_count} tools` : ' - not uploaded';
+      const text = escapeHTML(label) + escapeHTML(counts);
+      return node.id
+        ? `<div class="session-meta-line"><a href="/sessions/${encodeURIComponent(node.id)}" data-nav>${text}</a></div>`
+        : `<div class="session-meta-line">${text}</div>`;
+    };
+
     header.innerHTML = `
       <a class="back-link" href="/" data-nav>&larr; Back</a>
       <div class="session-id">Session: ${escapeHTML(detail.session_id)}</div>
+      ${titles.length ? `<div class="session-meta-line">${escapeHTML(titles[titles.length - 1])}</div>` : ''}
+      ${parentHtml}
+      ${lineageHtml}
       <div class="session-meta-line">${escapeHTML(detail.tool || 'unknown')} - ${escapeHTML(formatDate(detail.created_at))} ${escapeHTML(formatTime(detail.created_at))} - ${escapeHTML(formatDuration(detail.duration_seconds))}</div>
       <div class="session-meta-line">${escapeHTML(detail.cwd || '')}</div>
+      ${gitHtml}
       <div class="session-uploader"><span class="icon">&#9650;</span> Shared by ${escapeHTML(detail.uploaded_by || 'unknown')} on ${escapeHTML(formatDate(detail.uploaded_at))}</div>
       ${tagsHtml}
-      <div class="session-meta-line">${detail.message_count} messages - ${detail.tool_use_count} tools</div>
+      <div class="session-meta-line">${detail.message_count} messages - ${detail.tool_use_count} tools${escapeHTML(formatUsage(detail))}</div>
+      ${timingHtml}
+      ${unlinkedSubagents.map(renderSubagent).join('')}
     `;
 
     const list = document.createElement('div');
     list.className = 'detail-list';
 
-    const items = mergeMessagesAndTools(messages, tools);
+    const items = mergeMessagesAndTools(messages, tools, markers);
     items.forEach((item) => {
+      if (item.type === 'marker') {
+        list.appendChild(renderMarker(item));
+        return;
+      }
+
       if (item.type === 'message') {
         const content = extractText(item.content);
         const card = document.createElement('div');
@@ -403,6 +504,7 @@
           </div>
           ${inputText ? `<details ${inputOpen}><summary>Input</summary><pre>${escapeHTML(inputText)}</pre></details>` : ''}
           ${outputText ? `<details ${outputOpen}><summary>Output</summary><pre>${escapeHTML(outputText)}</pre></details>` : ''}
+          ${subagentsByToolUse[item.tool_use_id] ? renderSubagent(subagentsByToolUse[item.tool_use_id]) : ''}
         `;
         list.appendChild(card);
       }
@@ -413,12 +515,42 @@
     app.appendChild(list);
   };
 
-  const mergeMessagesAndTools = (messages, tools) => {
+  // Markers show where the model's context changed: a compaction drops
+  // earlier turns in favour of a summary, and notices are injected text.
+  const renderMarker = (item) => {
+    const data = item.data || {};
+    let label = 'System notice';
+    let body = data.content || '';
+    if (item.marker_type === 'compaction') {
+      const details = [data.trigger, data.pre_tokens ? `${Number(data.pre_tokens).toLocaleString()} tokens before` : '']
+        .filter(Boolean).join(', ');
+      label = `Context compacted${details ? ` (${details})` : ''} - earlier messages were replaced by a summary`;
+      body = '';
+    } else if (item.marker_type === 'summary') {
+      label = data.kind === 'compaction' ? 'Compaction summary' : 'Summary';
+      body = data.summary || '';
+    } else if (data.subtype) {
+      label = `System notice (${data.subtype}${data.hook_name ? `: ${data.hook_name}` : ''})`;
+    }
+    const marker = document.createElement('div');
+    marker.className = `timeline-marker ${item.marker_type}`;
+    marker.innerHTML = `
+      <div class="marker-title">
+        <span>${escapeHTML(label)}</span>
+        <span>${escapeHTML(formatTime(item.timestamp))}</span>
+      </div>
+      ${body ? `<details><summary>Show text</summary><div class="message-content">${escapeHTML(body)}</div></details>` : ''}
+    `;
+    return marker;
+  };
+
+  const mergeMessagesAndTools = (messages, tools, markers = []) => {
     const items = [];
     messages.forEach((msg) => {
       items.push({
         type: 'message',
         timestamp: msg.timestamp,
+        seq: msg.seq,
         role: msg.role,
         content: msg.content,
       });
@@ -427,13 +559,25 @@
       items.push({
         type: 'tool',
         timestamp: tool.timestamp,
+        seq: tool.seq,
+        tool_use_id: tool.tool_use_id,
         tool_name: tool.tool_name,
         input: tool.input,
         output: tool.output,
         is_error: tool.is_error,
       });
     });
-    items.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
+    markers.forEach((marker) => {
+      items.push({
+        type: 'marker',
+        timestamp: marker.timestamp,
+        seq: marker.seq,
+        marker_type: marker.type,
+        data: marker.data,
+      });
+    });
+    // seq is the session's event order; timestamps only break ties.
+    items.sort((a, b) => (a.seq || 0) - (b.seq || 0) || new Date(a.timestamp) - new Date(b.timestamp));
     return items;
   };
 
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UsageFilter scopes a usage rollup. GroupBy holds "user", "day" or both.
+type UsageFilter struct {
+	GroupBy []string
+	Tool    string
+	Since   time.Time
+	Until   time.Time
+}
+
+type UsageResponse struct {
+	GroupBy []string   `json:"group_by"`
+	Rows    []UsageRow `json:"rows"`
+	Totals  UsageRow   `json:"totals"`
+}
+
+// UsageRow is one rollup bucket. Cost only sums sessions that reported one.
+type UsageRow struct {
+	User                     string  `json:"user,omitempty"`
+	Day                      string  `json:"day,omitempty"`
+	Sessions                 int     `json:"sessions"`
+	InputTokens              int64   `json:"input_tokens"`
+	OutputTokens             int64   `json:"output_tokens"`
+	CacheCreationInputTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64   `json:"cache_read_input_tokens"`
+	CostUSD                  float64 `json:"cost_usd"`
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := s.requireJSONAuth(w, r); !ok {
+		return
+	}
+
+	filter, err := parseUsageFilter(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	rows, err := s.usageRollup(r.Context(), filter)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "server_error", "Failed to load usage")
+		return
+	}
+	resp := UsageResponse{GroupBy: filter.GroupBy, Rows: rows}
+	for _, row := range rows {
+		resp.Totals.Sessions += row.Sessions
+		resp.Totals.InputTokens += row.InputTokens
+		resp.Totals.OutputTokens += row.OutputTokens
+		resp.Totals.CacheCreationInputTokens += row.CacheCreationInputTokens
+		resp.Totals.CacheReadInputTokens += row.CacheReadInputTokens
+		resp.Totals.CostUSD += row.CostUSD
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func parseUsageFilter(r *http.Request) (UsageFilter, error) {
+	query := r.URL.Query()
+	filter := UsageFilter{Tool: strings.TrimSpace(query.Get("tool"))}
+
+	groupBy := strings.TrimSpace(query.Get("group_by"))
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(groupBy, ",") {
+		part = strings.TrimSpace(part)
+		if part != "user" && part != "day" {
+			return UsageFilter{}, errors.New("group_by must be user, day or user,day")
+		}
+		if !seen[part] {
+			seen[part] = true
+			filter.GroupBy = append(filter.GroupBy, part)
+		}
+	}
+
+	var err error
+	if filter.Since, err = parseUsageTime(query.Get("since")); err != nil {
+		return UsageFilter{}, errors.New("since must be YYYY-MM-DD or RFC3339")
+	}
+	if filter.Until, err = parseUsageTime(query.Get("until")); err != nil {
+		return UsageFilter{}, errors.New("until must be YYYY-MM-DD or RFC3339")
+	}
+	return filter, nil
+}
+
+func parseUsageTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := time.Parse("2006-01-02", raw); err == nil {
+		return ts, nil
+	}
+	return parseTime(raw)
+}
+
+func (s *Server) usageRollup(ctx context.Context, filter UsageFilter) ([]UsageRow, error) {
+	var keys []string
+	for _, group := range filter.GroupBy {
+		switch group {
+		case "user":
+			keys = append(keys, "s.uploaded_by")
+		case "day":
+			keys = append(keys, "to_char(s.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')")
+		}
+	}
+
+	var clauses []string
+	var args []interface{}
+	if filter.Tool != "" {
+		args = append(args, filter.Tool)
+		clauses = append(clauses, fmt.Sprintf("s.tool = $%d", len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		clauses = append(clauses, fmt.Sprintf("s.created_at >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		clauses = append(clauses, fmt.Sprintf("s.created_at < $%d", len(args)))
+	}
+	where := ""
+	if len(clauses) > 0 {
+		where = "WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	// Ordinal references keep GROUP BY / ORDER BY in step with the select list.
+	ordinals := make([]string, len(keys))
+	for i := range keys {
+		ordinals[i] = fmt.Sprintf("%d", i+1)
+	}
+	query := `
+		SELECT ` + strings.Join(keys, ", ") + `,
+			COUNT(*),
+			COALESCE(SUM(s.input_tokens), 0),
+			COALESCE(SUM(s.output_tokens), 0),
+			COALESCE(SUM(s.cache_creation_input_tokens), 0),
+			COALESCE(SUM(s.cache_read_input_tokens), 0),
+			COALESCE(SUM(s.cost_usd), 0)::float8
+		FROM sessions s
+		` + where + `
+		GROUP BY ` + strings.Join(ordinals, ", ") + `
+		ORDER BY ` + strings.Join(ordinals, ", ")
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []UsageRow{}
+	for rows.Next() {
+		var row UsageRow
+		dest := make([]interface{}, 0, len(keys)+6)
+		for _, group := range filter.GroupBy {
+			switch group {
+			case "user":
+				dest = append(dest, &row.User)
+			case "day":
+				dest = append(dest, &row.Day)
+			}
+		}
+		dest = append(dest, &row.Sessions, &row.InputTokens, &row.OutputTokens,
+			&row.CacheCreationInputTokens, &row.CacheReadInputTokens, &row.CostUSD)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
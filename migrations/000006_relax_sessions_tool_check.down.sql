@@ -0,0 +1,2 @@
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_tool_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_tool_check CHECK (tool IN ('claude-code', 'cursor'));
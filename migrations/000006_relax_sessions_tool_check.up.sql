@@ -0,0 +1,4 @@
+-- Tools are validated against the capturer registry in the application, so the
+-- database only enforces the name format.
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_tool_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_tool_check CHECK (tool ~ '^[a-z0-9][a-z0-9-]*$');
@@ -0,0 +1,5 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS cost_usd;
+ALTER TABLE sessions DROP COLUMN IF EXISTS cache_read_input_tokens;
+ALTER TABLE sessions DROP COLUMN IF EXISTS cache_creation_input_tokens;
+ALTER TABLE sessions DROP COLUMN IF EXISTS output_tokens;
+ALTER TABLE sessions DROP COLUMN IF EXISTS input_tokens;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_sessions_git_end_sha;
+DROP INDEX IF EXISTS idx_sessions_git_start_sha;
+DROP INDEX IF EXISTS idx_sessions_git_branch;
+DROP INDEX IF EXISTS idx_sessions_git_remote_url;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_dirty_files;
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_end_sha;
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_start_sha;
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_branch;
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_remote_url;
+ALTER TABLE sessions DROP COLUMN IF EXISTS git_repo_root;
@@ -0,0 +1,13 @@
+-- Repository state recorded by git_context events. start/end sha are HEAD at
+-- session start and end; remote URLs arrive with credentials stripped.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_repo_root TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_remote_url TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_branch TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_start_sha VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_end_sha VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS git_dirty_files JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_git_remote_url ON sessions(git_remote_url);
+CREATE INDEX IF NOT EXISTS idx_sessions_git_branch ON sessions(git_branch);
+CREATE INDEX IF NOT EXISTS idx_sessions_git_start_sha ON sessions(git_start_sha varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_sessions_git_end_sha ON sessions(git_end_sha varchar_pattern_ops);
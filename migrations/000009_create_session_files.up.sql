@@ -0,0 +1,18 @@
+-- Per-session ledger of files changed by Edit, MultiEdit and Write calls,
+-- built when a session is uploaded. changes holds each call's unified diff.
+CREATE TABLE IF NOT EXISTS session_files (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+  file_path TEXT NOT NULL,
+  edit_count INTEGER NOT NULL DEFAULT 0,
+  multi_edit_count INTEGER NOT NULL DEFAULT 0,
+  write_count INTEGER NOT NULL DEFAULT 0,
+  lines_added INTEGER NOT NULL DEFAULT 0,
+  lines_removed INTEGER NOT NULL DEFAULT 0,
+  first_touched_at TIMESTAMPTZ NOT NULL,
+  last_touched_at TIMESTAMPTZ NOT NULL,
+  changes JSONB NOT NULL DEFAULT '[]'::jsonb,
+  UNIQUE(session_id, file_path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_files_path ON session_files(file_path);
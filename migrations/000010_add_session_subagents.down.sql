@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_sessions_parent_session_id;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS subagents;
+ALTER TABLE sessions DROP COLUMN IF EXISTS subagent_description;
+ALTER TABLE sessions DROP COLUMN IF EXISTS subagent_type;
+ALTER TABLE sessions DROP COLUMN IF EXISTS agent_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS parent_tool_use_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS parent_session_id;
@@ -0,0 +1,11 @@
+-- Sub-agent lineage. A child session names its parent session and the tool
+-- call (Task) that spawned it; a parent keeps the links from its subagent
+-- events, so children that were never uploaded still show in its tree.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS parent_session_id VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS parent_tool_use_id VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS agent_id VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS subagent_type VARCHAR(100);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS subagent_description TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS subagents JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_parent_session_id ON sessions(parent_session_id);
@@ -0,0 +1,3 @@
+UPDATE sessions SET parent_session_id = NULL WHERE parent_relation = 'continuation';
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS parent_relation;
@@ -0,0 +1,6 @@
+-- Resume lineage. parent_session_id now also names the session a resumed
+-- conversation continues; parent_relation tells the two links apart.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS parent_relation VARCHAR(20);
+
+UPDATE sessions SET parent_relation = 'subagent'
+WHERE parent_session_id IS NOT NULL AND parent_relation IS NULL;
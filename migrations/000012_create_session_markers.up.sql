@@ -0,0 +1,12 @@
+-- Timeline markers: transcript records that are not dialogue, such as
+-- compaction boundaries and summaries, system notices and hook context.
+CREATE TABLE IF NOT EXISTS session_markers (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+  timestamp TIMESTAMPTZ NOT NULL,
+  seq INTEGER NOT NULL,
+  marker_type VARCHAR(50) NOT NULL,
+  data JSONB NOT NULL DEFAULT '{}'::jsonb
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_markers_session ON session_markers(session_id, seq);
@@ -0,0 +1,3 @@
+-- Durations measured between Claude Code hooks: tool latency, response time
+-- and time spent waiting on the user, with permission prompt counts.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS hook_timing JSONB;
@@ -0,0 +1 @@
+ALTER TABLE tools DROP COLUMN IF EXISTS seq;
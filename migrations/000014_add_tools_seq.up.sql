@@ -0,0 +1,3 @@
+-- Position of the tool call among the session's events. Sessions uploaded
+-- before it was recorded have NULL and sort by timestamp.
+ALTER TABLE tools ADD COLUMN IF NOT EXISTS seq INTEGER;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_tools_event_id;
+DROP INDEX IF EXISTS idx_session_markers_event_id;
+DROP INDEX IF EXISTS idx_messages_event_id;
+ALTER TABLE tools DROP COLUMN IF EXISTS event_id;
+ALTER TABLE session_markers DROP COLUMN IF EXISTS event_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS event_id;
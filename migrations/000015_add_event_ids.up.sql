@@ -0,0 +1,10 @@
+-- event_id of the event each row came from. Rows uploaded before it was
+-- recorded have NULL, which never conflicts, so only stamped events are
+-- deduplicated.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS event_id VARCHAR(64);
+ALTER TABLE session_markers ADD COLUMN IF NOT EXISTS event_id VARCHAR(64);
+ALTER TABLE tools ADD COLUMN IF NOT EXISTS event_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_event_id ON messages(session_id, event_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_markers_event_id ON session_markers(session_id, event_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tools_event_id ON tools(session_id, event_id);
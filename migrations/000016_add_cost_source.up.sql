@@ -0,0 +1,6 @@
+-- Who priced cost_usd: 'server' from per-model usage with the server's price
+-- table, 'client' when the server had no price for any of the session's
+-- models and kept the uploader's figure. NULL while cost_usd is NULL and for
+-- sessions uploaded before the server priced them.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS cost_source VARCHAR(16)
+    CHECK (cost_source IN ('server', 'client'));